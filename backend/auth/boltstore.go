@@ -0,0 +1,77 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* boltRecords keeps the stored sessions in the embedded database */
+type boltRecords struct {
+  DB *bbolt.DB
+}
+
+func NewBoltStore(db *bbolt.DB, max_age int, key_pairs ...[]byte) *RecordStore {
+  return newRecordStore(&boltRecords{DB: db}, max_age, key_pairs...)
+}
+
+func (records *boltRecords) load(ctx context.Context, id primitive.ObjectID) (storedSession, error) {
+  var stored storedSession
+
+  err := database.BoltView(ctx, records.DB, func(tx *bbolt.Tx) error {
+    return database.BoltGet(tx, SESSION_COLLECTION, id, &stored)
+  })
+  return stored, err
+}
+
+func (records *boltRecords) save(ctx context.Context, id primitive.ObjectID, stored *storedSession) (error) {
+  return database.BoltUpdate(ctx, records.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, SESSION_COLLECTION, id, stored)
+  })
+}
+
+func (records *boltRecords) delete(ctx context.Context, id primitive.ObjectID) (error) {
+  return database.BoltUpdate(ctx, records.DB, func(tx *bbolt.Tx) error {
+    return database.BoltDelete(tx, SESSION_COLLECTION, id)
+  })
+}
+
+func (records *boltRecords) purge(ctx context.Context, before time.Time) (int, error) {
+  var expired []primitive.ObjectID
+
+  err := database.BoltUpdate(ctx, records.DB, func(tx *bbolt.Tx) error {
+    b := tx.Bucket([]byte(SESSION_COLLECTION))
+    if b == nil {
+      return nil
+    }
+
+    err := b.ForEach(func(k, _ []byte) error {
+      var stored storedSession
+      var id primitive.ObjectID
+
+      copy(id[:], k)
+      if err := database.BoltGet(tx, SESSION_COLLECTION, id, &stored); err != nil {
+        return err
+      }
+      if stored.Modified.Before(before) {
+        expired = append(expired, id)
+      }
+      return nil
+    })
+    if err != nil {
+      return err
+    }
+
+    for _, id := range expired {
+      if err := database.BoltDelete(tx, SESSION_COLLECTION, id); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+  return len(expired), err
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+  "context"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/mongo"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/*
+ * The util tests are the conformance suite of the storage backends.  They run
+ * against the embedded database, and against MongoDB and PostgreSQL as well
+ * if MONGODB_TEST_URI and POSTGRES_TEST_URI are given.  The PostgreSQL auth
+ * tables are emptied at first.
+ */
+var bolt_db *bbolt.DB
+var mongo_client *mongo.Client
+var pg_db *pgxpool.Pool
+
+func openMongo() *mongo.Client {
+  uri := os.Getenv("MONGODB_TEST_URI")
+  if uri == "" {
+    return nil
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+  defer cancel()
+
+  client, err := database.Connect(ctx, uri, database.DEFAULT_BACKOFF)
+  if err != nil {
+    panic(err)
+  }
+  return client
+}
+
+func skipMongo(t *testing.T) {
+  if mongo_client == nil {
+    t.Skip("MONGODB_TEST_URI is not given")
+  }
+}
+
+func openPostgres() *pgxpool.Pool {
+  uri := os.Getenv("POSTGRES_TEST_URI")
+  if uri == "" {
+    return nil
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+  defer cancel()
+
+  pool, err := database.ConnectPostgres(ctx, uri, database.DEFAULT_BACKOFF)
+  if err != nil {
+    panic(err)
+  }
+  if _, err := database.MigratePostgres(ctx, pool); err != nil {
+    panic(err)
+  }
+  _, err = pool.Exec(ctx, "TRUNCATE users, user_scopes, sessions, session_infos")
+  if err != nil {
+    panic(err)
+  }
+  return pool
+}
+
+func skipPostgres(t *testing.T) {
+  if pg_db == nil {
+    t.Skip("POSTGRES_TEST_URI is not given")
+  }
+}
+
+func TestMain(m *testing.M) {
+  dir, err := os.MkdirTemp("", "auth")
+  if err != nil {
+    panic(err)
+  }
+
+  bolt_db, err = database.OpenBolt(filepath.Join(dir, "test.db"))
+  if err != nil {
+    panic(err)
+  }
+  mongo_client = openMongo()
+  pg_db = openPostgres()
+
+  code := m.Run()
+  bolt_db.Close()
+  if mongo_client != nil {
+    mongo_client.Disconnect(context.Background())
+  }
+  if pg_db != nil {
+    pg_db.Close()
+  }
+  os.RemoveAll(dir)
+  os.Exit(code)
+}
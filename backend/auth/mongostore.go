@@ -0,0 +1,73 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/*
+ * mongoRecords keeps the stored sessions in MongoDB, with the same documents
+ * as the former mongodriver store, so the logged in sessions stay.  The TTL
+ * index of EnsureStoreTTL removes the expired ones, too.
+ */
+type mongoRecords struct {
+  DB_Client *mongo.Client
+}
+
+func NewMongoStore(client *mongo.Client, max_age int, key_pairs ...[]byte) *RecordStore {
+  return newRecordStore(&mongoRecords{DB_Client: client}, max_age, key_pairs...)
+}
+
+func (records *mongoRecords) collection() *mongo.Collection {
+  return records.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_COLLECTION)
+}
+
+func (records *mongoRecords) load(ctx context.Context, id primitive.ObjectID) (storedSession, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var stored storedSession
+
+  err := records.collection().FindOne(ctx, bson.M{"_id": id}).Decode(&stored)
+  if err == mongo.ErrNoDocuments {
+    err = database.ErrNotFound
+  }
+  return stored, err
+}
+
+func (records *mongoRecords) save(ctx context.Context, id primitive.ObjectID, stored *storedSession) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  filter := bson.M{"_id": id}
+  opts := options.Replace().SetUpsert(true)
+  _, err := records.collection().ReplaceOne(ctx, filter, stored, opts)
+  return err
+}
+
+func (records *mongoRecords) delete(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := records.collection().DeleteOne(ctx, bson.M{"_id": id})
+  return err
+}
+
+func (records *mongoRecords) purge(ctx context.Context, before time.Time) (int, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  filter := bson.M{"modified": bson.M{"$lt": before.UTC()}}
+  res, err := records.collection().DeleteMany(ctx, filter)
+  if err != nil {
+    return 0, err
+  }
+  return int(res.DeletedCount), nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* pgRecords keeps the stored sessions in PostgreSQL */
+type pgRecords struct {
+  DB *pgxpool.Pool
+}
+
+func NewPGStore(db *pgxpool.Pool, max_age int, key_pairs ...[]byte) *RecordStore {
+  return newRecordStore(&pgRecords{DB: db}, max_age, key_pairs...)
+}
+
+func (records *pgRecords) load(ctx context.Context, id primitive.ObjectID) (storedSession, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var stored storedSession
+
+  row := records.DB.QueryRow(ctx, "SELECT data, modified FROM " + SESSION_COLLECTION + " WHERE id = $1", id.Hex())
+  err := row.Scan(&stored.Data, database.PGTime(&stored.Modified))
+  return stored, database.PGError(err)
+}
+
+func (records *pgRecords) save(ctx context.Context, id primitive.ObjectID, stored *storedSession) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := records.DB.Exec(ctx, "INSERT INTO " + SESSION_COLLECTION + " (id, data, modified) VALUES ($1, $2, $3) " +
+                            "ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, modified = EXCLUDED.modified",
+                            id.Hex(), stored.Data, stored.Modified)
+  return err
+}
+
+func (records *pgRecords) delete(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := records.DB.Exec(ctx, "DELETE FROM " + SESSION_COLLECTION + " WHERE id = $1", id.Hex())
+  return err
+}
+
+func (records *pgRecords) purge(ctx context.Context, before time.Time) (int, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  tag, err := records.DB.Exec(ctx, "DELETE FROM " + SESSION_COLLECTION + " WHERE modified < $1", before)
+  return int(tag.RowsAffected()), err
+}
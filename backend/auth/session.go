@@ -0,0 +1,247 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/*
+ * SessionInfo is the metadata of a logged in session.  The session itself
+ * keeps the hex string of the ID with the key "sid", and StoreID is the ID
+ * given by the session store, if the store has one.
+ */
+type SessionInfo struct {
+  ID primitive.ObjectID `bson:"_id"`
+  StoreID string
+  User primitive.ObjectID
+  IP string
+  UserAgent string
+  CreateTime time.Time
+  LastActivity time.Time
+}
+
+type ISessionUtils interface {
+  AddSession(ctx context.Context, info *SessionInfo) (primitive.ObjectID, error)
+  GetSessionByID(ctx context.Context, id primitive.ObjectID) (SessionInfo, error)
+  GetSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) ([]SessionInfo, error)
+  CountSessions(ctx context.Context, since time.Time) (int64, error)
+  TouchSession(ctx context.Context, id primitive.ObjectID, t time.Time) (error)
+  SetStoreID(ctx context.Context, id primitive.ObjectID, store_id string) (error)
+  /* Drop the stored session data of a renewed session ID */
+  DeleteStoreID(ctx context.Context, store_id string) (error)
+  DeleteSession(ctx context.Context, id primitive.ObjectID) (error)
+  DeleteSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) (int64, error)
+}
+
+type SessionUtils struct {
+  DB_Client *mongo.Client
+}
+
+/* The collection used by the session store, and the one for the metadata */
+const SESSION_COLLECTION = "sessions"
+const SESSION_INFO_COLLECTION = "session_infos"
+
+/*
+ * The session store removes the stored sessions with a TTL index on the
+ * "modified" field.  (Re)create the index, if it expires after another time.
+ */
+func (utils *SessionUtils) EnsureStoreTTL(ctx context.Context, max_age time.Duration) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  expire := int32(max_age.Seconds())
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_COLLECTION)
+  index := mongo.IndexModel{
+    Keys: bson.M{"modified": 1},
+    Options: options.Index().SetSparse(true).SetExpireAfterSeconds(expire),
+  }
+
+  _, err := coll.Indexes().CreateOne(ctx, index)
+  if err == nil {
+    return nil
+  }
+
+  _, err = coll.Indexes().DropOne(ctx, "modified_1")
+  if err != nil {
+    return err
+  }
+
+  _, err = coll.Indexes().CreateOne(ctx, index)
+  return err
+}
+
+/* The session store works, if its collection can be read */
+func (utils *SessionUtils) CheckStore(ctx context.Context) (error) {
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_COLLECTION)
+  opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+  err := coll.FindOne(ctx, bson.M{}, opts).Err()
+  if err == mongo.ErrNoDocuments {
+    return nil
+  }
+  return err
+}
+
+func (utils *SessionUtils) AddSession(ctx context.Context, info *SessionInfo) (primitive.ObjectID, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if info.ID.IsZero() {
+    info.ID = primitive.NewObjectID()
+  }
+  info.CreateTime = time.Now().UTC()
+  info.LastActivity = info.CreateTime
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  _, err := coll.InsertOne(ctx, info)
+  return info.ID, err
+}
+
+func (utils *SessionUtils) GetSessionByID(ctx context.Context, id primitive.ObjectID) (SessionInfo, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var info SessionInfo
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  filter := bson.M{"_id": id}
+  err := coll.FindOne(ctx, filter).Decode(&info)
+  return info, err
+}
+
+func (utils *SessionUtils) GetSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) ([]SessionInfo, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  infos := []SessionInfo{}
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  filter := bson.M{"user": u_id}
+  cur, err := coll.Find(ctx, filter)
+  if err != nil {
+    return infos, err
+  }
+
+  err = cur.All(ctx, &infos)
+  return infos, err
+}
+
+/* Count the sessions which are active since the time, or all with zero time */
+func (utils *SessionUtils) CountSessions(ctx context.Context, since time.Time) (int64, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  filter := bson.M{}
+  if !since.IsZero() {
+    filter = bson.M{"lastactivity": bson.M{"$gte": since.UTC()}}
+  }
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  return coll.CountDocuments(ctx, filter)
+}
+
+func (utils *SessionUtils) TouchSession(ctx context.Context, id primitive.ObjectID, t time.Time) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  filter := bson.M{"_id": id}
+  update := bson.M{"$set": bson.M{"lastactivity": t.UTC()}}
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  _, err := coll.UpdateOne(ctx, filter, update)
+  return err
+}
+
+/* The session got a new ID from the store, drop the data of the old one */
+func (utils *SessionUtils) SetStoreID(ctx context.Context, id primitive.ObjectID, store_id string) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  info, err := utils.GetSessionByID(ctx, id)
+  if err != nil {
+    return err
+  }
+
+  filter := bson.M{"_id": id}
+  update := bson.M{"$set": bson.M{"storeid": store_id}}
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  _, err = coll.UpdateOne(ctx, filter, update)
+  if err != nil || info.StoreID == store_id {
+    return err
+  }
+
+  return utils.deleteStoreSessions(ctx, []SessionInfo{info})
+}
+
+func (utils *SessionUtils) DeleteStoreID(ctx context.Context, store_id string) (error) {
+  return utils.deleteStoreSessions(ctx, []SessionInfo{{StoreID: store_id}})
+}
+
+/* Drop the stored session data as well, so a revoked session is really gone */
+func (utils *SessionUtils) deleteStoreSessions(ctx context.Context, infos []SessionInfo) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var ids []primitive.ObjectID
+
+  for _, info := range infos {
+    id, err := primitive.ObjectIDFromHex(info.StoreID)
+    if err == nil {
+      ids = append(ids, id)
+    }
+  }
+
+  if len(ids) == 0 {
+    return nil
+  }
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_COLLECTION)
+  filter := bson.M{"_id": bson.M{"$in": ids}}
+  _, err := coll.DeleteMany(ctx, filter)
+  return err
+}
+
+func (utils *SessionUtils) DeleteSession(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  info, err := utils.GetSessionByID(ctx, id)
+  if err != nil {
+    return err
+  }
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  filter := bson.M{"_id": id}
+  _, err = coll.DeleteOne(ctx, filter)
+  if err != nil {
+    return err
+  }
+
+  return utils.deleteStoreSessions(ctx, []SessionInfo{info})
+}
+
+func (utils *SessionUtils) DeleteSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) (int64, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  infos, err := utils.GetSessionsByUserID(ctx, u_id)
+  if err != nil {
+    return 0, err
+  }
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(SESSION_INFO_COLLECTION)
+  filter := bson.M{"user": u_id}
+  res, err := coll.DeleteMany(ctx, filter)
+  if err != nil {
+    return 0, err
+  }
+
+  return res.DeletedCount, utils.deleteStoreSessions(ctx, infos)
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* BoltSessionUtils keeps the session metadata in the embedded database */
+type BoltSessionUtils struct {
+  DB *bbolt.DB
+}
+
+/* The session store works, if its bucket can be read */
+func (utils *BoltSessionUtils) CheckStore(ctx context.Context) (error) {
+  return database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    _, err := database.BoltFindOne[storedSession](tx, SESSION_COLLECTION, nil)
+    if err == database.ErrNotFound {
+      return nil
+    }
+    return err
+  })
+}
+
+func (utils *BoltSessionUtils) AddSession(ctx context.Context, info *SessionInfo) (primitive.ObjectID, error) {
+  if info.ID.IsZero() {
+    info.ID = primitive.NewObjectID()
+  }
+  info.CreateTime = time.Now().UTC()
+  info.LastActivity = info.CreateTime
+
+  err := database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, SESSION_INFO_COLLECTION, info.ID, info)
+  })
+  return info.ID, err
+}
+
+func (utils *BoltSessionUtils) GetSessionByID(ctx context.Context, id primitive.ObjectID) (SessionInfo, error) {
+  var info SessionInfo
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltGet(tx, SESSION_INFO_COLLECTION, id, &info)
+  })
+  return info, err
+}
+
+func (utils *BoltSessionUtils) findSessions(tx *bbolt.Tx, u_id primitive.ObjectID) ([]SessionInfo, error) {
+  infos, err := database.BoltFind(tx, SESSION_INFO_COLLECTION, func(info *SessionInfo) bool {
+    return info.User == u_id
+  })
+  if infos == nil {
+    infos = []SessionInfo{}
+  }
+  return infos, err
+}
+
+func (utils *BoltSessionUtils) GetSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) ([]SessionInfo, error) {
+  infos := []SessionInfo{}
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var err error
+    infos, err = utils.findSessions(tx, u_id)
+    return err
+  })
+  return infos, err
+}
+
+/* Count the sessions which are active since the time, or all with zero time */
+func (utils *BoltSessionUtils) CountSessions(ctx context.Context, since time.Time) (int64, error) {
+  var count int64
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    infos, err := database.BoltFind(tx, SESSION_INFO_COLLECTION, func(info *SessionInfo) bool {
+      return since.IsZero() || !info.LastActivity.Before(since)
+    })
+    count = int64(len(infos))
+    return err
+  })
+  return count, err
+}
+
+/* Change the stored session metadata */
+func (utils *BoltSessionUtils) updateSession(ctx context.Context, id primitive.ObjectID, fn func(tx *bbolt.Tx, info *SessionInfo) error) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var info SessionInfo
+
+    if err := database.BoltGet(tx, SESSION_INFO_COLLECTION, id, &info); err != nil {
+      return err
+    }
+    if err := fn(tx, &info); err != nil {
+      return err
+    }
+    return database.BoltPut(tx, SESSION_INFO_COLLECTION, id, &info)
+  })
+}
+
+/* Touching a revoked session is not an error, just like MongoDB */
+func (utils *BoltSessionUtils) TouchSession(ctx context.Context, id primitive.ObjectID, t time.Time) (error) {
+  err := utils.updateSession(ctx, id, func(tx *bbolt.Tx, info *SessionInfo) error {
+    info.LastActivity = t.UTC()
+    return nil
+  })
+  if err == database.ErrNotFound {
+    return nil
+  }
+  return err
+}
+
+/* The session got a new ID from the store, drop the data of the old one */
+func (utils *BoltSessionUtils) SetStoreID(ctx context.Context, id primitive.ObjectID, store_id string) (error) {
+  return utils.updateSession(ctx, id, func(tx *bbolt.Tx, info *SessionInfo) error {
+    if info.StoreID != store_id {
+      if err := deleteBoltStoreSessions(tx, []SessionInfo{*info}); err != nil {
+        return err
+      }
+    }
+    info.StoreID = store_id
+    return nil
+  })
+}
+
+func (utils *BoltSessionUtils) DeleteStoreID(ctx context.Context, store_id string) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return deleteBoltStoreSessions(tx, []SessionInfo{{StoreID: store_id}})
+  })
+}
+
+/* Drop the stored session data as well, so a revoked session is really gone */
+func deleteBoltStoreSessions(tx *bbolt.Tx, infos []SessionInfo) (error) {
+  for _, info := range infos {
+    id, err := primitive.ObjectIDFromHex(info.StoreID)
+    if err != nil {
+      continue
+    }
+    if err := database.BoltDelete(tx, SESSION_COLLECTION, id); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (utils *BoltSessionUtils) DeleteSession(ctx context.Context, id primitive.ObjectID) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var info SessionInfo
+
+    if err := database.BoltGet(tx, SESSION_INFO_COLLECTION, id, &info); err != nil {
+      return err
+    }
+    if err := database.BoltDelete(tx, SESSION_INFO_COLLECTION, id); err != nil {
+      return err
+    }
+    return deleteBoltStoreSessions(tx, []SessionInfo{info})
+  })
+}
+
+func (utils *BoltSessionUtils) DeleteSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) (int64, error) {
+  var count int64
+
+  err := database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    infos, err := utils.findSessions(tx, u_id)
+    if err != nil {
+      return err
+    }
+
+    for _, info := range infos {
+      if err := database.BoltDelete(tx, SESSION_INFO_COLLECTION, info.ID); err != nil {
+        return err
+      }
+    }
+    count = int64(len(infos))
+    return deleteBoltStoreSessions(tx, infos)
+  })
+  return count, err
+}
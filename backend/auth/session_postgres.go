@@ -0,0 +1,189 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* PGSessionUtils keeps the session metadata in PostgreSQL */
+type PGSessionUtils struct {
+  DB *pgxpool.Pool
+}
+
+const pg_session_columns = "id, store_id, user_id, ip, user_agent, create_time, last_activity"
+
+/* The session store works, if its table can be read */
+func (utils *PGSessionUtils) CheckStore(ctx context.Context) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var id string
+
+  err := utils.DB.QueryRow(ctx, "SELECT id FROM " + SESSION_COLLECTION + " LIMIT 1").Scan(&id)
+  if database.PGError(err) == database.ErrNotFound {
+    return nil
+  }
+  return err
+}
+
+func (utils *PGSessionUtils) AddSession(ctx context.Context, info *SessionInfo) (primitive.ObjectID, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if info.ID.IsZero() {
+    info.ID = primitive.NewObjectID()
+  }
+  info.CreateTime = time.Now().UTC()
+  info.LastActivity = info.CreateTime
+
+  _, err := utils.DB.Exec(ctx, "INSERT INTO session_infos (" + pg_session_columns + ") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+                          info.ID.Hex(), info.StoreID, info.User.Hex(), info.IP, info.UserAgent,
+                          info.CreateTime, info.LastActivity)
+  return info.ID, err
+}
+
+func scanSession(row pgx.CollectableRow) (SessionInfo, error) {
+  var info SessionInfo
+
+  err := row.Scan(database.PGID(&info.ID), &info.StoreID, database.PGID(&info.User), &info.IP,
+                  &info.UserAgent, database.PGTime(&info.CreateTime), database.PGTime(&info.LastActivity))
+  return info, err
+}
+
+func (utils *PGSessionUtils) GetSessionByID(ctx context.Context, id primitive.ObjectID) (SessionInfo, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_session_columns + " FROM session_infos WHERE id = $1", id.Hex())
+  info, err := pgx.CollectOneRow(rows, scanSession)
+  return info, database.PGError(err)
+}
+
+func (utils *PGSessionUtils) GetSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) ([]SessionInfo, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_session_columns + " FROM session_infos WHERE user_id = $1 ORDER BY id", u_id.Hex())
+  infos, err := pgx.CollectRows(rows, scanSession)
+  if infos == nil {
+    infos = []SessionInfo{}
+  }
+  return infos, err
+}
+
+/* Count the sessions which are active since the time, or all with zero time */
+func (utils *PGSessionUtils) CountSessions(ctx context.Context, since time.Time) (int64, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var count int64
+
+  row := utils.DB.QueryRow(ctx, "SELECT COUNT(*) FROM session_infos WHERE $1::timestamptz IS NULL OR last_activity >= $1",
+                           pgSince(since))
+  err := row.Scan(&count)
+  return count, err
+}
+
+func pgSince(since time.Time) (any) {
+  if since.IsZero() {
+    return nil
+  }
+  return since.UTC()
+}
+
+/* Touching a revoked session is not an error, just like MongoDB */
+func (utils *PGSessionUtils) TouchSession(ctx context.Context, id primitive.ObjectID, t time.Time) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "UPDATE session_infos SET last_activity = $2 WHERE id = $1", id.Hex(), t.UTC())
+  return err
+}
+
+/* Drop the stored session data as well, so a revoked session is really gone */
+func deletePGStoreSessions(ctx context.Context, tx pgx.Tx, store_ids []string) (error) {
+  var ids []string
+
+  for _, store_id := range store_ids {
+    if id, err := primitive.ObjectIDFromHex(store_id); err == nil {
+      ids = append(ids, id.Hex())
+    }
+  }
+
+  if len(ids) == 0 {
+    return nil
+  }
+
+  _, err := tx.Exec(ctx, "DELETE FROM " + SESSION_COLLECTION + " WHERE id = ANY($1)", ids)
+  return err
+}
+
+/* The session got a new ID from the store, drop the data of the old one */
+func (utils *PGSessionUtils) SetStoreID(ctx context.Context, id primitive.ObjectID, store_id string) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    var orig string
+
+    err := tx.QueryRow(ctx, "SELECT store_id FROM session_infos WHERE id = $1 FOR UPDATE", id.Hex()).Scan(&orig)
+    if err != nil {
+      return database.PGError(err)
+    }
+
+    _, err = tx.Exec(ctx, "UPDATE session_infos SET store_id = $2 WHERE id = $1", id.Hex(), store_id)
+    if err != nil || orig == store_id {
+      return err
+    }
+    return deletePGStoreSessions(ctx, tx, []string{orig})
+  })
+}
+
+func (utils *PGSessionUtils) DeleteStoreID(ctx context.Context, store_id string) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    return deletePGStoreSessions(ctx, tx, []string{store_id})
+  })
+}
+
+func (utils *PGSessionUtils) DeleteSession(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    var store_id string
+
+    err := tx.QueryRow(ctx, "DELETE FROM session_infos WHERE id = $1 RETURNING store_id", id.Hex()).Scan(&store_id)
+    if err != nil {
+      return database.PGError(err)
+    }
+    return deletePGStoreSessions(ctx, tx, []string{store_id})
+  })
+}
+
+func (utils *PGSessionUtils) DeleteSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) (int64, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var count int64
+
+  err := pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    rows, _ := tx.Query(ctx, "DELETE FROM session_infos WHERE user_id = $1 RETURNING store_id", u_id.Hex())
+    store_ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+    if err != nil {
+      return err
+    }
+
+    count = int64(len(store_ids))
+    return deletePGStoreSessions(ctx, tx, store_ids)
+  })
+  return count, err
+}
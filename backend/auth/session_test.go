@@ -0,0 +1,95 @@
+package auth
+
+import (
+  "context"
+  "testing"
+  "time"
+  "github.com/stretchr/testify/assert"
+
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/* Both backends check their session store */
+type sessionUtils interface {
+  ISessionUtils
+  CheckStore(ctx context.Context) (error)
+}
+
+func runSessionUtils(t *testing.T, test func(t *testing.T, session_utils sessionUtils)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, &SessionUtils{DB_Client: mongo_client})
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, &BoltSessionUtils{DB: bolt_db}) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, &PGSessionUtils{DB: pg_db})
+  })
+}
+
+func TestAddSession(t *testing.T) {
+  runSessionUtils(t, testAddSession)
+}
+
+func testAddSession(t *testing.T, session_utils sessionUtils) {
+  u_id := primitive.NewObjectID()
+  infos := []SessionInfo {
+    { User: u_id, IP: "10.0.0.1", UserAgent: "foo" },
+    { User: u_id, IP: "10.0.0.2", UserAgent: "bar" },
+  }
+
+  /* Add Sessions */
+  id1, err1 := session_utils.AddSession(context.TODO(), &infos[0])
+  assert.Nil(t, err1)
+  assert.False(t, id1.IsZero())
+
+  id2, err2 := session_utils.AddSession(context.TODO(), &infos[1])
+  assert.Nil(t, err2)
+  assert.False(t, id2.IsZero())
+
+  /* Get the Session by ID */
+  info, err3 := session_utils.GetSessionByID(context.TODO(), id1)
+  assert.Nil(t, err3)
+  assert.Equal(t, u_id, info.User)
+  assert.Equal(t, "10.0.0.1", info.IP)
+
+  /* Get Sessions by the User */
+  user_infos, err4 := session_utils.GetSessionsByUserID(context.TODO(), u_id)
+  assert.Nil(t, err4)
+  assert.Equal(t, 2, len(user_infos))
+
+  /* Count the active Sessions */
+  count, err := session_utils.CountSessions(context.TODO(), time.Time{})
+  assert.Nil(t, err)
+  assert.True(t, count >= 2)
+
+  /* Touch the Session */
+  now := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+  err5 := session_utils.TouchSession(context.TODO(), id1, now)
+  assert.Nil(t, err5)
+  info, _ = session_utils.GetSessionByID(context.TODO(), id1)
+  assert.Equal(t, now, info.LastActivity)
+  active, _ := session_utils.CountSessions(context.TODO(), now)
+  assert.True(t, active >= 1)
+
+  /* Revoke one Session */
+  err6 := session_utils.DeleteSession(context.TODO(), id1)
+  assert.Nil(t, err6)
+  _, err7 := session_utils.GetSessionByID(context.TODO(), id1)
+  assert.NotNil(t, err7)
+
+  /* Revoke all the User's Sessions */
+  count, err8 := session_utils.DeleteSessionsByUserID(context.TODO(), u_id)
+  assert.Nil(t, err8)
+  assert.Equal(t, int64(1), count)
+  user_infos, _ = session_utils.GetSessionsByUserID(context.TODO(), u_id)
+  assert.Equal(t, 0, len(user_infos))
+}
+
+func TestCheckStore(t *testing.T) {
+  runSessionUtils(t, testCheckStore)
+}
+
+func testCheckStore(t *testing.T, session_utils sessionUtils) {
+  assert.Nil(t, session_utils.CheckStore(context.TODO()))
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+  "context"
+  "net/http"
+  "time"
+
+  "github.com/gin-contrib/sessions"
+  "github.com/gorilla/securecookie"
+  gsessions "github.com/gorilla/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* The stored session, the same as the one of the former mongodriver store */
+type storedSession struct {
+  Data string
+  Modified time.Time
+}
+
+/* sessionRecords keeps the stored sessions of a RecordStore by their IDs */
+type sessionRecords interface {
+  load(ctx context.Context, id primitive.ObjectID) (storedSession, error)
+  save(ctx context.Context, id primitive.ObjectID, stored *storedSession) (error)
+  delete(ctx context.Context, id primitive.ObjectID) (error)
+  /* Remove the sessions modified before the time */
+  purge(ctx context.Context, before time.Time) (int, error)
+}
+
+/*
+ * RecordStore is the session store of the storage backends.  The cookie only
+ * keeps the signed session ID, which is an ObjectID.  The sessions expire
+ * MaxAge after they were saved.  Unlike the mongodriver store, every session
+ * gets all the options of the store, SameSite as well.
+ */
+type RecordStore struct {
+  Codecs []securecookie.Codec
+  records sessionRecords
+  options *gsessions.Options
+}
+
+var _ sessions.Store = (*RecordStore)(nil)
+
+func newRecordStore(records sessionRecords, max_age int, key_pairs ...[]byte) *RecordStore {
+  store := &RecordStore{
+    Codecs: securecookie.CodecsFromPairs(key_pairs...),
+    records: records,
+    options: &gsessions.Options{Path: "/"},
+  }
+  store.MaxAge(max_age)
+  return store
+}
+
+func (store *RecordStore) Options(options sessions.Options) {
+  store.options = options.ToGorillaOptions()
+}
+
+func (store *RecordStore) MaxAge(age int) {
+  store.options.MaxAge = age
+  for _, codec := range store.Codecs {
+    if sc, ok := codec.(*securecookie.SecureCookie); ok {
+      sc.MaxAge(age)
+    }
+  }
+}
+
+func (store *RecordStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+  return gsessions.GetRegistry(r).Get(store, name)
+}
+
+/* A missing, expired or forged session is a new one */
+func (store *RecordStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+  session := gsessions.NewSession(store, name)
+  opts := *store.options
+  session.Options = &opts
+  session.IsNew = true
+
+  cookie, err := r.Cookie(name)
+  if err != nil {
+    return session, nil
+  }
+  if securecookie.DecodeMulti(name, cookie.Value, &session.ID, store.Codecs...) != nil {
+    session.ID = ""
+    return session, nil
+  }
+  if store.load(r.Context(), session) == nil {
+    session.IsNew = false
+  }
+  return session, nil
+}
+
+func (store *RecordStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+  if session.Options.MaxAge < 0 {
+    if id, err := primitive.ObjectIDFromHex(session.ID); err == nil {
+      if err := store.records.delete(r.Context(), id); err != nil {
+        return err
+      }
+    }
+    http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+    return nil
+  }
+
+  if session.ID == "" {
+    session.ID = primitive.NewObjectID().Hex()
+  }
+
+  data, err := securecookie.EncodeMulti(session.Name(), session.Values, store.Codecs...)
+  if err != nil {
+    return err
+  }
+
+  id, err := primitive.ObjectIDFromHex(session.ID)
+  if err != nil {
+    return err
+  }
+
+  stored := storedSession{Data: data, Modified: time.Now().UTC()}
+  if err := store.records.save(r.Context(), id, &stored); err != nil {
+    return err
+  }
+
+  encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, store.Codecs...)
+  if err != nil {
+    return err
+  }
+  http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+  return nil
+}
+
+func (store *RecordStore) maxAge() time.Duration {
+  return time.Duration(store.options.MaxAge) * time.Second
+}
+
+func (store *RecordStore) load(ctx context.Context, session *gsessions.Session) error {
+  id, err := primitive.ObjectIDFromHex(session.ID)
+  if err != nil {
+    return err
+  }
+
+  stored, err := store.records.load(ctx, id)
+  if err != nil {
+    return err
+  }
+  if store.maxAge() > 0 && time.Since(stored.Modified) > store.maxAge() {
+    return database.ErrNotFound
+  }
+
+  return securecookie.DecodeMulti(session.Name(), stored.Data, &session.Values, store.Codecs...)
+}
+
+/* Remove the expired sessions, like the TTL index of the MongoDB store */
+func (store *RecordStore) PurgeExpired(ctx context.Context) (int, error) {
+  if store.maxAge() <= 0 {
+    return 0, nil
+  }
+  return store.records.purge(ctx, time.Now().Add(-store.maxAge()))
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+
+  "github.com/gin-contrib/sessions"
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func requestWithCookies(w *httptest.ResponseRecorder) *http.Request {
+  req := httptest.NewRequest("GET", "/", nil)
+  for _, cookie := range w.Result().Cookies() {
+    req.AddCookie(cookie)
+  }
+  return req
+}
+
+func runRecordStore(t *testing.T, max_age int, test func(t *testing.T, store *RecordStore)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, NewMongoStore(mongo_client, max_age, []byte("secret")))
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, NewBoltStore(bolt_db, max_age, []byte("secret"))) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, NewPGStore(pg_db, max_age, []byte("secret")))
+  })
+}
+
+func TestRecordStore(t *testing.T) {
+  runRecordStore(t, 3600, testRecordStore)
+}
+
+func testRecordStore(t *testing.T, store *RecordStore) {
+  /* Save a new Session */
+  req := httptest.NewRequest("GET", "/", nil)
+  session, err := store.Get(req, "sessionid")
+  assert.Nil(t, err)
+  assert.True(t, session.IsNew)
+  session.Values["id"] = "foo"
+  w := httptest.NewRecorder()
+  assert.Nil(t, store.Save(req, w, session))
+  _, err = primitive.ObjectIDFromHex(session.ID)
+  assert.Nil(t, err)
+
+  /* Load it with the cookie */
+  loaded, err := store.New(requestWithCookies(w), "sessionid")
+  assert.Nil(t, err)
+  assert.False(t, loaded.IsNew)
+  assert.Equal(t, session.ID, loaded.ID)
+  assert.Equal(t, "foo", loaded.Values["id"])
+
+  /* A forged cookie is a new Session */
+  req = httptest.NewRequest("GET", "/", nil)
+  req.AddCookie(&http.Cookie{Name: "sessionid", Value: session.ID})
+  forged, _ := store.New(req, "sessionid")
+  assert.True(t, forged.IsNew)
+  assert.Empty(t, forged.Values)
+
+  /* Delete the Session */
+  loaded.Options.MaxAge = -1
+  w2 := httptest.NewRecorder()
+  assert.Nil(t, store.Save(requestWithCookies(w), w2, loaded))
+  deleted, _ := store.New(requestWithCookies(w), "sessionid")
+  assert.True(t, deleted.IsNew)
+}
+
+func TestRecordStoreExpired(t *testing.T) {
+  runRecordStore(t, 60, testRecordStoreExpired)
+}
+
+func testRecordStoreExpired(t *testing.T, store *RecordStore) {
+  req := httptest.NewRequest("GET", "/", nil)
+  session, _ := store.Get(req, "sessionid")
+  session.Values["id"] = "foo"
+  w := httptest.NewRecorder()
+  assert.Nil(t, store.Save(req, w, session))
+
+  /* Saved long ago */
+  id, _ := primitive.ObjectIDFromHex(session.ID)
+  stored, err := store.records.load(context.TODO(), id)
+  assert.Nil(t, err)
+  stored.Modified = time.Now().Add(-time.Hour)
+  assert.Nil(t, store.records.save(context.TODO(), id, &stored))
+
+  loaded, _ := store.New(requestWithCookies(w), "sessionid")
+  assert.True(t, loaded.IsNew)
+
+  count, err := store.PurgeExpired(context.TODO())
+  assert.Nil(t, err)
+  assert.True(t, count >= 1)
+  _, err = store.records.load(context.TODO(), id)
+  assert.NotNil(t, err)
+}
+
+func TestRecordStoreOptions(t *testing.T) {
+  runRecordStore(t, 3600, testRecordStoreOptions)
+}
+
+/* Every session gets the cookie options of the store */
+func testRecordStoreOptions(t *testing.T, store *RecordStore) {
+  store.Options(sessions.Options{
+    Path: "/",
+    MaxAge: 3600,
+    HttpOnly: true,
+    SameSite: http.SameSiteLaxMode,
+  })
+
+  req := httptest.NewRequest("GET", "/", nil)
+  session, _ := store.Get(req, "sessionid")
+  session.Values["id"] = "foo"
+  w := httptest.NewRecorder()
+  assert.Nil(t, store.Save(req, w, session))
+
+  cookie := w.Header().Get("Set-Cookie")
+  assert.Contains(t, cookie, "SameSite=Lax")
+  assert.Contains(t, cookie, "HttpOnly")
+
+  /* The loaded session keeps them, too */
+  loaded, _ := store.New(requestWithCookies(w), "sessionid")
+  assert.False(t, loaded.IsNew)
+  w2 := httptest.NewRecorder()
+  assert.Nil(t, store.Save(requestWithCookies(w), w2, loaded))
+  assert.Contains(t, w2.Header().Get("Set-Cookie"), "SameSite=Lax")
+}
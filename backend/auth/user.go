@@ -2,13 +2,19 @@ package auth
 
 import (
   "context"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "fmt"
   "time"
 
   "go.mongodb.org/mongo-driver/bson"
   "go.mongodb.org/mongo-driver/bson/primitive"
   "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
 
   "github.com/starnight/riskassessment/backend/config"
+  "github.com/starnight/riskassessment/backend/database"
 )
 
 const (
@@ -16,6 +22,15 @@ const (
   Administrator = 1
 )
 
+/* The accounts are unique, which is enforced by the storage */
+var ErrAccountExists = errors.New("account exists")
+
+/* The stored password is the hex string of the password's SHA-256 */
+func HashPassword(passwd string) string {
+  pwd := sha256.Sum256([]byte(passwd))
+  return hex.EncodeToString(pwd[:])
+}
+
 type UserInfo struct {
   Role uint
 }
@@ -26,17 +41,20 @@ type User struct {
   Account string `binding:"required"`
   Password string `binding:"required"`
   Role uint
+  Disabled bool
   Scopes []primitive.ObjectID
 }
 
 type IUserUtils interface {
-  AddUser(user *User) (primitive.ObjectID, error)
-  GetUserByID(id primitive.ObjectID) (User, error)
-  GetUserByAccount(account string) (User, error)
-  GetUserByAccountPwd(account string, password string) (User, error)
-  HasUser() (bool, error)
-  UserHasScopeID(u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error)
-  UpdateUser (user *User) (error)
+  AddUser(ctx context.Context, user *User) (primitive.ObjectID, error)
+  GetUserByID(ctx context.Context, id primitive.ObjectID) (User, error)
+  GetUserByAccount(ctx context.Context, account string) (User, error)
+  GetUserByAccountPwd(ctx context.Context, account string, password string) (User, error)
+  GetUsers(ctx context.Context) ([]User, error)
+  HasUser(ctx context.Context) (bool, error)
+  UserHasScopeID(ctx context.Context, u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error)
+  UpdateUser(ctx context.Context, user *User) (error)
+  PutUser(ctx context.Context, user *User) (error)
 }
 
 type UserUtils struct {
@@ -46,7 +64,10 @@ type UserUtils struct {
 var USER_MONGO_DB string = config.DB_NAME
 var USER_COLLECTION string = "users"
 
-func (utils *UserUtils) AddUser(user *User) (primitive.ObjectID, error) {
+func (utils *UserUtils) AddUser(ctx context.Context, user *User) (primitive.ObjectID, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var id primitive.ObjectID
 
   user.ID = primitive.NewObjectID()
@@ -57,56 +78,148 @@ func (utils *UserUtils) AddUser(user *User) (primitive.ObjectID, error) {
   }
 
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
-  res, err := coll.InsertOne(context.TODO(), user)
+  res, err := coll.InsertOne(ctx, user)
+  if mongo.IsDuplicateKeyError(err) {
+    return id, ErrAccountExists
+  } else if err != nil {
+    return id, err
+  }
   id = res.InsertedID.(primitive.ObjectID)
-  return id, err
+  return id, nil
 }
 
-func (utils *UserUtils) GetUserByID(id primitive.ObjectID) (User, error) {
+func (utils *UserUtils) GetUserByID(ctx context.Context, id primitive.ObjectID) (User, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var user User
 
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
   filter := bson.D{{ "_id", id }}
-  err := coll.FindOne(context.TODO(), filter).Decode(&user)
+  err := coll.FindOne(ctx, filter).Decode(&user)
   return user, err
 }
 
-func (utils *UserUtils) GetUserByAccount(account string) (User, error) {
+func (utils *UserUtils) GetUserByAccount(ctx context.Context, account string) (User, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var user User
 
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
   filter := bson.D{{"account", account}}
-  err := coll.FindOne(context.TODO(), filter).Decode(&user)
+  err := coll.FindOne(ctx, filter).Decode(&user)
   return user, err
 }
 
-func (utils *UserUtils) GetUserByAccountPwd(account string, password string) (User, error) {
+func (utils *UserUtils) GetUserByAccountPwd(ctx context.Context, account string, password string) (User, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var user User
 
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
   filter := bson.D{{"account", account}, {"password", password}}
-  err := coll.FindOne(context.TODO(), filter).Decode(&user)
+  err := coll.FindOne(ctx, filter).Decode(&user)
   return user, err
 }
 
-func (utils *UserUtils) HasUser() (bool, error) {
+func (utils *UserUtils) GetUsers(ctx context.Context) ([]User, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  users := []User{}
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
+  cur, err := coll.Find(ctx, bson.D{})
+  if err != nil {
+    return users, err
+  }
+
+  err = cur.All(ctx, &users)
+  return users, err
+}
+
+func (utils *UserUtils) HasUser(ctx context.Context) (bool, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
   filter := bson.D{{}}
-  count, err := coll.CountDocuments(context.TODO(), filter)
+  count, err := coll.CountDocuments(ctx, filter)
   return count > 0, err
 }
 
-func (utils *UserUtils) UserHasScopeID(u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error) {
+func (utils *UserUtils) UserHasScopeID(ctx context.Context, u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
   filter := bson.M{ "_id": u_id, "scopes": bson.M{ "$elemMatch": bson.M{ "$eq": s_id }}}
-  count, err := coll.CountDocuments(context.TODO(), filter)
+  count, err := coll.CountDocuments(ctx, filter)
   return count > 0, err
 }
 
-func (utils *UserUtils) UpdateUser(user *User) (error) {
+func (utils *UserUtils) UpdateUser(ctx context.Context, user *User) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   filter := bson.D{{ "_id", user.ID }}
 
   coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
-  _, err := coll.ReplaceOne(context.TODO(), filter, user)
+  _, err := coll.ReplaceOne(ctx, filter, user)
+  return err
+}
+
+/* Insert or replace the user with its own ID, like restoring a backup */
+func (utils *UserUtils) PutUser(ctx context.Context, user *User) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if user.Scopes == nil {
+    user.Scopes = []primitive.ObjectID{}
+  }
+
+  coll := utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
+  _, err := coll.ReplaceOne(ctx, bson.M{"_id": user.ID}, user, options.Replace().SetUpsert(true))
+  if mongo.IsDuplicateKeyError(err) {
+    return ErrAccountExists
+  }
+  return err
+}
+
+/*
+ * Make the accounts unique with an index.  The duplicate accounts must be
+ * resolved by hand at first.
+ */
+func EnsureAccountIndex(ctx context.Context, coll *mongo.Collection) (error) {
+  pipeline := mongo.Pipeline{
+    {{Key: "$group", Value: bson.M{"_id": "$account", "count": bson.M{"$sum": 1}}}},
+    {{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+  }
+  cur, err := coll.Aggregate(ctx, pipeline)
+  if err != nil {
+    return err
+  }
+
+  var dups []struct {
+    Account string `bson:"_id"`
+  }
+  if err := cur.All(ctx, &dups); err != nil {
+    return err
+  }
+  if len(dups) > 0 {
+    accounts := make([]string, len(dups))
+    for i, dup := range dups {
+      accounts[i] = dup.Account
+    }
+    return fmt.Errorf("duplicate accounts %q", accounts)
+  }
+
+  index := mongo.IndexModel{
+    Keys: bson.M{"account": 1},
+    Options: options.Index().SetUnique(true),
+  }
+  _, err = coll.Indexes().CreateOne(ctx, index)
   return err
 }
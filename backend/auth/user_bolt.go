@@ -0,0 +1,136 @@
+package auth
+
+import (
+  "context"
+  "time"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* BoltUserUtils keeps the users in the embedded database */
+type BoltUserUtils struct {
+  DB *bbolt.DB
+}
+
+func (utils *BoltUserUtils) AddUser(ctx context.Context, user *User) (primitive.ObjectID, error) {
+  user.ID = primitive.NewObjectID()
+  user.CreateTime = time.Now().UTC()
+
+  if user.Scopes == nil {
+    user.Scopes = []primitive.ObjectID{}
+  }
+
+  err := database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    _, err := database.BoltFindOne(tx, USER_COLLECTION, func(u *User) bool {
+      return u.Account == user.Account
+    })
+    if err == nil {
+      return ErrAccountExists
+    } else if err != database.ErrNotFound {
+      return err
+    }
+    return database.BoltPut(tx, USER_COLLECTION, user.ID, user)
+  })
+  return user.ID, err
+}
+
+func (utils *BoltUserUtils) GetUserByID(ctx context.Context, id primitive.ObjectID) (User, error) {
+  var user User
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltGet(tx, USER_COLLECTION, id, &user)
+  })
+  return user, err
+}
+
+func (utils *BoltUserUtils) findUser(ctx context.Context, match func(user *User) bool) (User, error) {
+  var user User
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var err error
+    user, err = database.BoltFindOne(tx, USER_COLLECTION, match)
+    return err
+  })
+  return user, err
+}
+
+func (utils *BoltUserUtils) GetUserByAccount(ctx context.Context, account string) (User, error) {
+  return utils.findUser(ctx, func(user *User) bool {
+    return user.Account == account
+  })
+}
+
+func (utils *BoltUserUtils) GetUserByAccountPwd(ctx context.Context, account string, password string) (User, error) {
+  return utils.findUser(ctx, func(user *User) bool {
+    return user.Account == account && user.Password == password
+  })
+}
+
+func (utils *BoltUserUtils) GetUsers(ctx context.Context) ([]User, error) {
+  users := []User{}
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    found, err := database.BoltFind[User](tx, USER_COLLECTION, nil)
+    if found != nil {
+      users = found
+    }
+    return err
+  })
+  return users, err
+}
+
+func (utils *BoltUserUtils) HasUser(ctx context.Context) (bool, error) {
+  _, err := utils.findUser(ctx, nil)
+  if err == database.ErrNotFound {
+    return false, nil
+  }
+  return err == nil, err
+}
+
+func (utils *BoltUserUtils) UserHasScopeID(ctx context.Context, u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error) {
+  user, err := utils.GetUserByID(ctx, u_id)
+  if err == database.ErrNotFound {
+    return false, nil
+  } else if err != nil {
+    return false, err
+  }
+
+  for _, id := range user.Scopes {
+    if id == s_id {
+      return true, nil
+    }
+  }
+  return false, nil
+}
+
+/* Replace the stored user, if there is one */
+func (utils *BoltUserUtils) UpdateUser(ctx context.Context, user *User) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    if !database.BoltHas(tx, USER_COLLECTION, user.ID) {
+      return nil
+    }
+    return database.BoltPut(tx, USER_COLLECTION, user.ID, user)
+  })
+}
+
+/* Insert or replace the user with its own ID, like restoring a backup */
+func (utils *BoltUserUtils) PutUser(ctx context.Context, user *User) (error) {
+  if user.Scopes == nil {
+    user.Scopes = []primitive.ObjectID{}
+  }
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    _, err := database.BoltFindOne(tx, USER_COLLECTION, func(u *User) bool {
+      return u.Account == user.Account && u.ID != user.ID
+    })
+    if err == nil {
+      return ErrAccountExists
+    } else if err != database.ErrNotFound {
+      return err
+    }
+    return database.BoltPut(tx, USER_COLLECTION, user.ID, user)
+  })
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+  "context"
+  "errors"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgconn"
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* PGUserUtils keeps the users and their scopes in PostgreSQL */
+type PGUserUtils struct {
+  DB *pgxpool.Pool
+}
+
+const pg_user_columns = "id, create_time, account, password, role, disabled"
+
+/* Replace the user's scopes, keeping their order */
+func insertUserScopes(ctx context.Context, tx pgx.Tx, user *User) (error) {
+  if _, err := tx.Exec(ctx, "DELETE FROM user_scopes WHERE user_id = $1", user.ID.Hex()); err != nil {
+    return err
+  }
+
+  for i, s_id := range user.Scopes {
+    _, err := tx.Exec(ctx, "INSERT INTO user_scopes (user_id, position, scope_id) VALUES ($1, $2, $3)",
+                      user.ID.Hex(), i, s_id.Hex())
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (utils *PGUserUtils) AddUser(ctx context.Context, user *User) (primitive.ObjectID, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  user.ID = primitive.NewObjectID()
+  user.CreateTime = time.Now().UTC()
+
+  if user.Scopes == nil {
+    user.Scopes = []primitive.ObjectID{}
+  }
+
+  err := pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    _, err := tx.Exec(ctx, "INSERT INTO users (" + pg_user_columns + ") VALUES ($1, $2, $3, $4, $5, $6)",
+                      user.ID.Hex(), user.CreateTime, user.Account, user.Password, user.Role, user.Disabled)
+    if err != nil {
+      return err
+    }
+    return insertUserScopes(ctx, tx, user)
+  })
+
+  var pg_err *pgconn.PgError
+  if errors.As(err, &pg_err) && pg_err.Code == database.PG_UNIQUE_VIOLATION {
+    return user.ID, ErrAccountExists
+  }
+  return user.ID, err
+}
+
+/* Get the users matching the condition with their scopes */
+func (utils *PGUserUtils) findUsers(ctx context.Context, where string, args ...any) ([]User, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_user_columns + " FROM users WHERE " + where + " ORDER BY id", args...)
+  users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (User, error) {
+    user := User{Scopes: []primitive.ObjectID{}}
+    err := row.Scan(database.PGID(&user.ID), database.PGTime(&user.CreateTime), &user.Account,
+                    &user.Password, &user.Role, &user.Disabled)
+    return user, err
+  })
+  if err != nil || len(users) == 0 {
+    return users, err
+  }
+
+  index := map[primitive.ObjectID]int{}
+  ids := make([]primitive.ObjectID, len(users))
+  for i := range users {
+    index[users[i].ID] = i
+    ids[i] = users[i].ID
+  }
+
+  var u_id, s_id primitive.ObjectID
+
+  rows, _ = utils.DB.Query(ctx, "SELECT user_id, scope_id FROM user_scopes WHERE user_id = ANY($1) ORDER BY user_id, position",
+                           database.PGHexes(ids))
+  _, err = pgx.ForEachRow(rows, []any{database.PGID(&u_id), database.PGID(&s_id)}, func() error {
+    i := index[u_id]
+    users[i].Scopes = append(users[i].Scopes, s_id)
+    return nil
+  })
+  return users, err
+}
+
+/* Get the first user matching the condition */
+func (utils *PGUserUtils) getUser(ctx context.Context, where string, args ...any) (User, error) {
+  users, err := utils.findUsers(ctx, where, args...)
+  if err != nil {
+    return User{}, err
+  }
+  if len(users) == 0 {
+    return User{}, database.ErrNotFound
+  }
+  return users[0], nil
+}
+
+func (utils *PGUserUtils) GetUserByID(ctx context.Context, id primitive.ObjectID) (User, error) {
+  return utils.getUser(ctx, "id = $1", id.Hex())
+}
+
+func (utils *PGUserUtils) GetUserByAccount(ctx context.Context, account string) (User, error) {
+  return utils.getUser(ctx, "account = $1", account)
+}
+
+func (utils *PGUserUtils) GetUserByAccountPwd(ctx context.Context, account string, password string) (User, error) {
+  return utils.getUser(ctx, "account = $1 AND password = $2", account, password)
+}
+
+func (utils *PGUserUtils) GetUsers(ctx context.Context) ([]User, error) {
+  return utils.findUsers(ctx, "true")
+}
+
+func (utils *PGUserUtils) HasUser(ctx context.Context) (bool, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var has bool
+
+  err := utils.DB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users)").Scan(&has)
+  return has, err
+}
+
+func (utils *PGUserUtils) UserHasScopeID(ctx context.Context, u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var has bool
+
+  row := utils.DB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM user_scopes WHERE user_id = $1 AND scope_id = $2)",
+                           u_id.Hex(), s_id.Hex())
+  err := row.Scan(&has)
+  return has, err
+}
+
+/* Replace the stored user, if there is one */
+func (utils *PGUserUtils) UpdateUser(ctx context.Context, user *User) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    tag, err := tx.Exec(ctx, "UPDATE users SET create_time = $2, account = $3, password = $4, role = $5, disabled = $6 WHERE id = $1",
+                        user.ID.Hex(), user.CreateTime, user.Account, user.Password, user.Role, user.Disabled)
+    if err != nil || tag.RowsAffected() == 0 {
+      return err
+    }
+    return insertUserScopes(ctx, tx, user)
+  })
+}
+
+/* Insert or replace the user with its own ID, like restoring a backup */
+func (utils *PGUserUtils) PutUser(ctx context.Context, user *User) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if user.Scopes == nil {
+    user.Scopes = []primitive.ObjectID{}
+  }
+
+  err := pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    _, err := tx.Exec(ctx, "INSERT INTO users (" + pg_user_columns + ") VALUES ($1, $2, $3, $4, $5, $6) " +
+                      "ON CONFLICT (id) DO UPDATE SET create_time = $2, account = $3, password = $4, role = $5, disabled = $6",
+                      user.ID.Hex(), user.CreateTime, user.Account, user.Password, user.Role, user.Disabled)
+    if err != nil {
+      return err
+    }
+    return insertUserScopes(ctx, tx, user)
+  })
+
+  var pg_err *pgconn.PgError
+  if errors.As(err, &pg_err) && pg_err.Code == database.PG_UNIQUE_VIOLATION {
+    return ErrAccountExists
+  }
+  return err
+}
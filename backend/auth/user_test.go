@@ -1,43 +1,56 @@
 package auth
 
 import (
+  "context"
   "testing"
+  "time"
   "github.com/stretchr/testify/assert"
-  "github.com/starnight/riskassessment/backend/database"
 
   "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var utils = UserUtils{
-  DB_Client: database.ConnectDB(database.GetDBStr("")),
+func runUserUtils(t *testing.T, test func(t *testing.T, utils IUserUtils)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, &UserUtils{DB_Client: mongo_client})
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, &BoltUserUtils{DB: bolt_db}) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, &PGUserUtils{DB: pg_db})
+  })
 }
 
 func TestAddAsset(t *testing.T) {
+  runUserUtils(t, testAddAsset)
+}
+
+func testAddAsset(t *testing.T, utils IUserUtils) {
   /* Add an User */
   user := User {
-    Account: "foo",
+    Account: "foo" + primitive.NewObjectID().Hex(),
     Password: "bar",
   }
 
-  id, err1 := utils.AddUser(&user)
+  id, err1 := utils.AddUser(context.TODO(), &user)
 
   assert.Nil(t, err1)
   assert.True(t, id.Hex() != "")
 
   /* Get the User by ID */
-  get_user2, err2 := utils.GetUserByID(id)
+  get_user2, err2 := utils.GetUserByID(context.TODO(), id)
   assert.Nil(t, err2)
   assert.Equal(t, id, get_user2.ID)
   assert.Equal(t, user.Account, get_user2.Account)
   assert.Equal(t, user.Password, get_user2.Password)
 
   /* Get the user by account */
-  get_user3, err3 := utils.GetUserByAccount(user.Account)
+  get_user3, err3 := utils.GetUserByAccount(context.TODO(), user.Account)
   assert.Nil(t, err3)
   assert.Equal(t, get_user2, get_user3)
 
   /* Get the User by account and password */
-  get_user4, err4 := utils.GetUserByAccountPwd(user.Account, user.Password)
+  get_user4, err4 := utils.GetUserByAccountPwd(context.TODO(), user.Account, user.Password)
   assert.Nil(t, err4)
   assert.Equal(t, get_user2, get_user4)
 
@@ -45,23 +58,108 @@ func TestAddAsset(t *testing.T) {
   update_user1 := get_user2
   scope_ID := primitive.NewObjectID()
   update_user1.Scopes = append(update_user1.Scopes, scope_ID)
-  err5 := utils.UpdateUser(&update_user1)
+  err5 := utils.UpdateUser(context.TODO(), &update_user1)
   assert.Nil(t, err5)
-  update_user2, _ := utils.GetUserByID(update_user1.ID)
+  update_user2, _ := utils.GetUserByID(context.TODO(), update_user1.ID)
   assert.Equal(t, update_user1.Scopes, update_user2.Scopes)
 
   /* Check the user is in the scope */
-  in1, err5 := utils.UserHasScopeID(update_user1.ID, scope_ID)
+  in1, err5 := utils.UserHasScopeID(context.TODO(), update_user1.ID, scope_ID)
   assert.Nil(t, err5)
   assert.True(t, in1)
 
-  in2, err6 := utils.UserHasScopeID(update_user1.ID, primitive.NewObjectID())
+  in2, err6 := utils.UserHasScopeID(context.TODO(), update_user1.ID, primitive.NewObjectID())
   assert.Nil(t, err6)
   assert.False(t, in2)
 }
 
+func TestAddUserExists(t *testing.T) {
+  runUserUtils(t, func(t *testing.T, utils IUserUtils) {
+    /* MongoDB needs the unique index of the migration */
+    if mongo_utils, ok := utils.(*UserUtils); ok {
+      coll := mongo_utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
+      assert.Nil(t, EnsureAccountIndex(context.TODO(), coll))
+    }
+    testAddUserExists(t, utils)
+  })
+}
+
+func testAddUserExists(t *testing.T, utils IUserUtils) {
+  account := "dup" + primitive.NewObjectID().Hex()
+
+  _, err := utils.AddUser(context.TODO(), &User{Account: account, Password: "foo"})
+  assert.Nil(t, err)
+
+  _, err = utils.AddUser(context.TODO(), &User{Account: account, Password: "bar"})
+  assert.Equal(t, ErrAccountExists, err)
+}
+
+func TestGetUsers(t *testing.T) {
+  runUserUtils(t, testGetUsers)
+}
+
+func testGetUsers(t *testing.T, utils IUserUtils) {
+  user := User{Account: "list" + primitive.NewObjectID().Hex(), Password: "foo"}
+  id, err := utils.AddUser(context.TODO(), &user)
+  assert.Nil(t, err)
+
+  users, err := utils.GetUsers(context.TODO())
+  assert.Nil(t, err)
+  found := false
+  for _, u := range users {
+    if u.ID == id {
+      found = true
+      assert.Equal(t, user.Account, u.Account)
+      assert.Equal(t, []primitive.ObjectID{}, u.Scopes)
+    }
+  }
+  assert.True(t, found)
+}
+
+func TestPutUser(t *testing.T) {
+  runUserUtils(t, func(t *testing.T, utils IUserUtils) {
+    if mongo_utils, ok := utils.(*UserUtils); ok {
+      coll := mongo_utils.DB_Client.Database(USER_MONGO_DB).Collection(USER_COLLECTION)
+      assert.Nil(t, EnsureAccountIndex(context.TODO(), coll))
+    }
+    testPutUser(t, utils)
+  })
+}
+
+func testPutUser(t *testing.T, utils IUserUtils) {
+  /* A restored user keeps its ID and create time */
+  user := User{
+    ID: primitive.NewObjectID(),
+    CreateTime: time.Now().UTC().Truncate(time.Millisecond),
+    Account: "put" + primitive.NewObjectID().Hex(),
+    Password: "foo",
+    Scopes: []primitive.ObjectID{primitive.NewObjectID()},
+  }
+  assert.Nil(t, utils.PutUser(context.TODO(), &user))
+
+  get_user, err := utils.GetUserByID(context.TODO(), user.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, user, get_user)
+
+  /* Put the same user again replaces it */
+  user.Role = Administrator
+  user.Scopes = []primitive.ObjectID{}
+  assert.Nil(t, utils.PutUser(context.TODO(), &user))
+  get_user, err = utils.GetUserByID(context.TODO(), user.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, user, get_user)
+
+  /* The account is still unique */
+  other := User{ID: primitive.NewObjectID(), Account: user.Account, Password: "bar"}
+  assert.Equal(t, ErrAccountExists, utils.PutUser(context.TODO(), &other))
+}
+
 func TestHasUser(t *testing.T) {
-  has, err := utils.HasUser()
+  runUserUtils(t, testHasUser)
+}
+
+func testHasUser(t *testing.T, utils IUserUtils) {
+  has, err := utils.HasUser(context.TODO())
   assert.Nil(t, err)
   assert.True(t, has)
 }
@@ -0,0 +1,472 @@
+package backup
+
+import (
+  "archive/tar"
+  "bytes"
+  "compress/gzip"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "time"
+
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/*
+ * A backup is a gzip compressed tar archive, which does not depend on the
+ * storage backend.  The manifest comes first, and then each collection is a
+ * file of JSON lines in the order of restoring:
+ *
+ *   manifest.json
+ *   scopes.jsonl
+ *   users.jsonl
+ *   assets.jsonl
+ *   templates.jsonl
+ *   trends.jsonl
+ *
+ * The sessions are not backed up, since they are only valid on the instance
+ * which issued them.
+ */
+const FORMAT = "riskassessment-backup"
+
+/*
+ * The archive version, which is raised once the archive changes incompatibly.
+ * The archives of the older versions are still restored:  version 1 has no
+ * report templates, and version 2 has no risk trends.
+ */
+const VERSION = 3
+
+const MANIFEST_FILE = "manifest.json"
+
+const (
+  SCOPES_FILE = "scopes.jsonl"
+  USERS_FILE = "users.jsonl"
+  ASSETS_FILE = "assets.jsonl"
+  TEMPLATES_FILE = "templates.jsonl"
+  TRENDS_FILE = "trends.jsonl"
+)
+
+type Manifest struct {
+  Format string
+  Version int
+  CreateTime time.Time
+  /* Whether the users come with their password hashes */
+  Passwords bool
+  /* The number of the records in each file */
+  Counts map[string]int
+}
+
+type Archive struct {
+  Manifest Manifest
+  Scopes []risk_assessment.Scope
+  Users []auth.User
+  Assets []risk_assessment.Asset
+  Templates []report.Template
+  Trends []risk_assessment.TrendPoint
+}
+
+/* Storage is where the archive is dumped from and restored to */
+type Storage struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+  Template_utils report.ITemplateUtils
+  Trend_utils risk_assessment.ITrendUtils
+  /* Delete all the stored data before a full restore */
+  Clear func(ctx context.Context) error
+}
+
+/* Dump all the scopes, users, assets, report templates and risk trends of the storage */
+func Dump(ctx context.Context, storage *Storage, passwords bool) (*Archive, error) {
+  var err error
+
+  archive := &Archive{
+    Manifest: Manifest{
+      Format: FORMAT,
+      Version: VERSION,
+      CreateTime: time.Now().UTC(),
+      Passwords: passwords,
+    },
+  }
+
+  if archive.Scopes, err = storage.Scope_utils.GetScopes(ctx); err != nil {
+    return nil, err
+  }
+  if archive.Users, err = storage.User_utils.GetUsers(ctx); err != nil {
+    return nil, err
+  }
+  if archive.Assets, err = storage.Asset_utils.GetAssets(ctx, 0, 0); err != nil {
+    return nil, err
+  }
+  if archive.Templates, err = storage.Template_utils.GetTemplates(ctx); err != nil {
+    return nil, err
+  }
+  if archive.Trends, err = storage.Trend_utils.GetTrends(ctx); err != nil {
+    return nil, err
+  }
+
+  if !passwords {
+    for i := range archive.Users {
+      archive.Users[i].Password = ""
+    }
+  }
+
+  archive.Manifest.Counts = archive.counts()
+  return archive, nil
+}
+
+func encodeLines[T any](docs []T) ([]byte, error) {
+  var buf bytes.Buffer
+
+  enc := json.NewEncoder(&buf)
+  for i := range docs {
+    if err := enc.Encode(&docs[i]); err != nil {
+      return nil, err
+    }
+  }
+  return buf.Bytes(), nil
+}
+
+func decodeLines[T any](r io.Reader) ([]T, error) {
+  docs := []T{}
+
+  dec := json.NewDecoder(r)
+  dec.DisallowUnknownFields()
+  for {
+    var doc T
+    err := dec.Decode(&doc)
+    if err == io.EOF {
+      return docs, nil
+    } else if err != nil {
+      return nil, err
+    }
+    docs = append(docs, doc)
+  }
+}
+
+/* The number of the records in each file */
+func (archive *Archive) counts() map[string]int {
+  return map[string]int{
+    SCOPES_FILE: len(archive.Scopes),
+    USERS_FILE: len(archive.Users),
+    ASSETS_FILE: len(archive.Assets),
+    TEMPLATES_FILE: len(archive.Templates),
+    TRENDS_FILE: len(archive.Trends),
+  }
+}
+
+/* Write the compressed archive */
+func (archive *Archive) Write(w io.Writer) error {
+  files := []string{MANIFEST_FILE, SCOPES_FILE, USERS_FILE, ASSETS_FILE, TEMPLATES_FILE, TRENDS_FILE}
+  contents := make([][]byte, len(files))
+
+  var err error
+  if contents[0], err = json.MarshalIndent(&archive.Manifest, "", "  "); err != nil {
+    return err
+  }
+  if contents[1], err = encodeLines(archive.Scopes); err != nil {
+    return err
+  }
+  if contents[2], err = encodeLines(archive.Users); err != nil {
+    return err
+  }
+  if contents[3], err = encodeLines(archive.Assets); err != nil {
+    return err
+  }
+  if contents[4], err = encodeLines(archive.Templates); err != nil {
+    return err
+  }
+  if contents[5], err = encodeLines(archive.Trends); err != nil {
+    return err
+  }
+
+  zw := gzip.NewWriter(w)
+  tw := tar.NewWriter(zw)
+  for i, name := range files {
+    hdr := &tar.Header{
+      Name: name,
+      Mode: 0600,
+      Size: int64(len(contents[i])),
+      ModTime: archive.Manifest.CreateTime,
+    }
+    if err := tw.WriteHeader(hdr); err != nil {
+      return err
+    }
+    if _, err := tw.Write(contents[i]); err != nil {
+      return err
+    }
+  }
+
+  if err := tw.Close(); err != nil {
+    return err
+  }
+  return zw.Close()
+}
+
+func (manifest *Manifest) validate() error {
+  if manifest.Format != FORMAT {
+    return fmt.Errorf("not a backup archive, but %q", manifest.Format)
+  }
+  if manifest.Version < 1 || manifest.Version > VERSION {
+    return fmt.Errorf("unsupported backup version %d, the supported one is %d", manifest.Version, VERSION)
+  }
+  return nil
+}
+
+/* Every record has its ID, and the accounts are unique */
+func (archive *Archive) validate() error {
+  for name, count := range archive.counts() {
+    if archive.Manifest.Counts[name] != count {
+      return fmt.Errorf("%s has %d records, but the manifest says %d", name, count, archive.Manifest.Counts[name])
+    }
+  }
+
+  for _, scope := range archive.Scopes {
+    if scope.ID.IsZero() {
+      return fmt.Errorf("scope %q has no ID", scope.Name)
+    }
+  }
+
+  accounts := map[string]bool{}
+  for _, user := range archive.Users {
+    if user.ID.IsZero() || user.Account == "" {
+      return fmt.Errorf("user %q has no ID or account", user.Account)
+    }
+    if accounts[user.Account] {
+      return fmt.Errorf("duplicate account %q", user.Account)
+    }
+    accounts[user.Account] = true
+  }
+
+  for _, asset := range archive.Assets {
+    if asset.ID.IsZero() {
+      return fmt.Errorf("asset %q has no ID", asset.Name)
+    }
+  }
+
+  for _, tmpl := range archive.Templates {
+    if tmpl.ID.IsZero() {
+      return fmt.Errorf("template %q has no ID", tmpl.Name)
+    }
+  }
+
+  for _, point := range archive.Trends {
+    if point.ID.IsZero() || point.Scope.IsZero() {
+      return fmt.Errorf("trend point %s has no ID or scope", point.ID.Hex())
+    }
+  }
+  return nil
+}
+
+/* Read and validate the compressed archive */
+func Read(r io.Reader) (*Archive, error) {
+  zr, err := gzip.NewReader(r)
+  if err != nil {
+    return nil, fmt.Errorf("not a backup archive: %w", err)
+  }
+  defer zr.Close()
+
+  archive := &Archive{}
+  tr := tar.NewReader(zr)
+  for i := 0; ; i++ {
+    hdr, err := tr.Next()
+    if err == io.EOF {
+      break
+    } else if err != nil {
+      return nil, err
+    }
+
+    /* Check the version before anything else */
+    if i == 0 {
+      if hdr.Name != MANIFEST_FILE {
+        return nil, errors.New("the backup archive does not begin with the manifest")
+      }
+      if err := json.NewDecoder(tr).Decode(&archive.Manifest); err != nil {
+        return nil, fmt.Errorf("%s: %w", MANIFEST_FILE, err)
+      }
+      if err := archive.Manifest.validate(); err != nil {
+        return nil, err
+      }
+      continue
+    }
+
+    switch hdr.Name {
+    case SCOPES_FILE:
+      archive.Scopes, err = decodeLines[risk_assessment.Scope](tr)
+    case USERS_FILE:
+      archive.Users, err = decodeLines[auth.User](tr)
+    case ASSETS_FILE:
+      archive.Assets, err = decodeLines[risk_assessment.Asset](tr)
+    case TEMPLATES_FILE:
+      archive.Templates, err = decodeLines[report.Template](tr)
+    case TRENDS_FILE:
+      archive.Trends, err = decodeLines[risk_assessment.TrendPoint](tr)
+    default:
+      err = errors.New("unknown file")
+    }
+    if err != nil {
+      return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+    }
+  }
+
+  if archive.Manifest.Format == "" {
+    return nil, errors.New("empty backup archive")
+  }
+  if err := archive.validate(); err != nil {
+    return nil, err
+  }
+  return archive, nil
+}
+
+const (
+  /* Delete all the stored data, and restore the archive's */
+  FullRestore = "full"
+  /* Keep the stored data, and replace the records with the same IDs */
+  MergeRestore = "merge"
+)
+
+type Report struct {
+  Scopes int
+  Users int
+  Assets int
+  Templates int
+  Trends int
+  /* The records which are not restored, and why */
+  Skipped []string
+  /* The restored accounts without a password, which must be reset */
+  No_password []string
+}
+
+/* A full restore without the password hashes would leave no one able to log in */
+var ErrNoPasswords = errors.New("a full restore needs the password hashes")
+
+/*
+ * Restore the archive into the storage, keeping the records' IDs.  The users
+ * which are already stored keep their passwords, if the archive has none.
+ * A user whose account belongs to another stored user is skipped, and so is
+ * a trend point whose scope is not in the archive.
+ *
+ * A full restore dumps the stored data first, and puts them back if the
+ * restore fails partway, so the storage is either restored or unchanged,
+ * except for the deleted sessions.
+ */
+func Restore(ctx context.Context, storage *Storage, archive *Archive, mode string) (Report, error) {
+  report := Report{Skipped: []string{}, No_password: []string{}}
+  stored := map[primitive.ObjectID]auth.User{}
+
+  switch mode {
+  case FullRestore:
+    if !archive.Manifest.Passwords {
+      return report, ErrNoPasswords
+    }
+
+    snapshot, err := Dump(ctx, storage, true)
+    if err == nil {
+      err = snapshot.validate()
+    }
+    if err != nil {
+      return report, fmt.Errorf("cannot keep the stored data before the restore: %w", err)
+    }
+
+    if err = storage.Clear(ctx); err == nil {
+      err = putRecords(ctx, storage, archive, stored, &report)
+    }
+    if err != nil {
+      return Report{Skipped: []string{}, No_password: []string{}}, rollback(ctx, storage, snapshot, err)
+    }
+    return report, nil
+  case MergeRestore:
+    users, err := storage.User_utils.GetUsers(ctx)
+    if err != nil {
+      return report, err
+    }
+    for _, user := range users {
+      stored[user.ID] = user
+    }
+    err = putRecords(ctx, storage, archive, stored, &report)
+    return report, err
+  default:
+    return report, fmt.Errorf("unknown restore mode %q, use %s or %s", mode, FullRestore, MergeRestore)
+  }
+}
+
+/* Put back the data stored before the failed full restore, even if the restore is canceled */
+func rollback(ctx context.Context, storage *Storage, snapshot *Archive, cause error) error {
+  ctx = context.WithoutCancel(ctx)
+
+  ignored := Report{}
+  err := storage.Clear(ctx)
+  if err == nil {
+    err = putRecords(ctx, storage, snapshot, map[primitive.ObjectID]auth.User{}, &ignored)
+  }
+  if err != nil {
+    return fmt.Errorf("restore failed: %w, and rolling back the stored data failed too: %w", cause, err)
+  }
+  return fmt.Errorf("restore failed, and the stored data are rolled back: %w", cause)
+}
+
+/* Put the archive's records into the storage, where stored are the users before the restore */
+func putRecords(ctx context.Context, storage *Storage, archive *Archive, stored map[primitive.ObjectID]auth.User, report *Report) error {
+  for i := range archive.Scopes {
+    if err := storage.Scope_utils.PutScope(ctx, &archive.Scopes[i]); err != nil {
+      return err
+    }
+    report.Scopes++
+  }
+
+  for _, user := range archive.Users {
+    if !archive.Manifest.Passwords || user.Password == "" {
+      user.Password = stored[user.ID].Password
+    }
+
+    err := storage.User_utils.PutUser(ctx, &user)
+    if err == auth.ErrAccountExists {
+      report.Skipped = append(report.Skipped, fmt.Sprintf("user %s %q: account exists", user.ID.Hex(), user.Account))
+      continue
+    } else if err != nil {
+      return err
+    }
+
+    report.Users++
+    if user.Password == "" {
+      report.No_password = append(report.No_password, user.Account)
+    }
+  }
+
+  for i := range archive.Assets {
+    if err := storage.Asset_utils.PutAsset(ctx, &archive.Assets[i]); err != nil {
+      return err
+    }
+    report.Assets++
+  }
+
+  for i := range archive.Templates {
+    if err := storage.Template_utils.PutTemplate(ctx, &archive.Templates[i]); err != nil {
+      return err
+    }
+    report.Templates++
+  }
+
+  scopes := map[primitive.ObjectID]bool{}
+  for _, scope := range archive.Scopes {
+    scopes[scope.ID] = true
+  }
+  for i := range archive.Trends {
+    point := &archive.Trends[i]
+    if !scopes[point.Scope] {
+      report.Skipped = append(report.Skipped, fmt.Sprintf("trend point %s: unknown scope %s", point.ID.Hex(), point.Scope.Hex()))
+      continue
+    }
+    if err := storage.Trend_utils.PutTrendPoint(ctx, point); err != nil {
+      return err
+    }
+    report.Trends++
+  }
+  return nil
+}
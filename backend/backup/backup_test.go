@@ -0,0 +1,304 @@
+package backup
+
+import (
+  "archive/tar"
+  "bytes"
+  "compress/gzip"
+  "context"
+  "errors"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newStorage(t *testing.T) *Storage {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "backup.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  return &Storage{
+    User_utils: &auth.BoltUserUtils{DB: db},
+    Scope_utils: &risk_assessment.BoltScopeUtils{DB: db},
+    Asset_utils: &risk_assessment.BoltAssetUtils{DB: db},
+    Template_utils: &report.BoltTemplateUtils{DB: db},
+    Trend_utils: &risk_assessment.BoltTrendUtils{DB: db},
+    Clear: func(ctx context.Context) error {
+      return database.BoltUpdate(ctx, db, func(tx *bbolt.Tx) error {
+        for _, name := range []string{auth.USER_COLLECTION, risk_assessment.SCOPE_COLLECTION, risk_assessment.ASSET_COLLECTION,
+                                  report.TEMPLATE_COLLECTION, risk_assessment.TREND_COLLECTION} {
+          if err := database.BoltClear(tx, name); err != nil {
+            return err
+          }
+        }
+        return nil
+      })
+    },
+  }
+}
+
+/* A storage with a scope, its asset and trend point, an user and a report template */
+func fillStorage(t *testing.T, storage *Storage) {
+  ctx := context.TODO()
+
+  scope := risk_assessment.Scope{Name: "scope", Levels: risk_assessment.RiskLevels{Medium: 10, High: 20}}
+  s_id, err := storage.Scope_utils.AddScope(ctx, &scope)
+  assert.Nil(t, err)
+
+  user := auth.User{Account: "alice", Password: auth.HashPassword("pw"), Scopes: []primitive.ObjectID{s_id}}
+  _, err = storage.User_utils.AddUser(ctx, &user)
+  assert.Nil(t, err)
+
+  asset := risk_assessment.Asset{
+    Scope: s_id,
+    Name: "asset",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []risk_assessment.Risk{{Threat: "threat", Possibility: 2, Impact: 3}},
+  }
+  assert.Nil(t, storage.Asset_utils.AddAsset(ctx, &asset))
+
+  tmpl := report.Template{Name: "template", Format: report.MarkdownFormat, Content: "# {{.Scope.Name}}"}
+  assert.Nil(t, storage.Template_utils.AddTemplate(ctx, &tmpl))
+
+  point := risk_assessment.NewTrendPoint(&scope, []risk_assessment.Asset{asset}, time.Now())
+  assert.Nil(t, storage.Trend_utils.RecordTrendPoint(ctx, &point))
+}
+
+func dumpArchive(t *testing.T, storage *Storage, passwords bool) *Archive {
+  archive, err := Dump(context.TODO(), storage, passwords)
+  assert.Nil(t, err)
+
+  var buf bytes.Buffer
+  assert.Nil(t, archive.Write(&buf))
+  read, err := Read(&buf)
+  assert.Nil(t, err)
+  return read
+}
+
+func TestWriteRead(t *testing.T) {
+  storage := newStorage(t)
+  fillStorage(t, storage)
+
+  archive, err := Dump(context.TODO(), storage, true)
+  assert.Nil(t, err)
+  assert.Equal(t, VERSION, archive.Manifest.Version)
+  assert.Equal(t, map[string]int{SCOPES_FILE: 1, USERS_FILE: 1, ASSETS_FILE: 1, TEMPLATES_FILE: 1, TRENDS_FILE: 1}, archive.Manifest.Counts)
+
+  var buf bytes.Buffer
+  assert.Nil(t, archive.Write(&buf))
+  read, err := Read(&buf)
+  assert.Nil(t, err)
+  assert.Equal(t, archive.Scopes, read.Scopes)
+  assert.Equal(t, archive.Users, read.Users)
+  assert.Equal(t, archive.Assets, read.Assets)
+  assert.Equal(t, archive.Templates, read.Templates)
+  assert.Equal(t, archive.Trends, read.Trends)
+  assert.True(t, archive.Manifest.CreateTime.Equal(read.Manifest.CreateTime))
+
+  /* Without the password hashes */
+  archive = dumpArchive(t, storage, false)
+  assert.False(t, archive.Manifest.Passwords)
+  assert.Equal(t, "", archive.Users[0].Password)
+}
+
+/* Write the files as they are into a compressed tar */
+func writeFiles(t *testing.T, files ...string) *bytes.Buffer {
+  var buf bytes.Buffer
+
+  zw := gzip.NewWriter(&buf)
+  tw := tar.NewWriter(zw)
+  for i := 0; i < len(files); i += 2 {
+    tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0600, Size: int64(len(files[i + 1]))})
+    tw.Write([]byte(files[i + 1]))
+  }
+  assert.Nil(t, tw.Close())
+  assert.Nil(t, zw.Close())
+  return &buf
+}
+
+func TestReadInvalid(t *testing.T) {
+  _, err := Read(bytes.NewBufferString("foo"))
+  assert.NotNil(t, err)
+
+  _, err = Read(writeFiles(t))
+  assert.NotNil(t, err)
+
+  _, err = Read(writeFiles(t, SCOPES_FILE, "", MANIFEST_FILE, `{"Format": "riskassessment-backup", "Version": 1}`))
+  assert.ErrorContains(t, err, "manifest")
+
+  _, err = Read(writeFiles(t, MANIFEST_FILE, `{"Format": "foo", "Version": 1}`))
+  assert.ErrorContains(t, err, "not a backup")
+
+  _, err = Read(writeFiles(t, MANIFEST_FILE, `{"Format": "riskassessment-backup", "Version": 4}`))
+  assert.ErrorContains(t, err, "unsupported backup version 4")
+
+  /* A truncated file */
+  _, err = Read(writeFiles(t, MANIFEST_FILE, `{"Format": "riskassessment-backup", "Version": 1, "Counts": {"scopes.jsonl": 2}}`,
+                           SCOPES_FILE, `{"ID": "` + primitive.NewObjectID().Hex() + `", "Name": "foo"}`))
+  assert.ErrorContains(t, err, "scopes.jsonl has 1 records, but the manifest says 2")
+
+  _, err = Read(writeFiles(t, MANIFEST_FILE, `{"Format": "riskassessment-backup", "Version": 1}`, "foo.jsonl", ""))
+  assert.ErrorContains(t, err, "foo.jsonl")
+
+  _, err = Read(writeFiles(t, MANIFEST_FILE, `{"Format": "riskassessment-backup", "Version": 1, "Counts": {"users.jsonl": 1}}`,
+                           USERS_FILE, `{"Account": "alice"}`))
+  assert.ErrorContains(t, err, "no ID")
+}
+
+func TestReadVersion1(t *testing.T) {
+  /* The archives before the report templates */
+  s_id := primitive.NewObjectID().Hex()
+  archive, err := Read(writeFiles(t, MANIFEST_FILE, `{"Format": "riskassessment-backup", "Version": 1, "Passwords": true, "Counts": {"scopes.jsonl": 1}}`,
+                                  SCOPES_FILE, `{"ID": "` + s_id + `", "Name": "foo"}`,
+                                  USERS_FILE, "", ASSETS_FILE, ""))
+  assert.Nil(t, err)
+  assert.Equal(t, 1, len(archive.Scopes))
+  assert.Equal(t, 0, len(archive.Templates))
+  assert.Equal(t, 0, len(archive.Trends))
+
+  result, err := Restore(context.TODO(), newStorage(t), archive, FullRestore)
+  assert.Nil(t, err)
+  assert.Equal(t, 1, result.Scopes)
+  assert.Equal(t, 0, result.Templates)
+}
+
+func TestRestoreFull(t *testing.T) {
+  ctx := context.TODO()
+  source := newStorage(t)
+  fillStorage(t, source)
+  archive := dumpArchive(t, source, true)
+
+  target := newStorage(t)
+  fillStorage(t, target)
+
+  restored, err := Restore(ctx, target, archive, FullRestore)
+  assert.Nil(t, err)
+  assert.Equal(t, Report{Scopes: 1, Users: 1, Assets: 1, Templates: 1, Trends: 1, Skipped: []string{}, No_password: []string{}}, restored)
+
+  /* The target is the same as the source */
+  scopes, _ := target.Scope_utils.GetScopes(ctx)
+  assert.Equal(t, archive.Scopes, scopes)
+  users, _ := target.User_utils.GetUsers(ctx)
+  assert.Equal(t, archive.Users, users)
+  assets, _ := target.Asset_utils.GetAssets(ctx, 0, 0)
+  assert.Equal(t, archive.Assets, assets)
+  templates, _ := target.Template_utils.GetTemplates(ctx)
+  assert.Equal(t, archive.Templates, templates)
+  trends, _ := target.Trend_utils.GetTrends(ctx)
+  assert.Equal(t, archive.Trends, trends)
+
+  _, err = target.User_utils.GetUserByAccountPwd(ctx, "alice", auth.HashPassword("pw"))
+  assert.Nil(t, err)
+}
+
+/* The asset utils which fail to put the given assets */
+type failingAssetUtils struct {
+  risk_assessment.IAssetUtils
+  fail func(asset *risk_assessment.Asset) bool
+}
+
+func (utils *failingAssetUtils) PutAsset(ctx context.Context, asset *risk_assessment.Asset) (error) {
+  if utils.fail(asset) {
+    return errors.New("put failed")
+  }
+  return utils.IAssetUtils.PutAsset(ctx, asset)
+}
+
+func TestRestoreFullRollback(t *testing.T) {
+  ctx := context.TODO()
+  source := newStorage(t)
+  fillStorage(t, source)
+  archive := dumpArchive(t, source, true)
+
+  target := newStorage(t)
+  fillStorage(t, target)
+  before, err := Dump(ctx, target, true)
+  assert.Nil(t, err)
+
+  /* Fail the archive's asset, after the scopes and users are restored */
+  failing := &failingAssetUtils{IAssetUtils: target.Asset_utils, fail: func(asset *risk_assessment.Asset) bool {
+    return asset.ID == archive.Assets[0].ID
+  }}
+  target.Asset_utils = failing
+
+  result, err := Restore(ctx, target, archive, FullRestore)
+  assert.ErrorContains(t, err, "rolled back: put failed")
+  assert.Equal(t, 0, result.Scopes)
+
+  /* The target is the same as before */
+  after, err := Dump(ctx, target, true)
+  assert.Nil(t, err)
+  assert.Equal(t, before.Scopes, after.Scopes)
+  assert.Equal(t, before.Users, after.Users)
+  assert.Equal(t, before.Assets, after.Assets)
+  assert.Equal(t, before.Templates, after.Templates)
+  assert.Equal(t, before.Trends, after.Trends)
+
+  /* Rolling back fails too */
+  failing.fail = func(asset *risk_assessment.Asset) bool { return true }
+  _, err = Restore(ctx, target, archive, FullRestore)
+  assert.ErrorContains(t, err, "rolling back the stored data failed too")
+}
+
+func TestRestoreFullNoPasswords(t *testing.T) {
+  storage := newStorage(t)
+  fillStorage(t, storage)
+  archive := dumpArchive(t, storage, false)
+
+  _, err := Restore(context.TODO(), storage, archive, FullRestore)
+  assert.Equal(t, ErrNoPasswords, err)
+
+  /* Nothing is deleted */
+  users, _ := storage.User_utils.GetUsers(context.TODO())
+  assert.Equal(t, 1, len(users))
+}
+
+func TestRestoreMerge(t *testing.T) {
+  ctx := context.TODO()
+  storage := newStorage(t)
+  fillStorage(t, storage)
+  archive := dumpArchive(t, storage, false)
+
+  /* Change the stored data after the backup */
+  alice, _ := storage.User_utils.GetUserByAccount(ctx, "alice")
+  alice.Role = auth.Administrator
+  storage.User_utils.UpdateUser(ctx, &alice)
+  bob := auth.User{Account: "bob", Password: auth.HashPassword("pw")}
+  storage.User_utils.AddUser(ctx, &bob)
+
+  /* The archive has another user with the stored account, and a new one */
+  archive.Users = append(archive.Users,
+                         auth.User{ID: primitive.NewObjectID(), Account: "bob"},
+                         auth.User{ID: primitive.NewObjectID(), Account: "carol"})
+  /* And a trend point of an unknown scope */
+  archive.Trends = append(archive.Trends, risk_assessment.TrendPoint{ID: primitive.NewObjectID(), Scope: primitive.NewObjectID()})
+
+  result, err := Restore(ctx, storage, archive, MergeRestore)
+  assert.Nil(t, err)
+  assert.Equal(t, 2, result.Users)
+  assert.Equal(t, 1, result.Trends)
+  assert.Equal(t, 2, len(result.Skipped))
+  assert.Contains(t, result.Skipped[0], `"bob": account exists`)
+  assert.Contains(t, result.Skipped[1], "unknown scope")
+  assert.Equal(t, []string{"carol"}, result.No_password)
+
+  /* The stored user is replaced, but keeps the password */
+  restored, err := storage.User_utils.GetUserByAccountPwd(ctx, "alice", auth.HashPassword("pw"))
+  assert.Nil(t, err)
+  assert.Equal(t, uint(auth.NormalUser), restored.Role)
+
+  /* The users not in the archive are kept */
+  _, err = storage.User_utils.GetUserByID(ctx, bob.ID)
+  assert.Nil(t, err)
+
+  _, err = Restore(ctx, storage, archive, "foo")
+  assert.NotNil(t, err)
+}
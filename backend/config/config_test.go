@@ -0,0 +1,281 @@
+package config
+
+import (
+  "flag"
+  "io"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+  "github.com/stretchr/testify/assert"
+)
+
+var envNames = []string{
+  "CONFIG_FILE", "APP_MODE", "LISTEN_ADDR", "FUNCTIONS_CUSTOMHANDLER_PORT",
+  "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_REDIRECT_LISTEN", "CSRF_SECRET", "SESSION_SECRET", "LINK_SECRET", "STORAGE_BACKEND", "STORAGE_PATH", "MONGODB_URI", "MONGODB_DB", "POSTGRES_URI",
+  "MONGODB_CONNECT_TIMEOUT", "MONGODB_OPERATION_TIMEOUT", "SHUTDOWN_TIMEOUT", "SESSION_IDLE_TIMEOUT", "SESSION_ABSOLUTE_TIMEOUT", "LOG_FORMAT", "LOG_LEVEL",
+  "METRICS_ENABLED", "METRICS_TOKEN", "METRICS_LISTEN", "FEATURE_REGISTRATION", "REPORT_FONT",
+}
+
+func clearEnv(t *testing.T) {
+  for _, name := range envNames {
+    t.Setenv(name, "")
+    os.Unsetenv(name)
+  }
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+  path := filepath.Join(t.TempDir(), name)
+  os.WriteFile(path, []byte(content), 0600)
+  return path
+}
+
+func TestLoadDefault(t *testing.T) {
+  clearEnv(t)
+
+  cfg, err := Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, ":8080", cfg.Listen)
+  assert.Equal(t, MongoStorage, cfg.Storage.Backend)
+  assert.Equal(t, DB_NAME, cfg.Mongo.DB_Name)
+  assert.Equal(t, MONGO_CONNECT_TIMEOUT, cfg.ConnectTimeout())
+  assert.Equal(t, MONGO_OPERATION_TIMEOUT, cfg.OperationTimeout())
+  assert.Equal(t, SHUTDOWN_TIMEOUT, cfg.ShutdownTimeout())
+  assert.Equal(t, SESSION_IDLE_TIMEOUT, cfg.IdleTimeout())
+  assert.Equal(t, SESSION_ABSOLUTE_TIMEOUT, cfg.AbsoluteTimeout())
+  assert.Equal(t, "text", cfg.Log.Format)
+  assert.Equal(t, "info", cfg.Log.Level)
+  assert.True(t, cfg.Features.Registration)
+}
+
+func TestLoadInsecureSecrets(t *testing.T) {
+  clearEnv(t)
+
+  /* The well known secrets are refused out of the dev mode */
+  _, err := Load("test", []string{}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-csrf-secret", "0123456789abcdef", "-session-secret", "short"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-csrf-secret", "0123456789abcdef", "-session-secret", "fedcba9876543210", "-link-secret", "short"}, io.Discard)
+  assert.NotNil(t, err)
+
+  cfg, err := Load("test", []string{"-csrf-secret", "0123456789abcdef", "-session-secret", "fedcba9876543210"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, ProductionMode, cfg.Mode)
+  /* The shared links are signed with the session secret by default */
+  assert.Equal(t, "fedcba9876543210", cfg.LinkSecret())
+
+  cfg, err = Load("test", []string{"-csrf-secret", "0123456789abcdef", "-session-secret", "fedcba9876543210", "-link-secret", "0011223344556677"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, "0011223344556677", cfg.LinkSecret())
+}
+
+func TestLoadYAML(t *testing.T) {
+  clearEnv(t)
+  path := writeFile(t, "config.yaml", `
+mode: dev
+listen: ":9000"
+mongo:
+  uri: mongodb://db:27017
+  db_name: foo
+session:
+  idle_timeout: 15m
+features:
+  registration: false
+`)
+
+  cfg, err := Load("test", []string{"-config", path}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, ":9000", cfg.Listen)
+  assert.Equal(t, "mongodb://db:27017", cfg.Mongo.URI)
+  assert.Equal(t, "foo", cfg.Mongo.DB_Name)
+  assert.Equal(t, 15 * time.Minute, cfg.IdleTimeout())
+  assert.Equal(t, SESSION_ABSOLUTE_TIMEOUT, cfg.AbsoluteTimeout())
+  assert.False(t, cfg.Features.Registration)
+}
+
+func TestLoadTOML(t *testing.T) {
+  clearEnv(t)
+  path := writeFile(t, "config.toml", `
+mode = "dev"
+listen = ":9001"
+
+[session]
+absolute_timeout = "8h"
+`)
+  t.Setenv("CONFIG_FILE", path)
+
+  cfg, err := Load("test", []string{}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, ":9001", cfg.Listen)
+  assert.Equal(t, 8 * time.Hour, cfg.AbsoluteTimeout())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+  clearEnv(t)
+  path := writeFile(t, "config.yml", `
+mode: dev
+listen: ":9000"
+mongo:
+  db_name: file
+`)
+
+  /* Environment variables override the file */
+  t.Setenv("MONGODB_DB", "env")
+  t.Setenv("FUNCTIONS_CUSTOMHANDLER_PORT", "9090")
+  t.Setenv("SESSION_IDLE_TIMEOUT", "10m")
+  t.Setenv("MONGODB_CONNECT_TIMEOUT", "0s")
+  t.Setenv("MONGODB_OPERATION_TIMEOUT", "3s")
+  cfg, err := Load("test", []string{"-config", path}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, time.Duration(0), cfg.ConnectTimeout())
+  assert.Equal(t, 3 * time.Second, cfg.OperationTimeout())
+  assert.Equal(t, ":9090", cfg.Listen)
+  assert.Equal(t, "env", cfg.Mongo.DB_Name)
+  assert.Equal(t, 10 * time.Minute, cfg.IdleTimeout())
+
+  /* Flags override the environment variables */
+  args := []string{"-config", path, "-db-name", "flag", "-listen", ":7000", "-session-idle-timeout", "5m", "-mongodb-operation-timeout", "1s"}
+  cfg, err = Load("test", args, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, time.Second, cfg.OperationTimeout())
+  assert.Equal(t, ":7000", cfg.Listen)
+  assert.Equal(t, "flag", cfg.Mongo.DB_Name)
+  assert.Equal(t, 5 * time.Minute, cfg.IdleTimeout())
+}
+
+func TestLoadInvalid(t *testing.T) {
+  clearEnv(t)
+
+  t.Setenv("SESSION_IDLE_TIMEOUT", "foo")
+  _, err := Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.NotNil(t, err)
+  os.Unsetenv("SESSION_IDLE_TIMEOUT")
+
+  _, err = Load("test", []string{"-mode", "foo"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-mode", "dev", "-mongodb-connect-timeout", "-1s"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-mode", "dev", "-mongodb-operation-timeout", "-1s"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-mode", "dev", "-shutdown-timeout", "-1s"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-mode", "dev", "-log-format", "xml"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-mode", "dev", "-log-level", "loud"}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-config", writeFile(t, "config.ini", "")}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-no-such-flag"}, io.Discard)
+  assert.NotNil(t, err)
+}
+
+func TestLoadTLS(t *testing.T) {
+  clearEnv(t)
+
+  cfg, err := Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.Nil(t, err)
+  assert.False(t, cfg.TLSEnabled())
+
+  t.Setenv("TLS_CERT_FILE", "cert.pem")
+  _, err = Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.NotNil(t, err)
+
+  cfg, err = Load("test", []string{"-mode", "dev", "-tls-key", "key.pem", "-tls-redirect-listen", ":80"}, io.Discard)
+  assert.Nil(t, err)
+  assert.True(t, cfg.TLSEnabled())
+  assert.Equal(t, ":80", cfg.TLS.Redirect_listen)
+
+  os.Unsetenv("TLS_CERT_FILE")
+  _, err = Load("test", []string{"-mode", "dev", "-tls-redirect-listen", ":80"}, io.Discard)
+  assert.NotNil(t, err)
+}
+
+func TestLoadMetrics(t *testing.T) {
+  clearEnv(t)
+
+  cfg, err := Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.Nil(t, err)
+  assert.False(t, cfg.Metrics.Enabled)
+
+  /* Metrics must not be public */
+  _, err = Load("test", []string{"-mode", "dev", "-metrics"}, io.Discard)
+  assert.NotNil(t, err)
+
+  t.Setenv("METRICS_ENABLED", "true")
+  t.Setenv("METRICS_TOKEN", "foo")
+  cfg, err = Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.Nil(t, err)
+  assert.True(t, cfg.Metrics.Enabled)
+  assert.Equal(t, "foo", cfg.Metrics.Token)
+
+  cfg, err = Load("test", []string{"-mode", "dev", "-metrics-token", "", "-metrics-listen", "127.0.0.1:9100"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, "127.0.0.1:9100", cfg.Metrics.Listen)
+}
+
+func TestLoadStorage(t *testing.T) {
+  clearEnv(t)
+
+  t.Setenv("STORAGE_BACKEND", "bolt")
+  cfg, err := Load("test", []string{"-mode", "dev", "-storage-path", "/var/lib/riskassessment.db"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, BoltStorage, cfg.Storage.Backend)
+  assert.Equal(t, "/var/lib/riskassessment.db", cfg.Storage.Path)
+
+  _, err = Load("test", []string{"-mode", "dev", "-storage-path", ""}, io.Discard)
+  assert.NotNil(t, err)
+
+  _, err = Load("test", []string{"-mode", "dev", "-storage", "mysql"}, io.Discard)
+  assert.NotNil(t, err)
+
+  t.Setenv("STORAGE_BACKEND", "postgres")
+  t.Setenv("POSTGRES_URI", "postgres://db.example.com/assetrisk")
+  cfg, err = Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, PostgresStorage, cfg.Storage.Backend)
+  assert.Equal(t, "postgres://db.example.com/assetrisk", cfg.Postgres.URI)
+
+  _, err = Load("test", []string{"-mode", "dev", "-postgres-uri", ""}, io.Discard)
+  assert.NotNil(t, err)
+}
+
+func TestLoadReport(t *testing.T) {
+  clearEnv(t)
+  font := writeFile(t, "font.ttf", "")
+
+  t.Setenv("REPORT_FONT", font)
+  cfg, err := Load("test", []string{"-mode", "dev"}, io.Discard)
+  assert.Nil(t, err)
+  assert.Equal(t, font, cfg.Report.Font)
+
+  /* The font file must exist */
+  _, err = Load("test", []string{"-mode", "dev", "-report-font", font + ".foo"}, io.Discard)
+  assert.ErrorContains(t, err, "report font")
+}
+
+func TestLoadCommand(t *testing.T) {
+  clearEnv(t)
+
+  var role *string
+  cfg, args, err := LoadCommand("test", []string{"-mode", "dev", "-role", "admin", "alice"}, io.Discard, func(fs *flag.FlagSet) {
+    role = fs.String("role", "user", "role")
+  })
+  assert.Nil(t, err)
+  assert.Equal(t, DevMode, cfg.Mode)
+  assert.Equal(t, "admin", *role)
+  assert.Equal(t, []string{"alice"}, args)
+
+  /* The command's flags are unknown to the others */
+  _, err = Load("test", []string{"-mode", "dev", "-role", "admin"}, io.Discard)
+  assert.NotNil(t, err)
+}
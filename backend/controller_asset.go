@@ -1,7 +1,10 @@
 package main
 
 import (
+  "math"
   "net/http"
+  "slices"
+  "strconv"
 
   "github.com/gin-gonic/gin"
   "github.com/gin-contrib/sessions"
@@ -17,17 +20,79 @@ type IAssetsApp interface {
   AddAsset(c *gin.Context)
   UpdateAsset(c *gin.Context)
   DeleteAsset(c *gin.Context)
+  ImportAssets(c *gin.Context)
 }
 
 type AssetsApp struct {
   User_utils auth.IUserUtils
   Csrf_utils middleware.ICSRFUtils
   Asset_utils risk_assessment.IAssetUtils
+  /* The levels of the scope filter the assets by the level */
+  Scope_utils risk_assessment.IScopeUtils
 }
 
+/* The assets, and the number of all the assets matching the query */
 type AssetPage struct {
   UserInfo auth.UserInfo
   Assets []risk_assessment.Asset
+  Total int64
+}
+
+const DEFAULT_ASSET_PAGE_SIZE = 50
+const MAX_ASSET_PAGE_SIZE = 500
+
+/* The asset value of the ?name= from 3 to MAX_RATING * 3, or 0 if it is not given */
+func assetValue(c *gin.Context, name string) (uint, bool) {
+  value := c.Query(name)
+  if (value == "") {
+    return 0, true
+  }
+
+  v, err := strconv.ParseUint(value, 10, 0)
+  return uint(v), err == nil && v >= 3 && v <= risk_assessment.MAX_RATING * 3
+}
+
+/*
+ * The listing of the query string: the ?page= from 1 of the ?size=, the
+ * ?bigcategory=, ?smallcategory= and ?owner= which are matched exactly, the
+ * ?minvalue= and ?maxvalue= of the asset value, the ?level= of the highest
+ * risk score, ?norisks=true, and the ?sort= with the ?order=asc or desc.
+ * It is false if any of them is invalid, or the page is beyond the offsets.
+ */
+func assetQuery(c *gin.Context, s_id primitive.ObjectID) (*risk_assessment.AssetQuery, bool) {
+  query := risk_assessment.AssetQuery{
+    Scope: s_id,
+    BigCategory: c.Query("bigcategory"),
+    SmallCategory: c.Query("smallcategory"),
+    Owner: c.Query("owner"),
+    Level: c.Query("level"),
+    Sort: c.DefaultQuery("sort", risk_assessment.SortByCreateTime),
+  }
+
+  page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+  if (err != nil || page < 1) {
+    return nil, false
+  }
+  size, err := strconv.ParseInt(c.DefaultQuery("size", strconv.Itoa(DEFAULT_ASSET_PAGE_SIZE)), 10, 64)
+  if (err != nil || size < 1 || size > MAX_ASSET_PAGE_SIZE || page - 1 > math.MaxInt64 / size) {
+    return nil, false
+  }
+  query.Offset = (page - 1) * size
+  query.Limit = size
+
+  var min_ok, max_ok bool
+  query.MinValue, min_ok = assetValue(c, "minvalue")
+  query.MaxValue, max_ok = assetValue(c, "maxvalue")
+  if (!min_ok || !max_ok || (query.MaxValue > 0 && query.MinValue > query.MaxValue)) {
+    return nil, false
+  }
+
+  query.NoRisks, err = strconv.ParseBool(c.DefaultQuery("norisks", "false"))
+  order := c.DefaultQuery("order", "asc")
+  query.Descending = order == "desc"
+  return &query, err == nil && (order == "asc" || order == "desc") &&
+                  slices.Contains(risk_assessment.ASSET_SORTS, query.Sort) &&
+                  (query.Level == "" || slices.Contains(risk_assessment.RISK_LEVEL_NAMES, query.Level))
 }
 
 type assetReq struct {
@@ -54,18 +119,26 @@ func (ap *AssetsApp) GetAssets(c *gin.Context) {
     return
   }
 
-  authorized, err = ap.User_utils.UserHasScopeID(u_id, s_id)
+  query, ok := assetQuery(c, s_id)
+  if (!ok) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err = ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   } else if (!authorized) {
     c.AbortWithStatus(http.StatusForbidden)
     return
   }
 
-  asset_page.Assets, err = ap.Asset_utils.GetAssetsByScopeID(s_id)
+  /* Without the query string, the first page of DEFAULT_ASSET_PAGE_SIZE assets */
+  list, err := ap.queryAssets(c, query)
+  asset_page.Assets, asset_page.Total = list.Assets, list.Total
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -73,6 +146,18 @@ func (ap *AssetsApp) GetAssets(c *gin.Context) {
   c.JSON(http.StatusOK, asset_page)
 }
 
+/* A page of the assets, where the level follows the scope's thresholds */
+func (ap *AssetsApp) queryAssets(c *gin.Context, query *risk_assessment.AssetQuery) (risk_assessment.AssetList, error) {
+  if (query.Level != "") {
+    scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), query.Scope)
+    if (err != nil) {
+      return risk_assessment.AssetList{}, err
+    }
+    query.Levels = scope.RiskLevels()
+  }
+  return ap.Asset_utils.QueryAssets(c.Request.Context(), query)
+}
+
 func (ap *AssetsApp) AddAsset(c *gin.Context) {
   var asset risk_assessment.Asset
 
@@ -85,18 +170,18 @@ func (ap *AssetsApp) AddAsset(c *gin.Context) {
     return
   }
 
-  authorized, err := ap.User_utils.UserHasScopeID(u_id, asset.Scope)
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, asset.Scope)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   } else if (!authorized) {
     c.AbortWithStatus(http.StatusForbidden)
     return
   }
 
-  err = ap.Asset_utils.AddAsset(&asset)
+  err = ap.Asset_utils.AddAsset(c.Request.Context(), &asset)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
   c.Status(http.StatusOK)
@@ -115,15 +200,15 @@ func (ap *AssetsApp) UpdateAsset(c *gin.Context) {
     return
   }
 
-  orig_asset, err := ap.Asset_utils.GetAssetByID(asset.ID)
+  orig_asset, err := ap.Asset_utils.GetAssetByID(c.Request.Context(), asset.ID)
   if (err != nil) {
     c.AbortWithStatus(http.StatusBadRequest)
     return
   }
 
-  authorized, err = ap.User_utils.UserHasScopeID(u_id, orig_asset.Scope)
+  authorized, err = ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, orig_asset.Scope)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   } else if (!authorized) {
     c.AbortWithStatus(http.StatusForbidden)
@@ -132,9 +217,9 @@ func (ap *AssetsApp) UpdateAsset(c *gin.Context) {
 
   asset.CreateTime = orig_asset.CreateTime
   asset.Scope = orig_asset.Scope
-  err = ap.Asset_utils.UpdateAsset(&asset)
+  err = ap.Asset_utils.UpdateAsset(c.Request.Context(), &asset)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -158,26 +243,95 @@ func (ap *AssetsApp) DeleteAsset(c *gin.Context) {
     return
   }
 
-  asset, err := ap.Asset_utils.GetAssetByID(id.Id)
+  asset, err := ap.Asset_utils.GetAssetByID(c.Request.Context(), id.Id)
   if (err != nil) {
     c.AbortWithStatus(http.StatusBadRequest)
     return
   }
 
-  authorized, err = ap.User_utils.UserHasScopeID(u_id, asset.Scope)
+  authorized, err = ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, asset.Scope)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   } else if (!authorized) {
     c.AbortWithStatus(http.StatusForbidden)
     return
   }
 
-  err = ap.Asset_utils.DeleteAsset(id.Id)
+  err = ap.Asset_utils.DeleteAsset(c.Request.Context(), id.Id)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
   c.Status(http.StatusOK)
 }
+
+/* The largest CSV of the assets which could be uploaded */
+const MAX_CSV_SIZE = 8 << 20
+
+/*
+ * Add the assets of the uploaded CSV to the scope, unless any row is invalid.
+ * With ?dry_run=true, nothing is added, and only the report of the rows is
+ * returned.
+ */
+func (ap *AssetsApp) ImportAssets(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  dry_run, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  /* The names must not be the same as the stored assets' */
+  existing, err := ap.Asset_utils.GetAssetsByScopeID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  body := http.MaxBytesReader(c.Writer, c.Request.Body, MAX_CSV_SIZE)
+  assets, report, err := risk_assessment.ParseAssetsCSV(body, existing)
+  if (err != nil) {
+    c.String(http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if (dry_run) {
+    c.JSON(http.StatusOK, report)
+    return
+  } else if (report.Invalid()) {
+    c.JSON(http.StatusBadRequest, report)
+    return
+  }
+
+  for i := range assets {
+    assets[i].Scope = s_id
+  }
+  err = ap.Asset_utils.AddAssets(c.Request.Context(), assets)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  report.Imported = true
+  c.JSON(http.StatusOK, report)
+}
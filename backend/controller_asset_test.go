@@ -2,6 +2,7 @@ package main
 
 import (
   "bytes"
+  "context"
   "errors"
   "testing"
   "time"
@@ -28,41 +29,61 @@ type mockAssetUtils struct {
   mock.Mock
 }
 
-func (m *mockAssetUtils) AddAsset(asset *risk_assessment.Asset) (error) {
+func (m *mockAssetUtils) AddAsset(ctx context.Context, asset *risk_assessment.Asset) (error) {
   args := m.Called(asset)
   return args.Error(0)
 }
 
-func (m *mockAssetUtils) GetAssetByID(id primitive.ObjectID) (risk_assessment.Asset, error) {
+func (m *mockAssetUtils) GetAssetByID(ctx context.Context, id primitive.ObjectID) (risk_assessment.Asset, error) {
   args := m.Called(id)
   return args.Get(0).(risk_assessment.Asset), args.Error(1)
 }
 
-func (m *mockAssetUtils) GetAssetsByScopeID(id primitive.ObjectID) ([]risk_assessment.Asset, error) {
+func (m *mockAssetUtils) AddAssets(ctx context.Context, assets []risk_assessment.Asset) (error) {
+  args := m.Called(assets)
+  return args.Error(0)
+}
+
+func (m *mockAssetUtils) GetAssetsByScopeID(ctx context.Context, id primitive.ObjectID) ([]risk_assessment.Asset, error) {
   args := m.Called(id)
   return args.Get(0).([]risk_assessment.Asset), args.Error(1)
 }
 
-func (m *mockAssetUtils) GetAssets(offset int64, amount int64) ([]risk_assessment.Asset, error) {
+func (m *mockAssetUtils) GetAssets(ctx context.Context, offset int64, amount int64) ([]risk_assessment.Asset, error) {
   args := m.Called(offset, amount)
   return args.Get(0).([]risk_assessment.Asset), args.Error(1)
 }
 
-func (m *mockAssetUtils) SetAssetValue(id string, c uint, i uint, a uint) (error) {
+func (m *mockAssetUtils) QueryAssets(ctx context.Context, query *risk_assessment.AssetQuery) (risk_assessment.AssetList, error) {
+  args := m.Called(query)
+  return args.Get(0).(risk_assessment.AssetList), args.Error(1)
+}
+
+func (m *mockAssetUtils) SetAssetValue(ctx context.Context, id string, c uint, i uint, a uint) (error) {
   args := m.Called(id, c, i, a)
   return args.Error(0)
 }
 
-func (m *mockAssetUtils) UpdateAsset(asset *risk_assessment.Asset) (error) {
+func (m *mockAssetUtils) UpdateAsset(ctx context.Context, asset *risk_assessment.Asset) (error) {
   args := m.Called(asset)
   return args.Error(0)
 }
 
-func (m *mockAssetUtils) DeleteAsset(id primitive.ObjectID) (error) {
+func (m *mockAssetUtils) DeleteAsset(ctx context.Context, id primitive.ObjectID) (error) {
   args := m.Called(id)
   return args.Error(0)
 }
 
+func (m *mockAssetUtils) PutAsset(ctx context.Context, asset *risk_assessment.Asset) (error) {
+  args := m.Called(asset)
+  return args.Error(0)
+}
+
+func (m *mockAssetUtils) ReplaceAsset(ctx context.Context, old *risk_assessment.Asset, asset *risk_assessment.Asset) (error) {
+  args := m.Called(old, asset)
+  return args.Error(0)
+}
+
 func TestGetAssets(t *testing.T) {
   auth_util_mck := new(mockUserUtils)
   csrf_util_mck := new(mockCsrtUtils)
@@ -86,7 +107,10 @@ func TestGetAssets(t *testing.T) {
     },
   }
   auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
-  ast_util_mck.On("GetAssetsByScopeID", mock.Anything).Return(mockAssets, nil)
+  /* The first page without the query string */
+  ast_util_mck.On("QueryAssets", &risk_assessment.AssetQuery{
+    Scope: scopeID, Sort: "createtime", Offset: 0, Limit: DEFAULT_ASSET_PAGE_SIZE,
+  }).Return(risk_assessment.AssetList{Total: 120, Assets: mockAssets}, nil)
   ap := AssetsApp{User_utils: auth_util_mck, Csrf_utils: csrf_util_mck, Asset_utils: ast_util_mck}
 
   req := httptest.NewRequest("Get", "/", bytes.NewBufferString(""))
@@ -104,6 +128,7 @@ func TestGetAssets(t *testing.T) {
   json.Unmarshal(w.Body.Bytes(), &asset_page)
   assert.Equal(t, http.StatusOK, w.Code)
   assert.Equal(t, mockAssets, asset_page.Assets)
+  assert.Equal(t, int64(120), asset_page.Total)
 }
 
 func TestGetAssetsAuthorizeFailed1(t *testing.T) {
@@ -156,9 +181,8 @@ func TestGetAssetsFailed1(t *testing.T) {
   auth_util_mck := new(mockUserUtils)
   csrf_util_mck := new(mockCsrtUtils)
   ast_util_mck := new(mockAssetUtils)
-  mockAssets := []risk_assessment.Asset {}
   err := errors.New("Get failed")
-  ast_util_mck.On("GetAssetsByScopeID", mock.Anything).Return(mockAssets, err)
+  ast_util_mck.On("QueryAssets", mock.Anything).Return(risk_assessment.AssetList{}, err)
   ap := AssetsApp{User_utils: auth_util_mck, Csrf_utils: csrf_util_mck, Asset_utils: ast_util_mck}
 
   req := httptest.NewRequest("Get", "/", bytes.NewBufferString(""))
@@ -178,12 +202,11 @@ func TestGetAssetsFailed2(t *testing.T) {
   auth_util_mck := new(mockUserUtils)
   csrf_util_mck := new(mockCsrtUtils)
   ast_util_mck := new(mockAssetUtils)
-  mockAssets := []risk_assessment.Asset {}
   userID := primitive.NewObjectID()
   scopeID := primitive.NewObjectID()
   err := errors.New("Get failed")
   auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
-  ast_util_mck.On("GetAssetsByScopeID", mock.Anything).Return(mockAssets, err)
+  ast_util_mck.On("QueryAssets", mock.Anything).Return(risk_assessment.AssetList{}, err)
   ap := AssetsApp{User_utils: auth_util_mck, Csrf_utils: csrf_util_mck, Asset_utils: ast_util_mck}
 
   req := httptest.NewRequest("Get", "/", bytes.NewBufferString(""))
@@ -201,6 +224,86 @@ func TestGetAssetsFailed2(t *testing.T) {
   assert.Nil(t, w.Body.Bytes())
 }
 
+func getAssetsQuery(ap *AssetsApp, userID primitive.ObjectID, scopeID primitive.ObjectID, target string) *httptest.ResponseRecorder {
+  req := httptest.NewRequest("GET", target, nil)
+  c, w, session := GetMockContext(req)
+
+  session.Set("id", userID.Hex())
+  session.Set("role", uint(0))
+  session.Save()
+
+  c.Params = append(c.Params, gin.Param{Key: "scopeID", Value: scopeID.Hex()})
+
+  ap.GetAssets(c)
+  return w
+}
+
+func TestGetAssetsQuery(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  ast_util_mck := new(mockAssetUtils)
+  userID := primitive.NewObjectID()
+  scopeID := primitive.NewObjectID()
+  levels := risk_assessment.RiskLevels{Medium: 10, High: 20}
+  mockAssets := []risk_assessment.Asset {
+    {ID: primitive.NewObjectID(), Scope: scopeID, BigCategory: "Hardware", Name: "Test asset3"},
+  }
+  auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
+  scope_util_mck.On("GetScopeByID", scopeID).Return(risk_assessment.Scope{ID: scopeID, Levels: levels}, nil)
+  ast_util_mck.On("QueryAssets", &risk_assessment.AssetQuery{
+    Scope: scopeID, BigCategory: "Hardware", Owner: "alice", MinValue: 6, MaxValue: 9, Level: "high", Levels: levels,
+    Sort: "score", Descending: true, Offset: 40, Limit: 20,
+  }).Return(risk_assessment.AssetList{Total: 41, Assets: mockAssets}, nil)
+  ast_util_mck.On("QueryAssets", &risk_assessment.AssetQuery{
+    Scope: scopeID, NoRisks: true, Sort: "createtime", Offset: 0, Limit: DEFAULT_ASSET_PAGE_SIZE,
+  }).Return(risk_assessment.AssetList{Total: 1, Assets: mockAssets}, nil)
+  ap := AssetsApp{User_utils: auth_util_mck, Csrf_utils: new(mockCsrtUtils), Asset_utils: ast_util_mck, Scope_utils: scope_util_mck}
+
+  w := getAssetsQuery(&ap, userID, scopeID,
+                      "/?page=3&size=20&bigcategory=Hardware&owner=alice&minvalue=6&maxvalue=9&level=high&sort=score&order=desc")
+  assert.Equal(t, http.StatusOK, w.Code)
+  var asset_page AssetPage
+  json.Unmarshal(w.Body.Bytes(), &asset_page)
+  assert.Equal(t, int64(41), asset_page.Total)
+  assert.Equal(t, mockAssets, asset_page.Assets)
+
+  /* The scope is loaded only for the level */
+  w = getAssetsQuery(&ap, userID, scopeID, "/?norisks=true")
+  assert.Equal(t, http.StatusOK, w.Code)
+  scope_util_mck.AssertNumberOfCalls(t, "GetScopeByID", 1)
+}
+
+func TestGetAssetsQueryBadReq(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  userID := primitive.NewObjectID()
+  scopeID := primitive.NewObjectID()
+  auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
+  ap := AssetsApp{User_utils: auth_util_mck, Csrf_utils: new(mockCsrtUtils), Asset_utils: new(mockAssetUtils)}
+
+  for _, target := range []string{
+    "/?page=0", "/?page=x", "/?size=0", "/?size=501",
+    "/?page=9223372036854775807", "/?page=18446744073709553&size=500",
+    "/?minvalue=2", "/?maxvalue=13", "/?minvalue=9&maxvalue=6",
+    "/?level=critical", "/?norisks=maybe", "/?sort=owner", "/?order=up",
+  } {
+    w := getAssetsQuery(&ap, userID, scopeID, target)
+    assert.Equal(t, http.StatusBadRequest, w.Code, target)
+  }
+}
+
+func TestGetAssetsQueryFailed(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  ast_util_mck := new(mockAssetUtils)
+  userID := primitive.NewObjectID()
+  scopeID := primitive.NewObjectID()
+  auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
+  ast_util_mck.On("QueryAssets", mock.Anything).Return(risk_assessment.AssetList{}, errors.New("Query failed"))
+  ap := AssetsApp{User_utils: auth_util_mck, Csrf_utils: new(mockCsrtUtils), Asset_utils: ast_util_mck}
+
+  w := getAssetsQuery(&ap, userID, scopeID, "/?page=1")
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
 func TestAddAsset(t *testing.T) {
   auth_util_mck := new(mockUserUtils)
   mck := new(mockAssetUtils)
@@ -723,3 +826,107 @@ func TestDeleteAssetFailed(t *testing.T) {
 
   assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
+
+const testAssetsCSV = "BigCategory,SmallCategory,Name,C,I,A,Threat,Possibility,Impact\n" +
+                      "Hardware,Server,web,1,2,3,Fire,1,2\n"
+
+func TestImportAssets(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  mck := new(mockAssetUtils)
+  userID := primitive.NewObjectID()
+  scopeID := primitive.NewObjectID()
+  auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
+  mck.On("GetAssetsByScopeID", scopeID).Return([]risk_assessment.Asset{}, nil)
+  mck.On("AddAssets", mock.Anything).Return(nil)
+  ap := AssetsApp{User_utils: auth_util_mck, Asset_utils: mck}
+
+  /* The dry run adds nothing */
+  req := httptest.NewRequest("POST", "/?dry_run=true", bytes.NewBufferString(testAssetsCSV))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Save()
+  c.Params = append(c.Params, gin.Param{Key: "scopeID", Value: scopeID.Hex()})
+
+  ap.ImportAssets(c)
+
+  var report risk_assessment.CSVReport
+  json.Unmarshal(w.Body.Bytes(), &report)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, 1, report.Assets)
+  assert.False(t, report.Imported)
+  mck.AssertNotCalled(t, "AddAssets", mock.Anything)
+
+  req = httptest.NewRequest("POST", "/", bytes.NewBufferString(testAssetsCSV))
+  c, w, session = GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Save()
+  c.Params = append(c.Params, gin.Param{Key: "scopeID", Value: scopeID.Hex()})
+
+  ap.ImportAssets(c)
+
+  json.Unmarshal(w.Body.Bytes(), &report)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.True(t, report.Imported)
+  mck.AssertCalled(t, "AddAssets", mock.MatchedBy(func(assets []risk_assessment.Asset) bool {
+    return len(assets) == 1 && assets[0].Scope == scopeID && assets[0].Name == "web" && len(assets[0].Risks) == 1
+  }))
+  mck.AssertNotCalled(t, "AddAsset", mock.Anything)
+}
+
+func TestImportAssetsInvalid(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  mck := new(mockAssetUtils)
+  userID := primitive.NewObjectID()
+  scopeID := primitive.NewObjectID()
+  auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(true, nil)
+  mck.On("GetAssetsByScopeID", scopeID).Return([]risk_assessment.Asset{{Name: "web"}}, nil)
+  ap := AssetsApp{User_utils: auth_util_mck, Asset_utils: mck}
+
+  /* The name is the same as the stored asset's */
+  req := httptest.NewRequest("POST", "/", bytes.NewBufferString(testAssetsCSV))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Save()
+  c.Params = append(c.Params, gin.Param{Key: "scopeID", Value: scopeID.Hex()})
+
+  ap.ImportAssets(c)
+
+  var report risk_assessment.CSVReport
+  json.Unmarshal(w.Body.Bytes(), &report)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  assert.True(t, report.Invalid())
+  assert.False(t, report.Imported)
+  mck.AssertNotCalled(t, "AddAssets", mock.Anything)
+
+  /* Not a CSV of the assets */
+  req = httptest.NewRequest("POST", "/", bytes.NewBufferString("foo,bar\n"))
+  c, w, session = GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Save()
+  c.Params = append(c.Params, gin.Param{Key: "scopeID", Value: scopeID.Hex()})
+
+  ap.ImportAssets(c)
+
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  assert.Contains(t, w.Body.String(), "missing column")
+}
+
+func TestImportAssetsAuthorizeFailed(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  mck := new(mockAssetUtils)
+  userID := primitive.NewObjectID()
+  scopeID := primitive.NewObjectID()
+  auth_util_mck.On("UserHasScopeID", userID, scopeID).Return(false, nil)
+  ap := AssetsApp{User_utils: auth_util_mck, Asset_utils: mck}
+
+  req := httptest.NewRequest("POST", "/", bytes.NewBufferString(testAssetsCSV))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Save()
+  c.Params = append(c.Params, gin.Param{Key: "scopeID", Value: scopeID.Hex()})
+
+  ap.ImportAssets(c)
+
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  mck.AssertNotCalled(t, "GetAssetsByScopeID", mock.Anything)
+}
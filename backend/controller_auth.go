@@ -1,13 +1,10 @@
 package main
 
 import (
-  "encoding/hex"
   "net/http"
-  "crypto/sha256"
   "strings"
 
   "github.com/gin-gonic/gin"
-  "github.com/gin-contrib/sessions"
 
   "go.mongodb.org/mongo-driver/bson/primitive"
 
@@ -27,6 +24,9 @@ type IAuthApp interface {
 type AuthApp struct {
   User_utils auth.IUserUtils
   Csrf_utils middleware.ICSRFUtils
+  Session_utils auth.ISessionUtils
+  /* Only the first Administrator could register, if it is closed */
+  Closed_registration bool
 }
 
 func (ap *AuthApp) GetLogin(c *gin.Context) {
@@ -43,27 +43,27 @@ func (ap *AuthApp) DoLogin(c *gin.Context) {
     return
   }
 
-  pwd := sha256.Sum256([]byte(passwd))
-  password := hex.EncodeToString(pwd[:])
-  user, err := ap.User_utils.GetUserByAccountPwd(account, password)
+  password := auth.HashPassword(passwd)
+  user, err := ap.User_utils.GetUserByAccountPwd(c.Request.Context(), account, password)
   if (err != nil) {
     c.String(http.StatusForbidden, "Wrong account or password")
     return
+  } else if (user.Disabled) {
+    c.String(http.StatusForbidden, "Account disabled")
+    return
   }
 
-  session := sessions.Default(c)
-  session.Set("id", user.ID.Hex())
-  session.Set("role", user.Role)
-  session.Save()
+  err = startSession(c, ap.Session_utils, &user)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
 
   c.Status(http.StatusOK)
 }
 
 func (ap *AuthApp) Logout(c *gin.Context) {
-  session := sessions.Default(c)
-  session.Clear()
-  session.Options(sessions.Options{Path: "/", MaxAge: -1})
-  session.Save()
+  endSession(c, ap.Session_utils)
   c.Redirect(http.StatusFound, "/")
 }
 
@@ -79,12 +79,16 @@ func (ap *AuthApp) AddUser(c *gin.Context) {
   }
 
   user.Account = account
-  pwd := sha256.Sum256([]byte(passwd))
-  user.Password = hex.EncodeToString(pwd[:])
+  user.Password = auth.HashPassword(passwd)
 
-  has, err := ap.User_utils.HasUser()
+  has, err := ap.User_utils.HasUser(c.Request.Context())
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  if (has && ap.Closed_registration) {
+    c.String(http.StatusForbidden, "Registration is closed")
     return
   }
 
@@ -93,9 +97,12 @@ func (ap *AuthApp) AddUser(c *gin.Context) {
     user.Role = auth.Administrator
   }
 
-  _, err = ap.User_utils.AddUser(&user)
-  if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+  _, err = ap.User_utils.AddUser(c.Request.Context(), &user)
+  if (err == auth.ErrAccountExists) {
+    c.String(http.StatusConflict, "Account exists")
+    return
+  } else if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -106,6 +113,7 @@ type ReducedUser struct {
   ID primitive.ObjectID `bson:"_id"`
   Account string
   Role uint
+  Disabled bool
   Scopes []primitive.ObjectID
 }
 
@@ -116,7 +124,7 @@ func (ap *AuthApp) GetUser_By_Account(c *gin.Context) {
     return
   }
 
-  user, err := ap.User_utils.GetUserByAccount(account)
+  user, err := ap.User_utils.GetUserByAccount(c.Request.Context(), account)
   if (err != nil) {
     c.AbortWithStatus(http.StatusBadRequest)
     return
@@ -126,6 +134,7 @@ func (ap *AuthApp) GetUser_By_Account(c *gin.Context) {
   reduced_user.ID = user.ID
   reduced_user.Account = user.Account
   reduced_user.Role = user.Role
+  reduced_user.Disabled = user.Disabled
   reduced_user.Scopes = user.Scopes
 
   c.JSON(http.StatusOK, reduced_user)
@@ -139,19 +148,29 @@ func (ap *AuthApp) UpdateUser_Scopes(c *gin.Context) {
     return
   }
 
-  user, err := ap.User_utils.GetUserByID(reduced_user.ID)
+  user, err := ap.User_utils.GetUserByID(c.Request.Context(), reduced_user.ID)
   if (err != nil) {
     c.AbortWithStatus(http.StatusBadRequest)
     return
   }
 
   user.Role = reduced_user.Role
+  user.Disabled = reduced_user.Disabled
   user.Scopes = reduced_user.Scopes
-  err = ap.User_utils.UpdateUser(&user)
+  err = ap.User_utils.UpdateUser(c.Request.Context(), &user)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
+  /* A disabled user must not keep any logged in session */
+  if (user.Disabled) {
+    _, err = ap.Session_utils.DeleteSessionsByUserID(c.Request.Context(), user.ID)
+    if (err != nil) {
+      c.AbortWithError(http.StatusInternalServerError, err)
+      return
+    }
+  }
+
   c.Status(http.StatusOK)
 }
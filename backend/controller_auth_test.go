@@ -2,6 +2,7 @@ package main
 
 import (
   "bytes"
+  "context"
   "encoding/json"
   "errors"
   "net/http"
@@ -21,37 +22,47 @@ type mockUserUtils struct {
   mock.Mock
 }
 
-func (m *mockUserUtils) AddUser(user *auth.User) (primitive.ObjectID, error) {
+func (m *mockUserUtils) AddUser(ctx context.Context, user *auth.User) (primitive.ObjectID, error) {
   args := m.Called(user)
   return args.Get(0).(primitive.ObjectID), args.Error(1)
 }
 
-func (m *mockUserUtils) GetUserByID(id primitive.ObjectID) (auth.User, error) {
+func (m *mockUserUtils) GetUserByID(ctx context.Context, id primitive.ObjectID) (auth.User, error) {
   args := m.Called(id)
   return args.Get(0).(auth.User), args.Error(1)
 }
 
-func (m *mockUserUtils) GetUserByAccount(account string) (auth.User, error) {
+func (m *mockUserUtils) GetUserByAccount(ctx context.Context, account string) (auth.User, error) {
   args := m.Called(account)
   return args.Get(0).(auth.User), args.Error(1)
 }
 
-func (m *mockUserUtils) GetUserByAccountPwd(account string, password string) (auth.User, error) {
+func (m *mockUserUtils) GetUserByAccountPwd(ctx context.Context, account string, password string) (auth.User, error) {
   args := m.Called(account, password)
   return args.Get(0).(auth.User), args.Error(1)
 }
 
-func (m *mockUserUtils) HasUser() (bool, error){
+func (m *mockUserUtils) GetUsers(ctx context.Context) ([]auth.User, error) {
+  args := m.Called()
+  return args.Get(0).([]auth.User), args.Error(1)
+}
+
+func (m *mockUserUtils) HasUser(ctx context.Context) (bool, error){
   args := m.Called()
   return args.Get(0).(bool), args.Error(1)
 }
 
-func (m *mockUserUtils) UserHasScopeID(u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error) {
+func (m *mockUserUtils) UserHasScopeID(ctx context.Context, u_id primitive.ObjectID, s_id primitive.ObjectID) (bool, error) {
   args := m.Called(u_id, s_id)
   return args.Get(0).(bool), args.Error(1)
 }
 
-func (m *mockUserUtils) UpdateUser(user *auth.User) (error){
+func (m *mockUserUtils) UpdateUser(ctx context.Context, user *auth.User) (error){
+  args := m.Called(user)
+  return args.Error(0)
+}
+
+func (m *mockUserUtils) PutUser(ctx context.Context, user *auth.User) (error){
   args := m.Called(user)
   return args.Error(0)
 }
@@ -110,11 +121,12 @@ func TestDoLoginWronPwd(t *testing.T) {
   assert.Equal(t, "Wrong account or password", w.Body.String())
 }
 
-func TestDoLogin(t *testing.T) {
+func TestDoLoginDisabled(t *testing.T) {
   auth_utils_mck := new(mockUserUtils)
   mockUser := auth.User{
     ID: primitive.NewObjectID(),
     Role: auth.NormalUser,
+    Disabled: true,
   }
   auth_utils_mck.On("GetUserByAccountPwd", mock.Anything, mock.Anything).Return(mockUser, nil)
   ap := AuthApp{User_utils: auth_utils_mck}
@@ -130,20 +142,53 @@ func TestDoLogin(t *testing.T) {
 
   ap.DoLogin(c)
 
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  assert.Equal(t, "Account disabled", w.Body.String())
+}
+
+func TestDoLogin(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  mockUser := auth.User{
+    ID: primitive.NewObjectID(),
+    Role: auth.NormalUser,
+  }
+  auth_utils_mck.On("GetUserByAccountPwd", mock.Anything, mock.Anything).Return(mockUser, nil)
+  session_utils_mck := new(mockSessionUtils)
+  session_utils_mck.On("AddSession", mock.Anything).Return(primitive.NewObjectID(), nil)
+  ap := AuthApp{User_utils: auth_utils_mck, Session_utils: session_utils_mck}
+
+  data := url.Values{}
+  data.Set("account", "foo")
+  data.Set("passwd", "bar")
+  data.Set("_csrf", "csrf=")
+
+  req, _ := http.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+  req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  c, w, _ := GetMockContext(req)
+
+  ap.DoLogin(c)
+
   assert.Equal(t, http.StatusOK, w.Code)
+  info := session_utils_mck.Calls[0].Arguments.Get(0).(*auth.SessionInfo)
+  assert.Equal(t, mockUser.ID, info.User)
 }
 
 func TestLogout(t *testing.T) {
   auth_utils_mck := new(mockUserUtils)
-  ap := AuthApp{User_utils: auth_utils_mck}
+  session_utils_mck := new(mockSessionUtils)
+  sessionID := primitive.NewObjectID()
+  session_utils_mck.On("DeleteSession", sessionID).Return(nil)
+  ap := AuthApp{User_utils: auth_utils_mck, Session_utils: session_utils_mck}
 
   req, _ := http.NewRequest("GET", "/", bytes.NewBufferString(""))
-  c, w, _ := GetMockContext(req)
+  c, w, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
 
   ap.Logout(c)
 
   assert.Equal(t, http.StatusFound, w.Code)
   assert.Equal(t, "/", w.Header().Get("Location"))
+  session_utils_mck.AssertCalled(t, "DeleteSession", sessionID)
 }
 
 func TestAddUserNoPwd(t *testing.T) {
@@ -209,6 +254,46 @@ func TestAddUserFailed(t *testing.T) {
   assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestAddUserExists(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  auth_utils_mck.On("HasUser", mock.Anything, mock.Anything).Return(true, nil)
+  auth_utils_mck.On("AddUser", mock.Anything, mock.Anything).Return(primitive.NilObjectID, auth.ErrAccountExists)
+  ap := AuthApp{User_utils: auth_utils_mck}
+
+  data := url.Values{}
+  data.Set("account", "foo")
+  data.Set("passwd", "bar")
+  data.Set("_csrf", "csrf=")
+
+  req, _ := http.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+  req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  c, w, _ := GetMockContext(req)
+
+  ap.AddUser(c)
+
+  assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestAddUserClosedRegistration(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  auth_utils_mck.On("HasUser", mock.Anything, mock.Anything).Return(true, nil)
+  ap := AuthApp{User_utils: auth_utils_mck, Closed_registration: true}
+
+  data := url.Values{}
+  data.Set("account", "foo")
+  data.Set("passwd", "bar")
+  data.Set("_csrf", "csrf=")
+
+  req, _ := http.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+  req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  c, w, _ := GetMockContext(req)
+
+  ap.AddUser(c)
+
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  auth_utils_mck.AssertNotCalled(t, "AddUser", mock.Anything)
+}
+
 func TestAddUser(t *testing.T) {
   auth_utils_mck := new(mockUserUtils)
   auth_utils_mck.On("HasUser", mock.Anything, mock.Anything).Return(false, nil)
@@ -392,3 +477,35 @@ func TestUpdateUser_Scopes(t *testing.T) {
 
   assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestUpdateUser_ScopesDisable(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  session_utils_mck := new(mockSessionUtils)
+  mockUser := auth.User {
+    ID: primitive.NewObjectID(),
+    Account: "foo",
+    Scopes: []primitive.ObjectID{},
+  }
+  auth_utils_mck.On("GetUserByID", mock.Anything).Return(mockUser, nil)
+  auth_utils_mck.On("UpdateUser", mock.Anything).Return(nil)
+  session_utils_mck.On("DeleteSessionsByUserID", mockUser.ID).Return(int64(1), nil)
+  ap := AuthApp{User_utils: auth_utils_mck, Session_utils: session_utils_mck}
+
+  testUser := ReducedUser {
+    ID: mockUser.ID,
+    Disabled: true,
+    Scopes: []primitive.ObjectID{},
+  }
+  json_bytes, _ := json.Marshal(testUser)
+  json_buf := bytes.NewBuffer(json_bytes)
+
+  req, _ := http.NewRequest("POST", "/", json_buf)
+  c, w, _ := GetMockContext(req)
+
+  ap.UpdateUser_Scopes(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  updated := auth_utils_mck.Calls[1].Arguments.Get(0).(*auth.User)
+  assert.True(t, updated.Disabled)
+  session_utils_mck.AssertCalled(t, "DeleteSessionsByUserID", mockUser.ID)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+  "net/http"
+  "strconv"
+
+  "github.com/gin-gonic/gin"
+
+  "github.com/starnight/riskassessment/backend/backup"
+)
+
+type IBackupApp interface {
+  GetBackup(c *gin.Context)
+  Restore(c *gin.Context)
+}
+
+type BackupApp struct {
+  Storage *backup.Storage
+}
+
+/* The largest backup archive which could be uploaded */
+const MAX_BACKUP_SIZE = 256 << 20
+
+/* Download the backup, without the password hashes for ?passwords=false */
+func (ap *BackupApp) GetBackup(c *gin.Context) {
+  passwords, err := strconv.ParseBool(c.DefaultQuery("passwords", "true"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  archive, err := backup.Dump(c.Request.Context(), ap.Storage, passwords)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  name := "riskassessment-" + archive.Manifest.CreateTime.Format("20060102T150405Z") + ".tar.gz"
+  c.Header("Content-Disposition", `attachment; filename="` + name + `"`)
+  c.Header("Content-Type", "application/gzip")
+  c.Status(http.StatusOK)
+  if err := archive.Write(c.Writer); err != nil {
+    c.Error(err)
+  }
+}
+
+/*
+ * Restore the uploaded backup with ?mode=merge, which is the default, or
+ * ?mode=full.  A full restore deletes all the sessions, including the
+ * caller's, and needs the password hashes, or no one could log in.
+ */
+func (ap *BackupApp) Restore(c *gin.Context) {
+  mode := c.DefaultQuery("mode", backup.MergeRestore)
+  if (mode != backup.MergeRestore && mode != backup.FullRestore) {
+    c.String(http.StatusBadRequest, "Unknown restore mode")
+    return
+  }
+
+  archive, err := backup.Read(http.MaxBytesReader(c.Writer, c.Request.Body, MAX_BACKUP_SIZE))
+  if (err != nil) {
+    c.String(http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if (mode == backup.FullRestore && !archive.Manifest.Passwords) {
+    c.String(http.StatusBadRequest, "A full restore needs the password hashes")
+    return
+  }
+
+  report, err := backup.Restore(c.Request.Context(), ap.Storage, archive, mode)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/backup"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/* The mocked utils, and the templates and trends in an embedded database */
+func mockBackupStorage(t *testing.T) (*backup.Storage, *mockUserUtils, *mockScopeUtils, *mockAssetUtils) {
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "backup.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  storage := &backup.Storage{
+    User_utils: auth_util_mck,
+    Scope_utils: scope_util_mck,
+    Asset_utils: asset_util_mck,
+    Template_utils: &report.BoltTemplateUtils{DB: db},
+    Trend_utils: &risk_assessment.BoltTrendUtils{DB: db},
+    Clear: func(ctx context.Context) error { return nil },
+  }
+  return storage, auth_util_mck, scope_util_mck, asset_util_mck
+}
+
+func mockBackupArchive(t *testing.T, passwords bool) *bytes.Buffer {
+  storage, auth_util_mck, scope_util_mck, asset_util_mck := mockBackupStorage(t)
+  users := []auth.User{{ID: primitive.NewObjectID(), Account: "alice", Password: auth.HashPassword("pw")}}
+  auth_util_mck.On("GetUsers").Return(users, nil)
+  scope_util_mck.On("GetScopes").Return([]risk_assessment.Scope{{ID: primitive.NewObjectID(), Name: "foo"}}, nil)
+  asset_util_mck.On("GetAssets", int64(0), int64(0)).Return([]risk_assessment.Asset{}, nil)
+
+  archive, err := backup.Dump(context.TODO(), storage, passwords)
+  assert.Nil(t, err)
+
+  var buf bytes.Buffer
+  assert.Nil(t, archive.Write(&buf))
+  return &buf
+}
+
+func TestGetBackup(t *testing.T) {
+  storage, auth_util_mck, scope_util_mck, asset_util_mck := mockBackupStorage(t)
+  users := []auth.User{{ID: primitive.NewObjectID(), Account: "alice", Password: auth.HashPassword("pw")}}
+  auth_util_mck.On("GetUsers").Return(users, nil)
+  scope_util_mck.On("GetScopes").Return([]risk_assessment.Scope{}, nil)
+  asset_util_mck.On("GetAssets", int64(0), int64(0)).Return([]risk_assessment.Asset{}, nil)
+  ap := BackupApp{Storage: storage}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/?passwords=false", nil)
+  c, w, _ := GetMockContext(req)
+
+  ap.GetBackup(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+  assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment; filename=\"riskassessment-")
+
+  archive, err := backup.Read(w.Body)
+  assert.Nil(t, err)
+  assert.False(t, archive.Manifest.Passwords)
+  assert.Equal(t, "alice", archive.Users[0].Account)
+  assert.Equal(t, "", archive.Users[0].Password)
+}
+
+func TestGetBackupFailed(t *testing.T) {
+  storage, _, scope_util_mck, _ := mockBackupStorage(t)
+  scope_util_mck.On("GetScopes").Return([]risk_assessment.Scope{}, errors.New("Get failed"))
+  ap := BackupApp{Storage: storage}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, _ := GetMockContext(req)
+
+  ap.GetBackup(c)
+
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+  req = httptest.NewRequest("GET", "/?passwords=foo", nil)
+  c, w, _ = GetMockContext(req)
+
+  ap.GetBackup(c)
+
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRestore(t *testing.T) {
+  storage, auth_util_mck, scope_util_mck, asset_util_mck := mockBackupStorage(t)
+  auth_util_mck.On("GetUsers").Return([]auth.User{}, nil)
+  auth_util_mck.On("PutUser", mock.Anything).Return(nil)
+  scope_util_mck.On("PutScope", mock.Anything).Return(nil)
+  ap := BackupApp{Storage: storage}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("POST", "/?mode=merge", mockBackupArchive(t, true))
+  c, w, _ := GetMockContext(req)
+
+  ap.Restore(c)
+
+  var result backup.Report
+  json.Unmarshal(w.Body.Bytes(), &result)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, 1, result.Users)
+  assert.Equal(t, 1, result.Scopes)
+  asset_util_mck.AssertNotCalled(t, "PutAsset", mock.Anything)
+}
+
+func TestRestoreFailed(t *testing.T) {
+  storage, _, _, _ := mockBackupStorage(t)
+  ap := BackupApp{Storage: storage}
+
+  gin.SetMode(gin.TestMode)
+
+  /* Not an archive */
+  req := httptest.NewRequest("POST", "/", bytes.NewBufferString("foo"))
+  c, w, _ := GetMockContext(req)
+  ap.Restore(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  /* Unknown mode */
+  req = httptest.NewRequest("POST", "/?mode=foo", mockBackupArchive(t, true))
+  c, w, _ = GetMockContext(req)
+  ap.Restore(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  /* No one could log in after the full restore */
+  req = httptest.NewRequest("POST", "/?mode=full", mockBackupArchive(t, false))
+  c, w, _ = GetMockContext(req)
+  ap.Restore(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  assert.Equal(t, "A full restore needs the password hashes", w.Body.String())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type IBundleApp interface {
+  ExportScope(c *gin.Context)
+  ImportScope(c *gin.Context)
+}
+
+type BundleApp struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+}
+
+/* The largest scope bundle which could be uploaded */
+const MAX_BUNDLE_SIZE = 32 << 20
+
+/* Why the bundle is not imported, with the problems of each invalid asset */
+type ImportErrors struct {
+  Error string
+  Assets []risk_assessment.AssetProblems
+}
+
+/* Download the scope with its assets, if the user has the scope */
+func (ap *BundleApp) ExportScope(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  bundle, err := risk_assessment.ExportScope(c.Request.Context(), ap.Scope_utils, ap.Asset_utils, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.Header("Content-Disposition", `attachment; filename="scope-` + s_id.Hex() + `.json"`)
+  c.JSON(http.StatusOK, bundle)
+}
+
+/* Create a new scope from the uploaded bundle, unless any of it is invalid */
+func (ap *BundleApp) ImportScope(c *gin.Context) {
+  var bundle risk_assessment.ScopeBundle
+
+  body := http.MaxBytesReader(c.Writer, c.Request.Body, MAX_BUNDLE_SIZE)
+  if err := json.NewDecoder(body).Decode(&bundle); (err != nil) {
+    c.JSON(http.StatusBadRequest, ImportErrors{Error: err.Error(), Assets: []risk_assessment.AssetProblems{}})
+    return
+  }
+
+  invalid, err := bundle.Validate()
+  if (err != nil) {
+    c.JSON(http.StatusBadRequest, ImportErrors{Error: err.Error(), Assets: []risk_assessment.AssetProblems{}})
+    return
+  } else if (len(invalid) > 0) {
+    c.JSON(http.StatusBadRequest, ImportErrors{Error: "invalid assets", Assets: invalid})
+    return
+  }
+
+  result, err := risk_assessment.ImportScope(c.Request.Context(), ap.Scope_utils, ap.Asset_utils, &bundle)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.JSON(http.StatusOK, result)
+}
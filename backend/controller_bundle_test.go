@@ -0,0 +1,191 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func TestExportScope(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+  scope := risk_assessment.Scope{ID: primitive.NewObjectID(), Name: "foo"}
+  assets := []risk_assessment.Asset{{ID: primitive.NewObjectID(), Scope: scope.ID, Name: "bar"}}
+  auth_util_mck.On("UserHasScopeID", mock.Anything, scope.ID).Return(true, nil)
+  scope_util_mck.On("GetScopeByID", scope.ID).Return(scope, nil)
+  asset_util_mck.On("GetAssetsByScopeID", scope.ID).Return(assets, nil)
+  ap := BundleApp{User_utils: auth_util_mck, Scope_utils: scope_util_mck, Asset_utils: asset_util_mck}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}}
+
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.ExportScope(c)
+
+  var bundle risk_assessment.ScopeBundle
+  json.Unmarshal(w.Body.Bytes(), &bundle)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, `attachment; filename="scope-` + scope.ID.Hex() + `.json"`, w.Header().Get("Content-Disposition"))
+  assert.Equal(t, risk_assessment.BUNDLE_FORMAT, bundle.Format)
+  assert.Equal(t, scope, bundle.Scope)
+  assert.Equal(t, assets[0].ID, bundle.Assets[0].ID)
+}
+
+func TestExportScopeForbidden(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  auth_util_mck.On("UserHasScopeID", mock.Anything, mock.Anything).Return(false, nil)
+  ap := BundleApp{User_utils: auth_util_mck, Scope_utils: scope_util_mck, Asset_utils: new(mockAssetUtils)}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: primitive.NewObjectID().Hex()}}
+
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.ExportScope(c)
+
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  scope_util_mck.AssertNotCalled(t, "GetScopeByID", mock.Anything)
+}
+
+func importBundle(ap *BundleApp, bundle any) *httptest.ResponseRecorder {
+  body, _ := json.Marshal(bundle)
+  req := httptest.NewRequest("POST", "/", bytes.NewBuffer(body))
+  c, w, _ := GetMockContext(req)
+  ap.ImportScope(c)
+  return w
+}
+
+func TestImportScope(t *testing.T) {
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+  s_id := primitive.NewObjectID()
+  scope_util_mck.On("AddScope", mock.Anything).Return(s_id, nil)
+  asset_util_mck.On("AddAssets", mock.Anything).Return(nil)
+  ap := BundleApp{User_utils: new(mockUserUtils), Scope_utils: scope_util_mck, Asset_utils: asset_util_mck}
+
+  asset := risk_assessment.Asset{
+    ID: primitive.NewObjectID(),
+    Scope: primitive.NewObjectID(),
+    Name: "bar",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+  }
+  bundle := risk_assessment.ScopeBundle{
+    Format: risk_assessment.BUNDLE_FORMAT,
+    Version: risk_assessment.BUNDLE_VERSION,
+    Scope: risk_assessment.Scope{ID: asset.Scope, Name: "foo"},
+    Assets: []risk_assessment.Asset{asset},
+  }
+
+  gin.SetMode(gin.TestMode)
+  w := importBundle(&ap, bundle)
+
+  var result risk_assessment.ImportResult
+  json.Unmarshal(w.Body.Bytes(), &result)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, s_id, result.Scope)
+  assert.Contains(t, result.Assets, asset.ID.Hex())
+
+  /* The asset is added to the new scope */
+  added := asset_util_mck.Calls[0].Arguments.Get(0).([]risk_assessment.Asset)
+  assert.Equal(t, 1, len(added))
+  assert.Equal(t, s_id, added[0].Scope)
+  assert.Equal(t, "bar", added[0].Name)
+  scope_util_mck.AssertNotCalled(t, "DeleteScope", mock.Anything)
+}
+
+func TestImportScopeInvalid(t *testing.T) {
+  scope_util_mck := new(mockScopeUtils)
+  ap := BundleApp{User_utils: new(mockUserUtils), Scope_utils: scope_util_mck, Asset_utils: new(mockAssetUtils)}
+
+  bundle := risk_assessment.ScopeBundle{
+    Format: risk_assessment.BUNDLE_FORMAT,
+    Version: risk_assessment.BUNDLE_VERSION,
+    Scope: risk_assessment.Scope{Name: "foo"},
+    Assets: []risk_assessment.Asset{
+      {Name: "good", Value: risk_assessment.Value{Confidentiality: 1, Integrity: 1, Availability: 1}},
+      {Name: "", Value: risk_assessment.Value{Confidentiality: 1, Integrity: 1, Availability: 9}},
+    },
+  }
+
+  gin.SetMode(gin.TestMode)
+  w := importBundle(&ap, bundle)
+
+  var errs ImportErrors
+  json.Unmarshal(w.Body.Bytes(), &errs)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  assert.Equal(t, 1, len(errs.Assets))
+  assert.Equal(t, 1, errs.Assets[0].Index)
+  assert.Equal(t, []string{"empty name", "availability 9 is not in 1-4"}, errs.Assets[0].Problems)
+
+  /* A bundle of the other version */
+  bundle.Version = 2
+  w = importBundle(&ap, bundle)
+  json.Unmarshal(w.Body.Bytes(), &errs)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  assert.Contains(t, errs.Error, "unsupported scope bundle version")
+
+  w = importBundle(&ap, "foo")
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  scope_util_mck.AssertNotCalled(t, "AddScope", mock.Anything)
+}
+
+func TestImportScopeFailed(t *testing.T) {
+  scope_util_mck := new(mockScopeUtils)
+  scope_util_mck.On("AddScope", mock.Anything).Return(primitive.NilObjectID, errors.New("Add failed"))
+  ap := BundleApp{User_utils: new(mockUserUtils), Scope_utils: scope_util_mck, Asset_utils: new(mockAssetUtils)}
+
+  bundle := risk_assessment.ScopeBundle{
+    Format: risk_assessment.BUNDLE_FORMAT,
+    Version: risk_assessment.BUNDLE_VERSION,
+    Scope: risk_assessment.Scope{Name: "foo"},
+  }
+
+  gin.SetMode(gin.TestMode)
+  w := importBundle(&ap, bundle)
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestImportScopeAssetsFailed(t *testing.T) {
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+  s_id := primitive.NewObjectID()
+  scope_util_mck.On("AddScope", mock.Anything).Return(s_id, nil)
+  scope_util_mck.On("DeleteScope", s_id).Return(nil)
+  asset_util_mck.On("AddAssets", mock.Anything).Return(errors.New("Add failed"))
+  ap := BundleApp{User_utils: new(mockUserUtils), Scope_utils: scope_util_mck, Asset_utils: asset_util_mck}
+
+  bundle := risk_assessment.ScopeBundle{
+    Format: risk_assessment.BUNDLE_FORMAT,
+    Version: risk_assessment.BUNDLE_VERSION,
+    Scope: risk_assessment.Scope{Name: "foo"},
+    Assets: []risk_assessment.Asset{{
+      ID: primitive.NewObjectID(),
+      Name: "bar",
+      Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    }},
+  }
+
+  gin.SetMode(gin.TestMode)
+  w := importBundle(&ap, bundle)
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+  scope_util_mck.AssertCalled(t, "DeleteScope", s_id)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+  "bytes"
+  "crypto/hmac"
+  "crypto/sha256"
+  "encoding/base64"
+  "net/http"
+  "net/url"
+  "slices"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type IChartApp interface {
+  GetChart(c *gin.Context)
+  GetChartLink(c *gin.Context)
+  GetSharedChart(c *gin.Context)
+}
+
+type ChartApp struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+  /* Signs the shared links, so changing it revokes all of them */
+  Secret []byte
+}
+
+const DEFAULT_LINK_DAYS = 30
+const MAX_LINK_DAYS = 365
+
+/* The shared link of a chart, which is relative to the webserver */
+type ChartLink struct {
+  URL string
+  Expires time.Time
+}
+
+/* The chart of the :chart parameter like "heatmap.svg", or false if there is no such chart */
+func chartName(c *gin.Context) (string, bool) {
+  name, found := strings.CutSuffix(c.Param("chart"), ".svg")
+  return name, found && slices.Contains(report.CHARTS, name)
+}
+
+/* The key of the links is derived, so it never signs the same messages as the sessions */
+func (ap *ChartApp) sign(scopeID string, chart string, expires int64) string {
+  key := hmac.New(sha256.New, ap.Secret)
+  key.Write([]byte("riskassessment chart links"))
+  mac := hmac.New(sha256.New, key.Sum(nil))
+  mac.Write([]byte(scopeID + "/" + chart + "/" + strconv.FormatInt(expires, 10)))
+  return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+/* Render the chart of the scope with its thresholds */
+func (ap *ChartApp) render(c *gin.Context, s_id primitive.ObjectID, chart string, cache_control string) {
+  scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), s_id)
+  if (err == database.ErrNotFound) {
+    c.AbortWithStatus(http.StatusNotFound)
+    return
+  } else if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  assets, err := ap.Asset_utils.GetAssetsByScopeID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  var buf bytes.Buffer
+  levels := scope.RiskLevels()
+  switch chart {
+  case report.HeatMapChart:
+    err = report.WriteHeatMapSVG(&buf, scope.Name + " risk heat map", risk_assessment.NewHeatMap(assets, levels), levels)
+  case report.CategoriesChart:
+    err = report.WriteCategoriesSVG(&buf, scope.Name + " risks by category", report.NewCategoryLevels(assets, levels), levels)
+  }
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.Header("Cache-Control", cache_control)
+  c.Data(http.StatusOK, report.SVG_CONTENT_TYPE, buf.Bytes())
+}
+
+/* The scope of the :scopeID, if the user has it */
+func (ap *ChartApp) authorizedScope(c *gin.Context) (primitive.ObjectID, bool) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return s_id, false
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return s_id, false
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return s_id, false
+  }
+  return s_id, true
+}
+
+/* The SVG chart of the scope, if the user has the scope */
+func (ap *ChartApp) GetChart(c *gin.Context) {
+  chart, ok := chartName(c)
+  if (!ok) {
+    c.AbortWithStatus(http.StatusNotFound)
+    return
+  }
+
+  s_id, ok := ap.authorizedScope(c)
+  if (!ok) {
+    return
+  }
+  ap.render(c, s_id, chart, "private, no-cache")
+}
+
+/*
+ * Sign a link of the ?chart= of the scope, which anyone could open for the
+ * ?days=, so it could be embedded in the wiki pages and the emails
+ */
+func (ap *ChartApp) GetChartLink(c *gin.Context) {
+  chart := c.Query("chart")
+  days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(DEFAULT_LINK_DAYS)))
+  if (!slices.Contains(report.CHARTS, chart) || err != nil || days < 1 || days > MAX_LINK_DAYS) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  s_id, ok := ap.authorizedScope(c)
+  if (!ok) {
+    return
+  }
+
+  expires := time.Now().Add(time.Duration(days) * 24 * time.Hour).Truncate(time.Second)
+  query := url.Values{}
+  query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+  query.Set("signature", ap.sign(s_id.Hex(), chart, expires.Unix()))
+  c.JSON(http.StatusOK, ChartLink{
+    URL: "/api/sharedcharts/" + s_id.Hex() + "/" + chart + ".svg?" + query.Encode(),
+    Expires: expires,
+  })
+}
+
+/* The SVG chart of a signed link, which needs no session */
+func (ap *ChartApp) GetSharedChart(c *gin.Context) {
+  chart, ok := chartName(c)
+  if (!ok) {
+    c.AbortWithStatus(http.StatusNotFound)
+    return
+  }
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  expires, err_expires := strconv.ParseInt(c.Query("expires"), 10, 64)
+  if (err != nil || err_expires != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  signature := ap.sign(s_id.Hex(), chart, expires)
+  if (!hmac.Equal([]byte(signature), []byte(c.Query("signature")))) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  } else if (time.Now().Unix() >= expires) {
+    c.AbortWithStatus(http.StatusGone)
+    return
+  }
+
+  /* The caches could keep the picture for an hour, but not beyond the link */
+  max_age := min(expires - time.Now().Unix(), 3600)
+  ap.render(c, s_id, chart, "public, max-age=" + strconv.FormatInt(max_age, 10))
+}
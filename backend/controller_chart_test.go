@@ -0,0 +1,191 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newChartApp(t *testing.T, authorized bool) (*ChartApp, risk_assessment.Scope) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "chart.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  scope := risk_assessment.Scope{ID: primitive.NewObjectID(), Name: "foo", Levels: risk_assessment.RiskLevels{Medium: 10, High: 20}}
+  asset_utils := &risk_assessment.BoltAssetUtils{DB: db}
+  asset := risk_assessment.Asset{
+    Scope: scope.ID, BigCategory: "Hardware", Name: "web",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []risk_assessment.Risk{{Threat: "baz", Possibility: 2, Impact: 4}},
+  }
+  assert.Nil(t, asset_utils.AddAsset(context.TODO(), &asset))
+
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  auth_util_mck.On("UserHasScopeID", mock.Anything, scope.ID).Return(authorized, nil)
+  scope_util_mck.On("GetScopeByID", scope.ID).Return(scope, nil)
+
+  ap := &ChartApp{User_utils: auth_util_mck, Scope_utils: scope_util_mck, Asset_utils: asset_utils, Secret: []byte("0123456789abcdef")}
+  return ap, scope
+}
+
+func chartContext(target string, session_id bool) (*gin.Context, *httptest.ResponseRecorder) {
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", target, nil)
+  c, w, session := GetMockContext(req)
+  if session_id {
+    session.Set("id", primitive.NewObjectID().Hex())
+    session.Save()
+  }
+  return c, w
+}
+
+func TestGetChart(t *testing.T) {
+  ap, scope := newChartApp(t, true)
+
+  c, w := chartContext("/", true)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}, {Key: "chart", Value: "heatmap.svg"}}
+  ap.GetChart(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, report.SVG_CONTENT_TYPE, w.Header().Get("Content-Type"))
+  assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+  assert.Contains(t, w.Body.String(), "<title>foo risk heat map</title>")
+  /* The score 48 is high with the scope's thresholds */
+  assert.Contains(t, w.Body.String(), "low &lt; 10 ≤ medium &lt; 20 ≤ high")
+
+  c, w = chartContext("/", true)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}, {Key: "chart", Value: "categories.svg"}}
+  ap.GetChart(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Contains(t, w.Body.String(), "<title>high: 1</title>")
+}
+
+func TestGetChartFailed(t *testing.T) {
+  ap, scope := newChartApp(t, false)
+
+  for _, params := range []gin.Params{
+    {{Key: "scopeID", Value: scope.ID.Hex()}, {Key: "chart", Value: "pie.svg"}},
+    {{Key: "scopeID", Value: scope.ID.Hex()}, {Key: "chart", Value: "heatmap"}},
+  } {
+    c, w := chartContext("/", true)
+    c.Params = params
+    ap.GetChart(c)
+    assert.Equal(t, http.StatusNotFound, w.Code)
+  }
+
+  c, w := chartContext("/", true)
+  c.Params = gin.Params{{Key: "scopeID", Value: "xxx"}, {Key: "chart", Value: "heatmap.svg"}}
+  ap.GetChart(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  c, w = chartContext("/", true)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}, {Key: "chart", Value: "heatmap.svg"}}
+  ap.GetChart(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+/* Sign a link of the chart, and split it into the shared chart's parameters and query */
+func chartLink(t *testing.T, ap *ChartApp, scope risk_assessment.Scope, query string) (ChartLink, gin.Params, string) {
+  c, w := chartContext("/" + query, true)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}}
+  ap.GetChartLink(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+
+  var link ChartLink
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &link))
+  path, raw_query, _ := strings.Cut(link.URL, "?")
+  parts := strings.Split(path, "/")
+  assert.Equal(t, []string{"", "api", "sharedcharts", scope.ID.Hex()}, parts[:4])
+  return link, gin.Params{{Key: "scopeID", Value: parts[3]}, {Key: "chart", Value: parts[4]}}, raw_query
+}
+
+func TestGetSharedChart(t *testing.T) {
+  ap, scope := newChartApp(t, true)
+
+  link, params, query := chartLink(t, ap, scope, "?chart=categories&days=7")
+  assert.Equal(t, "categories.svg", params[1].Value)
+  assert.WithinDuration(t, time.Now().Add(7 * 24 * time.Hour), link.Expires, time.Minute)
+
+  /* Anyone could open the link without a session */
+  c, w := chartContext("/?" + query, false)
+  c.Params = params
+  ap.GetSharedChart(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, report.SVG_CONTENT_TYPE, w.Header().Get("Content-Type"))
+  assert.Equal(t, "public, max-age=3600", w.Header().Get("Cache-Control"))
+  assert.Contains(t, w.Body.String(), "<title>foo risks by category</title>")
+
+  /* The signature covers the chart, the scope and the expiry */
+  values, _ := url.ParseQuery(query)
+  for _, tc := range []struct {
+    params gin.Params
+    query url.Values
+  }{
+    {gin.Params{params[0], {Key: "chart", Value: "heatmap.svg"}}, values},
+    {gin.Params{{Key: "scopeID", Value: primitive.NewObjectID().Hex()}, params[1]}, values},
+    {params, url.Values{"expires": {strconv.FormatInt(link.Expires.Unix() + 1, 10)}, "signature": values["signature"]}},
+    {params, url.Values{"expires": values["expires"]}},
+  } {
+    c, w := chartContext("/?" + tc.query.Encode(), false)
+    c.Params = tc.params
+    ap.GetSharedChart(c)
+    assert.Equal(t, http.StatusForbidden, w.Code)
+  }
+
+  /* Another secret revokes the links */
+  other := *ap
+  other.Secret = []byte("fedcba9876543210")
+  c, w = chartContext("/?" + query, false)
+  c.Params = params
+  other.GetSharedChart(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGetSharedChartExpired(t *testing.T) {
+  ap, scope := newChartApp(t, true)
+
+  expires := time.Now().Add(-time.Minute).Unix()
+  query := url.Values{}
+  query.Set("expires", strconv.FormatInt(expires, 10))
+  query.Set("signature", ap.sign(scope.ID.Hex(), report.HeatMapChart, expires))
+
+  c, w := chartContext("/?" + query.Encode(), false)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}, {Key: "chart", Value: "heatmap.svg"}}
+  ap.GetSharedChart(c)
+  assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestGetChartLinkFailed(t *testing.T) {
+  ap, scope := newChartApp(t, false)
+
+  for _, query := range []string{"", "?chart=pie", "?chart=heatmap&days=0", "?chart=heatmap&days=366", "?chart=heatmap&days=x"} {
+    c, w := chartContext("/" + query, true)
+    c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}}
+    ap.GetChartLink(c)
+    assert.Equal(t, http.StatusBadRequest, w.Code)
+  }
+
+  c, w := chartContext("/?chart=heatmap", true)
+  c.Params = gin.Params{{Key: "scopeID", Value: scope.ID.Hex()}}
+  ap.GetChartLink(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "net/http"
+  "time"
+
+  "github.com/gin-gonic/gin"
+)
+
+type IHealthApp interface {
+  Healthz(c *gin.Context)
+  Readyz(c *gin.Context)
+}
+
+/* HealthCheck tells whether a dependency of the service is usable */
+type HealthCheck func(ctx context.Context) error
+
+type HealthApp struct {
+  Checks map[string]HealthCheck
+  Timeout time.Duration
+}
+
+/* The time given to all the readiness checks together */
+const READINESS_TIMEOUT = 3 * time.Second
+
+const (
+  HealthOK = "ok"
+  HealthUnavailable = "unavailable"
+)
+
+type HealthStatus struct {
+  Status string
+  Checks map[string]string `json:",omitempty"`
+}
+
+/* The process is alive, as long as it answers */
+func (ap *HealthApp) Healthz(c *gin.Context) {
+  c.JSON(http.StatusOK, HealthStatus{Status: HealthOK})
+}
+
+/*
+ * The service is ready, if all the checks pass.  The causes of the failed
+ * checks are logged, but not told to the prober.
+ */
+func (ap *HealthApp) Readyz(c *gin.Context) {
+  timeout := ap.Timeout
+  if (timeout <= 0) {
+    timeout = READINESS_TIMEOUT
+  }
+  ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+  defer cancel()
+
+  code := http.StatusOK
+  status := HealthStatus{Status: HealthOK, Checks: map[string]string{}}
+  for name, check := range ap.Checks {
+    if err := check(ctx); err != nil {
+      c.Error(fmt.Errorf("%s: %w", name, err))
+      status.Checks[name] = HealthUnavailable
+      status.Status = HealthUnavailable
+      code = http.StatusServiceUnavailable
+    } else {
+      status.Checks[name] = HealthOK
+    }
+  }
+
+  c.JSON(code, status)
+}
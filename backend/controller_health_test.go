@@ -0,0 +1,95 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+  ap := HealthApp{}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/healthz", nil)
+  c, w, _ := GetMockContext(req)
+
+  ap.Healthz(c)
+
+  var status HealthStatus
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &status))
+  assert.Equal(t, HealthOK, status.Status)
+}
+
+func TestReadyz(t *testing.T) {
+  ap := HealthApp{
+    Checks: map[string]HealthCheck{
+      "mongo": func(ctx context.Context) error { return nil },
+      "sessions": func(ctx context.Context) error { return nil },
+    },
+  }
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/readyz", nil)
+  c, w, _ := GetMockContext(req)
+
+  ap.Readyz(c)
+
+  var status HealthStatus
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &status))
+  assert.Equal(t, HealthOK, status.Status)
+  assert.Equal(t, map[string]string{"mongo": HealthOK, "sessions": HealthOK}, status.Checks)
+}
+
+func TestReadyzFailed(t *testing.T) {
+  ap := HealthApp{
+    Checks: map[string]HealthCheck{
+      "mongo": func(ctx context.Context) error { return errors.New("no reachable servers") },
+      "sessions": func(ctx context.Context) error { return nil },
+    },
+  }
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/readyz", nil)
+  c, w, _ := GetMockContext(req)
+
+  ap.Readyz(c)
+
+  var status HealthStatus
+  assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &status))
+  assert.Equal(t, HealthUnavailable, status.Status)
+  assert.Equal(t, HealthUnavailable, status.Checks["mongo"])
+  assert.Equal(t, HealthOK, status.Checks["sessions"])
+  /* The cause is only logged */
+  assert.NotContains(t, w.Body.String(), "no reachable servers")
+  assert.Len(t, c.Errors, 1)
+}
+
+func TestReadyzTimeout(t *testing.T) {
+  ap := HealthApp{
+    Checks: map[string]HealthCheck{
+      "mongo": func(ctx context.Context) error {
+        <-ctx.Done()
+        return ctx.Err()
+      },
+    },
+    Timeout: 10 * time.Millisecond,
+  }
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/readyz", nil)
+  c, w, _ := GetMockContext(req)
+
+  ap.Readyz(c)
+
+  assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
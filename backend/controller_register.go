@@ -0,0 +1,168 @@
+package main
+
+import (
+  "errors"
+  "net/http"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/register"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type IRegisterApp interface {
+  ExportRegister(c *gin.Context)
+  ImportRegister(c *gin.Context)
+}
+
+type RegisterApp struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+}
+
+const (
+  CSVFormat = "csv"
+  XLSXFormat = "xlsx"
+  /* The asset inventory and the risk evaluation forms of the government template */
+  GovernmentFormat = "gov"
+)
+
+/* The largest workbook which could be uploaded */
+const MAX_REGISTER_SIZE = 32 << 20
+
+const XLSX_CONTENT_TYPE = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+/* Download the risk register of the scope with ?format=csv, which is the default, xlsx or gov */
+func (ap *RegisterApp) ExportRegister(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  format := c.DefaultQuery("format", CSVFormat)
+  if (format != CSVFormat && format != XLSXFormat && format != GovernmentFormat) {
+    c.String(http.StatusBadRequest, "Unknown format")
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  assets, err := ap.Asset_utils.GetAssetsByScopeID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  if (format == GovernmentFormat) {
+    c.Header("Content-Disposition", `attachment; filename="inventory-` + s_id.Hex() + `.xlsx"`)
+    c.Header("Content-Type", XLSX_CONTENT_TYPE)
+    c.Status(http.StatusOK)
+    if err := register.WriteGovernmentXLSX(c.Writer, &scope, assets, time.Now()); (err != nil) {
+      c.Error(err)
+    }
+    return
+  }
+
+  rows := register.Rows(assets, scope.RiskLevels())
+  c.Header("Content-Disposition", `attachment; filename="register-` + s_id.Hex() + `.` + format + `"`)
+  if (format == XLSXFormat) {
+    c.Header("Content-Type", XLSX_CONTENT_TYPE)
+    c.Status(http.StatusOK)
+    err = register.WriteXLSX(c.Writer, rows, scope.RiskLevels())
+  } else {
+    c.Header("Content-Type", "text/csv; charset=utf-8")
+    c.Status(http.StatusOK)
+    err = register.WriteCSV(c.Writer, rows)
+  }
+  if (err != nil) {
+    c.Error(err)
+  }
+}
+
+/*
+ * Preview the changes of the uploaded workbook, which was exported from the
+ * scope and edited offline.  The same workbook uploaded with ?confirm=<the
+ * token of the preview> applies the changes, unless they differ from the
+ * preview's.
+ */
+func (ap *RegisterApp) ImportRegister(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  assets, err := ap.Asset_utils.GetAssetsByScopeID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  body := http.MaxBytesReader(c.Writer, c.Request.Body, MAX_REGISTER_SIZE)
+  changes, err := register.ParseChanges(body, assets)
+  if (err != nil) {
+    c.String(http.StatusBadRequest, err.Error())
+    return
+  }
+
+  token := c.Query("confirm")
+  if (token == "") {
+    c.JSON(http.StatusOK, changes)
+    return
+  } else if (len(changes.Invalid) > 0) {
+    c.JSON(http.StatusBadRequest, changes)
+    return
+  } else if (token != changes.Token) {
+    /* The assets are changed since the preview */
+    c.JSON(http.StatusConflict, changes)
+    return
+  }
+
+  err = register.Apply(c.Request.Context(), ap.Asset_utils, &changes)
+  if (errors.Is(err, risk_assessment.ErrAssetChanged)) {
+    /* An asset is changed since the upload */
+    c.String(http.StatusConflict, err.Error())
+    return
+  } else if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.JSON(http.StatusOK, changes)
+}
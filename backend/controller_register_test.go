@@ -0,0 +1,242 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "github.com/xuri/excelize/v2"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/register"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newRegisterApp(authorized bool) (*RegisterApp, primitive.ObjectID) {
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+  scope := risk_assessment.Scope{ID: primitive.NewObjectID(), Name: "foo"}
+  assets := []risk_assessment.Asset{{
+    ID: primitive.NewObjectID(),
+    Scope: scope.ID,
+    Name: "bar",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []risk_assessment.Risk{{Threat: "baz", Possibility: 2, Impact: 4}},
+  }}
+  auth_util_mck.On("UserHasScopeID", mock.Anything, scope.ID).Return(authorized, nil)
+  scope_util_mck.On("GetScopeByID", scope.ID).Return(scope, nil)
+  asset_util_mck.On("GetAssetsByScopeID", scope.ID).Return(assets, nil)
+
+  ap := &RegisterApp{User_utils: auth_util_mck, Scope_utils: scope_util_mck, Asset_utils: asset_util_mck}
+  return ap, scope.ID
+}
+
+func TestExportRegisterCSV(t *testing.T) {
+  ap, s_id := newRegisterApp(true)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.ExportRegister(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, `attachment; filename="register-` + s_id.Hex() + `.csv"`, w.Header().Get("Content-Disposition"))
+  lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+  assert.Equal(t, []string{strings.Join(register.HEADER, ","), ",,bar,,1,2,3,baz,,,2,4,48,high"}, lines)
+}
+
+func TestExportRegisterXLSX(t *testing.T) {
+  ap, s_id := newRegisterApp(true)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/?format=xlsx", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.ExportRegister(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, XLSX_CONTENT_TYPE, w.Header().Get("Content-Type"))
+
+  f, err := excelize.OpenReader(w.Body)
+  assert.Nil(t, err)
+  defer f.Close()
+  score, _ := f.GetCellValue(register.SHEET, "M2")
+  assert.Equal(t, "48", score)
+}
+
+func TestExportRegisterGovernment(t *testing.T) {
+  ap, s_id := newRegisterApp(true)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/?format=gov", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.ExportRegister(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, `attachment; filename="inventory-` + s_id.Hex() + `.xlsx"`, w.Header().Get("Content-Disposition"))
+
+  f, err := excelize.OpenReader(w.Body)
+  assert.Nil(t, err)
+  defer f.Close()
+  level, _ := f.GetCellValue(register.EVALUATION_SHEET, "K4")
+  assert.Equal(t, "高", level)
+}
+
+func TestExportRegisterFailed(t *testing.T) {
+  gin.SetMode(gin.TestMode)
+
+  /* The user does not have the scope */
+  ap, s_id := newRegisterApp(false)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  ap.ExportRegister(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  ap.Asset_utils.(*mockAssetUtils).AssertNotCalled(t, "GetAssetsByScopeID", mock.Anything)
+
+  /* Unknown format */
+  ap, s_id = newRegisterApp(true)
+  req = httptest.NewRequest("GET", "/?format=pdf", nil)
+  c, w, session = GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  ap.ExportRegister(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  /* The assets could not be got */
+  asset_util_mck := new(mockAssetUtils)
+  asset_util_mck.On("GetAssetsByScopeID", s_id).Return([]risk_assessment.Asset{}, errors.New("Get failed"))
+  ap.Asset_utils = asset_util_mck
+  req = httptest.NewRequest("GET", "/", nil)
+  c, w, session = GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  ap.ExportRegister(c)
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+/* The exported workbook of the assets, with the threat of the first risk edited */
+func editedRegister(t *testing.T, assets []risk_assessment.Asset, threat string) []byte {
+  var buf bytes.Buffer
+  rows := register.Rows(assets, risk_assessment.DEFAULT_RISK_LEVELS)
+  assert.Nil(t, register.WriteXLSX(&buf, rows, risk_assessment.DEFAULT_RISK_LEVELS))
+
+  f, err := excelize.OpenReader(&buf)
+  assert.Nil(t, err)
+  defer f.Close()
+  f.SetCellValue(register.SHEET, "H2", threat)
+
+  var edited bytes.Buffer
+  f.WriteTo(&edited)
+  return edited.Bytes()
+}
+
+func TestImportRegister(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  asset_util_mck := new(mockAssetUtils)
+  s_id := primitive.NewObjectID()
+  assets := []risk_assessment.Asset{{
+    ID: primitive.NewObjectID(),
+    Scope: s_id,
+    BigCategory: "Hardware",
+    SmallCategory: "Server",
+    Name: "bar",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []risk_assessment.Risk{{Threat: "baz", Possibility: 2, Impact: 4}},
+  }}
+  auth_util_mck.On("UserHasScopeID", mock.Anything, s_id).Return(true, nil)
+  asset_util_mck.On("GetAssetsByScopeID", s_id).Return(assets, nil)
+  asset_util_mck.On("ReplaceAsset", mock.Anything, mock.Anything).Return(nil)
+  ap := RegisterApp{User_utils: auth_util_mck, Scope_utils: new(mockScopeUtils), Asset_utils: asset_util_mck}
+  workbook := editedRegister(t, assets, "qux")
+
+  upload := func(query string, body []byte) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("POST", "/" + query, bytes.NewReader(body))
+    c, w, session := GetMockContext(req)
+    c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+    session.Set("id", primitive.NewObjectID().Hex())
+    session.Save()
+    ap.ImportRegister(c)
+    return w
+  }
+
+  gin.SetMode(gin.TestMode)
+
+  /* Preview */
+  w := upload("", workbook)
+  var changes register.ChangeSet
+  json.Unmarshal(w.Body.Bytes(), &changes)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, 1, len(changes.Changes))
+  assert.Equal(t, "qux", changes.Changes[0].Updated[0].Fields[0].New)
+  assert.False(t, changes.Applied)
+  asset_util_mck.AssertNotCalled(t, "ReplaceAsset", mock.Anything, mock.Anything)
+
+  /* Other changes than the preview's */
+  w = upload("?confirm=" + changes.Token, editedRegister(t, assets, "quux"))
+  assert.Equal(t, http.StatusConflict, w.Code)
+  asset_util_mck.AssertNotCalled(t, "ReplaceAsset", mock.Anything, mock.Anything)
+
+  /* Confirm */
+  w = upload("?confirm=" + changes.Token, workbook)
+  json.Unmarshal(w.Body.Bytes(), &changes)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.True(t, changes.Applied)
+  asset_util_mck.AssertCalled(t, "ReplaceAsset", &assets[0], mock.MatchedBy(func(asset *risk_assessment.Asset) bool {
+    return asset.ID == assets[0].ID && asset.Risks[0].Threat == "qux"
+  }))
+
+  /* The asset is changed since the upload */
+  asset_util_mck.ExpectedCalls = nil
+  asset_util_mck.On("GetAssetsByScopeID", s_id).Return(assets, nil)
+  asset_util_mck.On("ReplaceAsset", mock.Anything, mock.Anything).Return(risk_assessment.ErrAssetChanged)
+  w = upload("?confirm=" + changes.Token, workbook)
+  assert.Equal(t, http.StatusConflict, w.Code)
+  assert.Contains(t, w.Body.String(), "no change is applied")
+
+  /* Not a workbook */
+  w = upload("", []byte("foo"))
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImportRegisterForbidden(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  asset_util_mck := new(mockAssetUtils)
+  auth_util_mck.On("UserHasScopeID", mock.Anything, mock.Anything).Return(false, nil)
+  ap := RegisterApp{User_utils: auth_util_mck, Scope_utils: new(mockScopeUtils), Asset_utils: asset_util_mck}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("POST", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: primitive.NewObjectID().Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.ImportRegister(c)
+
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  asset_util_mck.AssertNotCalled(t, "GetAssetsByScopeID", mock.Anything)
+}
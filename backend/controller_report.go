@@ -0,0 +1,79 @@
+package main
+
+import (
+  "bytes"
+  "net/http"
+  "strconv"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type IReportApp interface {
+  GetReport(c *gin.Context)
+}
+
+type ReportApp struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+  /* The TrueType font file of the PDF, or the Go fonts */
+  Font string
+}
+
+/* Download the PDF report of the scope with the ?top=N risks, if the user has the scope */
+func (ap *ReportApp) GetReport(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  top, err := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(report.DEFAULT_TOP_RISKS)))
+  if (err != nil || top < 1) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  assets, err := ap.Asset_utils.GetAssetsByScopeID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  /* Nothing is sent for a failed PDF, which could be caused by the font */
+  var buf bytes.Buffer
+  err = report.WritePDF(&buf, &scope, assets, report.Options{Font: ap.Font, Date: time.Now(), Top: top})
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.Header("Content-Disposition", `attachment; filename="report-` + s_id.Hex() + `.pdf"`)
+  c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+  "bytes"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newReportApp(authorized bool) (*ReportApp, primitive.ObjectID) {
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+  scope := risk_assessment.Scope{ID: primitive.NewObjectID(), Name: "foo"}
+  assets := []risk_assessment.Asset{{
+    ID: primitive.NewObjectID(),
+    Scope: scope.ID,
+    Name: "bar",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []risk_assessment.Risk{{Threat: "baz", Possibility: 2, Impact: 4}},
+  }}
+  auth_util_mck.On("UserHasScopeID", mock.Anything, scope.ID).Return(authorized, nil)
+  scope_util_mck.On("GetScopeByID", scope.ID).Return(scope, nil)
+  asset_util_mck.On("GetAssetsByScopeID", scope.ID).Return(assets, nil)
+
+  ap := &ReportApp{User_utils: auth_util_mck, Scope_utils: scope_util_mck, Asset_utils: asset_util_mck}
+  return ap, scope.ID
+}
+
+func TestGetReport(t *testing.T) {
+  ap, s_id := newReportApp(true)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.GetReport(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+  assert.Equal(t, `attachment; filename="report-` + s_id.Hex() + `.pdf"`, w.Header().Get("Content-Disposition"))
+  assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+}
+
+func TestGetReportForbidden(t *testing.T) {
+  ap, s_id := newReportApp(false)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.GetReport(c)
+
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGetReportBadFont(t *testing.T) {
+  ap, s_id := newReportApp(true)
+  ap.Font = "/nonexistent/font.ttf"
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/?top=3", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.GetReport(c)
+
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+  assert.Equal(t, "", w.Header().Get("Content-Disposition"))
+}
+
+func TestGetReportBadTop(t *testing.T) {
+  ap, s_id := newReportApp(true)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", "/?top=0", nil)
+  c, w, session := GetMockContext(req)
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+
+  ap.GetReport(c)
+
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -46,9 +46,9 @@ func (ap *ScopesApp) GetScopes(c *gin.Context) {
     return
   }
 
-  scopes, err := ap.Scope_utils.GetScopes()
+  scopes, err := ap.Scope_utils.GetScopes(c.Request.Context())
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -69,18 +69,18 @@ func (ap *ScopesApp) GetScopesByUser(c *gin.Context) {
   id_str := session.Get("id")
   id, _ := primitive.ObjectIDFromHex(id_str.(string))
 
-  user, err := ap.User_utils.GetUserByID(id)
+  user, err := ap.User_utils.GetUserByID(c.Request.Context(), id)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
   var scope_page ScopePage
   var scopes []risk_assessment.Scope
   scope_page.UserInfo.Role = session.Get("role").(uint)
-  scopes, err = ap.Scope_utils.GetScopeByIDs(user.Scopes)
+  scopes, err = ap.Scope_utils.GetScopeByIDs(c.Request.Context(), user.Scopes)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -96,6 +96,11 @@ func (ap *ScopesApp) GetScopesByUser(c *gin.Context) {
   c.JSON(http.StatusOK, scope_page)
 }
 
+/* No risk levels means the default ones */
+func validLevels(levels risk_assessment.RiskLevels) bool {
+  return levels == (risk_assessment.RiskLevels{}) || levels.IsValid()
+}
+
 func (ap *ScopesApp) AddScope(c *gin.Context) {
   var scope risk_assessment.Scope
 
@@ -105,14 +110,14 @@ func (ap *ScopesApp) AddScope(c *gin.Context) {
   }
 
   scope.Name = strings.TrimSpace(scope.Name)
-  if (len(scope.Name) == 0)  {
+  if (len(scope.Name) == 0 || !validLevels(scope.Levels))  {
     c.AbortWithStatus(http.StatusBadRequest)
     return
   }
 
-  _, err := ap.Scope_utils.AddScope(&scope)
+  _, err := ap.Scope_utils.AddScope(c.Request.Context(), &scope)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -128,21 +133,25 @@ func (ap *ScopesApp) UpdateScope(c *gin.Context) {
   }
 
   scope.Name = strings.TrimSpace(scope.Name)
-  if (len(scope.Name) == 0)  {
+  if (len(scope.Name) == 0 || !validLevels(scope.Levels))  {
     c.AbortWithStatus(http.StatusBadRequest)
     return
   }
 
-  orig_scope, err := ap.Scope_utils.GetScopeByID(scope.ID)
+  orig_scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), scope.ID)
   if (err != nil) {
     c.AbortWithStatus(http.StatusBadRequest)
     return
   }
 
   scope.CreateTime = orig_scope.CreateTime
-  err = ap.Scope_utils.UpdateScope(&scope)
+  /* Keep the risk levels, if they are not given */
+  if (scope.Levels == (risk_assessment.RiskLevels{})) {
+    scope.Levels = orig_scope.Levels
+  }
+  err = ap.Scope_utils.UpdateScope(c.Request.Context(), &scope)
   if (err != nil) {
-    c.AbortWithStatus(http.StatusInternalServerError)
+    c.AbortWithError(http.StatusInternalServerError, err)
     return
   }
 
@@ -2,6 +2,7 @@ package main
 
 import (
   "bytes"
+  "context"
   "errors"
   "testing"
   "time"
@@ -23,36 +24,46 @@ type mockScopeUtils struct {
   mock.Mock
 }
 
-func (m *mockScopeUtils) AddScope(scope *risk_assessment.Scope) (primitive.ObjectID, error) {
+func (m *mockScopeUtils) AddScope(ctx context.Context, scope *risk_assessment.Scope) (primitive.ObjectID, error) {
   args := m.Called(scope)
   return args.Get(0).(primitive.ObjectID), args.Error(1)
 }
 
-func (m *mockScopeUtils) GetScopes() ([]risk_assessment.Scope, error) {
+func (m *mockScopeUtils) GetScopes(ctx context.Context) ([]risk_assessment.Scope, error) {
   args := m.Called()
   return args.Get(0).([]risk_assessment.Scope), args.Error(1)
 }
 
-func (m *mockScopeUtils) GetScopeByID(id primitive.ObjectID) (risk_assessment.Scope, error) {
+func (m *mockScopeUtils) GetScopeByID(ctx context.Context, id primitive.ObjectID) (risk_assessment.Scope, error) {
   args := m.Called(id)
   return args.Get(0).(risk_assessment.Scope), args.Error(1)
 }
 
-func (m *mockScopeUtils) GetScopeByIDs(ids []primitive.ObjectID) ([]risk_assessment.Scope, error) {
+func (m *mockScopeUtils) GetScopeByIDs(ctx context.Context, ids []primitive.ObjectID) ([]risk_assessment.Scope, error) {
   args := m.Called(ids)
   return args.Get(0).([]risk_assessment.Scope), args.Error(1)
 }
 
-func (m *mockScopeUtils) HasScopeID(id primitive.ObjectID) (bool, error) {
+func (m *mockScopeUtils) HasScopeID(ctx context.Context, id primitive.ObjectID) (bool, error) {
   args := m.Called(id)
   return args.Get(0).(bool), args.Error(1)
 }
 
-func (m *mockScopeUtils) UpdateScope(scope *risk_assessment.Scope) (error) {
+func (m *mockScopeUtils) UpdateScope(ctx context.Context, scope *risk_assessment.Scope) (error) {
   args := m.Called(scope)
   return args.Error(0)
 }
 
+func (m *mockScopeUtils) PutScope(ctx context.Context, scope *risk_assessment.Scope) (error) {
+  args := m.Called(scope)
+  return args.Error(0)
+}
+
+func (m *mockScopeUtils) DeleteScope(ctx context.Context, id primitive.ObjectID) (error) {
+  args := m.Called(id)
+  return args.Error(0)
+}
+
 func TestGetScopes(t *testing.T) {
   auth_util_mck := new(mockUserUtils)
   csrf_util_mck := new(mockCsrtUtils)
@@ -515,3 +526,95 @@ func TestUpdateScopeFailed4(t *testing.T) {
 
   assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
+
+func TestAddScopeInvalidLevels(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  csrf_util_mck := new(mockCsrtUtils)
+  scope_util_mck := new(mockScopeUtils)
+  ap := ScopesApp{User_utils: auth_util_mck, Csrf_utils: csrf_util_mck, Scope_utils: scope_util_mck}
+
+  testScope := risk_assessment.Scope {
+    Name: "Test Scope",
+    Levels: risk_assessment.RiskLevels{Medium: 48, High: 24},
+  }
+  json_bytes, _ := json.Marshal(testScope)
+  json_buf := bytes.NewBuffer(json_bytes)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("POST", "/", json_buf)
+  req.Header.Add("Content-Type", binding.MIMEJSON)
+  c, w, _ := GetMockContext(req)
+
+  ap.AddScope(c)
+
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  scope_util_mck.AssertNotCalled(t, "AddScope", mock.Anything)
+}
+
+func TestUpdateScopeKeepLevels(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  csrf_util_mck := new(mockCsrtUtils)
+  scope_util_mck := new(mockScopeUtils)
+  mockScope := risk_assessment.Scope {
+    ID: primitive.NewObjectID(),
+    CreateTime: time.Now().UTC(),
+    Name: "Original Scope",
+    Levels: risk_assessment.RiskLevels{Medium: 12, High: 36},
+  }
+  scope_util_mck.On("GetScopeByID", mock.Anything).Return(mockScope, nil)
+  scope_util_mck.On("UpdateScope", mock.MatchedBy(func(s *risk_assessment.Scope) bool {
+    return s.Levels == mockScope.Levels
+  })).Return(nil)
+  ap := ScopesApp{User_utils: auth_util_mck, Csrf_utils: csrf_util_mck, Scope_utils: scope_util_mck}
+
+  testScope := risk_assessment.Scope {
+    ID: mockScope.ID,
+    Name: "Test Scope",
+  }
+  json_bytes, _ := json.Marshal(testScope)
+  json_buf := bytes.NewBuffer(json_bytes)
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("POST", "/", json_buf)
+  req.Header.Add("Content-Type", binding.MIMEJSON)
+  c, w, _ := GetMockContext(req)
+
+  ap.UpdateScope(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  scope_util_mck.AssertExpectations(t)
+}
+
+/* Record the context given to the utils */
+type ctxScopeUtils struct {
+  mockScopeUtils
+  ctx context.Context
+}
+
+func (m *ctxScopeUtils) GetScopes(ctx context.Context) ([]risk_assessment.Scope, error) {
+  m.ctx = ctx
+  return []risk_assessment.Scope{}, ctx.Err()
+}
+
+func TestGetScopesCanceled(t *testing.T) {
+  auth_util_mck := new(mockUserUtils)
+  csrf_util_mck := new(mockCsrtUtils)
+  scope_utils := new(ctxScopeUtils)
+  ap := ScopesApp{User_utils: auth_util_mck, Csrf_utils: csrf_util_mck, Scope_utils: scope_utils}
+
+  /* The client has gone */
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("Get", "/", bytes.NewBufferString("")).WithContext(ctx)
+  c, w, session := GetMockContext(req)
+
+  session.Set("role", uint(auth.Administrator))
+  session.Save()
+
+  ap.GetScopes(c)
+
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+  assert.Equal(t, context.Canceled, scope_utils.ctx.Err())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+  "net/http"
+  "slices"
+  "strconv"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type ISearchApp interface {
+  Search(c *gin.Context)
+}
+
+type SearchApp struct {
+  User_utils auth.IUserUtils
+  Search_utils risk_assessment.ISearchUtils
+}
+
+const DEFAULT_SEARCH_RESULTS = 50
+const MAX_SEARCH_RESULTS = 200
+const MAX_SEARCH_LEN = 256
+
+/* The ?limit=N results, or false if it is not in 1..MAX_SEARCH_RESULTS */
+func searchLimit(c *gin.Context) (int, bool) {
+  limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DEFAULT_SEARCH_RESULTS)))
+  return limit, err == nil && limit >= 1 && limit <= MAX_SEARCH_RESULTS
+}
+
+/*
+ * Search the ?q= text in the assets and their risks of all the user's
+ * scopes, or of the ?scope= one only if the user has it.  The text follows
+ * MongoDB's text search, like ransomware, "remote access" or vpn -backup.
+ */
+func (ap *SearchApp) Search(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  text := c.Query("q")
+  if (len(text) > MAX_SEARCH_LEN) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+  if search := risk_assessment.ParseSearchText(text); (search.IsEmpty()) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+  limit, ok := searchLimit(c)
+  if (!ok) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  var s_id primitive.ObjectID
+  if (c.Query("scope") != "") {
+    var err error
+    s_id, err = primitive.ObjectIDFromHex(c.Query("scope"))
+    if (err != nil) {
+      c.AbortWithStatus(http.StatusBadRequest)
+      return
+    }
+  }
+
+  user, err := ap.User_utils.GetUserByID(c.Request.Context(), u_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  scopes := user.Scopes
+  if (!s_id.IsZero()) {
+    if (!slices.Contains(user.Scopes, s_id)) {
+      c.AbortWithStatus(http.StatusForbidden)
+      return
+    }
+    scopes = []primitive.ObjectID{s_id}
+  }
+
+  results, err := ap.Search_utils.SearchAssets(c.Request.Context(), scopes, text, limit)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.JSON(http.StatusOK, results)
+}
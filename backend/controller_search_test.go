@@ -0,0 +1,105 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newSearchApp(t *testing.T) (*SearchApp, []primitive.ObjectID) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "search.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  scopes := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+  asset_utils := &risk_assessment.BoltAssetUtils{DB: db}
+  for i, s_id := range scopes {
+    asset := risk_assessment.Asset{
+      Scope: s_id,
+      Name: "file server",
+      Risks: []risk_assessment.Risk{{Threat: "Power failure"}, {Threat: "Ransomware", CurrentControl: "Backup"}},
+    }
+    if (i == 1) {
+      asset.Name = "mail"
+    }
+    assert.Nil(t, asset_utils.AddAsset(context.TODO(), &asset))
+  }
+
+  /* The user does not have the last scope */
+  auth_util_mck := new(mockUserUtils)
+  auth_util_mck.On("GetUserByID", mock.Anything).Return(auth.User{Scopes: scopes[:2]}, nil)
+
+  return &SearchApp{User_utils: auth_util_mck, Search_utils: asset_utils}, scopes
+}
+
+func search(ap *SearchApp, target string) *httptest.ResponseRecorder {
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", target, nil)
+  c, w, session := GetMockContext(req)
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  ap.Search(c)
+  return w
+}
+
+func TestSearch(t *testing.T) {
+  ap, scopes := newSearchApp(t)
+
+  w := search(ap, "/?q=ransomware")
+  assert.Equal(t, http.StatusOK, w.Code)
+  var results []risk_assessment.SearchResult
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &results))
+  assert.Equal(t, 2, len(results))
+  for i := range results {
+    assert.NotEqual(t, scopes[2], results[i].Asset.Scope)
+    assert.Equal(t, 1, len(results[i].Risks))
+    assert.Equal(t, 1, results[i].Risks[0].Index)
+    assert.Equal(t, "Ransomware", results[i].Risks[0].Risk.Threat)
+  }
+
+  w = search(ap, "/?q=ransomware&limit=1")
+  results = nil
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &results))
+  assert.Equal(t, 1, len(results))
+
+  /* A scope of the user only */
+  w = search(ap, "/?q=ransomware&scope=" + scopes[1].Hex())
+  results = nil
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &results))
+  assert.Equal(t, 1, len(results))
+  assert.Equal(t, "mail", results[0].Asset.Name)
+
+  w = search(ap, "/?q=vpn")
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "[]", w.Body.String())
+}
+
+func TestSearchFailed(t *testing.T) {
+  ap, scopes := newSearchApp(t)
+
+  for _, target := range []string{
+    "/",
+    "/?q=",
+    "/?q=-ransomware",
+    "/?q=" + strings.Repeat("a", MAX_SEARCH_LEN + 1),
+    "/?q=ransomware&limit=0",
+    "/?q=ransomware&limit=1000",
+    "/?q=ransomware&scope=xxx",
+  } {
+    assert.Equal(t, http.StatusBadRequest, search(ap, target).Code, target)
+  }
+  assert.Equal(t, http.StatusForbidden, search(ap, "/?q=ransomware&scope=" + scopes[2].Hex()).Code)
+}
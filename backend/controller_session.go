@@ -0,0 +1,265 @@
+package main
+
+import (
+  "net/http"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  gsessions "github.com/gorilla/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/middleware"
+)
+
+type ISessionsApp interface {
+  ValidateSession(c *gin.Context)
+  GetSessions(c *gin.Context)
+  RevokeSession(c *gin.Context)
+  RevokeUserSessions(c *gin.Context)
+}
+
+type SessionsApp struct {
+  User_utils auth.IUserUtils
+  Csrf_utils middleware.ICSRFUtils
+  Session_utils auth.ISessionUtils
+  Idle_timeout time.Duration
+  Absolute_timeout time.Duration
+}
+
+/* Do not write the last activity time back more often than this */
+const SESSION_TOUCH_INTERVAL = time.Minute
+
+type SessionItem struct {
+  ID primitive.ObjectID
+  IP string
+  UserAgent string
+  CreateTime time.Time
+  LastActivity time.Time
+  Current bool
+}
+
+type SessionPage struct {
+  UserInfo auth.UserInfo
+  Sessions []SessionItem
+}
+
+func getSessionID(session sessions.Session) (primitive.ObjectID, bool) {
+  sid, ok := session.Get("sid").(string)
+  if (!ok) {
+    return primitive.NilObjectID, false
+  }
+
+  id, err := primitive.ObjectIDFromHex(sid)
+  return id, err == nil
+}
+
+/*
+ * Let the session store issue a new session ID with the next save, so that a
+ * session ID known before the login or a privilege change becomes useless.
+ * The stored data of the old ID are dropped, or the old cookie still works.
+ */
+func renewSessionID(c *gin.Context, session_utils auth.ISessionUtils, session sessions.Session) (error) {
+  s, ok := session.(interface{ Session() *gsessions.Session })
+  if (!ok || s.Session().ID == "") {
+    return nil
+  }
+
+  store_id := s.Session().ID
+  s.Session().ID = ""
+  return session_utils.DeleteStoreID(c.Request.Context(), store_id)
+}
+
+/* Record the metadata of a newly logged in session */
+func startSession(c *gin.Context, session_utils auth.ISessionUtils, user *auth.User) (error) {
+  session := sessions.Default(c)
+  info := auth.SessionInfo{
+    ID: primitive.NewObjectID(),
+    User: user.ID,
+    IP: c.ClientIP(),
+    UserAgent: c.Request.UserAgent(),
+  }
+
+  if id, ok := getSessionID(session); ok {
+    session_utils.DeleteSession(c.Request.Context(), id)
+  }
+  session.Clear()
+  if err := renewSessionID(c, session_utils, session); err != nil {
+    return err
+  }
+
+  session.Set("id", user.ID.Hex())
+  session.Set("role", user.Role)
+  session.Set("sid", info.ID.Hex())
+  err := session.Save()
+  if (err != nil) {
+    return err
+  }
+
+  info.StoreID = session.ID()
+  middleware.SetUserID(c, user.ID.Hex())
+  _, err = session_utils.AddSession(c.Request.Context(), &info)
+  return err
+}
+
+func endSession(c *gin.Context, session_utils auth.ISessionUtils) {
+  session := sessions.Default(c)
+  if id, ok := getSessionID(session); ok {
+    session_utils.DeleteSession(c.Request.Context(), id)
+  }
+
+  session.Clear()
+  session.Options(sessions.Options{Path: "/", MaxAge: -1})
+  session.Save()
+}
+
+func (ap *SessionsApp) rejectSession(c *gin.Context, msg string) {
+  endSession(c, ap.Session_utils)
+  c.String(http.StatusUnauthorized, msg)
+  c.Abort()
+}
+
+func (ap *SessionsApp) expired(info *auth.SessionInfo, now time.Time) bool {
+  if (ap.Idle_timeout > 0 && now.Sub(info.LastActivity) > ap.Idle_timeout) {
+    return true
+  }
+
+  return ap.Absolute_timeout > 0 && now.Sub(info.CreateTime) > ap.Absolute_timeout
+}
+
+/*
+ * Check the session is neither revoked nor expired, and refresh the role from
+ * the database, so that the changes of the user take effect immediately.
+ */
+func (ap *SessionsApp) ValidateSession(c *gin.Context) {
+  session := sessions.Default(c)
+
+  id, ok := getSessionID(session)
+  if (!ok) {
+    ap.rejectSession(c, "Please login first")
+    return
+  }
+
+  info, err := ap.Session_utils.GetSessionByID(c.Request.Context(), id)
+  if (err != nil) {
+    ap.rejectSession(c, "Please login first")
+    return
+  }
+
+  now := time.Now().UTC()
+  if (ap.expired(&info, now)) {
+    ap.rejectSession(c, "Session expired")
+    return
+  }
+
+  user, err := ap.User_utils.GetUserByID(c.Request.Context(), info.User)
+  if (err != nil || user.Disabled) {
+    ap.rejectSession(c, "Please login first")
+    return
+  }
+
+  role, _ := session.Get("role").(uint)
+  if (role != user.Role) {
+    session.Set("role", user.Role)
+    if err := renewSessionID(c, ap.Session_utils, session); err != nil {
+      c.AbortWithError(http.StatusInternalServerError, err)
+      return
+    }
+    if err := session.Save(); err != nil {
+      c.AbortWithError(http.StatusInternalServerError, err)
+      return
+    }
+    ap.Session_utils.SetStoreID(c.Request.Context(), id, session.ID())
+  }
+
+  if (now.Sub(info.LastActivity) > SESSION_TOUCH_INTERVAL) {
+    ap.Session_utils.TouchSession(c.Request.Context(), id, now)
+  }
+
+  middleware.SetUserID(c, info.User.Hex())
+  c.Next()
+}
+
+func (ap *SessionsApp) GetSessions(c *gin.Context) {
+  var session_page SessionPage
+
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+  session_page.UserInfo.Role = session.Get("role").(uint)
+  current, _ := getSessionID(session)
+
+  infos, err := ap.Session_utils.GetSessionsByUserID(c.Request.Context(), u_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  session_page.Sessions = []SessionItem{}
+  for _, info := range infos {
+    session_page.Sessions = append(session_page.Sessions,
+                                   SessionItem{
+                                     ID: info.ID,
+                                     IP: info.IP,
+                                     UserAgent: info.UserAgent,
+                                     CreateTime: info.CreateTime,
+                                     LastActivity: info.LastActivity,
+                                     Current: info.ID == current,
+                                   })
+  }
+
+  ap.Csrf_utils.AddCSRFToken(c)
+  c.JSON(http.StatusOK, session_page)
+}
+
+func (ap *SessionsApp) RevokeSession(c *gin.Context) {
+  var id ID
+
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  if (c.BindJSON(&id) != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  info, err := ap.Session_utils.GetSessionByID(c.Request.Context(), id.Id)
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  } else if (info.User != u_id) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  err = ap.Session_utils.DeleteSession(c.Request.Context(), id.Id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.Status(http.StatusOK)
+}
+
+type RevokedSessions struct {
+  Revoked int64
+}
+
+func (ap *SessionsApp) RevokeUserSessions(c *gin.Context) {
+  var id ID
+
+  if (c.BindJSON(&id) != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  count, err := ap.Session_utils.DeleteSessionsByUserID(c.Request.Context(), id.Id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  c.JSON(http.StatusOK, RevokedSessions{Revoked: count})
+}
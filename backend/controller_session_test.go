@@ -0,0 +1,438 @@
+package main
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+type mockSessionUtils struct {
+  mock.Mock
+}
+
+func (m *mockSessionUtils) AddSession(ctx context.Context, info *auth.SessionInfo) (primitive.ObjectID, error) {
+  args := m.Called(info)
+  return args.Get(0).(primitive.ObjectID), args.Error(1)
+}
+
+func (m *mockSessionUtils) GetSessionByID(ctx context.Context, id primitive.ObjectID) (auth.SessionInfo, error) {
+  args := m.Called(id)
+  return args.Get(0).(auth.SessionInfo), args.Error(1)
+}
+
+func (m *mockSessionUtils) GetSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) ([]auth.SessionInfo, error) {
+  args := m.Called(u_id)
+  return args.Get(0).([]auth.SessionInfo), args.Error(1)
+}
+
+func (m *mockSessionUtils) CountSessions(ctx context.Context, since time.Time) (int64, error) {
+  args := m.Called(since)
+  return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockSessionUtils) TouchSession(ctx context.Context, id primitive.ObjectID, t time.Time) (error) {
+  args := m.Called(id, t)
+  return args.Error(0)
+}
+
+func (m *mockSessionUtils) SetStoreID(ctx context.Context, id primitive.ObjectID, store_id string) (error) {
+  args := m.Called(id, store_id)
+  return args.Error(0)
+}
+
+func (m *mockSessionUtils) DeleteStoreID(ctx context.Context, store_id string) (error) {
+  args := m.Called(store_id)
+  return args.Error(0)
+}
+
+func (m *mockSessionUtils) DeleteSession(ctx context.Context, id primitive.ObjectID) (error) {
+  args := m.Called(id)
+  return args.Error(0)
+}
+
+func (m *mockSessionUtils) DeleteSessionsByUserID(ctx context.Context, u_id primitive.ObjectID) (int64, error) {
+  args := m.Called(u_id)
+  return args.Get(0).(int64), args.Error(1)
+}
+
+func TestValidateSessionNoSID(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  ap := SessionsApp{Session_utils: session_utils_mck}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("id", primitive.NewObjectID().Hex())
+
+  ap.ValidateSession(c)
+
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+  assert.True(t, c.IsAborted())
+}
+
+func TestValidateSessionRevoked(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  sessionID := primitive.NewObjectID()
+  err := errors.New("Get failed")
+  session_utils_mck.On("GetSessionByID", sessionID).Return(auth.SessionInfo{}, err)
+  session_utils_mck.On("DeleteSession", sessionID).Return(err)
+  ap := SessionsApp{Session_utils: session_utils_mck}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
+
+  ap.ValidateSession(c)
+
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+  assert.True(t, c.IsAborted())
+}
+
+func TestValidateSessionExpired(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{
+    ID: sessionID,
+    CreateTime: time.Now().UTC().Add(-time.Hour),
+    LastActivity: time.Now().UTC().Add(-time.Hour),
+  }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  session_utils_mck.On("DeleteSession", sessionID).Return(nil)
+  ap := SessionsApp{Session_utils: session_utils_mck, Idle_timeout: 30 * time.Minute}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
+
+  ap.ValidateSession(c)
+
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+  assert.Equal(t, "Session expired", w.Body.String())
+  session_utils_mck.AssertCalled(t, "DeleteSession", sessionID)
+}
+
+func TestValidateSessionAbsoluteExpired(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{
+    ID: sessionID,
+    CreateTime: time.Now().UTC().Add(-13 * time.Hour),
+    LastActivity: time.Now().UTC(),
+  }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  session_utils_mck.On("DeleteSession", sessionID).Return(nil)
+  ap := SessionsApp{
+    Session_utils: session_utils_mck,
+    Idle_timeout: 30 * time.Minute,
+    Absolute_timeout: 12 * time.Hour,
+  }
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
+
+  ap.ValidateSession(c)
+
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+  assert.Equal(t, "Session expired", w.Body.String())
+}
+
+func TestValidateSessionDisabledUser(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{
+    ID: sessionID,
+    User: userID,
+    CreateTime: time.Now().UTC(),
+    LastActivity: time.Now().UTC(),
+  }
+  mockUser := auth.User{ ID: userID, Disabled: true }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  session_utils_mck.On("DeleteSession", sessionID).Return(nil)
+  auth_utils_mck.On("GetUserByID", userID).Return(mockUser, nil)
+  ap := SessionsApp{User_utils: auth_utils_mck, Session_utils: session_utils_mck}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
+
+  ap.ValidateSession(c)
+
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+  session_utils_mck.AssertCalled(t, "DeleteSession", sessionID)
+}
+
+func TestValidateSessionRoleChanged(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{
+    ID: sessionID,
+    User: userID,
+    CreateTime: time.Now().UTC(),
+    LastActivity: time.Now().UTC(),
+  }
+  mockUser := auth.User{ ID: userID, Role: auth.NormalUser }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  session_utils_mck.On("SetStoreID", sessionID, mock.Anything).Return(nil)
+  auth_utils_mck.On("GetUserByID", userID).Return(mockUser, nil)
+  ap := SessionsApp{User_utils: auth_utils_mck, Session_utils: session_utils_mck}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, _, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
+  session.Set("role", uint(auth.Administrator))
+
+  ap.ValidateSession(c)
+
+  assert.False(t, c.IsAborted())
+  assert.Equal(t, uint(auth.NormalUser), session.Get("role"))
+  session_utils_mck.AssertCalled(t, "SetStoreID", sessionID, mock.Anything)
+}
+
+func TestValidateSession(t *testing.T) {
+  auth_utils_mck := new(mockUserUtils)
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{
+    ID: sessionID,
+    User: userID,
+    CreateTime: time.Now().UTC().Add(-time.Hour),
+    LastActivity: time.Now().UTC().Add(-10 * time.Minute),
+  }
+  mockUser := auth.User{ ID: userID, Role: auth.NormalUser }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  session_utils_mck.On("TouchSession", sessionID, mock.Anything).Return(nil)
+  auth_utils_mck.On("GetUserByID", userID).Return(mockUser, nil)
+  ap := SessionsApp{
+    User_utils: auth_utils_mck,
+    Session_utils: session_utils_mck,
+    Idle_timeout: 30 * time.Minute,
+    Absolute_timeout: 12 * time.Hour,
+  }
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, _, session := GetMockContext(req)
+  session.Set("sid", sessionID.Hex())
+  session.Set("role", uint(auth.NormalUser))
+
+  ap.ValidateSession(c)
+
+  assert.False(t, c.IsAborted())
+  session_utils_mck.AssertCalled(t, "TouchSession", sessionID, mock.Anything)
+  session_utils_mck.AssertNotCalled(t, "SetStoreID", sessionID, mock.Anything)
+}
+
+func TestGetSessions(t *testing.T) {
+  csrf_util_mck := new(mockCsrtUtils)
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  sessionID := primitive.NewObjectID()
+  mockInfos := []auth.SessionInfo{
+    { ID: sessionID, User: userID, IP: "10.0.0.1", UserAgent: "foo" },
+    { ID: primitive.NewObjectID(), User: userID, IP: "10.0.0.2", UserAgent: "bar" },
+  }
+  session_utils_mck.On("GetSessionsByUserID", userID).Return(mockInfos, nil)
+  ap := SessionsApp{Csrf_utils: csrf_util_mck, Session_utils: session_utils_mck}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Set("role", uint(auth.NormalUser))
+  session.Set("sid", sessionID.Hex())
+
+  ap.GetSessions(c)
+
+  var session_page SessionPage
+  json.Unmarshal(w.Body.Bytes(), &session_page)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, 2, len(session_page.Sessions))
+  assert.True(t, session_page.Sessions[0].Current)
+  assert.False(t, session_page.Sessions[1].Current)
+  assert.Equal(t, "10.0.0.2", session_page.Sessions[1].IP)
+}
+
+func TestGetSessionsFailed(t *testing.T) {
+  csrf_util_mck := new(mockCsrtUtils)
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  err := errors.New("Get failed")
+  session_utils_mck.On("GetSessionsByUserID", userID).Return([]auth.SessionInfo{}, err)
+  ap := SessionsApp{Csrf_utils: csrf_util_mck, Session_utils: session_utils_mck}
+
+  req := httptest.NewRequest("GET", "/", bytes.NewBufferString(""))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+  session.Set("role", uint(auth.NormalUser))
+
+  ap.GetSessions(c)
+
+  assert.Equal(t, http.StatusInternalServerError, w.Code)
+  assert.Equal(t, err, c.Errors.Last().Err)
+}
+
+func TestRevokeSessionOfOthers(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{ ID: sessionID, User: primitive.NewObjectID() }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  ap := SessionsApp{Session_utils: session_utils_mck}
+
+  json_bytes, _ := json.Marshal(ID{Id: sessionID})
+  req := httptest.NewRequest("POST", "/", bytes.NewBuffer(json_bytes))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+
+  ap.RevokeSession(c)
+
+  assert.Equal(t, http.StatusForbidden, w.Code)
+  session_utils_mck.AssertNotCalled(t, "DeleteSession", sessionID)
+}
+
+func TestRevokeSession(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  sessionID := primitive.NewObjectID()
+  mockInfo := auth.SessionInfo{ ID: sessionID, User: userID }
+  session_utils_mck.On("GetSessionByID", sessionID).Return(mockInfo, nil)
+  session_utils_mck.On("DeleteSession", sessionID).Return(nil)
+  ap := SessionsApp{Session_utils: session_utils_mck}
+
+  json_bytes, _ := json.Marshal(ID{Id: sessionID})
+  req := httptest.NewRequest("POST", "/", bytes.NewBuffer(json_bytes))
+  c, w, session := GetMockContext(req)
+  session.Set("id", userID.Hex())
+
+  ap.RevokeSession(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  session_utils_mck.AssertCalled(t, "DeleteSession", sessionID)
+}
+
+func TestRevokeUserSessionsWrongJSON(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  ap := SessionsApp{Session_utils: session_utils_mck}
+
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("POST", "/", bytes.NewBufferString("{"))
+  c, w, _ := GetMockContext(req)
+
+  ap.RevokeUserSessions(c)
+
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+  session_utils_mck := new(mockSessionUtils)
+  userID := primitive.NewObjectID()
+  session_utils_mck.On("DeleteSessionsByUserID", userID).Return(int64(3), nil)
+  ap := SessionsApp{Session_utils: session_utils_mck}
+
+  json_bytes, _ := json.Marshal(ID{Id: userID})
+  req := httptest.NewRequest("POST", "/", bytes.NewBuffer(json_bytes))
+  c, w, _ := GetMockContext(req)
+
+  ap.RevokeUserSessions(c)
+
+  var revoked RevokedSessions
+  json.Unmarshal(w.Body.Bytes(), &revoked)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, int64(3), revoked.Revoked)
+}
+
+/* A context with the sessions of the store, and the cookies of the response */
+func getStoreContext(store sessions.Store, w_prev *httptest.ResponseRecorder) (*gin.Context, *httptest.ResponseRecorder, sessions.Session) {
+  req := httptest.NewRequest("GET", "/", nil)
+  if w_prev != nil {
+    for _, cookie := range w_prev.Result().Cookies() {
+      req.AddCookie(cookie)
+    }
+  }
+
+  w := httptest.NewRecorder()
+  c, _ := gin.CreateTestContext(w)
+  c.Request = req
+  sessions.Sessions("sessionid", store)(c)
+  return c, w, sessions.Default(c)
+}
+
+func TestValidateSessionRenewStore(t *testing.T) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "sessions.db"))
+  assert.Nil(t, err)
+  defer db.Close()
+  store := auth.NewBoltStore(db, 3600, []byte("secret"))
+  session_utils := &auth.BoltSessionUtils{DB: db}
+
+  auth_utils_mck := new(mockUserUtils)
+  userID := primitive.NewObjectID()
+  auth_utils_mck.On("GetUserByID", userID).Return(auth.User{ID: userID, Role: auth.NormalUser}, nil)
+  ap := SessionsApp{User_utils: auth_utils_mck, Session_utils: session_utils}
+
+  /* A session logged in as an Administrator */
+  c, w_old, session := getStoreContext(store, nil)
+  sessionID, err := session_utils.AddSession(context.TODO(), &auth.SessionInfo{User: userID})
+  assert.Nil(t, err)
+  session.Set("sid", sessionID.Hex())
+  session.Set("role", uint(auth.Administrator))
+  assert.Nil(t, session.Save())
+  old_id := session.ID()
+  assert.Nil(t, session_utils.SetStoreID(context.TODO(), sessionID, old_id))
+
+  /* The role is changed, then the session ID is renewed */
+  c, w, session := getStoreContext(store, w_old)
+  ap.ValidateSession(c)
+  assert.False(t, c.IsAborted())
+  assert.NotEqual(t, old_id, session.ID())
+  info, _ := session_utils.GetSessionByID(context.TODO(), sessionID)
+  assert.Equal(t, session.ID(), info.StoreID)
+
+  /* The old session ID does not load anymore */
+  _, _, session = getStoreContext(store, w_old)
+  assert.Nil(t, session.Get("sid"))
+  _, _, session = getStoreContext(store, w)
+  assert.Equal(t, sessionID.Hex(), session.Get("sid"))
+}
+
+func TestStartSessionRenewStore(t *testing.T) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "sessions.db"))
+  assert.Nil(t, err)
+  defer db.Close()
+  store := auth.NewBoltStore(db, 3600, []byte("secret"))
+  session_utils := &auth.BoltSessionUtils{DB: db}
+
+  /* A session before the login, whose ID might be planted */
+  _, w_old, session := getStoreContext(store, nil)
+  session.Set("foo", "bar")
+  assert.Nil(t, session.Save())
+  old_id := session.ID()
+
+  c, w, session := getStoreContext(store, w_old)
+  user := auth.User{ID: primitive.NewObjectID(), Role: auth.NormalUser}
+  assert.Nil(t, startSession(c, session_utils, &user))
+  assert.NotEqual(t, old_id, session.ID())
+
+  _, _, session = getStoreContext(store, w_old)
+  assert.Nil(t, session.Get("foo"))
+  assert.Nil(t, session.Get("id"))
+  _, _, session = getStoreContext(store, w)
+  assert.Equal(t, user.ID.Hex(), session.Get("id"))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+  "net/http"
+  "strconv"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type IStatisticsApp interface {
+  GetStatistics(c *gin.Context)
+  GetScopeStatistics(c *gin.Context)
+}
+
+type StatisticsApp struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Statistics_utils risk_assessment.IStatisticsUtils
+}
+
+const DEFAULT_TOP_RISKS = 10
+const MAX_TOP_RISKS = 100
+
+/* The ?top=N risks, or false if it is not in 1..MAX_TOP_RISKS */
+func topRisks(c *gin.Context) (int, bool) {
+  top, err := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(DEFAULT_TOP_RISKS)))
+  return top, err == nil && top >= 1 && top <= MAX_TOP_RISKS
+}
+
+/* The statistics of all the user's scopes */
+func (ap *StatisticsApp) GetStatistics(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  top, ok := topRisks(c)
+  if (!ok) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  user, err := ap.User_utils.GetUserByID(c.Request.Context(), u_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  scopes := []risk_assessment.Scope{}
+  if (len(user.Scopes) > 0) {
+    scopes, err = ap.Scope_utils.GetScopeByIDs(c.Request.Context(), user.Scopes)
+    if (err != nil) {
+      c.AbortWithError(http.StatusInternalServerError, err)
+      return
+    }
+  }
+
+  statistics, err := ap.Statistics_utils.GetStatistics(c.Request.Context(), scopes, top)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.JSON(http.StatusOK, statistics)
+}
+
+/* The statistics of the scope, if the user has the scope */
+func (ap *StatisticsApp) GetScopeStatistics(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  top, ok := topRisks(c)
+  if (!ok) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  statistics, err := ap.Statistics_utils.GetStatistics(c.Request.Context(), []risk_assessment.Scope{scope}, top)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.JSON(http.StatusOK, statistics)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newStatisticsApp(t *testing.T, authorized bool) (*StatisticsApp, []risk_assessment.Scope) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "statistics.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  scopes := []risk_assessment.Scope{
+    {ID: primitive.NewObjectID(), Name: "foo"},
+    {ID: primitive.NewObjectID(), Name: "bar", Levels: risk_assessment.RiskLevels{Medium: 10, High: 20}},
+  }
+  asset_utils := &risk_assessment.BoltAssetUtils{DB: db}
+  for _, asset := range []risk_assessment.Asset{
+    {
+      Scope: scopes[0].ID, BigCategory: "Hardware", Name: "web",
+      Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+      Risks: []risk_assessment.Risk{{Threat: "baz", Possibility: 2, Impact: 4}},
+    },
+    {
+      Scope: scopes[1].ID, BigCategory: "Data", Name: "docs",
+      Value: risk_assessment.Value{Confidentiality: 1, Integrity: 1, Availability: 1},
+      Risks: []risk_assessment.Risk{{Threat: "leak", Possibility: 3, Impact: 4}},
+    },
+    {Scope: scopes[1].ID, BigCategory: "Data", Name: "empty", Risks: []risk_assessment.Risk{}},
+  } {
+    assert.Nil(t, asset_utils.AddAsset(context.TODO(), &asset))
+  }
+
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  auth_util_mck.On("UserHasScopeID", mock.Anything, scopes[0].ID).Return(authorized, nil)
+  auth_util_mck.On("GetUserByID", mock.Anything).Return(auth.User{Scopes: []primitive.ObjectID{scopes[0].ID, scopes[1].ID}}, nil)
+  scope_util_mck.On("GetScopeByID", scopes[0].ID).Return(scopes[0], nil)
+  scope_util_mck.On("GetScopeByIDs", []primitive.ObjectID{scopes[0].ID, scopes[1].ID}).Return(scopes, nil)
+
+  ap := &StatisticsApp{User_utils: auth_util_mck, Scope_utils: scope_util_mck, Statistics_utils: asset_utils}
+  return ap, scopes
+}
+
+func statisticsContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", target, nil)
+  c, w, session := GetMockContext(req)
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  return c, w
+}
+
+func TestGetScopeStatistics(t *testing.T) {
+  ap, scopes := newStatisticsApp(t, true)
+
+  c, w := statisticsContext("/")
+  c.Params = gin.Params{{Key: "scopeID", Value: scopes[0].ID.Hex()}}
+  ap.GetScopeStatistics(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  var statistics risk_assessment.Statistics
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &statistics))
+  assert.Equal(t, 1, statistics.Scopes)
+  assert.Equal(t, 1, statistics.Assets)
+  assert.Equal(t, map[string]int{"low": 0, "medium": 0, "high": 1}, statistics.Levels)
+  assert.Equal(t, 1, statistics.HeatMap.Counts[1][3])
+  assert.Equal(t, uint(48), statistics.TopRisks[0].Score)
+}
+
+func TestGetStatistics(t *testing.T) {
+  ap, _ := newStatisticsApp(t, true)
+
+  c, w := statisticsContext("/?top=1")
+  ap.GetStatistics(c)
+
+  assert.Equal(t, http.StatusOK, w.Code)
+  var statistics risk_assessment.Statistics
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &statistics))
+  assert.Equal(t, 2, statistics.Scopes)
+  assert.Equal(t, 3, statistics.Assets)
+  assert.Equal(t, 2, statistics.Risks)
+  /* 36 is high in the second scope */
+  assert.Equal(t, map[string]int{"low": 0, "medium": 0, "high": 2}, statistics.Levels)
+  assert.Equal(t, 1, len(statistics.TopRisks))
+  assert.Equal(t, "web", statistics.TopRisks[0].AssetName)
+  assert.Equal(t, "empty", statistics.Unassessed[0].Name)
+  assert.Equal(t, []risk_assessment.CategoryValue{
+    {BigCategory: "Data", Assets: 2, Average: 1.5, Max: 3},
+    {BigCategory: "Hardware", Assets: 1, Average: 6, Max: 6},
+  }, statistics.Categories)
+}
+
+func TestGetStatisticsBadRequest(t *testing.T) {
+  ap, scopes := newStatisticsApp(t, true)
+
+  for _, target := range []string{"/?top=0", "/?top=101", "/?top=foo"} {
+    c, w := statisticsContext(target)
+    ap.GetStatistics(c)
+    assert.Equal(t, http.StatusBadRequest, w.Code)
+  }
+
+  c, w := statisticsContext("/")
+  c.Params = gin.Params{{Key: "scopeID", Value: "foo"}}
+  ap.GetScopeStatistics(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  c, w = statisticsContext("/?top=0")
+  c.Params = gin.Params{{Key: "scopeID", Value: scopes[0].ID.Hex()}}
+  ap.GetScopeStatistics(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetScopeStatisticsForbidden(t *testing.T) {
+  ap, scopes := newStatisticsApp(t, false)
+
+  c, w := statisticsContext("/")
+  c.Params = gin.Params{{Key: "scopeID", Value: scopes[0].ID.Hex()}}
+  ap.GetScopeStatistics(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
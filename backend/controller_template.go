@@ -0,0 +1,275 @@
+package main
+
+import (
+  "bytes"
+  "io"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type ITemplateApp interface {
+  GetTemplates(c *gin.Context)
+  RenderReport(c *gin.Context)
+  GetTemplate(c *gin.Context)
+  AddTemplate(c *gin.Context)
+  UpdateTemplate(c *gin.Context)
+  DeleteTemplate(c *gin.Context)
+  PreviewTemplate(c *gin.Context)
+}
+
+type TemplateApp struct {
+  User_utils auth.IUserUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+  Template_utils report.ITemplateUtils
+}
+
+/* The largest template which could be uploaded */
+const MAX_TEMPLATE_SIZE = 1 << 20
+
+/* The template without its content, and the default one has the ID "default" */
+type TemplateInfo struct {
+  ID string
+  Name string
+  Format string
+  UpdateTime time.Time
+}
+
+func templateInfo(tmpl *report.Template) TemplateInfo {
+  return TemplateInfo{ID: tmpl.ID.Hex(), Name: tmpl.Name, Format: tmpl.Format, UpdateTime: tmpl.UpdateTime}
+}
+
+/* The default template, or the stored one of the ID */
+func (ap *TemplateApp) getTemplate(c *gin.Context, id string) (report.Template, int, error) {
+  if (id == "" || id == report.DEFAULT_TEMPLATE_ID) {
+    return report.DEFAULT_TEMPLATE, http.StatusOK, nil
+  }
+
+  t_id, err := primitive.ObjectIDFromHex(id)
+  if (err != nil) {
+    return report.Template{}, http.StatusBadRequest, err
+  }
+
+  tmpl, err := ap.Template_utils.GetTemplateByID(c.Request.Context(), t_id)
+  if (err == database.ErrNotFound) {
+    return tmpl, http.StatusNotFound, err
+  } else if (err != nil) {
+    return tmpl, http.StatusInternalServerError, err
+  }
+  return tmpl, http.StatusOK, nil
+}
+
+/* The scope and its assets, if the user has the scope */
+func (ap *TemplateApp) getScope(c *gin.Context, scopeID string) (*report.Data, int, error) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(scopeID)
+  if (err != nil) {
+    return nil, http.StatusBadRequest, err
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    return nil, http.StatusInternalServerError, err
+  } else if (!authorized) {
+    return nil, http.StatusForbidden, nil
+  }
+
+  scope, err := ap.Scope_utils.GetScopeByID(c.Request.Context(), s_id)
+  if (err != nil) {
+    return nil, http.StatusInternalServerError, err
+  }
+
+  assets, err := ap.Asset_utils.GetAssetsByScopeID(c.Request.Context(), s_id)
+  if (err != nil) {
+    return nil, http.StatusInternalServerError, err
+  }
+  return report.NewData(&scope, assets, time.Now()), http.StatusOK, nil
+}
+
+func abortWithStatus(c *gin.Context, status int, err error) {
+  if (status == http.StatusInternalServerError) {
+    c.AbortWithError(status, err)
+  } else {
+    c.AbortWithStatus(status)
+  }
+}
+
+/*
+ * Render the data with the template, or report why the template fails.  Only
+ * the rendered report is a download of the filename, if one is given.
+ */
+func render(c *gin.Context, tmpl *report.Template, data *report.Data, filename string) {
+  var buf bytes.Buffer
+  if err := tmpl.Render(c.Request.Context(), &buf, data); (err != nil) {
+    c.String(http.StatusUnprocessableEntity, err.Error())
+    return
+  }
+  if (filename != "") {
+    c.Header("Content-Disposition", `attachment; filename="` + filename + `"`)
+  }
+  c.Data(http.StatusOK, report.CONTENT_TYPES[tmpl.Format], buf.Bytes())
+}
+
+/* List the default and the stored templates */
+func (ap *TemplateApp) GetTemplates(c *gin.Context) {
+  templates, err := ap.Template_utils.GetTemplates(c.Request.Context())
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+
+  infos := []TemplateInfo{templateInfo(&report.DEFAULT_TEMPLATE)}
+  infos[0].ID = report.DEFAULT_TEMPLATE_ID
+  for i := range templates {
+    infos = append(infos, templateInfo(&templates[i]))
+  }
+  c.JSON(http.StatusOK, infos)
+}
+
+/* Download the report of the scope rendered with the ?template=ID, if the user has the scope */
+func (ap *TemplateApp) RenderReport(c *gin.Context) {
+  data, status, err := ap.getScope(c, c.Param("scopeID"))
+  if (status != http.StatusOK) {
+    abortWithStatus(c, status, err)
+    return
+  }
+
+  tmpl, status, err := ap.getTemplate(c, c.Query("template"))
+  if (status != http.StatusOK) {
+    abortWithStatus(c, status, err)
+    return
+  }
+
+  render(c, &tmpl, data, "report-" + data.Scope.ID.Hex() + report.EXTENSIONS[tmpl.Format])
+}
+
+/* Download the template's file, to edit it or to start a new one from the default template */
+func (ap *TemplateApp) GetTemplate(c *gin.Context) {
+  tmpl, status, err := ap.getTemplate(c, c.Param("templateID"))
+  if (status != http.StatusOK) {
+    abortWithStatus(c, status, err)
+    return
+  }
+
+  c.Header("Content-Disposition", `attachment; filename="template` + report.EXTENSIONS[tmpl.Format] + `"`)
+  c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(tmpl.Content))
+}
+
+/* The uploaded template file with the ?name= and the ?format=, which is not validated */
+func readTemplate(c *gin.Context) (report.Template, error) {
+  tmpl := report.Template{
+    Name: strings.TrimSpace(c.Query("name")),
+    Format: c.DefaultQuery("format", report.HTMLFormat),
+  }
+
+  content, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MAX_TEMPLATE_SIZE))
+  if (err != nil) {
+    return tmpl, err
+  }
+  tmpl.Content = string(content)
+  return tmpl, nil
+}
+
+func (ap *TemplateApp) AddTemplate(c *gin.Context) {
+  tmpl, err := readTemplate(c)
+  if (err == nil) {
+    err = tmpl.Validate()
+  }
+  if (err != nil) {
+    c.String(http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if err := ap.Template_utils.AddTemplate(c.Request.Context(), &tmpl); (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.JSON(http.StatusOK, templateInfo(&tmpl))
+}
+
+func (ap *TemplateApp) UpdateTemplate(c *gin.Context) {
+  stored, status, err := ap.getTemplate(c, c.Param("templateID"))
+  if (status == http.StatusOK && stored.ID.IsZero()) {
+    /* The default template is not stored */
+    status = http.StatusBadRequest
+  }
+  if (status != http.StatusOK) {
+    abortWithStatus(c, status, err)
+    return
+  }
+
+  tmpl, err := readTemplate(c)
+  if (err == nil) {
+    err = tmpl.Validate()
+  }
+  if (err != nil) {
+    c.String(http.StatusBadRequest, err.Error())
+    return
+  }
+
+  tmpl.ID = stored.ID
+  tmpl.CreateTime = stored.CreateTime
+  if err := ap.Template_utils.UpdateTemplate(c.Request.Context(), &tmpl); (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.JSON(http.StatusOK, templateInfo(&tmpl))
+}
+
+func (ap *TemplateApp) DeleteTemplate(c *gin.Context) {
+  t_id, err := primitive.ObjectIDFromHex(c.Param("templateID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  if err := ap.Template_utils.DeleteTemplate(c.Request.Context(), t_id); (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.Status(http.StatusOK)
+}
+
+/*
+ * Render the uploaded template without storing it, with the ?scope= which
+ * the administrator has, or the sample data
+ */
+func (ap *TemplateApp) PreviewTemplate(c *gin.Context) {
+  tmpl, err := readTemplate(c)
+  if (err == nil) {
+    /* The preview needs no name */
+    if (tmpl.Name == "") {
+      tmpl.Name = "Preview"
+    }
+    err = tmpl.Validate()
+  }
+  if (err != nil) {
+    c.String(http.StatusBadRequest, err.Error())
+    return
+  }
+
+  data := report.SampleData(time.Now())
+  if scopeID := c.Query("scope"); (scopeID != "") {
+    var status int
+    data, status, err = ap.getScope(c, scopeID)
+    if (status != http.StatusOK) {
+      abortWithStatus(c, status, err)
+      return
+    }
+  }
+
+  render(c, &tmpl, data, "")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newTemplateApp(t *testing.T, authorized bool) (*TemplateApp, primitive.ObjectID) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "templates.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  auth_util_mck := new(mockUserUtils)
+  scope_util_mck := new(mockScopeUtils)
+  asset_util_mck := new(mockAssetUtils)
+  scope := risk_assessment.Scope{ID: primitive.NewObjectID(), Name: "foo"}
+  assets := []risk_assessment.Asset{{
+    ID: primitive.NewObjectID(),
+    Scope: scope.ID,
+    Name: "bar",
+    Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []risk_assessment.Risk{{Threat: "baz", Possibility: 2, Impact: 4}},
+  }}
+  auth_util_mck.On("UserHasScopeID", mock.Anything, scope.ID).Return(authorized, nil)
+  scope_util_mck.On("GetScopeByID", scope.ID).Return(scope, nil)
+  asset_util_mck.On("GetAssetsByScopeID", scope.ID).Return(assets, nil)
+
+  ap := &TemplateApp{
+    User_utils: auth_util_mck,
+    Scope_utils: scope_util_mck,
+    Asset_utils: asset_util_mck,
+    Template_utils: &report.BoltTemplateUtils{DB: db},
+  }
+  return ap, scope.ID
+}
+
+func templateContext(method string, target string, body string) (*gin.Context, *httptest.ResponseRecorder) {
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest(method, target, strings.NewReader(body))
+  c, w, session := GetMockContext(req)
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  return c, w
+}
+
+func TestAddTemplate(t *testing.T) {
+  ap, s_id := newTemplateApp(t, true)
+
+  c, w := templateContext("POST", "/?name=+foo+&format=html", "<h1>{{.Scope.Name}}</h1>")
+  ap.AddTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  var info TemplateInfo
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &info))
+  assert.Equal(t, "foo", info.Name)
+  assert.Equal(t, report.HTMLFormat, info.Format)
+
+  /* The default template is listed first */
+  c, w = templateContext("GET", "/", "")
+  ap.GetTemplates(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  var infos []TemplateInfo
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &infos))
+  assert.Equal(t, 2, len(infos))
+  assert.Equal(t, report.DEFAULT_TEMPLATE_ID, infos[0].ID)
+  assert.Equal(t, report.MarkdownFormat, infos[0].Format)
+  assert.Equal(t, info.ID, infos[1].ID)
+
+  /* Render the report */
+  c, w = templateContext("GET", "/?template=" + info.ID, "")
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  ap.RenderReport(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+  assert.Equal(t, `attachment; filename="report-` + s_id.Hex() + `.html"`, w.Header().Get("Content-Disposition"))
+  assert.Equal(t, "<h1>foo</h1>", w.Body.String())
+
+  /* Update and download the template */
+  c, w = templateContext("POST", "/?name=foo&format=markdown", "# {{.Scope.Name}}")
+  c.Params = gin.Params{{Key: "templateID", Value: info.ID}}
+  ap.UpdateTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+
+  c, w = templateContext("GET", "/", "")
+  c.Params = gin.Params{{Key: "templateID", Value: info.ID}}
+  ap.GetTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, `attachment; filename="template.md"`, w.Header().Get("Content-Disposition"))
+  assert.Equal(t, "# {{.Scope.Name}}", w.Body.String())
+
+  /* Delete the template */
+  c, w = templateContext("POST", "/", "")
+  c.Params = gin.Params{{Key: "templateID", Value: info.ID}}
+  ap.DeleteTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+
+  c, w = templateContext("GET", "/?template=" + info.ID, "")
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  ap.RenderReport(c)
+  assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAddTemplateInvalid(t *testing.T) {
+  ap, _ := newTemplateApp(t, true)
+
+  c, w := templateContext("POST", "/?name=foo&format=html", "{{.Scope.Name")
+  ap.AddTemplate(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+  assert.Contains(t, w.Body.String(), "unclosed action")
+
+  c, w = templateContext("POST", "/?format=html", "foo")
+  ap.AddTemplate(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  c, w = templateContext("POST", "/?name=foo&format=html", strings.Repeat("x", MAX_TEMPLATE_SIZE + 1))
+  ap.AddTemplate(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+
+  /* The default template cannot be changed */
+  c, w = templateContext("POST", "/?name=foo", "foo")
+  c.Params = gin.Params{{Key: "templateID", Value: report.DEFAULT_TEMPLATE_ID}}
+  ap.UpdateTemplate(c)
+  assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRenderReportDefault(t *testing.T) {
+  ap, s_id := newTemplateApp(t, true)
+
+  c, w := templateContext("GET", "/", "")
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  ap.RenderReport(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+  assert.Contains(t, w.Body.String(), "| 1 | bar | baz |  | (none) | 2 | 4 | 48 | High |")
+}
+
+func TestRenderReportForbidden(t *testing.T) {
+  ap, s_id := newTemplateApp(t, false)
+
+  c, w := templateContext("GET", "/", "")
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  ap.RenderReport(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestPreviewTemplate(t *testing.T) {
+  ap, s_id := newTemplateApp(t, true)
+
+  /* The sample data without a scope */
+  c, w := templateContext("POST", "/?format=markdown", "{{.Scope.Name}} {{.Statistics.Risks}}")
+  ap.PreviewTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "Sample 3", w.Body.String())
+
+  c, w = templateContext("POST", "/?format=markdown&scope=" + s_id.Hex(), "{{.Scope.Name}} {{.Statistics.Risks}}")
+  ap.PreviewTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "foo 1", w.Body.String())
+
+  /* The template fails with the data */
+  c, w = templateContext("POST", "/?format=markdown", "{{.Scope.Foo}}")
+  ap.PreviewTemplate(c)
+  assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+  assert.Contains(t, w.Body.String(), "can't evaluate field Foo")
+
+  templates, _ := ap.Template_utils.GetTemplates(c.Request.Context())
+  assert.Equal(t, 0, len(templates))
+}
+
+func TestRenderReportFailed(t *testing.T) {
+  ap, s_id := newTemplateApp(t, true)
+
+  /* The sample data have more assets than the scope */
+  c, w := templateContext("POST", "/?name=foo&format=markdown", "{{(index .Assets 1).Name}}")
+  ap.AddTemplate(c)
+  assert.Equal(t, http.StatusOK, w.Code)
+  var info TemplateInfo
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &info))
+
+  /* The error is not a download of the report */
+  c, w = templateContext("GET", "/?template=" + info.ID, "")
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id.Hex()}}
+  ap.RenderReport(c)
+  assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+  assert.Contains(t, w.Body.String(), "out of range")
+  assert.Empty(t, w.Header().Get("Content-Disposition"))
+}
+
+func TestPreviewTemplateForbidden(t *testing.T) {
+  ap, s_id := newTemplateApp(t, false)
+
+  c, w := templateContext("POST", "/?format=markdown&scope=" + s_id.Hex(), "{{.Scope.Name}}")
+  ap.PreviewTemplate(c)
+  assert.Equal(t, http.StatusForbidden, w.Code)
+}
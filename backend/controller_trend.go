@@ -0,0 +1,80 @@
+package main
+
+import (
+  "net/http"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/gin-contrib/sessions"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type ITrendApp interface {
+  GetTrend(c *gin.Context)
+}
+
+type TrendApp struct {
+  User_utils auth.IUserUtils
+  Trend_utils risk_assessment.ITrendUtils
+}
+
+/* The dates of the ?from= and the ?to= */
+const TREND_DATE_FORMAT = time.DateOnly
+
+/* The trend covers an assessment cycle of a year by default */
+const DEFAULT_TREND_DAYS = 365
+
+/* The ?name= date, or the default one if it is not given */
+func trendDate(c *gin.Context, name string, default_date time.Time) (time.Time, error) {
+  value := c.Query(name)
+  if (value == "") {
+    return risk_assessment.TrendDay(default_date), nil
+  }
+  return time.Parse(TREND_DATE_FORMAT, value)
+}
+
+/*
+ * The daily points of the scope from the ?from= to the ?to= date, both
+ * included, if the user has the scope.  The dates are in UTC.
+ */
+func (ap *TrendApp) GetTrend(c *gin.Context) {
+  session := sessions.Default(c)
+  userID := session.Get("id").(string)
+  u_id, _ := primitive.ObjectIDFromHex(userID)
+
+  s_id, err := primitive.ObjectIDFromHex(c.Param("scopeID"))
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  to, err := trendDate(c, "to", time.Now())
+  if (err != nil) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+  from, err := trendDate(c, "from", to.AddDate(0, 0, -DEFAULT_TREND_DAYS))
+  if (err != nil || from.After(to)) {
+    c.AbortWithStatus(http.StatusBadRequest)
+    return
+  }
+
+  authorized, err := ap.User_utils.UserHasScopeID(c.Request.Context(), u_id, s_id)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  } else if (!authorized) {
+    c.AbortWithStatus(http.StatusForbidden)
+    return
+  }
+
+  points, err := ap.Trend_utils.GetTrend(c.Request.Context(), s_id, from, to)
+  if (err != nil) {
+    c.AbortWithError(http.StatusInternalServerError, err)
+    return
+  }
+  c.JSON(http.StatusOK, points)
+}
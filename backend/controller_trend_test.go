@@ -0,0 +1,92 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/gin-gonic/gin"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func newTrendApp(t *testing.T, authorized bool) (*TrendApp, primitive.ObjectID) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "trend.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  s_id := primitive.NewObjectID()
+  trend_utils := &risk_assessment.BoltTrendUtils{DB: db}
+  today := risk_assessment.TrendDay(time.Now())
+  for _, date := range []time.Time{
+    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+    time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+    today.AddDate(0, 0, -400),
+    today.AddDate(0, 0, -30),
+    today,
+  } {
+    point := risk_assessment.TrendPoint{Scope: s_id, Date: date, Assets: 1}
+    assert.Nil(t, trend_utils.RecordTrendPoint(context.TODO(), &point))
+  }
+
+  auth_util_mck := new(mockUserUtils)
+  auth_util_mck.On("UserHasScopeID", mock.Anything, s_id).Return(authorized, nil)
+
+  return &TrendApp{User_utils: auth_util_mck, Trend_utils: trend_utils}, s_id
+}
+
+func getTrend(ap *TrendApp, s_id string, target string) *httptest.ResponseRecorder {
+  gin.SetMode(gin.TestMode)
+  req := httptest.NewRequest("GET", target, nil)
+  c, w, session := GetMockContext(req)
+  session.Set("id", primitive.NewObjectID().Hex())
+  session.Save()
+  c.Params = gin.Params{{Key: "scopeID", Value: s_id}}
+  ap.GetTrend(c)
+  return w
+}
+
+func TestGetTrend(t *testing.T) {
+  ap, s_id := newTrendApp(t, true)
+
+  w := getTrend(ap, s_id.Hex(), "/?from=2026-01-01&to=2026-01-01")
+  assert.Equal(t, http.StatusOK, w.Code)
+  var points []risk_assessment.TrendPoint
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &points))
+  assert.Equal(t, 1, len(points))
+  assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), points[0].Date)
+
+  /* The last year by default */
+  w = getTrend(ap, s_id.Hex(), "/")
+  assert.Equal(t, http.StatusOK, w.Code)
+  points = nil
+  assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &points))
+  assert.LessOrEqual(t, 2, len(points))
+  assert.Equal(t, risk_assessment.TrendDay(time.Now()), points[len(points) - 1].Date)
+  for i := range points {
+    assert.False(t, points[i].Date.Before(risk_assessment.TrendDay(time.Now()).AddDate(0, 0, -DEFAULT_TREND_DAYS)))
+  }
+
+  /* No points is an empty array */
+  w = getTrend(ap, s_id.Hex(), "/?from=2000-01-01&to=2000-12-31")
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Equal(t, "[]", w.Body.String())
+}
+
+func TestGetTrendFailed(t *testing.T) {
+  ap, s_id := newTrendApp(t, false)
+
+  assert.Equal(t, http.StatusBadRequest, getTrend(ap, "xxx", "/").Code)
+  for _, target := range []string{"/?from=2026-13-01", "/?to=yesterday", "/?from=2026-02-01&to=2026-01-01"} {
+    assert.Equal(t, http.StatusBadRequest, getTrend(ap, s_id.Hex(), target).Code, target)
+  }
+  assert.Equal(t, http.StatusForbidden, getTrend(ap, s_id.Hex(), "/").Code)
+}
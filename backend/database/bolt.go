@@ -0,0 +1,124 @@
+package database
+
+import (
+  "context"
+  "time"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+  "go.mongodb.org/mongo-driver/mongo"
+)
+
+/*
+ * The embedded backend keeps the documents in a bbolt file.  Each collection
+ * is a bucket, and each document is BSON keyed by its ObjectID, so both the
+ * documents and their order are the same as the ones in MongoDB.
+ */
+
+/* Both backends report a missing document with the MongoDB error */
+var ErrNotFound = mongo.ErrNoDocuments
+
+func OpenBolt(path string) (*bbolt.DB, error) {
+  return bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+}
+
+/* bbolt cannot be interrupted, so only a context which is already done stops it */
+func BoltView(ctx context.Context, db *bbolt.DB, fn func(tx *bbolt.Tx) error) error {
+  if err := ctx.Err(); err != nil {
+    return err
+  }
+  return db.View(fn)
+}
+
+func BoltUpdate(ctx context.Context, db *bbolt.DB, fn func(tx *bbolt.Tx) error) error {
+  if err := ctx.Err(); err != nil {
+    return err
+  }
+  return db.Update(fn)
+}
+
+func BoltPut(tx *bbolt.Tx, bucket string, id primitive.ObjectID, doc interface{}) error {
+  b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+  if err != nil {
+    return err
+  }
+
+  data, err := bson.Marshal(doc)
+  if err != nil {
+    return err
+  }
+  return b.Put(id[:], data)
+}
+
+func BoltGet(tx *bbolt.Tx, bucket string, id primitive.ObjectID, doc interface{}) error {
+  b := tx.Bucket([]byte(bucket))
+  if b == nil {
+    return ErrNotFound
+  }
+
+  data := b.Get(id[:])
+  if data == nil {
+    return ErrNotFound
+  }
+  return bson.Unmarshal(data, doc)
+}
+
+func BoltHas(tx *bbolt.Tx, bucket string, id primitive.ObjectID) bool {
+  b := tx.Bucket([]byte(bucket))
+  return b != nil && b.Get(id[:]) != nil
+}
+
+/* Deleting a missing document is not an error, just like MongoDB */
+func BoltDelete(tx *bbolt.Tx, bucket string, id primitive.ObjectID) error {
+  b := tx.Bucket([]byte(bucket))
+  if b == nil {
+    return nil
+  }
+  return b.Delete(id[:])
+}
+
+/* Delete all the documents of the bucket, which may be missing */
+func BoltClear(tx *bbolt.Tx, bucket string) error {
+  err := tx.DeleteBucket([]byte(bucket))
+  if err == bbolt.ErrBucketNotFound {
+    return nil
+  }
+  return err
+}
+
+/* Decode the documents in the order of their IDs, which match the filter */
+func BoltFind[T any](tx *bbolt.Tx, bucket string, match func(doc *T) bool) ([]T, error) {
+  var docs []T
+
+  b := tx.Bucket([]byte(bucket))
+  if b == nil {
+    return docs, nil
+  }
+
+  err := b.ForEach(func(_, data []byte) error {
+    var doc T
+    if err := bson.Unmarshal(data, &doc); err != nil {
+      return err
+    }
+    if match == nil || match(&doc) {
+      docs = append(docs, doc)
+    }
+    return nil
+  })
+  return docs, err
+}
+
+/* The first document matching the filter, or ErrNotFound */
+func BoltFindOne[T any](tx *bbolt.Tx, bucket string, match func(doc *T) bool) (T, error) {
+  var found T
+
+  docs, err := BoltFind(tx, bucket, match)
+  if err != nil {
+    return found, err
+  }
+  if len(docs) == 0 {
+    return found, ErrNotFound
+  }
+  return docs[0], nil
+}
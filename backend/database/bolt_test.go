@@ -0,0 +1,69 @@
+package database
+
+import (
+  "context"
+  "path/filepath"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type boltDoc struct {
+  ID primitive.ObjectID `bson:"_id"`
+  Name string
+}
+
+func TestBolt(t *testing.T) {
+  db, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+  assert.Nil(t, err)
+  defer db.Close()
+
+  id := primitive.NewObjectID()
+  err = BoltUpdate(context.TODO(), db, func(tx *bbolt.Tx) error {
+    BoltPut(tx, "docs", primitive.NewObjectID(), &boltDoc{Name: "bar"})
+    return BoltPut(tx, "docs", id, &boltDoc{ID: id, Name: "foo"})
+  })
+  assert.Nil(t, err)
+
+  BoltView(context.TODO(), db, func(tx *bbolt.Tx) error {
+    var doc boltDoc
+    assert.Nil(t, BoltGet(tx, "docs", id, &doc))
+    assert.Equal(t, "foo", doc.Name)
+    assert.True(t, BoltHas(tx, "docs", id))
+
+    docs, err := BoltFind(tx, "docs", func(doc *boltDoc) bool { return doc.Name == "bar" })
+    assert.Nil(t, err)
+    assert.Equal(t, 1, len(docs))
+
+    /* Neither the bucket nor the document */
+    assert.Equal(t, ErrNotFound, BoltGet(tx, "none", id, &doc))
+    _, err = BoltFindOne[boltDoc](tx, "docs", func(doc *boltDoc) bool { return false })
+    assert.Equal(t, ErrNotFound, err)
+    return nil
+  })
+
+  BoltUpdate(context.TODO(), db, func(tx *bbolt.Tx) error {
+    return BoltDelete(tx, "docs", id)
+  })
+  BoltView(context.TODO(), db, func(tx *bbolt.Tx) error {
+    assert.False(t, BoltHas(tx, "docs", id))
+    return nil
+  })
+
+  /* Clear the bucket, even a missing one */
+  BoltUpdate(context.TODO(), db, func(tx *bbolt.Tx) error {
+    assert.Nil(t, BoltClear(tx, "docs"))
+    assert.Nil(t, BoltClear(tx, "none"))
+    docs, err := BoltFind[boltDoc](tx, "docs", nil)
+    assert.Nil(t, err)
+    assert.Equal(t, 0, len(docs))
+    return nil
+  })
+
+  /* A canceled context does not touch the database */
+  ctx, cancel := context.WithCancel(context.TODO())
+  cancel()
+  assert.Equal(t, context.Canceled, BoltView(ctx, db, func(tx *bbolt.Tx) error { return nil }))
+}
@@ -2,14 +2,15 @@ package database
 
 import (
   "context"
+  "log/slog"
   "os"
+  "time"
 
   "go.mongodb.org/mongo-driver/mongo"
   "go.mongodb.org/mongo-driver/mongo/options"
+  "go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-var _client *mongo.Client = nil
-
 func GetDBStr(uri string) string {
   if uri != "" {
      return uri
@@ -22,16 +23,70 @@ func GetDBStr(uri string) string {
   return uri
 }
 
-func ConnectDB(uri string) *mongo.Client {
-  if (_client != nil) {
-    return _client
+/* The longest time a single database operation may take, 0 for no limit */
+var OPERATION_TIMEOUT = 10 * time.Second
+
+/* Limit the operation with OPERATION_TIMEOUT, besides the caller's context */
+func WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+  if OPERATION_TIMEOUT <= 0 {
+    return context.WithCancel(ctx)
   }
+  return context.WithTimeout(ctx, OPERATION_TIMEOUT)
+}
+
+/* The time to wait for the answer of a single ping */
+var PING_TIMEOUT = 5 * time.Second
 
-  var err error
-  _client, err = mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
-  if(err != nil) {
-    panic(err)
+/* Backoff doubles the wait between the attempts from Min up to Max */
+type Backoff struct {
+  Min time.Duration
+  Max time.Duration
+}
+
+var DEFAULT_BACKOFF = Backoff{Min: 500 * time.Millisecond, Max: 30 * time.Second}
+
+func (b Backoff) Next(wait time.Duration) time.Duration {
+  if wait < b.Min {
+    return b.Min
+  }
+  wait *= 2
+  if wait > b.Max {
+    return b.Max
   }
+  return wait
+}
+
+func Ping(ctx context.Context, client *mongo.Client) error {
+  ctx, cancel := context.WithTimeout(ctx, PING_TIMEOUT)
+  defer cancel()
+  return client.Ping(ctx, readpref.Primary())
+}
 
-  return _client
+/*
+ * Connect and wait until MongoDB answers, retrying with the back-off until the
+ * context is done.  A wrong URI or option fails at once.
+ */
+func Connect(ctx context.Context, uri string, backoff Backoff, opts ...*options.ClientOptions) (*mongo.Client, error) {
+  opts = append([]*options.ClientOptions{options.Client().ApplyURI(uri)}, opts...)
+  client, err := mongo.Connect(ctx, opts...)
+  if err != nil {
+    return nil, err
+  }
+
+  var wait time.Duration
+  for {
+    err = Ping(ctx, client)
+    if err == nil {
+      return client, nil
+    }
+
+    wait = backoff.Next(wait)
+    slog.Warn("MongoDB is not reachable", "error", err, "retry_in", wait)
+    select {
+    case <-ctx.Done():
+      client.Disconnect(context.Background())
+      return nil, err
+    case <-time.After(wait):
+    }
+  }
 }
@@ -1,8 +1,11 @@
 package database
 
 import (
+  "context"
   "os"
   "testing"
+  "time"
+
   "github.com/stretchr/testify/assert"
 )
 
@@ -22,12 +25,69 @@ func TestGetDBStr(t *testing.T) {
   assert.Equal(t, expect_uri, uri)
 }
 
-func TestConnectDB(t *testing.T) {
-  mongo_uri := "mongodb://localhost:27017"
-  client := ConnectDB(mongo_uri)
-  assert.NotNil(t, client)
+func TestConnect(t *testing.T) {
+  uri := os.Getenv("MONGODB_TEST_URI")
+  if uri == "" {
+    t.Skip("MONGODB_TEST_URI is not given")
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+  defer cancel()
+
+  client, err := Connect(ctx, uri, DEFAULT_BACKOFF)
+  assert.Nil(t, err)
+  assert.Nil(t, Ping(ctx, client))
+  client.Disconnect(context.Background())
+}
+
+func TestBackoff(t *testing.T) {
+  b := Backoff{Min: time.Second, Max: 5 * time.Second}
+
+  var wait time.Duration
+  var waits []time.Duration
+  for i := 0; i < 5; i++ {
+    wait = b.Next(wait)
+    waits = append(waits, wait)
+  }
+
+  expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+  assert.Equal(t, expected, waits)
+}
+
+func TestConnectInvalidURI(t *testing.T) {
+  _, err := Connect(context.Background(), "foo://bar", DEFAULT_BACKOFF)
+  assert.NotNil(t, err)
+}
+
+func TestConnectGiveUp(t *testing.T) {
+  /* Nothing listens on the port */
+  uri := "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100"
+  ctx, cancel := context.WithTimeout(context.Background(), 300 * time.Millisecond)
+  defer cancel()
+
+  start := time.Now()
+  _, err := Connect(ctx, uri, Backoff{Min: 50 * time.Millisecond, Max: 100 * time.Millisecond})
+  assert.NotNil(t, err)
+  assert.Less(t, time.Since(start), 2 * time.Second)
+}
+
+func TestWithTimeout(t *testing.T) {
+  orig := OPERATION_TIMEOUT
+  defer func() { OPERATION_TIMEOUT = orig }()
+
+  OPERATION_TIMEOUT = time.Second
+  ctx, cancel := WithTimeout(context.Background())
+  deadline, ok := ctx.Deadline()
+  cancel()
+  assert.True(t, ok)
+  assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100 * time.Millisecond)
 
-  expect_client := client
-  client = ConnectDB(mongo_uri)
-  assert.Equal(t, expect_client, client)
+  /* No limit, but still canceled with the parent */
+  OPERATION_TIMEOUT = 0
+  parent, cancel_parent := context.WithCancel(context.Background())
+  ctx, cancel = WithTimeout(parent)
+  defer cancel()
+  _, ok = ctx.Deadline()
+  assert.False(t, ok)
+  cancel_parent()
+  <-ctx.Done()
 }
@@ -0,0 +1,92 @@
+package database
+
+import (
+  "context"
+  "fmt"
+  "log/slog"
+  "time"
+
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+ * MongoMigration creates the indexes or transforms the documents, when the
+ * structs change.  Up must be idempotent, because the webservers starting
+ * together may run the same migration at the same time.
+ */
+type MongoMigration struct {
+  Version int
+  Name string
+  Up func(ctx context.Context, db *mongo.Database) error
+}
+
+/* The collection keeping the schema version of the database */
+const METADATA_COLLECTION = "metadata"
+const SCHEMA_VERSION_ID = "schema_version"
+
+type AppliedMigration struct {
+  Version int
+  Name string
+  Applied time.Time
+}
+
+type SchemaVersion struct {
+  ID string `bson:"_id"`
+  Version int
+  Migrations []AppliedMigration
+}
+
+/* The schema version of the database, which is 0 before any migration */
+func MongoSchemaVersion(ctx context.Context, db *mongo.Database) (int, error) {
+  var schema SchemaVersion
+
+  coll := db.Collection(METADATA_COLLECTION)
+  err := coll.FindOne(ctx, bson.M{"_id": SCHEMA_VERSION_ID}).Decode(&schema)
+  if err == mongo.ErrNoDocuments {
+    return 0, nil
+  }
+  return schema.Version, err
+}
+
+/*
+ * Apply the migrations newer than the schema version in order, and record
+ * each one in the metadata collection.  Return the schema version.
+ */
+func MigrateMongo(ctx context.Context, db *mongo.Database, migrations []MongoMigration) (int, error) {
+  version, err := MongoSchemaVersion(ctx, db)
+  if err != nil {
+    return 0, err
+  }
+
+  if len(migrations) > 0 && version > migrations[len(migrations) - 1].Version {
+    return version, fmt.Errorf("schema version %d is newer than this webserver's %d", version, migrations[len(migrations) - 1].Version)
+  }
+
+  coll := db.Collection(METADATA_COLLECTION)
+  for _, m := range migrations {
+    if m.Version <= version {
+      continue
+    }
+
+    if err := m.Up(ctx, db); err != nil {
+      return version, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+    }
+
+    applied := AppliedMigration{Version: m.Version, Name: m.Name, Applied: time.Now().UTC()}
+    filter := bson.M{"_id": SCHEMA_VERSION_ID}
+    update := bson.M{
+      "$max": bson.M{"version": m.Version},
+      "$push": bson.M{"migrations": applied},
+    }
+    _, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+    if err != nil {
+      return version, err
+    }
+    slog.Info("migrated MongoDB", "version", m.Version, "migration", m.Name)
+    version = m.Version
+  }
+  return version, nil
+}
+
@@ -0,0 +1,71 @@
+-- The users with their scopes in order
+CREATE TABLE users (
+  id char(24) PRIMARY KEY,
+  create_time timestamptz NOT NULL,
+  account text NOT NULL,
+  password text NOT NULL,
+  role integer NOT NULL,
+  disabled boolean NOT NULL DEFAULT false
+);
+CREATE INDEX users_account ON users (account);
+
+CREATE TABLE user_scopes (
+  user_id char(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  position integer NOT NULL,
+  scope_id char(24) NOT NULL,
+  PRIMARY KEY (user_id, position)
+);
+CREATE INDEX user_scopes_scope ON user_scopes (scope_id);
+
+CREATE TABLE scopes (
+  id char(24) PRIMARY KEY,
+  create_time timestamptz NOT NULL,
+  name text NOT NULL,
+  level_medium integer NOT NULL DEFAULT 0,
+  level_high integer NOT NULL DEFAULT 0
+);
+
+-- The assets with their risks in order
+CREATE TABLE assets (
+  id char(24) PRIMARY KEY,
+  create_time timestamptz NOT NULL,
+  scope_id char(24) NOT NULL,
+  big_category text NOT NULL,
+  small_category text NOT NULL,
+  name text NOT NULL,
+  owner text NOT NULL,
+  confidentiality integer NOT NULL,
+  integrity integer NOT NULL,
+  availability integer NOT NULL
+);
+CREATE INDEX assets_scope ON assets (scope_id);
+
+CREATE TABLE risks (
+  asset_id char(24) NOT NULL REFERENCES assets (id) ON DELETE CASCADE,
+  position integer NOT NULL,
+  threat text NOT NULL,
+  vulnerability text NOT NULL,
+  current_control text NOT NULL,
+  possibility integer NOT NULL,
+  impact integer NOT NULL,
+  PRIMARY KEY (asset_id, position)
+);
+
+-- The session store, and the metadata of the logged in sessions
+CREATE TABLE sessions (
+  id char(24) PRIMARY KEY,
+  data text NOT NULL,
+  modified timestamptz NOT NULL
+);
+CREATE INDEX sessions_modified ON sessions (modified);
+
+CREATE TABLE session_infos (
+  id char(24) PRIMARY KEY,
+  store_id text NOT NULL,
+  user_id char(24) NOT NULL,
+  ip text NOT NULL,
+  user_agent text NOT NULL,
+  create_time timestamptz NOT NULL,
+  last_activity timestamptz NOT NULL
+);
+CREATE INDEX session_infos_user ON session_infos (user_id);
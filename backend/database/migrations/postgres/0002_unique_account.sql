@@ -0,0 +1,3 @@
+-- Two concurrent registrations must not create the same account
+DROP INDEX users_account;
+CREATE UNIQUE INDEX users_account ON users (account);
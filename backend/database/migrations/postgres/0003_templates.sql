@@ -0,0 +1,9 @@
+-- The report templates uploaded by the administrators
+CREATE TABLE templates (
+  id char(24) PRIMARY KEY,
+  create_time timestamptz NOT NULL,
+  update_time timestamptz NOT NULL,
+  name text NOT NULL,
+  format text NOT NULL,
+  content text NOT NULL
+);
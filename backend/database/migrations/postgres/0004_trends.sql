@@ -0,0 +1,14 @@
+-- The risk trends, a point of a scope a day
+CREATE TABLE trends (
+  id char(24) NOT NULL UNIQUE,
+  scope_id char(24) NOT NULL,
+  day date NOT NULL,
+  assets integer NOT NULL,
+  risks integer NOT NULL,
+  total_score bigint NOT NULL,
+  level_low integer NOT NULL,
+  level_medium integer NOT NULL,
+  level_high integer NOT NULL,
+  update_time timestamptz NOT NULL,
+  PRIMARY KEY (scope_id, day)
+);
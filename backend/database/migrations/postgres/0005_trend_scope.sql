@@ -0,0 +1,3 @@
+-- The trend points are deleted with their scope
+DELETE FROM trends WHERE scope_id NOT IN (SELECT id FROM scopes);
+ALTER TABLE trends ADD FOREIGN KEY (scope_id) REFERENCES scopes (id) ON DELETE CASCADE;
@@ -0,0 +1,214 @@
+package database
+
+import (
+  "context"
+  "embed"
+  "errors"
+  "fmt"
+  "io/fs"
+  "log/slog"
+  "path"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+ * The PostgreSQL backend keeps the ObjectIDs as their hex strings, so the IDs
+ * in the URLs and the sessions are the same as the ones of MongoDB.
+ */
+
+/* The schema migrations, named like 0001_init.sql and applied in order */
+//go:embed migrations/postgres/*.sql
+var pg_migrations embed.FS
+
+func PingPostgres(ctx context.Context, pool *pgxpool.Pool) error {
+  ctx, cancel := context.WithTimeout(ctx, PING_TIMEOUT)
+  defer cancel()
+  return pool.Ping(ctx)
+}
+
+/*
+ * Connect and wait until PostgreSQL answers, retrying with the back-off until
+ * the context is done.  A wrong connection string fails at once.
+ */
+func ConnectPostgres(ctx context.Context, uri string, backoff Backoff) (*pgxpool.Pool, error) {
+  pool, err := pgxpool.New(ctx, uri)
+  if err != nil {
+    return nil, err
+  }
+
+  var wait time.Duration
+  for {
+    err = PingPostgres(ctx, pool)
+    if err == nil {
+      return pool, nil
+    }
+
+    wait = backoff.Next(wait)
+    slog.Warn("PostgreSQL is not reachable", "error", err, "retry_in", wait)
+    select {
+    case <-ctx.Done():
+      pool.Close()
+      return nil, err
+    case <-time.After(wait):
+    }
+  }
+}
+
+type pgMigration struct {
+  Version int
+  Name string
+  SQL string
+}
+
+func loadPGMigrations() ([]pgMigration, error) {
+  var migrations []pgMigration
+
+  names, err := fs.Glob(pg_migrations, "migrations/postgres/*.sql")
+  if err != nil {
+    return nil, err
+  }
+
+  for _, name := range names {
+    base := path.Base(name)
+    prefix, _, _ := strings.Cut(base, "_")
+    version, err := strconv.Atoi(prefix)
+    if err != nil {
+      return nil, fmt.Errorf("bad migration name %q", base)
+    }
+
+    data, err := pg_migrations.ReadFile(name)
+    if err != nil {
+      return nil, err
+    }
+    migrations = append(migrations, pgMigration{Version: version, Name: base, SQL: string(data)})
+  }
+
+  sort.Slice(migrations, func(i, j int) bool {
+    return migrations[i].Version < migrations[j].Version
+  })
+  return migrations, nil
+}
+
+/* Serialize the webservers migrating the same database at the startup */
+const PG_MIGRATION_LOCK = 0x72697361
+
+/*
+ * Apply the migrations, which are not applied yet, in a single transaction and
+ * record them in the schema_migrations table.  Return the schema version.
+ */
+func MigratePostgres(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+  var version int
+
+  migrations, err := loadPGMigrations()
+  if err != nil {
+    return 0, err
+  }
+
+  err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+    if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", PG_MIGRATION_LOCK); err != nil {
+      return err
+    }
+
+    _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+      version integer PRIMARY KEY,
+      name text NOT NULL,
+      applied_at timestamptz NOT NULL DEFAULT now()
+    )`)
+    if err != nil {
+      return err
+    }
+
+    err = tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+    if err != nil {
+      return err
+    }
+
+    if len(migrations) > 0 && version > migrations[len(migrations) - 1].Version {
+      return fmt.Errorf("schema version %d is newer than this webserver's %d", version, migrations[len(migrations) - 1].Version)
+    }
+
+    for _, m := range migrations {
+      if m.Version <= version {
+        continue
+      }
+      if _, err := tx.Exec(ctx, m.SQL); err != nil {
+        return fmt.Errorf("migration %s: %w", m.Name, err)
+      }
+      _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+      if err != nil {
+        return err
+      }
+      slog.Info("migrated PostgreSQL", "migration", m.Name)
+      version = m.Version
+    }
+    return nil
+  })
+  return version, err
+}
+
+/* The SQLSTATE of a duplicate key */
+const PG_UNIQUE_VIOLATION = "23505"
+
+/* Report a missing row with the same error as the other backends */
+func PGError(err error) error {
+  if errors.Is(err, pgx.ErrNoRows) {
+    return ErrNotFound
+  }
+  return err
+}
+
+func PGHexes(ids []primitive.ObjectID) []string {
+  hexes := make([]string, len(ids))
+  for i, id := range ids {
+    hexes[i] = id.Hex()
+  }
+  return hexes
+}
+
+type pgObjectID struct {
+  id *primitive.ObjectID
+}
+
+func (s pgObjectID) Scan(src any) error {
+  hex, ok := src.(string)
+  if !ok {
+    return fmt.Errorf("cannot scan %T into an ObjectID", src)
+  }
+
+  id, err := primitive.ObjectIDFromHex(strings.TrimSpace(hex))
+  if err != nil {
+    return err
+  }
+  *s.id = id
+  return nil
+}
+
+/* Scan the hex string column into the ObjectID */
+func PGID(id *primitive.ObjectID) any {
+  return pgObjectID{id}
+}
+
+type pgTime struct {
+  t *time.Time
+}
+
+func (s pgTime) Scan(src any) error {
+  t, ok := src.(time.Time)
+  if !ok {
+    return fmt.Errorf("cannot scan %T into a time", src)
+  }
+  *s.t = t.UTC().Truncate(time.Millisecond)
+  return nil
+}
+
+/* Scan the timestamp column into UTC with milliseconds, like the BSON dates */
+func PGTime(t *time.Time) any {
+  return pgTime{t}
+}
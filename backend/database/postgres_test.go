@@ -0,0 +1,37 @@
+package database
+
+import (
+  "testing"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPGMigrations(t *testing.T) {
+  migrations, err := loadPGMigrations()
+  assert.Nil(t, err)
+  assert.NotEmpty(t, migrations)
+  for i, m := range migrations {
+    assert.Equal(t, i + 1, m.Version, m.Name)
+    assert.NotEmpty(t, m.SQL)
+  }
+}
+
+func TestPGScan(t *testing.T) {
+  assert.Equal(t, ErrNotFound, PGError(pgx.ErrNoRows))
+
+  var id primitive.ObjectID
+  expect_id := primitive.NewObjectID()
+  assert.Nil(t, PGID(&id).(pgObjectID).Scan(expect_id.Hex()))
+  assert.Equal(t, expect_id, id)
+  assert.NotNil(t, PGID(&id).(pgObjectID).Scan(42))
+
+  var tm time.Time
+  local := time.Date(2024, 5, 1, 8, 0, 0, 123456789, time.FixedZone("CST", 8 * 3600))
+  assert.Nil(t, PGTime(&tm).(pgTime).Scan(local))
+  assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 123000000, time.UTC), tm)
+
+  assert.Equal(t, []string{expect_id.Hex()}, PGHexes([]primitive.ObjectID{expect_id}))
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+  "fmt"
+  "io"
+  "log/slog"
+  "strings"
+)
+
+const (
+  TextFormat = "text"
+  JSONFormat = "json"
+)
+
+func ParseLevel(level string) (slog.Level, error) {
+  var l slog.Level
+  err := l.UnmarshalText([]byte(level))
+  return l, err
+}
+
+/* NewLogger writes the records in the format, "text" or "json", to w */
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+  l, err := ParseLevel(level)
+  if err != nil {
+    return nil, err
+  }
+
+  opts := &slog.HandlerOptions{Level: l}
+  switch strings.ToLower(format) {
+  case TextFormat:
+    return slog.New(slog.NewTextHandler(w, opts)), nil
+  case JSONFormat:
+    return slog.New(slog.NewJSONHandler(w, opts)), nil
+  }
+
+  return nil, fmt.Errorf("unknown log format %q", format)
+}
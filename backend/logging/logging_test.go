@@ -0,0 +1,31 @@
+package logging
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+  var buf bytes.Buffer
+
+  logger, err := NewLogger(&buf, "json", "warn")
+  assert.Nil(t, err)
+  logger.Info("hidden")
+  logger.Warn("shown", "foo", "bar")
+  assert.False(t, strings.Contains(buf.String(), "hidden"))
+  assert.True(t, strings.Contains(buf.String(), `"foo":"bar"`))
+
+  buf.Reset()
+  logger, err = NewLogger(&buf, "text", "debug")
+  assert.Nil(t, err)
+  logger.Debug("shown", "foo", "bar")
+  assert.True(t, strings.Contains(buf.String(), "foo=bar"))
+
+  _, err = NewLogger(&buf, "xml", "info")
+  assert.NotNil(t, err)
+
+  _, err = NewLogger(&buf, "json", "loud")
+  assert.NotNil(t, err)
+}
@@ -2,38 +2,68 @@ package main
 
 import (
   "context"
+  "fmt"
+  "log/slog"
+  "net/http"
   "os"
+  "os/signal"
+  "strings"
+  "syscall"
 
   "github.com/gin-gonic/gin"
   "github.com/gin-contrib/sessions"
   "github.com/gin-contrib/sessions/cookie"
-  "github.com/gin-contrib/sessions/mongo/mongodriver"
   "github.com/utrack/gin-csrf"
   "go.mongodb.org/mongo-driver/mongo"
 
   "github.com/starnight/riskassessment/backend/auth"
   "github.com/starnight/riskassessment/backend/config"
   "github.com/starnight/riskassessment/backend/middleware"
-  "github.com/starnight/riskassessment/backend/risk_assessment"
-  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/logging"
+  "github.com/starnight/riskassessment/backend/metrics"
+  "github.com/starnight/riskassessment/backend/server"
 )
 
 type Apps struct {
   AuthApp IAuthApp
   ScopesApp IScopesApp
   AssetsApp IAssetsApp
+  SessionsApp ISessionsApp
+  HealthApp IHealthApp
+  BackupApp IBackupApp
+  BundleApp IBundleApp
+  RegisterApp IRegisterApp
+  ReportApp IReportApp
+  TemplateApp ITemplateApp
+  StatisticsApp IStatisticsApp
+  ChartApp IChartApp
+  TrendApp ITrendApp
+  SearchApp ISearchApp
+  Metrics *metrics.Metrics
 }
 
-func getSecretString() string {
-  return "secret123"
-}
+func setupRouter(apps *Apps, store sessions.Store, cfg *config.Config) *gin.Engine {
+  r := gin.New()
+
+  r.Use(middleware.RequestID)
+  r.Use(middleware.Logger(slog.Default()))
+  r.Use(gin.Recovery())
 
-func setupRouter(apps *Apps, store sessions.Store) *gin.Engine {
-  r := gin.Default()
+  /* Probes and scrapers have neither a session nor a CSRF token */
+  probe := r.Group("/")
+  HealthRoutes(probe, apps.HealthApp)
 
+  if apps.Metrics != nil {
+    r.Use(apps.Metrics.Middleware())
+    if cfg.Metrics.Listen == "" {
+      r.GET("/metrics", gin.WrapH(apps.Metrics.Handler(cfg.Metrics.Token)))
+    }
+  }
+
+  r.Use(middleware.SecurityHeaders(cfg.TLSEnabled()))
   r.Use(sessions.Sessions("sessionid", store))
   r.Use(csrf.Middleware(csrf.Options{
-    Secret: getSecretString(),
+    Secret: cfg.Secrets.CSRF,
     ErrorFunc: middleware.CSRFError,
   }))
 
@@ -42,78 +72,242 @@ func setupRouter(apps *Apps, store sessions.Store) *gin.Engine {
 
   public := r.Group("/")
   PublicAuthRoutes(public, apps.AuthApp)
+  PublicChartRoutes(public, apps.ChartApp)
 
   private := r.Group("/")
   private.Use(middleware.AuthenticationRequired)
+  private.Use(apps.SessionsApp.ValidateSession)
   PrivateAuthRoutes(private, apps.AuthApp)
   ScopesRoutes(private, apps.ScopesApp)
   AssetsRoutes(private, apps.AssetsApp)
+  SessionsRoutes(private, apps.SessionsApp)
+  BundleRoutes(private, apps.BundleApp)
+  RegisterRoutes(private, apps.RegisterApp)
+  ReportRoutes(private, apps.ReportApp)
+  TemplateRoutes(private, apps.TemplateApp)
+  StatisticsRoutes(private, apps.StatisticsApp)
+  TrendRoutes(private, apps.TrendApp)
+  SearchRoutes(private, apps.SearchApp)
+  ChartRoutes(private, apps.ChartApp)
 
   privilege := r.Group("/")
   privilege.Use(middleware.AuthenticationRequired)
+  privilege.Use(apps.SessionsApp.ValidateSession)
   privilege.Use(middleware.AuthorizationRequired)
   PrivilegeAuthRoutes(privilege, apps.AuthApp)
+  PrivilegeSessionsRoutes(privilege, apps.SessionsApp)
+  BackupRoutes(privilege, apps.BackupApp)
+  PrivilegeBundleRoutes(privilege, apps.BundleApp)
+  PrivilegeTemplateRoutes(privilege, apps.TemplateApp)
 
   return r
 }
 
-func prepareDb() *mongo.Client {
-  return database.ConnectDB(database.GetDBStr(""))
+/* The metrics could be served by a separate server */
+func prepareMetrics(cfg *config.Config) (*metrics.Metrics, []*http.Server) {
+  if !cfg.Metrics.Enabled {
+    return nil, nil
+  }
+
+  m := metrics.New()
+  if cfg.Metrics.Listen == "" {
+    return m, nil
+  }
+
+  srv := &http.Server{
+    Addr: cfg.Metrics.Listen,
+    Handler: m.Handler(cfg.Metrics.Token),
+  }
+  return m, []*http.Server{srv}
+}
+
+/* The session cookie is only sent over HTTPS, if TLS is on */
+func sessionOptions(cfg *config.Config) sessions.Options {
+  return sessions.Options{
+    Path: "/",
+    MaxAge: int(cfg.AbsoluteTimeout().Seconds()),
+    Secure: cfg.TLSEnabled(),
+    HttpOnly: true,
+    SameSite: http.SameSiteLaxMode,
+  }
 }
 
-func prepareSessionStore(db_client *mongo.Client) (sessions.Store) {
+func prepareSessionStore(db_client *mongo.Client, cfg *config.Config) (sessions.Store) {
+  secret := []byte(cfg.Secrets.Session)
+  max_age := cfg.AbsoluteTimeout()
+
   if db_client == nil {
-    return cookie.NewStore([]byte("secret"))
+    store := cookie.NewStore(secret)
+    store.Options(sessionOptions(cfg))
+    return store
   }
 
-  col := db_client.Database(config.DB_NAME).Collection("sessions")
-  return mongodriver.NewStore(col, 3600, true, []byte("secret"))
+  store := auth.NewMongoStore(db_client, int(max_age.Seconds()), secret)
+  store.Options(sessionOptions(cfg))
+  return store
 }
 
-func getPort() string {
-  port := ":8080"
-  /*
-   * Azure Function will pass the forwarding port with environment variable
-   * "FUNCTIONS_CUSTOMHANDLER_PORT"
-   */
-  if val, ok := os.LookupEnv("FUNCTIONS_CUSTOMHANDLER_PORT"); ok {
-      port = ":" + val
+func setupLogger(cfg *config.Config) error {
+  logger, err := logging.NewLogger(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+  if err != nil {
+    return err
   }
-  return port
+  slog.SetDefault(logger)
+  return nil
 }
 
-func main() {
-  db_client := prepareDb()
-  defer func() {
-  if err := db_client.Disconnect(context.TODO()); err != nil {
-      panic(err)
-    }
-  }()
+/* webserver [serve] [flags] serves until SIGTERM or Ctrl-C */
+func serve(name string, args []string) int {
+  cfg, _ := loadConfig(name, args, nil)
+
+  if !cfg.IsDev() && os.Getenv(gin.EnvGinMode) == "" {
+    gin.SetMode(gin.ReleaseMode)
+  }
+
+  /* Drain the in-flight requests before closing the storage */
+  ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+  defer stop()
+
+  m, metrics_servers := prepareMetrics(cfg)
+  storage, err := prepareStorage(ctx, cfg, m)
+  if err != nil {
+    slog.Error("cannot open the storage", "backend", cfg.Storage.Backend, "error", err)
+    return 1
+  }
+  defer storage.Close()
+  go recordTrends(ctx, storage)
 
-  session_store := prepareSessionStore(db_client)
   csrf_utils := middleware.CsrfUtils{}
 
-  user_utils := auth.UserUtils{ DB_Client: db_client }
   auth_ap := AuthApp{
-    User_utils: &user_utils,
+    User_utils: storage.User_utils,
     Csrf_utils: &csrf_utils,
+    Session_utils: storage.Session_utils,
+    Closed_registration: !cfg.Features.Registration,
   }
 
-  scope_utils := risk_assessment.ScopeUtils{ DB_Client: db_client }
   scopes_ap := ScopesApp{
-    User_utils: &user_utils,
+    User_utils: storage.User_utils,
     Csrf_utils: &csrf_utils,
-    Scope_utils: &scope_utils,
+    Scope_utils: storage.Scope_utils,
   }
 
-  asset_utils := risk_assessment.AssetUtils{ DB_Client: db_client }
   assets_ap := AssetsApp{
-    User_utils: &user_utils,
+    User_utils: storage.User_utils,
     Csrf_utils: &csrf_utils,
-    Asset_utils: &asset_utils,
+    Asset_utils: storage.Asset_utils,
+    Scope_utils: storage.Scope_utils,
+  }
+
+  sessions_ap := SessionsApp{
+    User_utils: storage.User_utils,
+    Csrf_utils: &csrf_utils,
+    Session_utils: storage.Session_utils,
+    Idle_timeout: cfg.IdleTimeout(),
+    Absolute_timeout: cfg.AbsoluteTimeout(),
+  }
+
+  health_ap := HealthApp{
+    Checks: storage.Checks,
+  }
+
+  backup_ap := BackupApp{
+    Storage: storage.backupStorage(),
+  }
+
+  bundle_ap := BundleApp{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Asset_utils: storage.Asset_utils,
+  }
+
+  register_ap := RegisterApp{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Asset_utils: storage.Asset_utils,
+  }
+
+  report_ap := ReportApp{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Asset_utils: storage.Asset_utils,
+    Font: cfg.Report.Font,
   }
 
-  apps := Apps{ AuthApp: &auth_ap, ScopesApp: &scopes_ap, AssetsApp: &assets_ap }
-  r := setupRouter(&apps, session_store)
-  r.Run(getPort())
+  template_ap := TemplateApp{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Asset_utils: storage.Asset_utils,
+    Template_utils: storage.Template_utils,
+  }
+
+  statistics_ap := StatisticsApp{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Statistics_utils: storage.Statistics_utils,
+  }
+
+  chart_ap := ChartApp{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Asset_utils: storage.Asset_utils,
+    Secret: []byte(cfg.LinkSecret()),
+  }
+
+  trend_ap := TrendApp{
+    User_utils: storage.User_utils,
+    Trend_utils: storage.Trend_utils,
+  }
+
+  search_ap := SearchApp{
+    User_utils: storage.User_utils,
+    Search_utils: storage.Search_utils,
+  }
+
+  apps := Apps{
+    AuthApp: &auth_ap,
+    ScopesApp: &scopes_ap,
+    AssetsApp: &assets_ap,
+    SessionsApp: &sessions_ap,
+    HealthApp: &health_ap,
+    BackupApp: &backup_ap,
+    BundleApp: &bundle_ap,
+    RegisterApp: &register_ap,
+    ReportApp: &report_ap,
+    TemplateApp: &template_ap,
+    StatisticsApp: &statistics_ap,
+    ChartApp: &chart_ap,
+    TrendApp: &trend_ap,
+    SearchApp: &search_ap,
+    Metrics: m,
+  }
+
+  if m != nil {
+    m.Registry.MustRegister(&metrics.BusinessCollector{
+      Session_utils: storage.Session_utils,
+      Scope_utils: storage.Scope_utils,
+      Asset_utils: storage.Asset_utils,
+      Idle_timeout: cfg.IdleTimeout(),
+    })
+  }
+
+  r := setupRouter(&apps, storage.Session_store, cfg)
+  if err := server.Serve(ctx, cfg, r, metrics_servers...); err != nil {
+    slog.Error("server stopped", "error", err)
+    return 1
+  }
+  slog.Info("server stopped")
+  return 0
+}
+
+func main() {
+  name, args := os.Args[0], os.Args[1:]
+  if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+    usage(name, os.Stdout)
+    fmt.Fprintf(os.Stdout, "\nFlags of serve:\n")
+  }
+  if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+    os.Exit(runCommand(name, args))
+  }
+  os.Exit(serve(name, args))
 }
@@ -4,7 +4,6 @@ import (
   "net/http"
   "net/http/httptest"
   "net/url"
-  "os"
   "strings"
   "testing"
 
@@ -15,6 +14,7 @@ import (
   "github.com/utrack/gin-csrf"
 
   "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/config"
   "github.com/starnight/riskassessment/backend/middleware"
   "github.com/starnight/riskassessment/backend/risk_assessment"
 )
@@ -95,17 +95,175 @@ func (m *mockAssetsApp) DeleteAsset(c *gin.Context) {
   c.String(http.StatusOK, c.Request.URL.Path)
 }
 
+func (m *mockAssetsApp) ImportAssets(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockSessionsApp struct {}
+
+func (m *mockSessionsApp) ValidateSession(c *gin.Context) {
+  c.Next()
+}
+
+func (m *mockSessionsApp) GetSessions(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockSessionsApp) RevokeSession(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockSessionsApp) RevokeUserSessions(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockBackupApp struct {}
+
+func (m *mockBackupApp) GetBackup(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockBackupApp) Restore(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockBundleApp struct {}
+
+func (m *mockBundleApp) ExportScope(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockBundleApp) ImportScope(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockRegisterApp struct {}
+
+func (m *mockRegisterApp) ExportRegister(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockRegisterApp) ImportRegister(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockReportApp struct {}
+
+func (m *mockReportApp) GetReport(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockStatisticsApp struct {}
+
+func (m *mockStatisticsApp) GetStatistics(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockStatisticsApp) GetScopeStatistics(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockChartApp struct {}
+
+func (m *mockChartApp) GetChart(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockChartApp) GetChartLink(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockChartApp) GetSharedChart(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockTrendApp struct {}
+
+func (m *mockTrendApp) GetTrend(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockSearchApp struct {}
+
+func (m *mockSearchApp) Search(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockTemplateApp struct {}
+
+func (m *mockTemplateApp) GetTemplates(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockTemplateApp) RenderReport(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockTemplateApp) GetTemplate(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockTemplateApp) AddTemplate(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockTemplateApp) UpdateTemplate(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockTemplateApp) DeleteTemplate(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockTemplateApp) PreviewTemplate(c *gin.Context) {
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+type mockHealthApp struct {}
+
+/* Tell whether the request passed the session middleware */
+func (m *mockHealthApp) probe(c *gin.Context) {
+  if _, ok := c.Get(sessions.DefaultKey); ok {
+    c.String(http.StatusOK, "session")
+    return
+  }
+  c.String(http.StatusOK, c.Request.URL.Path)
+}
+
+func (m *mockHealthApp) Healthz(c *gin.Context) {
+  m.probe(c)
+}
+
+func (m *mockHealthApp) Readyz(c *gin.Context) {
+  m.probe(c)
+}
+
 func copyCookies(req *http.Request, res *httptest.ResponseRecorder) {
   req.Header.Set("Cookie", strings.Join(res.Header().Values("Set-Cookie"), "; "))
 }
 
 func TestSetupRouter(t *testing.T) {
-  session_store := prepareSessionStore(nil)
+  cfg := config.Default()
+  session_store := prepareSessionStore(nil, cfg)
   auth_ap := mockAuthApp{}
   scope_ap := mockScopesApp{}
   assets_ap := mockAssetsApp{}
-  apps := Apps{AuthApp: &auth_ap, ScopesApp: &scope_ap, AssetsApp: &assets_ap}
-  r := setupRouter(&apps, session_store)
+  sessions_ap := mockSessionsApp{}
+  health_ap := mockHealthApp{}
+  backup_ap := mockBackupApp{}
+  bundle_ap := mockBundleApp{}
+  register_ap := mockRegisterApp{}
+  report_ap := mockReportApp{}
+  template_ap := mockTemplateApp{}
+  statistics_ap := mockStatisticsApp{}
+  chart_ap := mockChartApp{}
+  trend_ap := mockTrendApp{}
+  search_ap := mockSearchApp{}
+  apps := Apps{AuthApp: &auth_ap, ScopesApp: &scope_ap, AssetsApp: &assets_ap, SessionsApp: &sessions_ap, HealthApp: &health_ap,
+               BackupApp: &backup_ap, BundleApp: &bundle_ap, RegisterApp: &register_ap, ReportApp: &report_ap,
+               TemplateApp: &template_ap, StatisticsApp: &statistics_ap, ChartApp: &chart_ap,
+               TrendApp: &trend_ap, SearchApp: &search_ap}
+  r := setupRouter(&apps, session_store, cfg)
 
   /* Get CSRF token for Login */
   w := httptest.NewRecorder()
@@ -174,6 +332,164 @@ func TestSetupRouter(t *testing.T) {
   assert.Equal(t, http.StatusOK, w6.Code)
   assert.Equal(t, "/api/deleteasset", w6.Body.String())
 
+  /* Get own Sessions */
+  w9 := httptest.NewRecorder()
+  req9, _ := http.NewRequest("GET", "/api/getsessions", nil)
+  copyCookies(req9, w1)
+  r.ServeHTTP(w9, req9)
+  assert.Equal(t, http.StatusOK, w9.Code)
+  assert.Equal(t, "/api/getsessions", w9.Body.String())
+
+  /* Revoke an User's Sessions */
+  w10 := httptest.NewRecorder()
+  req10, _ := http.NewRequest("POST", "/api/revokeuser_sessions", nil)
+  req10.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req10, w1)
+  r.ServeHTTP(w10, req10)
+  assert.Equal(t, http.StatusOK, w10.Code)
+  assert.Equal(t, "/api/revokeuser_sessions", w10.Body.String())
+
+  /* Backup and restore */
+  w11 := httptest.NewRecorder()
+  req11, _ := http.NewRequest("GET", "/api/backup", nil)
+  copyCookies(req11, w1)
+  r.ServeHTTP(w11, req11)
+  assert.Equal(t, http.StatusOK, w11.Code)
+  assert.Equal(t, "/api/backup", w11.Body.String())
+
+  w12 := httptest.NewRecorder()
+  req12, _ := http.NewRequest("POST", "/api/restore", nil)
+  req12.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req12, w1)
+  r.ServeHTTP(w12, req12)
+  assert.Equal(t, http.StatusOK, w12.Code)
+  assert.Equal(t, "/api/restore", w12.Body.String())
+
+  /* Import the assets */
+  w15 := httptest.NewRecorder()
+  req15, _ := http.NewRequest("POST", "/api/importassets/xxxaa", nil)
+  req15.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req15, w1)
+  r.ServeHTTP(w15, req15)
+  assert.Equal(t, http.StatusOK, w15.Code)
+  assert.Equal(t, "/api/importassets/xxxaa", w15.Body.String())
+
+  /* Export and import a scope */
+  w13 := httptest.NewRecorder()
+  req13, _ := http.NewRequest("GET", "/api/exportscope/xxxaa", nil)
+  copyCookies(req13, w1)
+  r.ServeHTTP(w13, req13)
+  assert.Equal(t, http.StatusOK, w13.Code)
+  assert.Equal(t, "/api/exportscope/xxxaa", w13.Body.String())
+
+  w14 := httptest.NewRecorder()
+  req14, _ := http.NewRequest("POST", "/api/importscope", nil)
+  req14.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req14, w1)
+  r.ServeHTTP(w14, req14)
+  assert.Equal(t, http.StatusOK, w14.Code)
+  assert.Equal(t, "/api/importscope", w14.Body.String())
+
+  /* Export the risk register */
+  w16 := httptest.NewRecorder()
+  req16, _ := http.NewRequest("GET", "/api/register/xxxaa?format=xlsx", nil)
+  copyCookies(req16, w1)
+  r.ServeHTTP(w16, req16)
+  assert.Equal(t, http.StatusOK, w16.Code)
+  assert.Equal(t, "/api/register/xxxaa", w16.Body.String())
+
+  w17 := httptest.NewRecorder()
+  req17, _ := http.NewRequest("POST", "/api/importregister/xxxaa", nil)
+  req17.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req17, w1)
+  r.ServeHTTP(w17, req17)
+  assert.Equal(t, http.StatusOK, w17.Code)
+  assert.Equal(t, "/api/importregister/xxxaa", w17.Body.String())
+
+  /* Get the PDF report */
+  w18 := httptest.NewRecorder()
+  req18, _ := http.NewRequest("GET", "/api/report/xxxaa", nil)
+  copyCookies(req18, w1)
+  r.ServeHTTP(w18, req18)
+  assert.Equal(t, http.StatusOK, w18.Code)
+  assert.Equal(t, "/api/report/xxxaa", w18.Body.String())
+
+  /* Render a report with a template, and upload a template */
+  w19 := httptest.NewRecorder()
+  req19, _ := http.NewRequest("GET", "/api/templatereport/xxxaa?template=default", nil)
+  copyCookies(req19, w1)
+  r.ServeHTTP(w19, req19)
+  assert.Equal(t, http.StatusOK, w19.Code)
+  assert.Equal(t, "/api/templatereport/xxxaa", w19.Body.String())
+
+  w20 := httptest.NewRecorder()
+  req20, _ := http.NewRequest("POST", "/api/addtemplate?name=foo", nil)
+  req20.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req20, w1)
+  r.ServeHTTP(w20, req20)
+  assert.Equal(t, http.StatusOK, w20.Code)
+  assert.Equal(t, "/api/addtemplate", w20.Body.String())
+
+  w21 := httptest.NewRecorder()
+  req21, _ := http.NewRequest("POST", "/api/previewtemplate", nil)
+  req21.Header.Set("X-CSRF-TOKEN", csrf_token)
+  copyCookies(req21, w1)
+  r.ServeHTTP(w21, req21)
+  assert.Equal(t, http.StatusOK, w21.Code)
+  assert.Equal(t, "/api/previewtemplate", w21.Body.String())
+
+  /* Get the statistics of all the scopes, and of a scope */
+  w22 := httptest.NewRecorder()
+  req22, _ := http.NewRequest("GET", "/api/statistics", nil)
+  copyCookies(req22, w1)
+  r.ServeHTTP(w22, req22)
+  assert.Equal(t, http.StatusOK, w22.Code)
+  assert.Equal(t, "/api/statistics", w22.Body.String())
+
+  w23 := httptest.NewRecorder()
+  req23, _ := http.NewRequest("GET", "/api/statistics/xxxaa?top=5", nil)
+  copyCookies(req23, w1)
+  r.ServeHTTP(w23, req23)
+  assert.Equal(t, http.StatusOK, w23.Code)
+  assert.Equal(t, "/api/statistics/xxxaa", w23.Body.String())
+
+  /* Get a chart, sign its link, and open the link without the session */
+  w24 := httptest.NewRecorder()
+  req24, _ := http.NewRequest("GET", "/api/charts/xxxaa/heatmap.svg", nil)
+  copyCookies(req24, w1)
+  r.ServeHTTP(w24, req24)
+  assert.Equal(t, http.StatusOK, w24.Code)
+  assert.Equal(t, "/api/charts/xxxaa/heatmap.svg", w24.Body.String())
+
+  w25 := httptest.NewRecorder()
+  req25, _ := http.NewRequest("GET", "/api/chartlink/xxxaa?chart=heatmap", nil)
+  copyCookies(req25, w1)
+  r.ServeHTTP(w25, req25)
+  assert.Equal(t, http.StatusOK, w25.Code)
+  assert.Equal(t, "/api/chartlink/xxxaa", w25.Body.String())
+
+  w26 := httptest.NewRecorder()
+  req26, _ := http.NewRequest("GET", "/api/sharedcharts/xxxaa/heatmap.svg?expires=1&signature=x", nil)
+  r.ServeHTTP(w26, req26)
+  assert.Equal(t, http.StatusOK, w26.Code)
+  assert.Equal(t, "/api/sharedcharts/xxxaa/heatmap.svg", w26.Body.String())
+
+  /* Get the risk trend of a scope */
+  w27 := httptest.NewRecorder()
+  req27, _ := http.NewRequest("GET", "/api/trend/xxxaa?from=2026-01-01&to=2026-06-30", nil)
+  copyCookies(req27, w1)
+  r.ServeHTTP(w27, req27)
+  assert.Equal(t, http.StatusOK, w27.Code)
+  assert.Equal(t, "/api/trend/xxxaa", w27.Body.String())
+
+  /* Search the assets and their risks */
+  w28 := httptest.NewRecorder()
+  req28, _ := http.NewRequest("GET", "/api/search?q=ransomware", nil)
+  copyCookies(req28, w1)
+  r.ServeHTTP(w28, req28)
+  assert.Equal(t, http.StatusOK, w28.Code)
+  assert.Equal(t, "/api/search", w28.Body.String())
+
   /* Logout */
   w7 := httptest.NewRecorder()
   req7, _ := http.NewRequest("GET", "/api/logout", nil)
@@ -191,12 +507,34 @@ func TestSetupRouter(t *testing.T) {
   assert.Equal(t, "/api/getuser_by_account", w8.Body.String())
 }
 
-func TestGetPort(t *testing.T) {
-  os.Setenv("FUNCTIONS_CUSTOMHANDLER_PORT", "9090")
-  res1 := getPort()
-  assert.Equal(t, ":9090", res1)
-
-  os.Unsetenv("FUNCTIONS_CUSTOMHANDLER_PORT")
-  res2 := getPort()
-  assert.Equal(t, ":8080", res2)
+func TestSetupRouterProbes(t *testing.T) {
+  cfg := config.Default()
+  session_store := prepareSessionStore(nil, cfg)
+  apps := Apps{
+    AuthApp: &mockAuthApp{},
+    ScopesApp: &mockScopesApp{},
+    AssetsApp: &mockAssetsApp{},
+    SessionsApp: &mockSessionsApp{},
+    HealthApp: &mockHealthApp{},
+    BackupApp: &mockBackupApp{},
+    BundleApp: &mockBundleApp{},
+    RegisterApp: &mockRegisterApp{},
+    ReportApp: &mockReportApp{},
+    TemplateApp: &mockTemplateApp{},
+    StatisticsApp: &mockStatisticsApp{},
+    ChartApp: &mockChartApp{},
+    TrendApp: &mockTrendApp{},
+    SearchApp: &mockSearchApp{},
+  }
+  r := setupRouter(&apps, session_store, cfg)
+
+  /* The probes bypass the session and CSRF middlewares */
+  for _, path := range []string{"/healthz", "/readyz"} {
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", path, nil)
+    r.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+    assert.Equal(t, path, w.Body.String())
+    assert.Empty(t, w.Header().Values("Set-Cookie"))
+  }
 }
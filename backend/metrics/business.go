@@ -0,0 +1,95 @@
+package metrics
+
+import (
+  "context"
+  "time"
+
+  "github.com/prometheus/client_golang/prometheus"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+var (
+  activeSessionsDesc = prometheus.NewDesc(
+    prometheus.BuildFQName(NAMESPACE, "", "active_sessions"),
+    "Number of the logged in sessions, which are not idle for too long.",
+    nil, nil)
+  assetsDesc = prometheus.NewDesc(
+    prometheus.BuildFQName(NAMESPACE, "", "assets"),
+    "Number of the assets in the scope.",
+    []string{"scope_id", "scope"}, nil)
+  risksDesc = prometheus.NewDesc(
+    prometheus.BuildFQName(NAMESPACE, "", "risks"),
+    "Number of the risks in the scope by the risk level.",
+    []string{"scope_id", "scope", "level"}, nil)
+)
+
+/*
+ * BusinessCollector reads the numbers from the database at every scrape.  The
+ * risks are leveled with the thresholds of their own scope.
+ */
+type BusinessCollector struct {
+  Session_utils auth.ISessionUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+  Idle_timeout time.Duration
+}
+
+func (bc *BusinessCollector) Describe(ch chan<- *prometheus.Desc) {
+  ch <- activeSessionsDesc
+  ch <- assetsDesc
+  ch <- risksDesc
+}
+
+func (bc *BusinessCollector) collectSessions(ctx context.Context, ch chan<- prometheus.Metric) {
+  var since time.Time
+  if bc.Idle_timeout > 0 {
+    since = time.Now().UTC().Add(-bc.Idle_timeout)
+  }
+
+  count, err := bc.Session_utils.CountSessions(ctx, since)
+  if err != nil {
+    ch <- prometheus.NewInvalidMetric(activeSessionsDesc, err)
+    return
+  }
+  ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count))
+}
+
+func (bc *BusinessCollector) collectScope(ctx context.Context, ch chan<- prometheus.Metric, scope *risk_assessment.Scope) {
+  id := scope.ID.Hex()
+  assets, err := bc.Asset_utils.GetAssetsByScopeID(ctx, scope.ID)
+  if err != nil {
+    ch <- prometheus.NewInvalidMetric(assetsDesc, err)
+    return
+  }
+
+  levels := scope.RiskLevels()
+  counts := map[string]int{}
+  for _, asset := range assets {
+    for _, risk := range asset.Risks {
+      counts[levels.Level(risk_assessment.RiskScore(asset.Value, risk))]++
+    }
+  }
+
+  ch <- prometheus.MustNewConstMetric(assetsDesc, prometheus.GaugeValue, float64(len(assets)), id, scope.Name)
+  for _, level := range risk_assessment.RISK_LEVEL_NAMES {
+    ch <- prometheus.MustNewConstMetric(risksDesc, prometheus.GaugeValue, float64(counts[level]), id, scope.Name, level)
+  }
+}
+
+/* Each query is limited by the operation timeout of the utils */
+func (bc *BusinessCollector) Collect(ch chan<- prometheus.Metric) {
+  ctx := context.Background()
+  bc.collectSessions(ctx, ch)
+
+  scopes, err := bc.Scope_utils.GetScopes(ctx)
+  if err != nil {
+    ch <- prometheus.NewInvalidMetric(assetsDesc, err)
+    return
+  }
+
+  for i := range scopes {
+    bc.collectScope(ctx, ch, &scopes[i])
+  }
+}
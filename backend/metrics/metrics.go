@@ -0,0 +1,154 @@
+package metrics
+
+import (
+  "context"
+  "crypto/subtle"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/prometheus/client_golang/prometheus"
+  "github.com/prometheus/client_golang/prometheus/collectors"
+  "github.com/prometheus/client_golang/prometheus/promhttp"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/event"
+)
+
+const NAMESPACE = "riskassessment"
+
+/* Metrics holds the collectors, which are exposed in Prometheus format */
+type Metrics struct {
+  Registry *prometheus.Registry
+
+  requests *prometheus.CounterVec
+  request_duration *prometheus.HistogramVec
+  mongo_duration *prometheus.HistogramVec
+  mongo_errors *prometheus.CounterVec
+
+  /* The collection of the started Mongo commands, until they finish */
+  commands sync.Map
+}
+
+func New() *Metrics {
+  m := &Metrics{
+    Registry: prometheus.NewRegistry(),
+    requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+      Namespace: NAMESPACE,
+      Name: "http_requests_total",
+      Help: "Number of the HTTP requests by method, route and status code.",
+    }, []string{"method", "route", "code"}),
+    request_duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+      Namespace: NAMESPACE,
+      Name: "http_request_duration_seconds",
+      Help: "Latency of the HTTP requests by method and route.",
+      Buckets: prometheus.DefBuckets,
+    }, []string{"method", "route"}),
+    mongo_duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+      Namespace: NAMESPACE,
+      Name: "mongo_operation_duration_seconds",
+      Help: "Latency of the MongoDB commands by command and collection.",
+      Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+    }, []string{"command", "collection"}),
+    mongo_errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+      Namespace: NAMESPACE,
+      Name: "mongo_operation_errors_total",
+      Help: "Number of the failed MongoDB commands by command and collection.",
+    }, []string{"command", "collection"}),
+  }
+
+  m.Registry.MustRegister(
+    collectors.NewGoCollector(),
+    collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+    m.requests,
+    m.request_duration,
+    m.mongo_duration,
+    m.mongo_errors,
+  )
+  return m
+}
+
+/* Middleware counts the requests by the route pattern, not the raw path */
+func (m *Metrics) Middleware() gin.HandlerFunc {
+  return func(c *gin.Context) {
+    start := time.Now()
+
+    c.Next()
+
+    route := c.FullPath()
+    if route == "" {
+      route = "unmatched"
+    }
+    code := strconv.Itoa(c.Writer.Status())
+    m.requests.WithLabelValues(c.Request.Method, route, code).Inc()
+    m.request_duration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+  }
+}
+
+type commandKey struct {
+  connection string
+  request int64
+}
+
+/* The collection is the value of the command, or the "collection" field */
+func commandCollection(cmd bson.Raw, name string) string {
+  if coll, ok := cmd.Lookup(name).StringValueOK(); ok {
+    return coll
+  }
+  if coll, ok := cmd.Lookup("collection").StringValueOK(); ok {
+    return coll
+  }
+  return "none"
+}
+
+/* CommandMonitor observes every MongoDB command sent by the utils */
+func (m *Metrics) CommandMonitor() *event.CommandMonitor {
+  finish := func(key commandKey, name string, d time.Duration, failed bool) {
+    coll := "none"
+    if v, ok := m.commands.LoadAndDelete(key); ok {
+      coll = v.(string)
+    }
+
+    m.mongo_duration.WithLabelValues(name, coll).Observe(d.Seconds())
+    if failed {
+      m.mongo_errors.WithLabelValues(name, coll).Inc()
+    }
+  }
+
+  return &event.CommandMonitor{
+    Started: func(_ context.Context, e *event.CommandStartedEvent) {
+      key := commandKey{e.ConnectionID, e.RequestID}
+      m.commands.Store(key, commandCollection(e.Command, e.CommandName))
+    },
+    Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+      finish(commandKey{e.ConnectionID, e.RequestID}, e.CommandName, e.Duration, false)
+    },
+    Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+      finish(commandKey{e.ConnectionID, e.RequestID}, e.CommandName, e.Duration, true)
+    },
+  }
+}
+
+/*
+ * Handler serves the metrics.  If the token is not empty, the scraper must
+ * send it as "Authorization: Bearer <token>".
+ */
+func (m *Metrics) Handler(token string) http.Handler {
+  h := promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{
+    ErrorHandling: promhttp.ContinueOnError,
+  })
+  if token == "" {
+    return h
+  }
+
+  expected := []byte("Bearer " + token)
+  return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+    got := []byte(req.Header.Get("Authorization"))
+    if subtle.ConstantTimeCompare(got, expected) != 1 {
+      http.Error(w, "Permission denied", http.StatusUnauthorized)
+      return
+    }
+    h.ServeHTTP(w, req)
+  })
+}
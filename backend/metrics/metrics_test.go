@@ -0,0 +1,142 @@
+package metrics
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/gin-gonic/gin"
+  "github.com/prometheus/client_golang/prometheus/testutil"
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func TestMiddleware(t *testing.T) {
+  m := New()
+
+  gin.SetMode(gin.TestMode)
+  r := gin.New()
+  r.Use(m.Middleware())
+  r.GET("/api/getasset/:id", func(c *gin.Context) {
+    c.Status(http.StatusOK)
+  })
+
+  for _, path := range []string{"/api/getasset/1", "/api/getasset/2", "/nowhere"} {
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+  }
+
+  assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/api/getasset/:id", "200")))
+  assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "unmatched", "404")))
+}
+
+func TestHandler(t *testing.T) {
+  m := New()
+  h := m.Handler("token123")
+
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+  req := httptest.NewRequest("GET", "/metrics", nil)
+  req.Header.Set("Authorization", "Bearer wrong")
+  w = httptest.NewRecorder()
+  h.ServeHTTP(w, req)
+  assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+  req = httptest.NewRequest("GET", "/metrics", nil)
+  req.Header.Set("Authorization", "Bearer token123")
+  w = httptest.NewRecorder()
+  h.ServeHTTP(w, req)
+  assert.Equal(t, http.StatusOK, w.Code)
+  assert.Contains(t, w.Body.String(), "go_goroutines")
+}
+
+func TestHandlerNoToken(t *testing.T) {
+  w := httptest.NewRecorder()
+  New().Handler("").ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+  assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCommandCollection(t *testing.T) {
+  find, _ := bson.Marshal(bson.M{"find": "assets", "filter": bson.M{}})
+  more, _ := bson.Marshal(bson.M{"getMore": int64(1), "collection": "assets"})
+  ping, _ := bson.Marshal(bson.M{"ping": 1})
+
+  assert.Equal(t, "assets", commandCollection(find, "find"))
+  assert.Equal(t, "assets", commandCollection(more, "getMore"))
+  assert.Equal(t, "none", commandCollection(ping, "ping"))
+}
+
+/* Only the methods used by the collector are implemented */
+type fakeSessionUtils struct {
+  auth.ISessionUtils
+  count int64
+}
+
+func (f *fakeSessionUtils) CountSessions(ctx context.Context, since time.Time) (int64, error) {
+  return f.count, nil
+}
+
+type fakeScopeUtils struct {
+  risk_assessment.IScopeUtils
+  scopes []risk_assessment.Scope
+}
+
+func (f *fakeScopeUtils) GetScopes(ctx context.Context) ([]risk_assessment.Scope, error) {
+  return f.scopes, nil
+}
+
+type fakeAssetUtils struct {
+  risk_assessment.IAssetUtils
+  assets map[primitive.ObjectID][]risk_assessment.Asset
+}
+
+func (f *fakeAssetUtils) GetAssetsByScopeID(ctx context.Context, id primitive.ObjectID) ([]risk_assessment.Asset, error) {
+  return f.assets[id], nil
+}
+
+func TestBusinessCollector(t *testing.T) {
+  scope := risk_assessment.Scope{ID: primitive.NewObjectID(), Name: "Scope"}
+  value := risk_assessment.Value{Confidentiality: 2, Integrity: 2, Availability: 2}
+  asset := risk_assessment.Asset{
+    Value: value,
+    Risks: []risk_assessment.Risk{
+      {Possibility: 1, Impact: 1},
+      {Possibility: 3, Impact: 3},
+    },
+  }
+
+  bc := &BusinessCollector{
+    Session_utils: &fakeSessionUtils{count: 3},
+    Scope_utils: &fakeScopeUtils{scopes: []risk_assessment.Scope{scope}},
+    Asset_utils: &fakeAssetUtils{assets: map[primitive.ObjectID][]risk_assessment.Asset{
+      scope.ID: {asset},
+    }},
+    Idle_timeout: time.Hour,
+  }
+
+  id := scope.ID.Hex()
+  expected := `
+# HELP riskassessment_active_sessions Number of the logged in sessions, which are not idle for too long.
+# TYPE riskassessment_active_sessions gauge
+riskassessment_active_sessions 3
+# HELP riskassessment_assets Number of the assets in the scope.
+# TYPE riskassessment_assets gauge
+riskassessment_assets{scope="Scope",scope_id="` + id + `"} 1
+# HELP riskassessment_risks Number of the risks in the scope by the risk level.
+# TYPE riskassessment_risks gauge
+riskassessment_risks{level="high",scope="Scope",scope_id="` + id + `"} 1
+riskassessment_risks{level="low",scope="Scope",scope_id="` + id + `"} 1
+riskassessment_risks{level="medium",scope="Scope",scope_id="` + id + `"} 0
+`
+  err := testutil.CollectAndCompare(bc, strings.NewReader(expected))
+  assert.Nil(t, err)
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+  "log/slog"
+  "net/http"
+  "time"
+
+  "github.com/gin-gonic/gin"
+)
+
+/* The handlers keep the hex ID of the logged in user with this key */
+const USER_ID_KEY = "user_id"
+
+func SetUserID(c *gin.Context, id string) {
+  c.Set(USER_ID_KEY, id)
+}
+
+/*
+ * Logger writes one structured record per request.  The errors attached by
+ * the handlers with c.Error(), like the database errors of a 5xx response,
+ * are logged as the cause.
+ */
+func Logger(logger *slog.Logger) gin.HandlerFunc {
+  return func(c *gin.Context) {
+    start := time.Now()
+    path := c.Request.URL.Path
+
+    c.Next()
+
+    status := c.Writer.Status()
+    attrs := []slog.Attr{
+      slog.String("request_id", RequestIDFromContext(c.Request.Context())),
+      slog.String("method", c.Request.Method),
+      slog.String("path", path),
+      slog.String("route", c.FullPath()),
+      slog.Int("status", status),
+      slog.Duration("latency", time.Since(start)),
+      slog.String("client_ip", c.ClientIP()),
+    }
+
+    if id := c.GetString(USER_ID_KEY); id != "" {
+      attrs = append(attrs, slog.String("user_id", id))
+    }
+    if len(c.Errors) > 0 {
+      attrs = append(attrs, slog.String("error", c.Errors.String()))
+    }
+
+    level := slog.LevelInfo
+    if status >= http.StatusInternalServerError {
+      level = slog.LevelError
+    } else if status >= http.StatusBadRequest {
+      level = slog.LevelWarn
+    }
+
+    logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+  }
+}
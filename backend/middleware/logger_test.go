@@ -0,0 +1,63 @@
+package middleware
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "log/slog"
+  "net/http"
+  "github.com/gin-gonic/gin"
+
+  "testing"
+  "net/http/httptest"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+  var buf bytes.Buffer
+  logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+  r := gin.New()
+  r.Use(RequestID)
+  r.Use(Logger(logger))
+  r.GET("/fail/:id", func (c *gin.Context) {
+    SetUserID(c, "foo")
+    c.AbortWithError(http.StatusInternalServerError, errors.New("db is gone"))
+  })
+
+  res := httptest.NewRecorder()
+  req, _ := http.NewRequest("GET", "/fail/1", nil)
+  req.Header.Set(REQUEST_ID_HEADER, "bar")
+  r.ServeHTTP(res, req)
+
+  var record map[string]interface{}
+  json.Unmarshal(buf.Bytes(), &record)
+  assert.Equal(t, "ERROR", record["level"])
+  assert.Equal(t, "bar", record["request_id"])
+  assert.Equal(t, "/fail/1", record["path"])
+  assert.Equal(t, "/fail/:id", record["route"])
+  assert.Equal(t, float64(http.StatusInternalServerError), record["status"])
+  assert.Equal(t, "foo", record["user_id"])
+  assert.Contains(t, record["error"], "db is gone")
+}
+
+func TestLoggerInfo(t *testing.T) {
+  var buf bytes.Buffer
+  logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+  r := gin.New()
+  r.Use(Logger(logger))
+  r.GET("/", func (c *gin.Context) {
+    c.Status(http.StatusOK)
+  })
+
+  res := httptest.NewRecorder()
+  req, _ := http.NewRequest("GET", "/", nil)
+  r.ServeHTTP(res, req)
+
+  var record map[string]interface{}
+  json.Unmarshal(buf.Bytes(), &record)
+  assert.Equal(t, "INFO", record["level"])
+  assert.NotContains(t, record, "user_id")
+  assert.NotContains(t, record, "error")
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "regexp"
+
+  "github.com/gin-gonic/gin"
+)
+
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+type requestIDKey struct {}
+
+/* Trust the request ID given by a proxy only if it looks like an ID */
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func newRequestID() string {
+  b := make([]byte, 16)
+  rand.Read(b)
+  return hex.EncodeToString(b)
+}
+
+/*
+ * RequestID takes the X-Request-ID from the request, or generates one.  The ID
+ * is sent back with the response, and goes along with the request's context.
+ */
+func RequestID(c *gin.Context) {
+  id := c.GetHeader(REQUEST_ID_HEADER)
+  if !validRequestID.MatchString(id) {
+    id = newRequestID()
+  }
+
+  ctx := context.WithValue(c.Request.Context(), requestIDKey{}, id)
+  c.Request = c.Request.WithContext(ctx)
+  c.Writer.Header().Set(REQUEST_ID_HEADER, id)
+
+  c.Next()
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+  id, _ := ctx.Value(requestIDKey{}).(string)
+  return id
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+  "net/http"
+  "github.com/gin-gonic/gin"
+
+  "testing"
+  "net/http/httptest"
+  "github.com/stretchr/testify/assert"
+)
+
+func requestIDRouter() *gin.Engine {
+  r := gin.Default()
+  r.Use(RequestID)
+  r.GET("/", func (c *gin.Context) {
+    c.String(http.StatusOK, RequestIDFromContext(c.Request.Context()))
+  })
+  return r
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+  r := requestIDRouter()
+
+  res := httptest.NewRecorder()
+  req, _ := http.NewRequest("GET", "/", nil)
+  r.ServeHTTP(res, req)
+
+  id := res.Header().Get(REQUEST_ID_HEADER)
+  assert.Equal(t, 32, len(id))
+  assert.Equal(t, id, res.Body.String())
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+  r := requestIDRouter()
+
+  res1 := httptest.NewRecorder()
+  req1, _ := http.NewRequest("GET", "/", nil)
+  req1.Header.Set(REQUEST_ID_HEADER, "foo-123")
+  r.ServeHTTP(res1, req1)
+
+  assert.Equal(t, "foo-123", res1.Header().Get(REQUEST_ID_HEADER))
+  assert.Equal(t, "foo-123", res1.Body.String())
+
+  /* Do not trust a weird one */
+  res2 := httptest.NewRecorder()
+  req2, _ := http.NewRequest("GET", "/", nil)
+  req2.Header.Set(REQUEST_ID_HEADER, "foo\"bar")
+  r.ServeHTTP(res2, req2)
+
+  assert.NotEqual(t, "foo\"bar", res2.Header().Get(REQUEST_ID_HEADER))
+}
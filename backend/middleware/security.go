@@ -0,0 +1,38 @@
+package middleware
+
+import (
+  "github.com/gin-gonic/gin"
+)
+
+/*
+ * The built Vue bundle only loads its scripts, styles and images from the
+ * server itself, and talks to the API on the same origin.
+ */
+const CONTENT_SECURITY_POLICY = "default-src 'self'; " +
+  "script-src 'self'; " +
+  "style-src 'self'; " +
+  "img-src 'self' data:; " +
+  "font-src 'self'; " +
+  "connect-src 'self'; " +
+  "object-src 'none'; " +
+  "base-uri 'self'; " +
+  "form-action 'self'; " +
+  "frame-ancestors 'none'"
+
+const STRICT_TRANSPORT_SECURITY = "max-age=31536000; includeSubDomains"
+
+/* HSTS only makes sense, when the server is served over HTTPS */
+func SecurityHeaders(tls bool) gin.HandlerFunc {
+  return func(c *gin.Context) {
+    h := c.Writer.Header()
+    h.Set("Content-Security-Policy", CONTENT_SECURITY_POLICY)
+    h.Set("X-Frame-Options", "DENY")
+    h.Set("X-Content-Type-Options", "nosniff")
+    h.Set("Referrer-Policy", "same-origin")
+    if tls {
+      h.Set("Strict-Transport-Security", STRICT_TRANSPORT_SECURITY)
+    }
+
+    c.Next()
+  }
+}
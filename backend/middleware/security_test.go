@@ -0,0 +1,43 @@
+package middleware
+
+import (
+  "net/http"
+  "github.com/gin-gonic/gin"
+
+  "testing"
+  "net/http/httptest"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+  r := gin.Default()
+  r.Use(SecurityHeaders(false))
+  r.GET("/", func (c *gin.Context) {
+    c.Status(http.StatusOK)
+  })
+
+  res := httptest.NewRecorder()
+  req, _ := http.NewRequest("GET", "/", nil)
+  r.ServeHTTP(res, req)
+
+  assert.Equal(t, http.StatusOK, res.Code)
+  assert.Equal(t, CONTENT_SECURITY_POLICY, res.Header().Get("Content-Security-Policy"))
+  assert.Equal(t, "DENY", res.Header().Get("X-Frame-Options"))
+  assert.Equal(t, "same-origin", res.Header().Get("Referrer-Policy"))
+  assert.Equal(t, "nosniff", res.Header().Get("X-Content-Type-Options"))
+  assert.Empty(t, res.Header().Get("Strict-Transport-Security"))
+}
+
+func TestSecurityHeadersTLS(t *testing.T) {
+  r := gin.Default()
+  r.Use(SecurityHeaders(true))
+  r.GET("/", func (c *gin.Context) {
+    c.Status(http.StatusOK)
+  })
+
+  res := httptest.NewRecorder()
+  req, _ := http.NewRequest("GET", "/", nil)
+  r.ServeHTTP(res, req)
+
+  assert.Equal(t, STRICT_TRANSPORT_SECURITY, res.Header().Get("Strict-Transport-Security"))
+}
@@ -0,0 +1,76 @@
+/*
+ * The schema migrations of MongoDB.  The PostgreSQL ones are the SQL files of
+ * the database package, and the bolt storage needs none.
+ */
+
+package migrations
+
+import (
+  "context"
+
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/mongo"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/* Append the new migrations with the next versions, never change the old ones */
+var MONGO_MIGRATIONS = []database.MongoMigration{
+  {Version: 1, Name: "unique account", Up: uniqueAccount},
+  {Version: 2, Name: "asset scope index", Up: assetScopeIndex},
+  {Version: 3, Name: "session user index", Up: sessionUserIndex},
+  {Version: 4, Name: "empty scopes and risks", Up: emptyArrays},
+  {Version: 5, Name: "unique trend day", Up: uniqueTrendDay},
+  {Version: 6, Name: "asset text index", Up: assetTextIndex},
+}
+
+func uniqueAccount(ctx context.Context, db *mongo.Database) (error) {
+  return auth.EnsureAccountIndex(ctx, db.Collection(auth.USER_COLLECTION))
+}
+
+func assetScopeIndex(ctx context.Context, db *mongo.Database) (error) {
+  index := mongo.IndexModel{ Keys: bson.M{"scope": 1} }
+  _, err := db.Collection(risk_assessment.ASSET_COLLECTION).Indexes().CreateOne(ctx, index)
+  return err
+}
+
+func sessionUserIndex(ctx context.Context, db *mongo.Database) (error) {
+  index := mongo.IndexModel{ Keys: bson.M{"user": 1} }
+  _, err := db.Collection(auth.SESSION_INFO_COLLECTION).Indexes().CreateOne(ctx, index)
+  return err
+}
+
+/* The users' scopes and the assets' risks are arrays, even if they are empty */
+func emptyArrays(ctx context.Context, db *mongo.Database) (error) {
+  fields := []struct {
+    Collection string
+    Field string
+  }{
+    {auth.USER_COLLECTION, "scopes"},
+    {risk_assessment.ASSET_COLLECTION, "risks"},
+  }
+
+  for _, f := range fields {
+    filter := bson.M{f.Field: nil}
+    update := bson.M{"$set": bson.M{f.Field: bson.A{}}}
+    if _, err := db.Collection(f.Collection).UpdateMany(ctx, filter, update); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func uniqueTrendDay(ctx context.Context, db *mongo.Database) (error) {
+  return risk_assessment.EnsureTrendIndex(ctx, db.Collection(risk_assessment.TREND_COLLECTION))
+}
+
+func assetTextIndex(ctx context.Context, db *mongo.Database) (error) {
+  return risk_assessment.EnsureSearchIndex(ctx, db.Collection(risk_assessment.ASSET_COLLECTION))
+}
+
+/* Migrate the database of the client to the latest schema version */
+func MigrateMongo(ctx context.Context, client *mongo.Client, db_name string) (int, error) {
+  return database.MigrateMongo(ctx, client.Database(db_name), MONGO_MIGRATIONS)
+}
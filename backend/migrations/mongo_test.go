@@ -0,0 +1,63 @@
+package migrations
+
+import (
+  "context"
+  "os"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+func TestMongoMigrationVersions(t *testing.T) {
+  for i, m := range MONGO_MIGRATIONS {
+    assert.Equal(t, i + 1, m.Version, m.Name)
+    assert.NotNil(t, m.Up, m.Name)
+  }
+}
+
+func TestMigrateMongo(t *testing.T) {
+  uri := os.Getenv("MONGODB_TEST_URI")
+  if uri == "" {
+    t.Skip("MONGODB_TEST_URI is not given")
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+  defer cancel()
+  client, err := database.Connect(ctx, uri, database.DEFAULT_BACKOFF)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer client.Disconnect(context.Background())
+
+  db := client.Database("migrations_test")
+  db.Drop(context.TODO())
+  defer db.Drop(context.TODO())
+
+  /* A user of the old schema without scopes */
+  users := db.Collection(auth.USER_COLLECTION)
+  _, err = users.InsertOne(context.TODO(), bson.M{"_id": primitive.NewObjectID(), "account": "foo"})
+  assert.Nil(t, err)
+
+  latest := MONGO_MIGRATIONS[len(MONGO_MIGRATIONS) - 1].Version
+  version, err := MigrateMongo(context.TODO(), client, "migrations_test")
+  assert.Nil(t, err)
+  assert.Equal(t, latest, version)
+
+  var user auth.User
+  users.FindOne(context.TODO(), bson.M{"account": "foo"}).Decode(&user)
+  assert.Equal(t, []primitive.ObjectID{}, user.Scopes)
+
+  /* The account is unique now */
+  _, err = users.InsertOne(context.TODO(), bson.M{"_id": primitive.NewObjectID(), "account": "foo"})
+  assert.NotNil(t, err)
+
+  /* Nothing more to migrate */
+  version, err = MigrateMongo(context.TODO(), client, "migrations_test")
+  assert.Nil(t, err)
+  assert.Equal(t, latest, version)
+}
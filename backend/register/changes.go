@@ -0,0 +1,428 @@
+package register
+
+import (
+  "context"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "sort"
+  "strconv"
+  "strings"
+
+  "github.com/xuri/excelize/v2"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/*
+ * An exported workbook could be edited offline and uploaded again.  The rows
+ * are matched to the stored assets and risks by the hidden columns, and the
+ * differences become a change set, which is previewed before it is applied:
+ *
+ *   - The edited cells of an asset or a risk update them.
+ *   - A new row of an asset's name, or a copied row, adds a risk to it.
+ *   - A deleted row removes the risk, but an asset without any row is kept.
+ *   - The rows of an asset changed since the export are rejected.
+ *   - The changes are applied only to the assets which are not changed since
+ *     the upload, or none of them are.
+ */
+
+/* The header of the asset and the risk cells, without the computed ones */
+var ASSET_CELLS = HEADER[:7]
+var RISK_CELLS = HEADER[7:12]
+
+/* The names of the ratings in the problems, like the CSV of the assets */
+var RATING_NAMES = map[string]string{
+  "C": risk_assessment.COLUMN_CONFIDENTIALITY,
+  "I": risk_assessment.COLUMN_INTEGRITY,
+  "A": risk_assessment.COLUMN_AVAILABILITY,
+  "Possibility": risk_assessment.COLUMN_POSSIBILITY,
+  "Impact": risk_assessment.COLUMN_IMPACT,
+}
+
+type FieldChange struct {
+  Field string
+  Old string
+  New string
+}
+
+/* The changed cells of a stored risk, which is numbered from 1 as the Risk ID */
+type RiskChange struct {
+  Risk int
+  Fields []FieldChange
+}
+
+type AssetChange struct {
+  ID primitive.ObjectID
+  Name string
+  /* The version of the asset which the changes are made on */
+  Version string
+  Fields []FieldChange
+  Updated []RiskChange
+  Added []risk_assessment.Risk
+  Removed []risk_assessment.Risk
+  /* The asset before and after the changes */
+  stored risk_assessment.Asset
+  asset risk_assessment.Asset
+}
+
+type RowProblem struct {
+  Line int
+  Name string
+  Problem string
+}
+
+type ChangeSet struct {
+  Changes []AssetChange
+  /* The rows of the assets changed or deleted since the export */
+  Rejected []RowProblem
+  Invalid []RowProblem
+  /* Confirms the same changes as the preview, if nothing is invalid */
+  Token string
+  Applied bool
+}
+
+/* The version of the asset, which changes with any of its fields */
+func Version(asset *risk_assessment.Asset) string {
+  data, _ := json.Marshal(asset)
+  sum := sha256.Sum256(data)
+  return hex.EncodeToString(sum[:8])
+}
+
+/* A row of the uploaded sheet, numbered from 1 for the header */
+type sheetRow struct {
+  line int
+  cells map[string]string
+  /* Whether the row has the hidden asset ID */
+  exported bool
+}
+
+func (row *sheetRow) empty(names []string) bool {
+  for _, name := range names {
+    if row.cells[name] != "" {
+      return false
+    }
+  }
+  return true
+}
+
+func assetCells(asset *risk_assessment.Asset) []string {
+  row := Row{Asset: asset}
+  return row.Strings()[:len(ASSET_CELLS)]
+}
+
+func riskCells(risk *risk_assessment.Risk) []string {
+  return []string{risk.Threat, risk.Vulnerability, risk.CurrentControl,
+                  uintString(risk.Possibility), uintString(risk.Impact)}
+}
+
+func fieldChanges(names []string, old []string, new []string) []FieldChange {
+  changes := []FieldChange{}
+  for i, name := range names {
+    if old[i] != new[i] {
+      changes = append(changes, FieldChange{Field: name, Old: old[i], New: new[i]})
+    }
+  }
+  return changes
+}
+
+/* The asset as the rows, and the changes of it */
+func diffAsset(stored *risk_assessment.Asset, rows []sheetRow) (AssetChange, []RowProblem) {
+  problems := []RowProblem{}
+  problem := func(row *sheetRow, format string, args ...interface{}) {
+    problems = append(problems, RowProblem{Line: row.line, Name: stored.Name, Problem: fmt.Sprintf(format, args...)})
+  }
+  rating := func(row *sheetRow, name string) uint {
+    value, msg := risk_assessment.ParseRating(RATING_NAMES[name], row.cells[name])
+    if msg != "" {
+      problem(row, "%s", msg)
+    }
+    return value
+  }
+
+  /* The asset cells of the first exported row, which the others must have too */
+  var first *sheetRow
+  for i := range rows {
+    if !rows[i].exported {
+      continue
+    }
+    if first == nil {
+      first = &rows[i]
+      continue
+    }
+    for _, name := range ASSET_CELLS {
+      if rows[i].cells[name] != first.cells[name] {
+        problem(&rows[i], "the asset cells are different from line %d", first.line)
+        break
+      }
+    }
+  }
+
+  asset := *stored
+  asset.BigCategory = first.cells["Big Category"]
+  asset.SmallCategory = first.cells["Small Category"]
+  asset.Name = first.cells["Name"]
+  asset.Owner = first.cells["Owner"]
+  asset.Value = risk_assessment.Value{
+    Confidentiality: rating(first, "C"),
+    Integrity: rating(first, "I"),
+    Availability: rating(first, "A"),
+  }
+  if asset.Name == "" {
+    problem(first, "empty name")
+  }
+  if !risk_assessment.ValidCategory(asset.BigCategory, asset.SmallCategory) {
+    problem(first, "unknown category %q / %q", asset.BigCategory, asset.SmallCategory)
+  }
+
+  change := AssetChange{
+    ID: stored.ID,
+    Name: asset.Name,
+    Version: Version(stored),
+    Fields: fieldChanges(ASSET_CELLS, assetCells(stored), assetCells(&asset)),
+    Updated: []RiskChange{},
+    Added: []risk_assessment.Risk{},
+    Removed: []risk_assessment.Risk{},
+  }
+
+  asset.Risks = []risk_assessment.Risk{}
+  used := map[int]bool{}
+  for i := range rows {
+    row := &rows[i]
+    if row.empty(RISK_CELLS) && row.cells[COLUMN_RISK_ID] == "" {
+      continue
+    }
+
+    risk := risk_assessment.Risk{
+      Threat: row.cells["Threat"],
+      Vulnerability: row.cells["Vulnerability"],
+      CurrentControl: row.cells["Control"],
+      Possibility: rating(row, "Possibility"),
+      Impact: rating(row, "Impact"),
+    }
+
+    /* A copied row has the same Risk ID, but it is a new risk */
+    index := 0
+    if id := row.cells[COLUMN_RISK_ID]; row.exported && id != "" {
+      n, err := strconv.Atoi(id)
+      if err != nil || n < 1 || n > len(stored.Risks) {
+        problem(row, "invalid risk ID %q", id)
+        continue
+      }
+      if !used[n] {
+        used[n] = true
+        index = n
+      }
+    }
+
+    asset.Risks = append(asset.Risks, risk)
+    if index == 0 {
+      change.Added = append(change.Added, risk)
+    } else if fields := fieldChanges(RISK_CELLS, riskCells(&stored.Risks[index - 1]), riskCells(&risk)); len(fields) > 0 {
+      change.Updated = append(change.Updated, RiskChange{Risk: index, Fields: fields})
+    }
+  }
+
+  for i := range stored.Risks {
+    if !used[i + 1] {
+      change.Removed = append(change.Removed, stored.Risks[i])
+    }
+  }
+
+  change.stored = *stored
+  change.asset = asset
+  return change, problems
+}
+
+func (change *AssetChange) changed() bool {
+  return len(change.Fields) + len(change.Updated) + len(change.Added) + len(change.Removed) > 0
+}
+
+func sortProblems(problems []RowProblem) {
+  sort.SliceStable(problems, func(i, j int) bool {
+    return problems[i].Line < problems[j].Line
+  })
+}
+
+/*
+ * Compute the changes of the uploaded workbook against the stored assets of
+ * the scope.  An error means it is not an exported risk register at all.
+ */
+func ParseChanges(r io.Reader, assets []risk_assessment.Asset) (ChangeSet, error) {
+  changes := ChangeSet{Changes: []AssetChange{}, Rejected: []RowProblem{}, Invalid: []RowProblem{}}
+
+  f, err := excelize.OpenReader(r)
+  if err != nil {
+    return changes, err
+  }
+  defer f.Close()
+
+  rows, err := f.GetRows(SHEET)
+  if err != nil {
+    return changes, fmt.Errorf("no sheet %q of a risk register", SHEET)
+  } else if len(rows) == 0 {
+    return changes, errors.New("empty sheet")
+  } else if len(rows) - 1 > risk_assessment.MAX_CSV_ROWS {
+    return changes, fmt.Errorf("more than %d rows", risk_assessment.MAX_CSV_ROWS)
+  }
+
+  columns := map[string]int{}
+  for i, name := range rows[0] {
+    columns[strings.TrimSpace(name)] = i
+  }
+  names := append(append(append([]string{}, ASSET_CELLS...), RISK_CELLS...), HIDDEN_HEADER...)
+  for _, name := range names {
+    if _, ok := columns[name]; !ok {
+      return changes, fmt.Errorf("missing column %q", name)
+    }
+  }
+
+  stored := map[primitive.ObjectID]*risk_assessment.Asset{}
+  by_name := map[string]*risk_assessment.Asset{}
+  for i := range assets {
+    stored[assets[i].ID] = &assets[i]
+    by_name[strings.TrimSpace(assets[i].Name)] = &assets[i]
+  }
+
+  sheet := []sheetRow{}
+  for i, record := range rows[1:] {
+    row := sheetRow{line: i + 2, cells: map[string]string{}}
+    for _, name := range names {
+      if column := columns[name]; column < len(record) {
+        row.cells[name] = strings.TrimSpace(record[column])
+      }
+    }
+    if !row.empty(names) {
+      sheet = append(sheet, row)
+    }
+  }
+
+  /* The new rows could have the new names of the assets in the same upload */
+  for _, row := range sheet {
+    id, err := primitive.ObjectIDFromHex(row.cells[COLUMN_ASSET_ID])
+    if asset := stored[id]; err == nil && asset != nil && row.cells["Name"] != "" {
+      by_name[row.cells["Name"]] = asset
+    }
+  }
+
+  order := []primitive.ObjectID{}
+  grouped := map[primitive.ObjectID][]sheetRow{}
+  rejected := map[primitive.ObjectID]string{}
+  for _, row := range sheet {
+    var asset *risk_assessment.Asset
+    if id_hex := row.cells[COLUMN_ASSET_ID]; id_hex != "" {
+      id, err := primitive.ObjectIDFromHex(id_hex)
+      if err != nil {
+        changes.Invalid = append(changes.Invalid, RowProblem{Line: row.line, Name: row.cells["Name"], Problem: "invalid asset ID"})
+        continue
+      }
+      asset = stored[id]
+      if asset == nil {
+        changes.Rejected = append(changes.Rejected, RowProblem{Line: row.line, Name: row.cells["Name"], Problem: "the asset is deleted since the export"})
+        continue
+      } else if row.cells[COLUMN_VERSION] != Version(asset) {
+        rejected[id] = "the asset is changed since the export"
+      }
+      row.exported = true
+    } else if asset = by_name[row.cells["Name"]]; asset == nil {
+      changes.Invalid = append(changes.Invalid, RowProblem{Line: row.line, Name: row.cells["Name"], Problem: "unknown asset, new assets are imported from a CSV"})
+      continue
+    }
+
+    if _, ok := grouped[asset.ID]; !ok {
+      order = append(order, asset.ID)
+    }
+    grouped[asset.ID] = append(grouped[asset.ID], row)
+  }
+
+  /* The names must stay unique in the scope */
+  owners := map[string]primitive.ObjectID{}
+  for i := range assets {
+    owners[strings.TrimSpace(assets[i].Name)] = assets[i].ID
+  }
+
+  for _, id := range order {
+    rows := grouped[id]
+    if reason, ok := rejected[id]; ok {
+      for _, row := range rows {
+        changes.Rejected = append(changes.Rejected, RowProblem{Line: row.line, Name: stored[id].Name, Problem: reason})
+      }
+      continue
+    }
+
+    exported := false
+    for _, row := range rows {
+      exported = exported || row.exported
+    }
+    if !exported {
+      for _, row := range rows {
+        changes.Invalid = append(changes.Invalid, RowProblem{Line: row.line, Name: stored[id].Name, Problem: "no exported row of the asset"})
+      }
+      continue
+    }
+
+    change, problems := diffAsset(stored[id], rows)
+    changes.Invalid = append(changes.Invalid, problems...)
+    if change.Name != stored[id].Name && change.Name != "" {
+      if owner, dup := owners[change.Name]; dup && owner != id {
+        changes.Invalid = append(changes.Invalid, RowProblem{Line: rows[0].line, Name: stored[id].Name,
+                                                             Problem: fmt.Sprintf("duplicate name %q of another asset", change.Name)})
+      }
+      delete(owners, stored[id].Name)
+      owners[change.Name] = id
+    }
+    if change.changed() {
+      changes.Changes = append(changes.Changes, change)
+    }
+  }
+
+  sortProblems(changes.Rejected)
+  sortProblems(changes.Invalid)
+  if len(changes.Invalid) == 0 {
+    data, _ := json.Marshal([]interface{}{changes.Changes, changes.Rejected})
+    sum := sha256.Sum256(data)
+    changes.Token = hex.EncodeToString(sum[:])
+  }
+  return changes, nil
+}
+
+/*
+ * Update the changed assets of the change set without any invalid row, if
+ * they are still the uploaded ones.  If any of them fails, the updated ones
+ * are rolled back, unless they are changed again, and the error tells which
+ * are left applied.
+ */
+func Apply(ctx context.Context, asset_utils risk_assessment.IAssetUtils, changes *ChangeSet) error {
+  if len(changes.Invalid) > 0 {
+    return errors.New("invalid rows")
+  }
+
+  for i := range changes.Changes {
+    change := &changes.Changes[i]
+    if err := asset_utils.ReplaceAsset(ctx, &change.stored, &change.asset); err != nil {
+      return rollback(ctx, asset_utils, changes.Changes[:i], fmt.Errorf("asset %q: %w", change.stored.Name, err))
+    }
+  }
+  changes.Applied = true
+  return nil
+}
+
+/* Roll back the applied changes after the cause, even if the request is canceled */
+func rollback(ctx context.Context, asset_utils risk_assessment.IAssetUtils, applied []AssetChange, cause error) error {
+  ctx = context.WithoutCancel(ctx)
+
+  kept := []string{}
+  for i := len(applied) - 1; i >= 0; i-- {
+    if err := asset_utils.ReplaceAsset(ctx, &applied[i].asset, &applied[i].stored); err != nil {
+      kept = append(kept, strconv.Quote(applied[i].Name))
+    }
+  }
+  if len(kept) > 0 {
+    return fmt.Errorf("%w, and the changes of %s are left applied", cause, strings.Join(kept, ", "))
+  }
+  return fmt.Errorf("%w, and no change is applied", cause)
+}
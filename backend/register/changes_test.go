@@ -0,0 +1,226 @@
+package register
+
+import (
+  "bytes"
+  "context"
+  "path/filepath"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/xuri/excelize/v2"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/* The stored test assets of a scope */
+func storeAssets(t *testing.T) (*risk_assessment.BoltAssetUtils, primitive.ObjectID) {
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "register.db"))
+  assert.Nil(t, err)
+  t.Cleanup(func() { db.Close() })
+
+  asset_utils := &risk_assessment.BoltAssetUtils{DB: db}
+  s_id := primitive.NewObjectID()
+  for _, asset := range testAssets() {
+    asset.Scope = s_id
+    assert.Nil(t, asset_utils.AddAsset(context.TODO(), &asset))
+  }
+  return asset_utils, s_id
+}
+
+func getAssets(t *testing.T, asset_utils risk_assessment.IAssetUtils, s_id primitive.ObjectID) []risk_assessment.Asset {
+  assets, err := asset_utils.GetAssetsByScopeID(context.TODO(), s_id)
+  assert.Nil(t, err)
+  return assets
+}
+
+/* Export the assets, and edit the workbook like an assessor */
+func editWorkbook(t *testing.T, assets []risk_assessment.Asset, edit func(f *excelize.File)) *bytes.Buffer {
+  var buf bytes.Buffer
+  assert.Nil(t, WriteXLSX(&buf, Rows(assets, risk_assessment.DEFAULT_RISK_LEVELS), risk_assessment.DEFAULT_RISK_LEVELS))
+
+  f, err := excelize.OpenReader(&buf)
+  assert.Nil(t, err)
+  defer f.Close()
+  edit(f)
+
+  var edited bytes.Buffer
+  _, err = f.WriteTo(&edited)
+  assert.Nil(t, err)
+  return &edited
+}
+
+func TestParseChangesUnchanged(t *testing.T) {
+  asset_utils, s_id := storeAssets(t)
+  assets := getAssets(t, asset_utils, s_id)
+
+  changes, err := ParseChanges(editWorkbook(t, assets, func(f *excelize.File) {}), assets)
+  assert.Nil(t, err)
+  assert.Equal(t, []AssetChange{}, changes.Changes)
+  assert.Equal(t, []RowProblem{}, changes.Rejected)
+  assert.Equal(t, []RowProblem{}, changes.Invalid)
+  assert.NotEqual(t, "", changes.Token)
+}
+
+func TestParseChanges(t *testing.T) {
+  ctx := context.TODO()
+  asset_utils, s_id := storeAssets(t)
+  assets := getAssets(t, asset_utils, s_id)
+
+  /* web: C 3 -> 4, edit the first risk and remove the second; gcc: add a risk */
+  workbook := editWorkbook(t, assets, func(f *excelize.File) {
+    assert.Nil(t, f.RemoveRow(SHEET, 3))
+    f.SetCellValue(SHEET, "E2", 4)
+    f.SetCellValue(SHEET, "H2", "Blackout")
+    f.SetSheetRow(SHEET, "A4", &[]interface{}{"", "", "gcc", "", "", "", "", "Theft", "", "", 1, 1})
+  })
+
+  changes, err := ParseChanges(workbook, assets)
+  assert.Nil(t, err)
+  assert.Equal(t, []RowProblem{}, changes.Invalid)
+  assert.Equal(t, 2, len(changes.Changes))
+
+  web := changes.Changes[0]
+  assert.Equal(t, assets[0].ID, web.ID)
+  assert.Equal(t, []FieldChange{{Field: "C", Old: "3", New: "4"}}, web.Fields)
+  assert.Equal(t, []RiskChange{{Risk: 1, Fields: []FieldChange{{Field: "Threat", Old: "Power failure", New: "Blackout"}}}}, web.Updated)
+  assert.Equal(t, []risk_assessment.Risk{}, web.Added)
+  assert.Equal(t, []risk_assessment.Risk{assets[0].Risks[1]}, web.Removed)
+
+  gcc := changes.Changes[1]
+  assert.Equal(t, []FieldChange{}, gcc.Fields)
+  assert.Equal(t, []risk_assessment.Risk{{Threat: "Theft", Possibility: 1, Impact: 1}}, gcc.Added)
+
+  /* The same changes have the same token */
+  again, _ := ParseChanges(editWorkbook(t, assets, func(f *excelize.File) {
+    f.RemoveRow(SHEET, 3)
+    f.SetCellValue(SHEET, "E2", 4)
+    f.SetCellValue(SHEET, "H2", "Blackout")
+    f.SetSheetRow(SHEET, "A4", &[]interface{}{"", "", "gcc", "", "", "", "", "Theft", "", "", 1, 1})
+  }), assets)
+  assert.Equal(t, changes.Token, again.Token)
+
+  assert.Nil(t, Apply(ctx, asset_utils, &changes))
+  assert.True(t, changes.Applied)
+  stored := getAssets(t, asset_utils, s_id)
+  assert.Equal(t, uint(4), stored[0].Value.Confidentiality)
+  assert.Equal(t, []risk_assessment.Risk{{Threat: "Blackout", Vulnerability: "No UPS", Possibility: 2, Impact: 3}}, stored[0].Risks)
+  assert.Equal(t, assets[0].CreateTime, stored[0].CreateTime)
+  assert.Equal(t, 1, len(stored[1].Risks))
+}
+
+func TestParseChangesRenamed(t *testing.T) {
+  asset_utils, s_id := storeAssets(t)
+  assets := getAssets(t, asset_utils, s_id)
+
+  /* gcc is renamed, and a new risk row has the new name */
+  workbook := editWorkbook(t, assets, func(f *excelize.File) {
+    f.SetCellValue(SHEET, "C4", "clang")
+    f.SetSheetRow(SHEET, "A5", &[]interface{}{"", "", "clang", "", "", "", "", "Theft", "", "", 1, 1})
+  })
+
+  changes, err := ParseChanges(workbook, assets)
+  assert.Nil(t, err)
+  assert.Equal(t, []RowProblem{}, changes.Invalid)
+  assert.Equal(t, 1, len(changes.Changes))
+  assert.Equal(t, assets[1].ID, changes.Changes[0].ID)
+  assert.Equal(t, []FieldChange{{Field: "Name", Old: "gcc", New: "clang"}}, changes.Changes[0].Fields)
+  assert.Equal(t, []risk_assessment.Risk{{Threat: "Theft", Possibility: 1, Impact: 1}}, changes.Changes[0].Added)
+}
+
+func TestApplyChanged(t *testing.T) {
+  ctx := context.TODO()
+  asset_utils, s_id := storeAssets(t)
+  assets := getAssets(t, asset_utils, s_id)
+
+  workbook := editWorkbook(t, assets, func(f *excelize.File) {
+    f.SetCellValue(SHEET, "D2", "Ops")
+    f.SetCellValue(SHEET, "D3", "Ops")
+    f.SetCellValue(SHEET, "D4", "Dev")
+  })
+  changes, err := ParseChanges(workbook, assets)
+  assert.Nil(t, err)
+  assert.Equal(t, 2, len(changes.Changes))
+
+  /* Someone changed gcc after the upload, so web is rolled back */
+  gcc := assets[1]
+  gcc.Owner = "Security"
+  assert.Nil(t, asset_utils.UpdateAsset(ctx, &gcc))
+
+  err = Apply(ctx, asset_utils, &changes)
+  assert.ErrorIs(t, err, risk_assessment.ErrAssetChanged)
+  assert.ErrorContains(t, err, `asset "gcc"`)
+  assert.ErrorContains(t, err, "no change is applied")
+  assert.False(t, changes.Applied)
+  stored := getAssets(t, asset_utils, s_id)
+  assert.Equal(t, assets[0], stored[0])
+  assert.Equal(t, "Security", stored[1].Owner)
+}
+
+func TestParseChangesRejected(t *testing.T) {
+  ctx := context.TODO()
+  asset_utils, s_id := storeAssets(t)
+  assets := getAssets(t, asset_utils, s_id)
+
+  workbook := editWorkbook(t, assets, func(f *excelize.File) {
+    f.SetCellValue(SHEET, "D2", "Ops")
+    f.SetCellValue(SHEET, "D3", "Ops")
+    f.SetCellValue(SHEET, "D4", "Dev")
+  })
+
+  /* Someone changed web after the export */
+  web := assets[0]
+  web.Owner = "Security"
+  assert.Nil(t, asset_utils.UpdateAsset(ctx, &web))
+  assets = getAssets(t, asset_utils, s_id)
+
+  changes, err := ParseChanges(bytes.NewReader(workbook.Bytes()), assets)
+  assert.Nil(t, err)
+  assert.Equal(t, []RowProblem{
+    {Line: 2, Name: "web", Problem: "the asset is changed since the export"},
+    {Line: 3, Name: "web", Problem: "the asset is changed since the export"},
+  }, changes.Rejected)
+  assert.Equal(t, 1, len(changes.Changes))
+  assert.Equal(t, []FieldChange{{Field: "Owner", Old: "", New: "Dev"}}, changes.Changes[0].Fields)
+
+  /* The deleted asset */
+  assert.Nil(t, asset_utils.DeleteAsset(ctx, assets[0].ID))
+  changes, err = ParseChanges(workbook, getAssets(t, asset_utils, s_id))
+  assert.Nil(t, err)
+  assert.Equal(t, "the asset is deleted since the export", changes.Rejected[0].Problem)
+}
+
+func TestParseChangesInvalid(t *testing.T) {
+  ctx := context.TODO()
+  asset_utils, s_id := storeAssets(t)
+  assets := getAssets(t, asset_utils, s_id)
+
+  workbook := editWorkbook(t, assets, func(f *excelize.File) {
+    f.SetCellValue(SHEET, "E2", 4)
+    f.SetCellValue(SHEET, "K3", 5)
+    f.SetCellValue(SHEET, "C4", "web")
+    f.SetSheetRow(SHEET, "A5", &[]interface{}{"", "", "foo", "", "", "", "", "Theft", "", "", 1, 1})
+  })
+
+  changes, err := ParseChanges(workbook, assets)
+  assert.Nil(t, err)
+  assert.Equal(t, []RowProblem{
+    {Line: 3, Name: "web", Problem: "the asset cells are different from line 2"},
+    {Line: 3, Name: "web", Problem: "possibility 5 is not in 1-4"},
+    {Line: 4, Name: "gcc", Problem: `duplicate name "web" of another asset`},
+    {Line: 5, Name: "foo", Problem: "unknown asset, new assets are imported from a CSV"},
+  }, changes.Invalid)
+  assert.Equal(t, "", changes.Token)
+  assert.NotNil(t, Apply(ctx, asset_utils, &changes))
+  assert.Equal(t, assets, getAssets(t, asset_utils, s_id))
+
+  _, err = ParseChanges(bytes.NewBufferString("foo"), assets)
+  assert.NotNil(t, err)
+
+  workbook = editWorkbook(t, assets, func(f *excelize.File) {
+    f.RemoveCol(SHEET, "O")
+  })
+  _, err = ParseChanges(workbook, assets)
+  assert.ErrorContains(t, err, `missing column "Asset ID"`)
+}
@@ -0,0 +1,232 @@
+package register
+
+import (
+  "fmt"
+  "io"
+  "time"
+
+  "github.com/xuri/excelize/v2"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/*
+ * The asset inventory and the risk evaluation forms of the government
+ * training document cited in assetrisk.go, which the agencies submit in
+ * the same layout: a title, the scope and the date, then the header.
+ */
+const (
+  INVENTORY_SHEET = "資產清冊"
+  EVALUATION_SHEET = "風險評鑑表"
+  INVENTORY_TITLE = "資訊資產清冊"
+  EVALUATION_TITLE = "資訊資產風險評鑑表"
+)
+
+var INVENTORY_HEADER = []string{
+  "項次", "資產編號", "資產大類", "資產小類", "資產名稱", "資產擁有者",
+  "機密性(C)", "完整性(I)", "可用性(A)", "資產價值",
+}
+
+var INVENTORY_WIDTHS = []float64{6, 10, 20, 20, 24, 14, 10, 10, 10, 10}
+
+var EVALUATION_HEADER = []string{
+  "項次", "資產編號", "資產名稱", "資產價值", "威脅", "弱點", "現有控制措施",
+  "發生可能性", "衝擊程度", "風險值", "風險等級",
+}
+
+var EVALUATION_WIDTHS = []float64{6, 10, 24, 10, 28, 28, 28, 11, 10, 10, 10}
+
+var LEVEL_NAMES = map[string]string{
+  risk_assessment.LowRisk: "低",
+  risk_assessment.MediumRisk: "中",
+  risk_assessment.HighRisk: "高",
+}
+
+/* The header row, after the title and the scope rows */
+const GOVERNMENT_HEADER_ROW = 3
+
+/* The asset numbers of the forms, like A001 */
+func assetNumber(i int) string {
+  return fmt.Sprintf("A%03d", i + 1)
+}
+
+type governmentStyles struct {
+  title int
+  info int
+  header int
+  cell int
+  number int
+}
+
+func newGovernmentStyles(f *excelize.File) (governmentStyles, error) {
+  var styles governmentStyles
+  var err error
+
+  border := []excelize.Border{
+    {Type: "left", Color: "000000", Style: 1},
+    {Type: "top", Color: "000000", Style: 1},
+    {Type: "right", Color: "000000", Style: 1},
+    {Type: "bottom", Color: "000000", Style: 1},
+  }
+  font := &excelize.Font{Family: "標楷體", Size: 12}
+
+  if styles.title, err = f.NewStyle(&excelize.Style{
+    Font: &excelize.Font{Family: "標楷體", Size: 16, Bold: true},
+    Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+  }); err != nil {
+    return styles, err
+  }
+  if styles.info, err = f.NewStyle(&excelize.Style{Font: font}); err != nil {
+    return styles, err
+  }
+  if styles.header, err = f.NewStyle(&excelize.Style{
+    Font: &excelize.Font{Family: "標楷體", Size: 12, Bold: true},
+    Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9D9D9"}},
+    Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center", WrapText: true},
+    Border: border,
+  }); err != nil {
+    return styles, err
+  }
+  if styles.cell, err = f.NewStyle(&excelize.Style{
+    Font: font,
+    Alignment: &excelize.Alignment{Vertical: "center", WrapText: true},
+    Border: border,
+  }); err != nil {
+    return styles, err
+  }
+  styles.number, err = f.NewStyle(&excelize.Style{
+    Font: font,
+    Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+    Border: border,
+  })
+  return styles, err
+}
+
+/*
+ * Write a form of the title, the scope and the date, the header, and the
+ * bordered rows.  The columns from numbers on are centered.
+ */
+func writeForm(f *excelize.File, styles governmentStyles, sheet string, title string, info string,
+               header []string, widths []float64, numbers int, rows [][]interface{}) error {
+  last_column, _ := excelize.ColumnNumberToName(len(header))
+  if err := f.MergeCell(sheet, "A1", last_column + "1"); err != nil {
+    return err
+  }
+  f.SetCellValue(sheet, "A1", title)
+  if err := f.SetCellStyle(sheet, "A1", "A1", styles.title); err != nil {
+    return err
+  }
+  if err := f.SetRowHeight(sheet, 1, 28); err != nil {
+    return err
+  }
+
+  if err := f.MergeCell(sheet, "A2", last_column + "2"); err != nil {
+    return err
+  }
+  f.SetCellValue(sheet, "A2", info)
+  if err := f.SetCellStyle(sheet, "A2", "A2", styles.info); err != nil {
+    return err
+  }
+
+  values := []interface{}{}
+  for _, name := range header {
+    values = append(values, name)
+  }
+  header_cell := fmt.Sprintf("A%d", GOVERNMENT_HEADER_ROW)
+  if err := f.SetSheetRow(sheet, header_cell, &values); err != nil {
+    return err
+  }
+  if err := f.SetCellStyle(sheet, header_cell, fmt.Sprintf("%s%d", last_column, GOVERNMENT_HEADER_ROW), styles.header); err != nil {
+    return err
+  }
+
+  for i := range rows {
+    row := GOVERNMENT_HEADER_ROW + i + 1
+    if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", row), &rows[i]); err != nil {
+      return err
+    }
+    number_column, _ := excelize.ColumnNumberToName(numbers)
+    if err := f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("%s%d", last_column, row), styles.cell); err != nil {
+      return err
+    }
+    if err := f.SetCellStyle(sheet, fmt.Sprintf("%s%d", number_column, row), fmt.Sprintf("%s%d", last_column, row), styles.number); err != nil {
+      return err
+    }
+    if err := f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("B%d", row), styles.number); err != nil {
+      return err
+    }
+  }
+
+  for i, width := range widths {
+    column, _ := excelize.ColumnNumberToName(i + 1)
+    if err := f.SetColWidth(sheet, column, column, width); err != nil {
+      return err
+    }
+  }
+
+  return f.SetPanes(sheet, &excelize.Panes{
+    Freeze: true,
+    YSplit: GOVERNMENT_HEADER_ROW,
+    TopLeftCell: fmt.Sprintf("A%d", GOVERNMENT_HEADER_ROW + 1),
+    ActivePane: "bottomLeft",
+  })
+}
+
+/*
+ * Write the asset inventory and the risk evaluation forms of the scope's
+ * assets as a workbook.  The asset numbers are the same in both forms.
+ */
+func WriteGovernmentXLSX(w io.Writer, scope *risk_assessment.Scope, assets []risk_assessment.Asset, date time.Time) error {
+  f := excelize.NewFile()
+  defer f.Close()
+
+  if err := f.SetSheetName("Sheet1", INVENTORY_SHEET); err != nil {
+    return err
+  }
+  if _, err := f.NewSheet(EVALUATION_SHEET); err != nil {
+    return err
+  }
+
+  styles, err := newGovernmentStyles(f)
+  if err != nil {
+    return err
+  }
+
+  info := fmt.Sprintf("評鑑範圍：%s　　製表日期：%s", scope.Name, date.Format("2006-01-02"))
+  levels := scope.RiskLevels()
+
+  inventory := [][]interface{}{}
+  evaluation := [][]interface{}{}
+  for i := range assets {
+    asset := &assets[i]
+    number := assetNumber(i)
+    value := asset.Value.Sum()
+    inventory = append(inventory, []interface{}{
+      i + 1, number, asset.BigCategory, asset.SmallCategory, asset.Name, asset.Owner,
+      asset.Value.Confidentiality, asset.Value.Integrity, asset.Value.Availability, value,
+    })
+
+    for j := range asset.Risks {
+      risk := &asset.Risks[j]
+      score := risk_assessment.RiskScore(asset.Value, *risk)
+      evaluation = append(evaluation, []interface{}{
+        len(evaluation) + 1, number, asset.Name, value, risk.Threat, risk.Vulnerability, risk.CurrentControl,
+        risk.Possibility, risk.Impact, score, LEVEL_NAMES[levels.Level(score)],
+      })
+    }
+  }
+
+  err = writeForm(f, styles, INVENTORY_SHEET, INVENTORY_TITLE, info,
+                  INVENTORY_HEADER, INVENTORY_WIDTHS, 7, inventory)
+  if err != nil {
+    return err
+  }
+  err = writeForm(f, styles, EVALUATION_SHEET, EVALUATION_TITLE, info,
+                  EVALUATION_HEADER, EVALUATION_WIDTHS, 8, evaluation)
+  if err != nil {
+    return err
+  }
+
+  _, err = f.WriteTo(w)
+  return err
+}
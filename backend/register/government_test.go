@@ -0,0 +1,44 @@
+package register
+
+import (
+  "bytes"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/xuri/excelize/v2"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func TestWriteGovernmentXLSX(t *testing.T) {
+  scope := risk_assessment.Scope{Name: "foo", Levels: risk_assessment.RiskLevels{Medium: 20, High: 48}}
+  date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+  var buf bytes.Buffer
+  assert.Nil(t, WriteGovernmentXLSX(&buf, &scope, testAssets(), date))
+
+  f, err := excelize.OpenReader(&buf)
+  assert.Nil(t, err)
+  defer f.Close()
+  assert.Equal(t, []string{INVENTORY_SHEET, EVALUATION_SHEET}, f.GetSheetList())
+
+  inventory, err := f.GetRows(INVENTORY_SHEET)
+  assert.Nil(t, err)
+  assert.Equal(t, INVENTORY_TITLE, inventory[0][0])
+  assert.Equal(t, "評鑑範圍：foo　　製表日期：2024-05-01", inventory[1][0])
+  assert.Equal(t, INVENTORY_HEADER, inventory[2])
+  assert.Equal(t, []string{"1", "A001", "Hardware", "Server", "web", "IT", "3", "3", "2", "8"}, inventory[3])
+  assert.Equal(t, []string{"2", "A002", "Software", "Toolchain", "gcc", "", "1", "2", "1", "4"}, inventory[4])
+
+  /* The asset without any risk has no row */
+  evaluation, err := f.GetRows(EVALUATION_SHEET)
+  assert.Nil(t, err)
+  assert.Equal(t, EVALUATION_HEADER, evaluation[2])
+  assert.Equal(t, 5, len(evaluation))
+  assert.Equal(t, []string{"1", "A001", "web", "8", "Power failure", "No UPS", "", "2", "3", "48", "高"}, evaluation[3])
+  assert.Equal(t, []string{"2", "A001", "web", "8", "Disk failure", "No RAID", "Backup", "1", "2", "16", "低"}, evaluation[4])
+
+  cells, _ := f.GetMergeCells(EVALUATION_SHEET)
+  assert.Equal(t, "A1:K1", cells[0].GetStartAxis() + ":" + cells[0].GetEndAxis())
+}
@@ -0,0 +1,83 @@
+/*
+ * The risk register flattens the assets of a scope into one row per risk,
+ * the same shape as RiskAssessmentView, for the auditors' spreadsheets.
+ */
+
+package register
+
+import (
+  "encoding/csv"
+  "io"
+  "strconv"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/* The column names could be imported again as the CSV of the assets */
+var HEADER = []string{
+  "Big Category", "Small Category", "Name", "Owner", "C", "I", "A",
+  "Threat", "Vulnerability", "Control", "Possibility", "Impact", "Risk", "Level",
+}
+
+/* A row of a risk, or of an asset without any risk, whose Risk is nil */
+type Row struct {
+  Asset *risk_assessment.Asset
+  Risk *risk_assessment.Risk
+  /* The index of the risk in the asset's risks */
+  Index int
+  Score uint
+  Level string
+}
+
+/* The rows of the assets in order, and the risks of each asset in order */
+func Rows(assets []risk_assessment.Asset, levels risk_assessment.RiskLevels) []Row {
+  rows := []Row{}
+  for i := range assets {
+    asset := &assets[i]
+    /* The view shows an empty risk for the asset without any risk */
+    if len(asset.Risks) == 0 {
+      rows = append(rows, Row{Asset: asset})
+      continue
+    }
+    for j := range asset.Risks {
+      score := risk_assessment.RiskScore(asset.Value, asset.Risks[j])
+      rows = append(rows, Row{Asset: asset, Risk: &asset.Risks[j], Index: j, Score: score, Level: levels.Level(score)})
+    }
+  }
+  return rows
+}
+
+func uintString(n uint) string {
+  return strconv.FormatUint(uint64(n), 10)
+}
+
+/* The cells of the row as the HEADER */
+func (row *Row) Strings() []string {
+  asset := row.Asset
+  cells := []string{
+    asset.BigCategory, asset.SmallCategory, asset.Name, asset.Owner,
+    uintString(asset.Value.Confidentiality), uintString(asset.Value.Integrity), uintString(asset.Value.Availability),
+  }
+  if row.Risk == nil {
+    return append(cells, "", "", "", "", "", "", "")
+  }
+
+  risk := row.Risk
+  return append(cells, risk.Threat, risk.Vulnerability, risk.CurrentControl,
+                uintString(risk.Possibility), uintString(risk.Impact), uintString(row.Score), row.Level)
+}
+
+/* Write the rows as a CSV with the HEADER */
+func WriteCSV(w io.Writer, rows []Row) error {
+  writer := csv.NewWriter(w)
+  if err := writer.Write(HEADER); err != nil {
+    return err
+  }
+  for i := range rows {
+    if err := writer.Write(rows[i].Strings()); err != nil {
+      return err
+    }
+  }
+  writer.Flush()
+  return writer.Error()
+}
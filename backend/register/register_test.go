@@ -0,0 +1,113 @@
+package register
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "github.com/xuri/excelize/v2"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func testAssets() []risk_assessment.Asset {
+  return []risk_assessment.Asset{
+    {
+      BigCategory: "Hardware",
+      SmallCategory: "Server",
+      Name: "web",
+      Owner: "IT",
+      Value: risk_assessment.Value{Confidentiality: 3, Integrity: 3, Availability: 2},
+      Risks: []risk_assessment.Risk{
+        {Threat: "Power failure", Vulnerability: "No UPS", Possibility: 2, Impact: 3},
+        {Threat: "Disk failure", Vulnerability: "No RAID", CurrentControl: "Backup", Possibility: 1, Impact: 2},
+      },
+    },
+    {
+      BigCategory: "Software",
+      SmallCategory: "Toolchain",
+      Name: "gcc",
+      Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 1},
+      Risks: []risk_assessment.Risk{},
+    },
+  }
+}
+
+func TestRows(t *testing.T) {
+  assets := testAssets()
+  rows := Rows(assets, risk_assessment.RiskLevels{Medium: 20, High: 48})
+
+  assert.Equal(t, 3, len(rows))
+  assert.Equal(t, uint(48), rows[0].Score)
+  assert.Equal(t, risk_assessment.HighRisk, rows[0].Level)
+  assert.Equal(t, uint(16), rows[1].Score)
+  assert.Equal(t, risk_assessment.LowRisk, rows[1].Level)
+  assert.Nil(t, rows[2].Risk)
+
+  assert.Equal(t, []string{"Hardware", "Server", "web", "IT", "3", "3", "2",
+                           "Disk failure", "No RAID", "Backup", "1", "2", "16", "low"}, rows[1].Strings())
+  assert.Equal(t, []string{"Software", "Toolchain", "gcc", "", "1", "2", "1",
+                           "", "", "", "", "", "", ""}, rows[2].Strings())
+}
+
+func TestWriteCSV(t *testing.T) {
+  rows := Rows(testAssets(), risk_assessment.DEFAULT_RISK_LEVELS)
+
+  var buf bytes.Buffer
+  assert.Nil(t, WriteCSV(&buf, rows))
+  lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+  assert.Equal(t, 4, len(lines))
+  assert.Equal(t, strings.Join(HEADER, ","), lines[0])
+  assert.Equal(t, "Hardware,Server,web,IT,3,3,2,Power failure,No UPS,,2,3,48,high", lines[1])
+  assert.Equal(t, "Software,Toolchain,gcc,,1,2,1,,,,,,,", lines[3])
+}
+
+func TestWriteXLSX(t *testing.T) {
+  rows := Rows(testAssets(), risk_assessment.DEFAULT_RISK_LEVELS)
+
+  var buf bytes.Buffer
+  assert.Nil(t, WriteXLSX(&buf, rows, risk_assessment.DEFAULT_RISK_LEVELS))
+
+  f, err := excelize.OpenReader(&buf)
+  assert.Nil(t, err)
+  defer f.Close()
+
+  cells, err := f.GetRows(SHEET)
+  assert.Nil(t, err)
+  assert.Equal(t, HEADER, cells[0][:len(HEADER)])
+  assert.Equal(t, HIDDEN_HEADER, cells[0][len(HEADER):])
+  assert.Equal(t, rows[0].Strings(), cells[1][:len(HEADER)])
+  assert.Equal(t, 4, len(cells))
+
+  visible, err := f.GetColVisible(SHEET, "O")
+  assert.Nil(t, err)
+  assert.False(t, visible)
+
+  panes, err := f.GetPanes(SHEET)
+  assert.Nil(t, err)
+  assert.True(t, panes.Freeze)
+  assert.Equal(t, 1, panes.YSplit)
+  assert.Equal(t, 3, panes.XSplit)
+
+  formats, err := f.GetConditionalFormats(SHEET)
+  assert.Nil(t, err)
+  assert.Equal(t, 3, len(formats["M2:N4"]))
+  assert.Equal(t, "AND(ISNUMBER($M2),$M2>=48)", formats["M2:N4"][0].Criteria)
+
+  style, err := f.GetCellStyle(SHEET, "A1")
+  assert.Nil(t, err)
+  assert.NotEqual(t, 0, style)
+}
+
+func TestWriteXLSXEmpty(t *testing.T) {
+  var buf bytes.Buffer
+  assert.Nil(t, WriteXLSX(&buf, []Row{}, risk_assessment.DEFAULT_RISK_LEVELS))
+
+  f, err := excelize.OpenReader(&buf)
+  assert.Nil(t, err)
+  defer f.Close()
+  cells, _ := f.GetRows(SHEET)
+  assert.Equal(t, 1, len(cells))
+  assert.Equal(t, HEADER, cells[0][:len(HEADER)])
+}
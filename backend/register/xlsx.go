@@ -0,0 +1,168 @@
+package register
+
+import (
+  "fmt"
+  "io"
+
+  "github.com/xuri/excelize/v2"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+const SHEET = "Risk Register"
+
+/* The fill colors of the risk levels, as the spreadsheets' defaults */
+var LEVEL_COLORS = map[string]string{
+  risk_assessment.LowRisk: "C6EFCE",
+  risk_assessment.MediumRisk: "FFEB9C",
+  risk_assessment.HighRisk: "FFC7CE",
+}
+
+var COLUMN_WIDTHS = []float64{20, 20, 24, 16, 5, 5, 5, 28, 28, 28, 11, 9, 8, 9}
+
+/*
+ * The hidden columns after the HEADER tell which asset and risk a row was
+ * exported from, and the version of the asset then.
+ */
+const (
+  COLUMN_ASSET_ID = "Asset ID"
+  COLUMN_RISK_ID = "Risk ID"
+  COLUMN_VERSION = "Version"
+)
+
+var HIDDEN_HEADER = []string{COLUMN_ASSET_ID, COLUMN_RISK_ID, COLUMN_VERSION}
+
+/* The cells of the row with the numbers as numbers, and the hidden ones */
+func (row *Row) values(version string) []interface{} {
+  asset := row.Asset
+  values := []interface{}{
+    asset.BigCategory, asset.SmallCategory, asset.Name, asset.Owner,
+    asset.Value.Confidentiality, asset.Value.Integrity, asset.Value.Availability,
+  }
+  if row.Risk == nil {
+    return append(values, nil, nil, nil, nil, nil, nil, nil, asset.ID.Hex(), nil, version)
+  }
+
+  risk := row.Risk
+  return append(values, risk.Threat, risk.Vulnerability, risk.CurrentControl,
+                risk.Possibility, risk.Impact, row.Score, row.Level,
+                asset.ID.Hex(), row.Index + 1, version)
+}
+
+/*
+ * Color the risk and level cells by the score, so that the colors follow the
+ * scores edited in the spreadsheet.
+ */
+func colorLevels(f *excelize.File, last int, levels risk_assessment.RiskLevels) error {
+  rules := []struct {
+    level string
+    formula string
+  }{
+    {risk_assessment.HighRisk, fmt.Sprintf("AND(ISNUMBER($M2),$M2>=%d)", levels.High)},
+    {risk_assessment.MediumRisk, fmt.Sprintf("AND(ISNUMBER($M2),$M2>=%d)", levels.Medium)},
+    {risk_assessment.LowRisk, "ISNUMBER($M2)"},
+  }
+
+  opts := []excelize.ConditionalFormatOptions{}
+  for _, rule := range rules {
+    format, err := f.NewConditionalStyle(&excelize.Style{
+      Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{LEVEL_COLORS[rule.level]}},
+    })
+    if err != nil {
+      return err
+    }
+    opts = append(opts, excelize.ConditionalFormatOptions{
+      Type: "formula",
+      Criteria: rule.formula,
+      Format: format,
+      StopIfTrue: true,
+    })
+  }
+  return f.SetConditionalFormat(SHEET, fmt.Sprintf("M2:N%d", last), opts)
+}
+
+/*
+ * Write the rows as a workbook with a bold header, the header and the asset
+ * names frozen, a filter, and the risks colored by the levels.  The edited
+ * workbook could be uploaded again with the hidden columns.
+ */
+func WriteXLSX(w io.Writer, rows []Row, levels risk_assessment.RiskLevels) error {
+  f := excelize.NewFile()
+  defer f.Close()
+
+  if err := f.SetSheetName("Sheet1", SHEET); err != nil {
+    return err
+  }
+
+  header := []interface{}{}
+  for _, name := range append(HEADER, HIDDEN_HEADER...) {
+    header = append(header, name)
+  }
+  if err := f.SetSheetRow(SHEET, "A1", &header); err != nil {
+    return err
+  }
+  versions := map[*risk_assessment.Asset]string{}
+  for i := range rows {
+    version, ok := versions[rows[i].Asset]
+    if !ok {
+      version = Version(rows[i].Asset)
+      versions[rows[i].Asset] = version
+    }
+    values := rows[i].values(version)
+    if err := f.SetSheetRow(SHEET, fmt.Sprintf("A%d", i + 2), &values); err != nil {
+      return err
+    }
+  }
+
+  last_column, _ := excelize.ColumnNumberToName(len(HEADER))
+  style, err := f.NewStyle(&excelize.Style{
+    Font: &excelize.Font{Bold: true, Color: "FFFFFF"},
+    Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"305496"}},
+    Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center", WrapText: true},
+    Border: []excelize.Border{{Type: "bottom", Color: "000000", Style: 1}},
+  })
+  if err != nil {
+    return err
+  }
+  if err := f.SetCellStyle(SHEET, "A1", last_column + "1", style); err != nil {
+    return err
+  }
+
+  for i, width := range COLUMN_WIDTHS {
+    column, _ := excelize.ColumnNumberToName(i + 1)
+    if err := f.SetColWidth(SHEET, column, column, width); err != nil {
+      return err
+    }
+  }
+
+  first_hidden, _ := excelize.ColumnNumberToName(len(HEADER) + 1)
+  last_hidden, _ := excelize.ColumnNumberToName(len(HEADER) + len(HIDDEN_HEADER))
+  if err := f.SetColVisible(SHEET, first_hidden + ":" + last_hidden, false); err != nil {
+    return err
+  }
+
+  /* Keep the header and the columns to the asset name in sight */
+  err = f.SetPanes(SHEET, &excelize.Panes{
+    Freeze: true,
+    XSplit: 3,
+    YSplit: 1,
+    TopLeftCell: "D2",
+    ActivePane: "bottomRight",
+  })
+  if err != nil {
+    return err
+  }
+
+  last := len(rows) + 1
+  if err := f.AutoFilter(SHEET, fmt.Sprintf("A1:%s%d", last_column, last), nil); err != nil {
+    return err
+  }
+  if len(rows) > 0 {
+    if err := colorLevels(f, last, levels); err != nil {
+      return err
+    }
+  }
+
+  _, err = f.WriteTo(w)
+  return err
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+  "context"
+  "time"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* BoltTemplateUtils keeps the report templates in the embedded database */
+type BoltTemplateUtils struct {
+  DB *bbolt.DB
+}
+
+func (utils *BoltTemplateUtils) AddTemplate(ctx context.Context, tmpl *Template) (error) {
+  tmpl.ID = primitive.NewObjectID()
+  tmpl.CreateTime = time.Now().UTC()
+  tmpl.UpdateTime = tmpl.CreateTime
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, TEMPLATE_COLLECTION, tmpl.ID, tmpl)
+  })
+}
+
+func (utils *BoltTemplateUtils) GetTemplates(ctx context.Context) ([]Template, error) {
+  templates := []Template{}
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    found, err := database.BoltFind[Template](tx, TEMPLATE_COLLECTION, nil)
+    templates = append(templates, found...)
+    return err
+  })
+  return templates, err
+}
+
+func (utils *BoltTemplateUtils) GetTemplateByID(ctx context.Context, id primitive.ObjectID) (Template, error) {
+  var tmpl Template
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltGet(tx, TEMPLATE_COLLECTION, id, &tmpl)
+  })
+  return tmpl, err
+}
+
+/* Replace the name, format and content of the stored template, if there is one */
+func (utils *BoltTemplateUtils) UpdateTemplate(ctx context.Context, tmpl *Template) (error) {
+  tmpl.UpdateTime = time.Now().UTC()
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var stored Template
+
+    err := database.BoltGet(tx, TEMPLATE_COLLECTION, tmpl.ID, &stored)
+    if err == database.ErrNotFound {
+      return nil
+    } else if err != nil {
+      return err
+    }
+
+    stored.Name = tmpl.Name
+    stored.Format = tmpl.Format
+    stored.Content = tmpl.Content
+    stored.UpdateTime = tmpl.UpdateTime
+    return database.BoltPut(tx, TEMPLATE_COLLECTION, stored.ID, &stored)
+  })
+}
+
+func (utils *BoltTemplateUtils) DeleteTemplate(ctx context.Context, id primitive.ObjectID) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltDelete(tx, TEMPLATE_COLLECTION, id)
+  })
+}
+
+func (utils *BoltTemplateUtils) PutTemplate(ctx context.Context, tmpl *Template) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, TEMPLATE_COLLECTION, tmpl.ID, tmpl)
+  })
+}
@@ -0,0 +1,349 @@
+/*
+ * The risk assessment report of a scope for the management, generated in pure
+ * Go: the cover, the methodology, the asset inventory, the risk register by
+ * the score, the heat map and the top risks.
+ */
+
+package report
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "sort"
+  "time"
+
+  "github.com/go-pdf/fpdf"
+  "golang.org/x/image/font/gofont/gobold"
+  "golang.org/x/image/font/gofont/goregular"
+
+  "github.com/starnight/riskassessment/backend/register"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+type Options struct {
+  /* A TrueType font file for the names out of the Go fonts, like CJK */
+  Font string
+  Date time.Time
+  /* The number of the top risks, or DEFAULT_TOP_RISKS */
+  Top int
+}
+
+const DEFAULT_TOP_RISKS = 10
+
+const FONT = "report"
+
+/* The same colors of the levels as the XLSX register */
+var LEVEL_COLORS = map[string][3]int{
+  risk_assessment.LowRisk: {198, 239, 206},
+  risk_assessment.MediumRisk: {255, 235, 156},
+  risk_assessment.HighRisk: {255, 199, 206},
+}
+
+var HEADER_COLOR = [3]int{217, 217, 217}
+
+const LINE_HEIGHT = 5.0
+
+/* The risks of the assets by the score from the highest, and in order for the same score */
+func SortedRisks(assets []risk_assessment.Asset, levels risk_assessment.RiskLevels) []register.Row {
+  rows := []register.Row{}
+  for _, row := range register.Rows(assets, levels) {
+    if row.Risk != nil {
+      rows = append(rows, row)
+    }
+  }
+  sort.SliceStable(rows, func(i, j int) bool {
+    return rows[i].Score > rows[j].Score
+  })
+  return rows
+}
+
+type document struct {
+  pdf *fpdf.Fpdf
+  width float64
+}
+
+func newDocument(opts Options) (*document, error) {
+  pdf := fpdf.New("P", "mm", "A4", "")
+  if opts.Font != "" {
+    data, err := os.ReadFile(opts.Font)
+    if err != nil {
+      return nil, err
+    }
+    pdf.AddUTF8FontFromBytes(FONT, "", data)
+    pdf.AddUTF8FontFromBytes(FONT, "B", data)
+  } else {
+    pdf.AddUTF8FontFromBytes(FONT, "", goregular.TTF)
+    pdf.AddUTF8FontFromBytes(FONT, "B", gobold.TTF)
+  }
+  pdf.SetCreationDate(opts.Date)
+  pdf.SetMargins(15, 15, 15)
+  pdf.SetAutoPageBreak(true, 15)
+  pdf.AliasNbPages("")
+  pdf.SetFooterFunc(func() {
+    pdf.SetY(-12)
+    pdf.SetFont(FONT, "", 8)
+    pdf.CellFormat(0, 5, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+  })
+
+  page_width, _ := pdf.GetPageSize()
+  left, _, right, _ := pdf.GetMargins()
+  return &document{pdf: pdf, width: page_width - left - right}, pdf.Error()
+}
+
+func (d *document) heading(text string) {
+  d.pdf.SetFont(FONT, "B", 14)
+  d.pdf.CellFormat(0, 10, text, "", 1, "L", false, 0, "")
+  d.pdf.SetFont(FONT, "", 9)
+}
+
+func (d *document) paragraph(text string) {
+  d.pdf.SetFont(FONT, "", 10)
+  d.pdf.MultiCell(0, LINE_HEIGHT, text, "", "L", false)
+  d.pdf.Ln(2)
+}
+
+func (d *document) rowHeight(cells []string, widths []float64) float64 {
+  lines := 1
+  for i, cell := range cells {
+    if n := len(d.pdf.SplitText(cell, widths[i] - 2)); n > lines {
+      lines = n
+    }
+  }
+  return float64(lines) * LINE_HEIGHT
+}
+
+/* Whether the height fits in the rest of the page */
+func (d *document) fits(height float64) bool {
+  _, page_height := d.pdf.GetPageSize()
+  _, _, _, bottom := d.pdf.GetMargins()
+  return d.pdf.GetY() + height <= page_height - bottom
+}
+
+/* A table row of the wrapped cells with the borders */
+func (d *document) row(cells []string, widths []float64, aligns string, fill *[3]int) {
+  height := d.rowHeight(cells, widths)
+  style := "D"
+  if fill != nil {
+    d.pdf.SetFillColor(fill[0], fill[1], fill[2])
+    style = "FD"
+  }
+
+  left, y := d.pdf.GetXY()
+  x := left
+  for i, cell := range cells {
+    d.pdf.Rect(x, y, widths[i], height, style)
+    d.pdf.SetXY(x, y)
+    d.pdf.MultiCell(widths[i], LINE_HEIGHT, cell, "", string(aligns[i]), false)
+    x += widths[i]
+  }
+  d.pdf.SetXY(left, y + height)
+}
+
+/*
+ * A table with the header repeated on every page.  The widths are the
+ * fractions of the page, the aligns are "L", "C" or "R" of each column, and
+ * the levels color the rows, if any.
+ */
+func (d *document) table(header []string, fractions []float64, aligns string, rows [][]string, levels []string) {
+  widths := make([]float64, len(fractions))
+  for i, fraction := range fractions {
+    widths[i] = fraction * d.width
+  }
+
+  writeHeader := func() {
+    d.pdf.SetFont(FONT, "B", 9)
+    d.row(header, widths, aligns, &HEADER_COLOR)
+    d.pdf.SetFont(FONT, "", 9)
+  }
+  writeHeader()
+
+  for i, cells := range rows {
+    /* A row is not split, and the header is put above it on the next page */
+    if !d.fits(d.rowHeight(cells, widths)) {
+      d.pdf.AddPage()
+      writeHeader()
+    }
+
+    var fill *[3]int
+    if levels != nil {
+      if color, ok := LEVEL_COLORS[levels[i]]; ok {
+        fill = &color
+      }
+    }
+    d.row(cells, widths, aligns, fill)
+  }
+  d.pdf.Ln(4)
+}
+
+func uintString(n uint) string {
+  return fmt.Sprintf("%d", n)
+}
+
+func (d *document) cover(scope *risk_assessment.Scope, assets []risk_assessment.Asset, risks int, opts Options) {
+  d.pdf.AddPage()
+  d.pdf.Ln(60)
+  d.pdf.SetFont(FONT, "B", 24)
+  d.pdf.MultiCell(0, 12, "Risk Assessment Report", "", "C", false)
+  d.pdf.SetFont(FONT, "B", 18)
+  d.pdf.MultiCell(0, 10, scope.Name, "", "C", false)
+  d.pdf.Ln(30)
+
+  levels := scope.RiskLevels()
+  info := [][]string{
+    {"Scope", scope.Name},
+    {"Scope created", scope.CreateTime.Format("2006-01-02")},
+    {"Report date", opts.Date.Format("2006-01-02")},
+    {"Assets", fmt.Sprintf("%d", len(assets))},
+    {"Risks", fmt.Sprintf("%d", risks)},
+    {"Risk levels", fmt.Sprintf("medium from %d, high from %d", levels.Medium, levels.High)},
+  }
+  d.pdf.SetFont(FONT, "", 11)
+  for _, line := range info {
+    d.pdf.SetX(45)
+    d.pdf.SetFont(FONT, "B", 11)
+    d.pdf.CellFormat(40, 8, line[0], "", 0, "L", false, 0, "")
+    d.pdf.SetFont(FONT, "", 11)
+    d.pdf.MultiCell(80, 8, line[1], "", "L", false)
+  }
+}
+
+func (d *document) methodology(levels risk_assessment.RiskLevels) {
+  d.pdf.AddPage()
+  d.heading("1. Methodology")
+  d.paragraph(fmt.Sprintf("Each asset is rated for its confidentiality (C), integrity (I) and availability (A) from 1 to %d.  " +
+                          "The asset value is the sum of the three ratings.", risk_assessment.MAX_RATING))
+  d.paragraph(fmt.Sprintf("Each risk of an asset is a threat exploiting a vulnerability, rated for its possibility and " +
+                          "impact from 1 to %d.  The risk score is the asset value multiplied by the possibility and " +
+                          "the impact.", risk_assessment.MAX_RATING))
+
+  d.heading("Risk levels")
+  rows := [][]string{
+    {"Low", fmt.Sprintf("score < %d", levels.Medium)},
+    {"Medium", fmt.Sprintf("%d <= score < %d", levels.Medium, levels.High)},
+    {"High", fmt.Sprintf("score >= %d", levels.High)},
+  }
+  d.table([]string{"Level", "Definition"}, []float64{0.3, 0.7}, "LL", rows, risk_assessment.RISK_LEVEL_NAMES)
+}
+
+func (d *document) inventory(assets []risk_assessment.Asset) {
+  d.pdf.AddPage()
+  d.heading("2. Asset inventory")
+  rows := [][]string{}
+  for i := range assets {
+    asset := &assets[i]
+    rows = append(rows, []string{
+      fmt.Sprintf("%d", i + 1), asset.BigCategory, asset.SmallCategory, asset.Name, asset.Owner,
+      uintString(asset.Value.Confidentiality), uintString(asset.Value.Integrity),
+      uintString(asset.Value.Availability), uintString(asset.Value.Sum()),
+    })
+  }
+  d.table([]string{"#", "Big category", "Small category", "Name", "Owner", "C", "I", "A", "Value"},
+          []float64{0.05, 0.17, 0.17, 0.21, 0.16, 0.05, 0.05, 0.05, 0.09}, "CLLLLCCCC", rows, nil)
+}
+
+func (d *document) register(risks []register.Row) {
+  d.pdf.AddPage()
+  d.heading("3. Risk register")
+  rows := [][]string{}
+  levels := []string{}
+  for _, row := range risks {
+    rows = append(rows, []string{
+      row.Asset.Name, row.Risk.Threat, row.Risk.Vulnerability,
+      uintString(row.Risk.Possibility), uintString(row.Risk.Impact), uintString(row.Score), row.Level,
+    })
+    levels = append(levels, row.Level)
+  }
+  d.table([]string{"Asset", "Threat", "Vulnerability", "Possibility", "Impact", "Score", "Level"},
+          []float64{0.18, 0.22, 0.22, 0.1, 0.08, 0.08, 0.12}, "LLLCCCC", rows, levels)
+}
+
+/* The possibility from the highest on the rows, and the impact on the columns */
+func (d *document) heatMap(heat_map risk_assessment.HeatMap) {
+  d.pdf.AddPage()
+  d.heading("4. Heat map")
+  d.paragraph("The number of the risks by the possibility and the impact.  A cell is colored by the highest level of its risks.")
+
+  const size = 25.0
+  left, y := d.pdf.GetXY()
+  x0 := left + 25
+  d.pdf.SetFont(FONT, "B", 10)
+  for p := risk_assessment.MAX_RATING; p >= 1; p-- {
+    row_y := y + float64(risk_assessment.MAX_RATING - p) * size
+    d.pdf.SetXY(left, row_y)
+    d.pdf.CellFormat(25, size, fmt.Sprintf("P %d", p), "", 0, "C", false, 0, "")
+    for i := 1; i <= risk_assessment.MAX_RATING; i++ {
+      count := heat_map.Counts[p - 1][i - 1]
+      fill := [3]int{242, 242, 242}
+      if color, ok := LEVEL_COLORS[heat_map.Levels[p - 1][i - 1]]; ok {
+        fill = color
+      }
+      d.pdf.SetFillColor(fill[0], fill[1], fill[2])
+      d.pdf.SetXY(x0 + float64(i - 1) * size, row_y)
+      text := ""
+      if count > 0 {
+        text = fmt.Sprintf("%d", count)
+      }
+      d.pdf.CellFormat(size, size, text, "1", 0, "C", true, 0, "")
+    }
+  }
+  d.pdf.SetXY(x0, y + float64(risk_assessment.MAX_RATING) * size)
+  for i := 1; i <= risk_assessment.MAX_RATING; i++ {
+    d.pdf.CellFormat(size, 8, fmt.Sprintf("I %d", i), "", 0, "C", false, 0, "")
+  }
+  d.pdf.Ln(14)
+  d.pdf.SetFont(FONT, "", 9)
+  d.pdf.SetX(left)
+  d.pdf.MultiCell(0, LINE_HEIGHT, "P: possibility, I: impact", "", "L", false)
+}
+
+func (d *document) topRisks(risks []register.Row, top int) {
+  d.pdf.AddPage()
+  d.heading(fmt.Sprintf("5. Top %d risks", top))
+  if len(risks) > top {
+    risks = risks[:top]
+  }
+  rows := [][]string{}
+  levels := []string{}
+  for i, row := range risks {
+    control := row.Risk.CurrentControl
+    if control == "" {
+      control = "(none)"
+    }
+    rows = append(rows, []string{
+      fmt.Sprintf("%d", i + 1), row.Asset.Name, row.Risk.Threat, row.Risk.Vulnerability,
+      control, uintString(row.Score), row.Level,
+    })
+    levels = append(levels, row.Level)
+  }
+  d.table([]string{"#", "Asset", "Threat", "Vulnerability", "Current control", "Score", "Level"},
+          []float64{0.05, 0.16, 0.2, 0.2, 0.23, 0.08, 0.08}, "CLLLLCC", rows, levels)
+}
+
+/* Write the report of the scope's assets as a PDF */
+func WritePDF(w io.Writer, scope *risk_assessment.Scope, assets []risk_assessment.Asset, opts Options) error {
+  if opts.Top <= 0 {
+    opts.Top = DEFAULT_TOP_RISKS
+  }
+  if opts.Date.IsZero() {
+    opts.Date = time.Now()
+  }
+
+  d, err := newDocument(opts)
+  if err != nil {
+    return err
+  }
+  d.pdf.SetTitle("Risk Assessment Report - " + scope.Name, true)
+
+  levels := scope.RiskLevels()
+  risks := SortedRisks(assets, levels)
+
+  d.cover(scope, assets, len(risks), opts)
+  d.methodology(levels)
+  d.inventory(assets)
+  d.register(risks)
+  d.heatMap(risk_assessment.NewHeatMap(assets, levels))
+  d.topRisks(risks, opts.Top)
+
+  return d.pdf.Output(w)
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+  "bytes"
+  "path/filepath"
+  "regexp"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func testAssets() []risk_assessment.Asset {
+  return []risk_assessment.Asset{
+    {
+      BigCategory: "Hardware",
+      Name: "web",
+      Value: risk_assessment.Value{Confidentiality: 3, Integrity: 3, Availability: 2},
+      Risks: []risk_assessment.Risk{
+        {Threat: "Disk failure", Possibility: 1, Impact: 2},
+        {Threat: "Power failure", Vulnerability: "No UPS", Possibility: 2, Impact: 3},
+      },
+    },
+    {
+      BigCategory: "Software",
+      Name: "gcc",
+      Value: risk_assessment.Value{Confidentiality: 1, Integrity: 2, Availability: 1},
+      Risks: []risk_assessment.Risk{{Threat: "Bug", Possibility: 4, Impact: 4}},
+    },
+    {
+      BigCategory: "Data",
+      Name: "docs",
+      Value: risk_assessment.Value{Confidentiality: 1, Integrity: 1, Availability: 1},
+      Risks: []risk_assessment.Risk{},
+    },
+  }
+}
+
+func TestSortedRisks(t *testing.T) {
+  rows := SortedRisks(testAssets(), risk_assessment.DEFAULT_RISK_LEVELS)
+
+  threats := []string{}
+  scores := []uint{}
+  for _, row := range rows {
+    threats = append(threats, row.Risk.Threat)
+    scores = append(scores, row.Score)
+  }
+  /* The asset without risks is left out */
+  assert.Equal(t, []string{"Bug", "Power failure", "Disk failure"}, threats)
+  assert.Equal(t, []uint{64, 48, 16}, scores)
+}
+
+func TestWritePDF(t *testing.T) {
+  scope := risk_assessment.Scope{Name: "foo"}
+  date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+  var buf bytes.Buffer
+  err := WritePDF(&buf, &scope, testAssets(), Options{Date: date})
+  assert.Nil(t, err)
+  assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+
+  /* The cover, methodology, inventory, register, heat map and top risks */
+  count := regexp.MustCompile(`/Type /Pages\s*/Kids \[[^\]]*\]\s*/Count (\d+)`).FindSubmatch(buf.Bytes())
+  assert.NotNil(t, count)
+  assert.Equal(t, "6", string(count[1]))
+}
+
+func TestWritePDFFont(t *testing.T) {
+  scope := risk_assessment.Scope{Name: "foo"}
+
+  var buf bytes.Buffer
+  err := WritePDF(&buf, &scope, testAssets(), Options{Font: filepath.Join(t.TempDir(), "missing.ttf")})
+  assert.NotNil(t, err)
+  assert.Equal(t, 0, buf.Len())
+}
@@ -0,0 +1,86 @@
+package report
+
+import (
+  "context"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* PGTemplateUtils keeps the report templates in PostgreSQL */
+type PGTemplateUtils struct {
+  DB *pgxpool.Pool
+}
+
+const pg_template_columns = "id, create_time, update_time, name, format, content"
+
+func (utils *PGTemplateUtils) AddTemplate(ctx context.Context, tmpl *Template) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  tmpl.ID = primitive.NewObjectID()
+  tmpl.CreateTime = time.Now().UTC()
+  tmpl.UpdateTime = tmpl.CreateTime
+
+  _, err := utils.DB.Exec(ctx, "INSERT INTO templates (" + pg_template_columns + ") VALUES ($1, $2, $3, $4, $5, $6)",
+                          tmpl.ID.Hex(), tmpl.CreateTime, tmpl.UpdateTime, tmpl.Name, tmpl.Format, tmpl.Content)
+  return err
+}
+
+func scanTemplate(row pgx.CollectableRow) (Template, error) {
+  var tmpl Template
+
+  err := row.Scan(database.PGID(&tmpl.ID), database.PGTime(&tmpl.CreateTime), database.PGTime(&tmpl.UpdateTime),
+                  &tmpl.Name, &tmpl.Format, &tmpl.Content)
+  return tmpl, err
+}
+
+func (utils *PGTemplateUtils) GetTemplates(ctx context.Context) ([]Template, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_template_columns + " FROM templates ORDER BY id")
+  return pgx.CollectRows(rows, scanTemplate)
+}
+
+func (utils *PGTemplateUtils) GetTemplateByID(ctx context.Context, id primitive.ObjectID) (Template, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_template_columns + " FROM templates WHERE id = $1", id.Hex())
+  tmpl, err := pgx.CollectOneRow(rows, scanTemplate)
+  return tmpl, database.PGError(err)
+}
+
+/* Replace the name, format and content of the stored template, if there is one */
+func (utils *PGTemplateUtils) UpdateTemplate(ctx context.Context, tmpl *Template) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  tmpl.UpdateTime = time.Now().UTC()
+  _, err := utils.DB.Exec(ctx, "UPDATE templates SET update_time = $2, name = $3, format = $4, content = $5 WHERE id = $1",
+                          tmpl.ID.Hex(), tmpl.UpdateTime, tmpl.Name, tmpl.Format, tmpl.Content)
+  return err
+}
+
+func (utils *PGTemplateUtils) DeleteTemplate(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "DELETE FROM templates WHERE id = $1", id.Hex())
+  return err
+}
+
+func (utils *PGTemplateUtils) PutTemplate(ctx context.Context, tmpl *Template) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "INSERT INTO templates (" + pg_template_columns + ") VALUES ($1, $2, $3, $4, $5, $6) " +
+                          "ON CONFLICT (id) DO UPDATE SET create_time = $2, update_time = $3, name = $4, format = $5, content = $6",
+                          tmpl.ID.Hex(), tmpl.CreateTime, tmpl.UpdateTime, tmpl.Name, tmpl.Format, tmpl.Content)
+  return err
+}
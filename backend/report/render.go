@@ -0,0 +1,345 @@
+package report
+
+import (
+  "context"
+  _ "embed"
+  "errors"
+  "fmt"
+  html_template "html/template"
+  "io"
+  "reflect"
+  "strings"
+  "text/template"
+  template_parse "text/template/parse"
+  "time"
+
+  "github.com/starnight/riskassessment/backend/register"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/*
+ * Data is what a template renders, which is documented in the README:
+ *
+ *   .Scope       the scope with its Name and Levels
+ *   .Date        the time of the report
+ *   .Levels      the scope's risk levels, or the default ones
+ *   .Assets      the assets in order, with their Value and Risks
+ *   .Risks       the rows of the risk register by the score from the highest,
+ *                with the .Asset, .Risk, .Score and .Level of each risk
+ *   .Statistics  the numbers of the assets and the risks, the risks of each
+ *                level, the maximum and the average scores, and the heat map
+ */
+type Data struct {
+  Scope risk_assessment.Scope
+  Date time.Time
+  Levels risk_assessment.RiskLevels
+  Assets []risk_assessment.Asset
+  Risks []register.Row
+  Statistics Statistics
+}
+
+type Statistics struct {
+  Assets int
+  Risks int
+  /* The number of the risks by the level name */
+  Levels map[string]int
+  MaxScore uint
+  AverageScore float64
+  HeatMap risk_assessment.HeatMap
+}
+
+func NewData(scope *risk_assessment.Scope, assets []risk_assessment.Asset, date time.Time) *Data {
+  levels := scope.RiskLevels()
+  risks := SortedRisks(assets, levels)
+
+  statistics := Statistics{
+    Assets: len(assets),
+    Risks: len(risks),
+    Levels: map[string]int{},
+    HeatMap: risk_assessment.NewHeatMap(assets, levels),
+  }
+  for _, name := range risk_assessment.RISK_LEVEL_NAMES {
+    statistics.Levels[name] = 0
+  }
+
+  var total uint
+  for _, row := range risks {
+    statistics.Levels[row.Level]++
+    total += row.Score
+    if row.Score > statistics.MaxScore {
+      statistics.MaxScore = row.Score
+    }
+  }
+  if len(risks) > 0 {
+    statistics.AverageScore = float64(total) / float64(len(risks))
+  }
+
+  return &Data{
+    Scope: *scope,
+    Date: date,
+    Levels: levels,
+    Assets: assets,
+    Risks: risks,
+    Statistics: statistics,
+  }
+}
+
+/* The made up scope of the previews without a scope */
+func SampleData(date time.Time) *Data {
+  scope := risk_assessment.Scope{Name: "Sample"}
+  assets := []risk_assessment.Asset{
+    {
+      BigCategory: "Hardware",
+      SmallCategory: "Server",
+      Name: "Web server",
+      Owner: "IT",
+      Value: risk_assessment.Value{Confidentiality: 3, Integrity: 3, Availability: 4},
+      Risks: []risk_assessment.Risk{
+        {Threat: "Power failure", Vulnerability: "No UPS", Possibility: 2, Impact: 4},
+        {Threat: "Disk failure", Vulnerability: "No RAID", CurrentControl: "Daily backup", Possibility: 2, Impact: 2},
+      },
+    },
+    {
+      BigCategory: "Information (or data)",
+      SmallCategory: "Database",
+      Name: "Contracts",
+      Owner: "Legal",
+      Value: risk_assessment.Value{Confidentiality: 4, Integrity: 3, Availability: 1},
+      Risks: []risk_assessment.Risk{
+        {Threat: "Leak", Vulnerability: "Shared folder", CurrentControl: "Access control", Possibility: 1, Impact: 4},
+      },
+    },
+  }
+  return NewData(&scope, assets, date)
+}
+
+/* Escape the text in a Markdown table cell */
+var markdownEscaper = strings.NewReplacer(
+  `\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;", ">", "&gt;",
+  "\r\n", " ", "\n", " ",
+)
+
+/* The indexes are int, but the ratings and the scores are uint */
+func toInt(v any) (int, error) {
+  value := reflect.ValueOf(v)
+  switch value.Kind() {
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    return int(value.Int()), nil
+  case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    return int(value.Uint()), nil
+  }
+  return 0, fmt.Errorf("%v is not an integer", v)
+}
+
+func arithmetic(op func(a int, b int) int) func(a any, b any) (int, error) {
+  return func(a any, b any) (int, error) {
+    x, err := toInt(a)
+    if err != nil {
+      return 0, err
+    }
+    y, err := toInt(b)
+    if err != nil {
+      return 0, err
+    }
+    return op(x, y), nil
+  }
+}
+
+/*
+ * The functions of the templates, besides the builtin ones.  None of them
+ * reads files or the environment, or changes the stored data.  _deadline
+ * fails once the context is done, and is called by the inserted checks.
+ */
+func funcs(ctx context.Context, levels risk_assessment.RiskLevels) template.FuncMap {
+  return template.FuncMap{
+    "upper": strings.ToUpper,
+    "lower": strings.ToLower,
+    "title": func(s string) string {
+      if s == "" {
+        return s
+      }
+      return strings.ToUpper(s[:1]) + s[1:]
+    },
+    "trim": strings.TrimSpace,
+    "join": func(sep string, elems []string) string { return strings.Join(elems, sep) },
+    "truncate": func(n int, s string) string {
+      runes := []rune(s)
+      if n < 0 || len(runes) <= n {
+        return s
+      }
+      return string(runes[:n]) + "…"
+    },
+    "default": func(def string, s string) string {
+      if s == "" {
+        return def
+      }
+      return s
+    },
+    "markdown": markdownEscaper.Replace,
+    "date": func(layout string, t time.Time) string { return t.Format(layout) },
+    "add": arithmetic(func(a int, b int) int { return a + b }),
+    "sub": arithmetic(func(a int, b int) int { return a - b }),
+    "mul": arithmetic(func(a int, b int) int { return a * b }),
+    "percent": func(part any, total any) (float64, error) {
+      p, err := toInt(part)
+      if err != nil {
+        return 0, err
+      }
+      t, err := toInt(total)
+      if err != nil || t == 0 {
+        return 0, err
+      }
+      return float64(p) * 100 / float64(t), nil
+    },
+    "score": risk_assessment.RiskScore,
+    "level": levels.Level,
+    "_deadline": func() (string, error) {
+      if err := ctx.Err(); err == context.DeadlineExceeded {
+        return "", ErrRenderTimeout
+      } else if err != nil {
+        return "", err
+      }
+      return "", nil
+    },
+  }
+}
+
+/* The limit of a rendered report, or a template could print endlessly */
+const MAX_OUTPUT_SIZE = 16 << 20
+
+var ErrOutputTooLarge = fmt.Errorf("the report is larger than %d bytes", MAX_OUTPUT_SIZE)
+
+type limitedWriter struct {
+  w io.Writer
+  left int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+  if len(p) > l.left {
+    return 0, ErrOutputTooLarge
+  }
+  l.left -= len(p)
+  return l.w.Write(p)
+}
+
+/*
+ * The limit of rendering a report.  A template could loop without printing,
+ * like {{range 1000000000000}}{{end}}, so the deadline is checked at the
+ * start of every template and every iteration of the ranges.
+ */
+const RENDER_TIMEOUT = 10 * time.Second
+
+var ErrRenderTimeout = fmt.Errorf("the report takes longer than %v to render", RENDER_TIMEOUT)
+
+/* The check of the deadline declares a variable, so html/template does not escape it into the output */
+const DEADLINE_CHECK = "{{$_deadline := _deadline}}"
+
+/* Insert the check into the ranges of the list, and the lists in it */
+func insertDeadline(list *template_parse.ListNode, check *template_parse.ActionNode) {
+  if list == nil {
+    return
+  }
+  for _, node := range list.Nodes {
+    switch n := node.(type) {
+    case *template_parse.IfNode:
+      insertDeadline(n.List, check)
+      insertDeadline(n.ElseList, check)
+    case *template_parse.WithNode:
+      insertDeadline(n.List, check)
+      insertDeadline(n.ElseList, check)
+    case *template_parse.RangeNode:
+      insertDeadline(n.List, check)
+      insertDeadline(n.ElseList, check)
+      n.List.Nodes = append([]template_parse.Node{check.Copy()}, n.List.Nodes...)
+    }
+  }
+}
+
+/* Insert the check into the templates' trees, before html/template escapes them at the first execution */
+func insertDeadlines(trees []*template_parse.Tree, fm template.FuncMap) error {
+  t, err := template.New("deadline").Funcs(fm).Parse(DEADLINE_CHECK)
+  if err != nil {
+    return err
+  }
+  check := t.Tree.Root.Nodes[0].(*template_parse.ActionNode)
+
+  for _, tree := range trees {
+    if tree == nil || tree.Root == nil {
+      continue
+    }
+    insertDeadline(tree.Root, check)
+    tree.Root.Nodes = append([]template_parse.Node{check.Copy()}, tree.Root.Nodes...)
+  }
+  return nil
+}
+
+type executor interface {
+  Execute(w io.Writer, data any) error
+}
+
+/* Parse the template, whose execution fails once the context is done */
+func parse(ctx context.Context, format string, content string, levels risk_assessment.RiskLevels) (executor, error) {
+  fm := funcs(ctx, levels)
+  trees := []*template_parse.Tree{}
+
+  switch format {
+  case HTMLFormat:
+    t, err := html_template.New("report").Funcs(html_template.FuncMap(fm)).Parse(content)
+    if err != nil {
+      return nil, err
+    }
+    for _, tmpl := range t.Templates() {
+      trees = append(trees, tmpl.Tree)
+    }
+    return t, insertDeadlines(trees, fm)
+  case MarkdownFormat:
+    t, err := template.New("report").Funcs(fm).Parse(content)
+    if err != nil {
+      return nil, err
+    }
+    for _, tmpl := range t.Templates() {
+      trees = append(trees, tmpl.Tree)
+    }
+    return t, insertDeadlines(trees, fm)
+  }
+  return nil, fmt.Errorf("unknown template format %q", format)
+}
+
+/* Check the template could be parsed, before it is stored */
+func (tmpl *Template) Validate() error {
+  if strings.TrimSpace(tmpl.Name) == "" {
+    return errors.New("the template has no name")
+  }
+  _, err := parse(context.Background(), tmpl.Format, tmpl.Content, risk_assessment.DEFAULT_RISK_LEVELS)
+  return err
+}
+
+/* Render the data with the template within RENDER_TIMEOUT, nothing is written if it fails */
+func (tmpl *Template) Render(ctx context.Context, w io.Writer, data *Data) error {
+  ctx, cancel := context.WithTimeout(ctx, RENDER_TIMEOUT)
+  defer cancel()
+
+  t, err := parse(ctx, tmpl.Format, tmpl.Content, data.Levels)
+  if err != nil {
+    return err
+  }
+
+  var buf strings.Builder
+  if err := t.Execute(&limitedWriter{w: &buf, left: MAX_OUTPUT_SIZE}, data); err != nil {
+    return err
+  }
+  _, err = io.WriteString(w, buf.String())
+  return err
+}
+
+//go:embed templates/default.md
+var default_template string
+
+/* The template shipped with the webserver, which is not stored */
+const DEFAULT_TEMPLATE_ID = "default"
+
+var DEFAULT_TEMPLATE = Template{
+  Name: "Default",
+  Format: MarkdownFormat,
+  Content: default_template,
+}
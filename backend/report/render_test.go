@@ -0,0 +1,126 @@
+package report
+
+import (
+  "bytes"
+  "context"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+func TestNewData(t *testing.T) {
+  scope := risk_assessment.Scope{Name: "foo"}
+  data := NewData(&scope, testAssets(), time.Now())
+
+  assert.Equal(t, risk_assessment.DEFAULT_RISK_LEVELS, data.Levels)
+  assert.Equal(t, 3, data.Statistics.Assets)
+  assert.Equal(t, 3, data.Statistics.Risks)
+  /* 64 and 48 are high, 16 is low */
+  assert.Equal(t, map[string]int{"low": 1, "medium": 0, "high": 2}, data.Statistics.Levels)
+  assert.Equal(t, uint(64), data.Statistics.MaxScore)
+  assert.Equal(t, float64(128) / 3, data.Statistics.AverageScore)
+  assert.Equal(t, 1, data.Statistics.HeatMap.Counts[3][3])
+  assert.Equal(t, "Bug", data.Risks[0].Risk.Threat)
+}
+
+func TestRenderDefault(t *testing.T) {
+  scope := risk_assessment.Scope{Name: "foo|bar"}
+  data := NewData(&scope, testAssets(), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+
+  var buf bytes.Buffer
+  assert.Nil(t, DEFAULT_TEMPLATE.Render(context.TODO(), &buf, data))
+  out := buf.String()
+  assert.Contains(t, out, `# Risk Assessment Report: foo\|bar`)
+  assert.Contains(t, out, "Date: 2024-05-01")
+  assert.Contains(t, out, "| Medium | 24 to 47 |")
+  assert.Contains(t, out, "| 1 | Hardware | web |  | 3 | 3 | 2 | 8 |")
+  assert.Contains(t, out, "| 1 | gcc | Bug |  | (none) | 4 | 4 | 64 | High |")
+
+  /* The sample data of the previews */
+  buf.Reset()
+  assert.Nil(t, DEFAULT_TEMPLATE.Render(context.TODO(), &buf, SampleData(time.Now())))
+  assert.Contains(t, buf.String(), "Web server")
+}
+
+func TestRenderHTML(t *testing.T) {
+  scope := risk_assessment.Scope{Name: "<script>"}
+  data := NewData(&scope, testAssets(), time.Now())
+  tmpl := Template{
+    Name: "foo",
+    Format: HTMLFormat,
+    Content: `<h1>{{.Scope.Name}}</h1>{{range .Risks}}<p>{{.Asset.Name}} {{.Score}} {{level .Score}} {{percent .Score .Statistics.MaxScore}}</p>{{end}}`,
+  }
+  /* .Statistics is not a field of the rows */
+  assert.Nil(t, tmpl.Validate())
+  assert.NotNil(t, tmpl.Render(context.TODO(), &bytes.Buffer{}, data))
+
+  tmpl.Content = `<h1>{{.Scope.Name}}</h1>{{range .Risks}}<p>{{.Asset.Name}} {{.Score}} {{level .Score}}</p>{{end}}` +
+                 `{{percent (index .Statistics.Levels "high") .Statistics.Risks | printf "%.0f"}}% {{add 1 .Levels.High}}`
+  var buf bytes.Buffer
+  assert.Nil(t, tmpl.Render(context.TODO(), &buf, data))
+  assert.Equal(t, "<h1>&lt;script&gt;</h1><p>gcc 64 high</p><p>web 48 high</p><p>web 16 low</p>67% 49", buf.String())
+}
+
+func TestRenderInvalid(t *testing.T) {
+  data := SampleData(time.Now())
+
+  tmpl := Template{Name: "foo", Format: "pdf", Content: "foo"}
+  assert.ErrorContains(t, tmpl.Validate(), `unknown template format "pdf"`)
+
+  tmpl = Template{Name: "foo", Format: MarkdownFormat, Content: "{{.Scope.Name"}
+  assert.NotNil(t, tmpl.Validate())
+
+  /* The functions reading files are not defined */
+  tmpl.Content = `{{readFile "/etc/passwd"}}`
+  assert.ErrorContains(t, tmpl.Validate(), `function "readFile" not defined`)
+
+  tmpl = Template{Format: MarkdownFormat, Content: "foo"}
+  assert.NotNil(t, tmpl.Validate())
+
+  /* Nothing is written for a failed template */
+  tmpl = Template{Name: "foo", Format: MarkdownFormat, Content: `{{.Scope.Name}}{{add "a" 1}}`}
+  var buf bytes.Buffer
+  assert.ErrorContains(t, tmpl.Render(context.TODO(), &buf, data), "a is not an integer")
+  assert.Equal(t, 0, buf.Len())
+
+  /* Nor for a too large report */
+  tmpl.Content = `{{define "loop"}}{{.}}{{template "loop" .}}{{end}}{{template "loop" "` + strings.Repeat("x", 1 << 10) + `"}}`
+  assert.ErrorIs(t, tmpl.Render(context.TODO(), &buf, data), ErrOutputTooLarge)
+  assert.Equal(t, 0, buf.Len())
+}
+
+func TestRenderTimeout(t *testing.T) {
+  data := SampleData(time.Now())
+  ctx, cancel := context.WithTimeout(context.TODO(), 100 * time.Millisecond)
+  defer cancel()
+
+  /* The loops which print nothing stop at the deadline */
+  for _, tmpl := range []Template{
+    {Name: "foo", Format: MarkdownFormat, Content: `{{range 1000000000000}}{{end}}`},
+    {Name: "foo", Format: HTMLFormat, Content: `<p>{{range $i := 1000000000000}}{{if $i}}{{end}}{{end}}</p>`},
+    {Name: "foo", Format: MarkdownFormat, Content: `{{define "a"}}{{template "b"}}{{template "b"}}{{end}}` +
+                                                   `{{define "b"}}{{template "a"}}{{template "a"}}{{end}}{{template "a"}}`},
+  } {
+    var buf bytes.Buffer
+    start := time.Now()
+    assert.ErrorIs(t, tmpl.Render(ctx, &buf, data), ErrRenderTimeout, tmpl.Content)
+    assert.Less(t, time.Since(start), 5 * time.Second)
+    assert.Equal(t, 0, buf.Len())
+  }
+
+  /* The checks print nothing */
+  tmpl := Template{Name: "foo", Format: HTMLFormat, Content: `<script>var a = [{{range 3}}{{.}},{{end}}];</script>`}
+  var buf bytes.Buffer
+  assert.Nil(t, tmpl.Render(context.TODO(), &buf, data))
+  assert.Equal(t, `<script>var a = [ 0 , 1 , 2 ,];</script>`, buf.String())
+}
+
+func TestSampleDataCategories(t *testing.T) {
+  for _, asset := range SampleData(time.Now()).Assets {
+    assert.True(t, risk_assessment.ValidCategory(asset.BigCategory, asset.SmallCategory), asset.Name)
+  }
+}
@@ -0,0 +1,213 @@
+package report
+
+import (
+  "bufio"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "sort"
+  "strings"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/*
+ * The standalone SVG charts of a scope, which are embedded in the wiki pages
+ * and the emails, so they have neither scripts nor external fonts or styles.
+ * The colors of the levels are the same as the PDF report's.
+ */
+const (
+  HeatMapChart = "heatmap"
+  CategoriesChart = "categories"
+)
+
+var CHARTS = []string{HeatMapChart, CategoriesChart}
+
+const SVG_CONTENT_TYPE = "image/svg+xml"
+
+const SVG_FONT = "font-family=\"Helvetica, Arial, sans-serif\""
+
+var EMPTY_COLOR = [3]int{242, 242, 242}
+
+func svgColor(color [3]int) string {
+  return fmt.Sprintf("#%02x%02x%02x", color[0], color[1], color[2])
+}
+
+func levelColor(level string) string {
+  if color, ok := LEVEL_COLORS[level]; ok {
+    return svgColor(color)
+  }
+  return svgColor(EMPTY_COLOR)
+}
+
+func escape(text string) string {
+  var b strings.Builder
+  xml.EscapeText(&b, []byte(text))
+  return b.String()
+}
+
+/* The thresholds of the levels, like "low < 24 ≤ medium < 48 ≤ high" */
+func levelsLegend(levels risk_assessment.RiskLevels) string {
+  return fmt.Sprintf("%s < %d ≤ %s < %d ≤ %s", risk_assessment.LowRisk, levels.Medium,
+                     risk_assessment.MediumRisk, levels.High, risk_assessment.HighRisk)
+}
+
+/* Draw the colored boxes of the levels from the x */
+func levelsKey(w io.Writer, x int, y int) {
+  for _, level := range risk_assessment.RISK_LEVEL_NAMES {
+    fmt.Fprintf(w, `<rect x="%d" y="%d" width="12" height="12" fill="%s" stroke="#999999"/>`, x, y, levelColor(level))
+    fmt.Fprintf(w, `<text x="%d" y="%d" font-size="12">%s</text>`, x + 16, y + 11, level)
+    x += 80
+  }
+  fmt.Fprintln(w)
+}
+
+/*
+ * The heat map of the possibility from the highest on the rows, and the
+ * impact on the columns.  A cell is colored by the highest level of its
+ * risks, which follows the scope's thresholds, and an empty cell is gray.
+ */
+func WriteHeatMapSVG(w io.Writer, title string, heat_map risk_assessment.HeatMap, levels risk_assessment.RiskLevels) error {
+  const size = 60
+  const left = 50
+  const top = 50
+  width := left + size * risk_assessment.MAX_RATING + 20
+  height := top + size * risk_assessment.MAX_RATING + 90
+
+  b := bufio.NewWriter(w)
+  fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" %s>`,
+              width, height, width, height, SVG_FONT)
+  fmt.Fprintf(b, "<title>%s</title>\n", escape(title))
+  fmt.Fprintf(b, `<rect width="%d" height="%d" fill="#ffffff"/>`, width, height)
+  fmt.Fprintf(b, `<text x="%d" y="24" font-size="16" font-weight="bold">%s</text>`, left, escape(title))
+  fmt.Fprintln(b)
+
+  for p := risk_assessment.MAX_RATING; p >= 1; p-- {
+    y := top + (risk_assessment.MAX_RATING - p) * size
+    fmt.Fprintf(b, `<text x="%d" y="%d" font-size="12" text-anchor="middle">P %d</text>`, left / 2, y + size / 2 + 4, p)
+    for i := 1; i <= risk_assessment.MAX_RATING; i++ {
+      x := left + (i - 1) * size
+      count := heat_map.Counts[p - 1][i - 1]
+      fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#999999"/>`,
+                  x, y, size, size, levelColor(heat_map.Levels[p - 1][i - 1]))
+      if count > 0 {
+        fmt.Fprintf(b, `<text x="%d" y="%d" font-size="16" font-weight="bold" text-anchor="middle">%d</text>`,
+                    x + size / 2, y + size / 2 + 6, count)
+      }
+    }
+    fmt.Fprintln(b)
+  }
+
+  y := top + risk_assessment.MAX_RATING * size
+  for i := 1; i <= risk_assessment.MAX_RATING; i++ {
+    fmt.Fprintf(b, `<text x="%d" y="%d" font-size="12" text-anchor="middle">I %d</text>`, left + (i - 1) * size + size / 2, y + 18, i)
+  }
+  fmt.Fprintln(b)
+  levelsKey(b, left, y + 34)
+  fmt.Fprintf(b, `<text x="%d" y="%d" font-size="11" fill="#666666">%s</text>`, left, y + 68, escape(levelsLegend(levels)))
+  fmt.Fprint(b, "\n</svg>\n")
+  return b.Flush()
+}
+
+/* The number of the risks of a BigCategory by the level */
+type CategoryLevels struct {
+  BigCategory string
+  Levels map[string]int
+}
+
+func (category *CategoryLevels) Total() int {
+  total := 0
+  for _, count := range category.Levels {
+    total += count
+  }
+  return total
+}
+
+/* Count the risks of each BigCategory in order, and the categories without risks are left out */
+func NewCategoryLevels(assets []risk_assessment.Asset, levels risk_assessment.RiskLevels) []CategoryLevels {
+  counts := map[string]map[string]int{}
+  for _, row := range SortedRisks(assets, levels) {
+    if counts[row.Asset.BigCategory] == nil {
+      counts[row.Asset.BigCategory] = map[string]int{}
+    }
+    counts[row.Asset.BigCategory][row.Level]++
+  }
+
+  categories := []CategoryLevels{}
+  for name, count := range counts {
+    categories = append(categories, CategoryLevels{BigCategory: name, Levels: count})
+  }
+  sort.Slice(categories, func(i, j int) bool {
+    return categories[i].BigCategory < categories[j].BigCategory
+  })
+  return categories
+}
+
+/* The horizontal bars of the categories, stacked from the high risks */
+func WriteCategoriesSVG(w io.Writer, title string, categories []CategoryLevels, levels risk_assessment.RiskLevels) error {
+  const label = 160
+  const bar = 24
+  const gap = 10
+  const top = 50
+  const scale_width = 400
+  width := label + scale_width + 60
+  height := top + len(categories) * (bar + gap) + 70
+
+  most := 1
+  for i := range categories {
+    most = max(most, categories[i].Total())
+  }
+
+  b := bufio.NewWriter(w)
+  fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" %s>`,
+              width, height, width, height, SVG_FONT)
+  fmt.Fprintf(b, "<title>%s</title>\n", escape(title))
+  fmt.Fprintf(b, `<rect width="%d" height="%d" fill="#ffffff"/>`, width, height)
+  fmt.Fprintf(b, `<text x="10" y="24" font-size="16" font-weight="bold">%s</text>`, escape(title))
+  fmt.Fprintln(b)
+
+  if len(categories) == 0 {
+    fmt.Fprintf(b, `<text x="10" y="%d" font-size="12" fill="#666666">No risks</text>`, top + 12)
+    fmt.Fprintln(b)
+  }
+  for i := range categories {
+    category := &categories[i]
+    y := top + i * (bar + gap)
+    name := category.BigCategory
+    if name == "" {
+      name = "(none)"
+    }
+    fmt.Fprintf(b, `<text x="%d" y="%d" font-size="12" text-anchor="end">%s</text>`,
+                label - 8, y + bar / 2 + 4, escape(shorten(name, 24)))
+
+    x := label
+    for j := len(risk_assessment.RISK_LEVEL_NAMES) - 1; j >= 0; j-- {
+      level := risk_assessment.RISK_LEVEL_NAMES[j]
+      count := category.Levels[level]
+      if count == 0 {
+        continue
+      }
+      length := count * scale_width / most
+      fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#999999"><title>%s: %d</title></rect>`,
+                  x, y, length, bar, levelColor(level), level, count)
+      x += length
+    }
+    fmt.Fprintf(b, `<text x="%d" y="%d" font-size="12">%d</text>`, x + 6, y + bar / 2 + 4, category.Total())
+    fmt.Fprintln(b)
+  }
+
+  y := top + len(categories) * (bar + gap) + 10
+  levelsKey(b, label, y)
+  fmt.Fprintf(b, `<text x="%d" y="%d" font-size="11" fill="#666666">%s</text>`, label, y + 34, escape(levelsLegend(levels)))
+  fmt.Fprint(b, "\n</svg>\n")
+  return b.Flush()
+}
+
+/* Cut the text at n runes with an ellipsis, to fit the labels */
+func shorten(text string, n int) string {
+  runes := []rune(text)
+  if len(runes) <= n {
+    return text
+  }
+  return string(runes[:n - 1]) + "…"
+}
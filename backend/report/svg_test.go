@@ -0,0 +1,89 @@
+package report
+
+import (
+  "bytes"
+  "encoding/xml"
+  "io"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/* The SVG must be well formed XML, or the browsers show nothing */
+func assertXML(t *testing.T, svg string) {
+  decoder := xml.NewDecoder(strings.NewReader(svg))
+  for {
+    _, err := decoder.Token()
+    if err == io.EOF {
+      break
+    }
+    assert.Nil(t, err)
+    if err != nil {
+      break
+    }
+  }
+}
+
+func TestWriteHeatMapSVG(t *testing.T) {
+  levels := risk_assessment.DEFAULT_RISK_LEVELS
+  var buf bytes.Buffer
+  err := WriteHeatMapSVG(&buf, "foo & bar", risk_assessment.NewHeatMap(testAssets(), levels), levels)
+  assert.Nil(t, err)
+
+  svg := buf.String()
+  assertXML(t, svg)
+  assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg"`))
+  assert.Contains(t, svg, "<title>foo &amp; bar</title>")
+  assert.Contains(t, svg, "low &lt; 24 ≤ medium &lt; 48 ≤ high")
+  /* 3 colored cells of the risks with the gray ones, and 3 boxes of the key */
+  assert.Equal(t, 2 + 1, strings.Count(svg, `fill="` + levelColor(risk_assessment.HighRisk) + `"`))
+  assert.Equal(t, 1 + 1, strings.Count(svg, `fill="` + levelColor(risk_assessment.LowRisk) + `"`))
+  assert.Equal(t, 13, strings.Count(svg, `fill="` + svgColor(EMPTY_COLOR) + `"`))
+  assert.NotContains(t, svg, "<script")
+
+  /* The scope's thresholds change the colors */
+  levels = risk_assessment.RiskLevels{Medium: 10, High: 60}
+  buf.Reset()
+  assert.Nil(t, WriteHeatMapSVG(&buf, "foo", risk_assessment.NewHeatMap(testAssets(), levels), levels))
+  svg = buf.String()
+  assert.Equal(t, 1 + 1, strings.Count(svg, `fill="` + levelColor(risk_assessment.HighRisk) + `"`))
+  assert.Equal(t, 2 + 1, strings.Count(svg, `fill="` + levelColor(risk_assessment.MediumRisk) + `"`))
+  assert.Contains(t, svg, "low &lt; 10 ≤ medium &lt; 60 ≤ high")
+}
+
+func TestNewCategoryLevels(t *testing.T) {
+  categories := NewCategoryLevels(testAssets(), risk_assessment.DEFAULT_RISK_LEVELS)
+  assert.Equal(t, []CategoryLevels{
+    {BigCategory: "Hardware", Levels: map[string]int{"low": 1, "high": 1}},
+    {BigCategory: "Software", Levels: map[string]int{"high": 1}},
+  }, categories)
+  assert.Equal(t, 2, categories[0].Total())
+
+  assert.Equal(t, []CategoryLevels{}, NewCategoryLevels(nil, risk_assessment.DEFAULT_RISK_LEVELS))
+}
+
+func TestWriteCategoriesSVG(t *testing.T) {
+  levels := risk_assessment.DEFAULT_RISK_LEVELS
+  categories := NewCategoryLevels(testAssets(), levels)
+  categories[0].BigCategory = "A very long category <name> which is cut"
+
+  var buf bytes.Buffer
+  assert.Nil(t, WriteCategoriesSVG(&buf, "foo", categories, levels))
+  svg := buf.String()
+  assertXML(t, svg)
+  assert.Contains(t, svg, "A very long category &lt;n…")
+  assert.Contains(t, svg, "<title>high: 1</title>")
+  assert.Contains(t, svg, "<title>low: 1</title>")
+  /* The longest bar spans the whole scale */
+  assert.Contains(t, svg, `width="200" height="24"`)
+  assert.NotContains(t, svg, "No risks")
+
+  buf.Reset()
+  assert.Nil(t, WriteCategoriesSVG(&buf, "foo", []CategoryLevels{}, levels))
+  svg = buf.String()
+  assertXML(t, svg)
+  assert.Contains(t, svg, "No risks")
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+  "context"
+  "time"
+
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+
+  "github.com/starnight/riskassessment/backend/config"
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/*
+ * A report template uploaded by the administrators.  An HTML template is
+ * parsed with html/template, which escapes the rendered data, and a Markdown
+ * one with text/template.
+ */
+type Template struct {
+  ID primitive.ObjectID `bson:"_id"`
+  CreateTime time.Time
+  UpdateTime time.Time
+  Name string
+  Format string
+  Content string
+}
+
+const (
+  HTMLFormat = "html"
+  MarkdownFormat = "markdown"
+)
+
+var CONTENT_TYPES = map[string]string{
+  HTMLFormat: "text/html; charset=utf-8",
+  MarkdownFormat: "text/markdown; charset=utf-8",
+}
+
+var EXTENSIONS = map[string]string{
+  HTMLFormat: ".html",
+  MarkdownFormat: ".md",
+}
+
+type ITemplateUtils interface {
+  AddTemplate(ctx context.Context, tmpl *Template) (error)
+  GetTemplates(ctx context.Context) ([]Template, error)
+  GetTemplateByID(ctx context.Context, id primitive.ObjectID) (Template, error)
+  UpdateTemplate(ctx context.Context, tmpl *Template) (error)
+  DeleteTemplate(ctx context.Context, id primitive.ObjectID) (error)
+  /* Store the template as it is, replacing the one with the same ID */
+  PutTemplate(ctx context.Context, tmpl *Template) (error)
+}
+
+type TemplateUtils struct {
+  DB_Client *mongo.Client
+}
+
+var TEMPLATE_MONGO_DB string = config.DB_NAME
+const TEMPLATE_COLLECTION = "templates"
+
+func (utils *TemplateUtils) AddTemplate(ctx context.Context, tmpl *Template) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  tmpl.ID = primitive.NewObjectID()
+  tmpl.CreateTime = time.Now().UTC()
+  tmpl.UpdateTime = tmpl.CreateTime
+
+  coll := utils.DB_Client.Database(TEMPLATE_MONGO_DB).Collection(TEMPLATE_COLLECTION)
+  _, err := coll.InsertOne(ctx, tmpl)
+  return err
+}
+
+func (utils *TemplateUtils) GetTemplates(ctx context.Context) ([]Template, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  templates := []Template{}
+
+  coll := utils.DB_Client.Database(TEMPLATE_MONGO_DB).Collection(TEMPLATE_COLLECTION)
+  cur, err := coll.Find(ctx, bson.D{{}})
+  if err != nil {
+    return templates, err
+  }
+
+  err = cur.All(ctx, &templates)
+  return templates, err
+}
+
+func (utils *TemplateUtils) GetTemplateByID(ctx context.Context, id primitive.ObjectID) (Template, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var tmpl Template
+
+  coll := utils.DB_Client.Database(TEMPLATE_MONGO_DB).Collection(TEMPLATE_COLLECTION)
+  err := coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&tmpl)
+  return tmpl, err
+}
+
+/* Replace the name, format and content of the stored template, if there is one */
+func (utils *TemplateUtils) UpdateTemplate(ctx context.Context, tmpl *Template) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  tmpl.UpdateTime = time.Now().UTC()
+  update := bson.M{"$set": bson.M{
+    "name": tmpl.Name,
+    "format": tmpl.Format,
+    "content": tmpl.Content,
+    "updatetime": tmpl.UpdateTime,
+  }}
+
+  coll := utils.DB_Client.Database(TEMPLATE_MONGO_DB).Collection(TEMPLATE_COLLECTION)
+  _, err := coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: tmpl.ID}}, update)
+  return err
+}
+
+func (utils *TemplateUtils) DeleteTemplate(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  coll := utils.DB_Client.Database(TEMPLATE_MONGO_DB).Collection(TEMPLATE_COLLECTION)
+  _, err := coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+  return err
+}
+
+func (utils *TemplateUtils) PutTemplate(ctx context.Context, tmpl *Template) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  coll := utils.DB_Client.Database(TEMPLATE_MONGO_DB).Collection(TEMPLATE_COLLECTION)
+  _, err := coll.ReplaceOne(ctx, bson.M{"_id": tmpl.ID}, tmpl, options.Replace().SetUpsert(true))
+  return err
+}
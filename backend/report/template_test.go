@@ -0,0 +1,107 @@
+package report
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+func runTemplateUtils(t *testing.T, test func(t *testing.T, template_utils ITemplateUtils)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, &TemplateUtils{DB_Client: mongo_client})
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, &BoltTemplateUtils{DB: bolt_db}) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, &PGTemplateUtils{DB: pg_db})
+  })
+}
+
+func TestTemplateUtils(t *testing.T) {
+  runTemplateUtils(t, testTemplateUtils)
+}
+
+func testTemplateUtils(t *testing.T, template_utils ITemplateUtils) {
+  ctx := context.TODO()
+
+  tmpl := Template{Name: "foo", Format: MarkdownFormat, Content: "# {{.Scope.Name}}"}
+  assert.Nil(t, template_utils.AddTemplate(ctx, &tmpl))
+  assert.False(t, tmpl.ID.IsZero())
+  assert.Equal(t, tmpl.CreateTime, tmpl.UpdateTime)
+
+  stored, err := template_utils.GetTemplateByID(ctx, tmpl.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, tmpl.Name, stored.Name)
+  assert.Equal(t, tmpl.Content, stored.Content)
+  assert.Equal(t, tmpl.CreateTime.Truncate(time.Millisecond), stored.CreateTime)
+
+  templates, err := template_utils.GetTemplates(ctx)
+  assert.Nil(t, err)
+  assert.Contains(t, templateNames(templates), "foo")
+
+  /* Update the template, but keep its creation time */
+  stored.Name = "bar"
+  stored.Format = HTMLFormat
+  stored.Content = "<h1>{{.Scope.Name}}</h1>"
+  assert.Nil(t, template_utils.UpdateTemplate(ctx, &stored))
+  updated, err := template_utils.GetTemplateByID(ctx, tmpl.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, "bar", updated.Name)
+  assert.Equal(t, HTMLFormat, updated.Format)
+  assert.Equal(t, stored.Content, updated.Content)
+  assert.Equal(t, stored.CreateTime, updated.CreateTime)
+  assert.False(t, updated.UpdateTime.Before(updated.CreateTime))
+
+  /* Delete the template */
+  assert.Nil(t, template_utils.DeleteTemplate(ctx, tmpl.ID))
+  _, err = template_utils.GetTemplateByID(ctx, tmpl.ID)
+  assert.Equal(t, database.ErrNotFound, err)
+  templates, err = template_utils.GetTemplates(ctx)
+  assert.Nil(t, err)
+  assert.NotContains(t, templateNames(templates), "bar")
+}
+
+func TestPutTemplate(t *testing.T) {
+  runTemplateUtils(t, testPutTemplate)
+}
+
+func testPutTemplate(t *testing.T, template_utils ITemplateUtils) {
+  ctx := context.TODO()
+  create_time := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+  tmpl := Template{
+    ID: primitive.NewObjectID(),
+    CreateTime: create_time,
+    UpdateTime: create_time.Add(time.Hour),
+    Name: "restored",
+    Format: MarkdownFormat,
+    Content: "# {{.Scope.Name}}",
+  }
+
+  /* A new template keeps its ID and times */
+  assert.Nil(t, template_utils.PutTemplate(ctx, &tmpl))
+  stored, err := template_utils.GetTemplateByID(ctx, tmpl.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, tmpl, stored)
+
+  /* The template of the same ID is replaced */
+  tmpl.Name = "replaced"
+  tmpl.Format = HTMLFormat
+  assert.Nil(t, template_utils.PutTemplate(ctx, &tmpl))
+  stored, err = template_utils.GetTemplateByID(ctx, tmpl.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, tmpl, stored)
+}
+
+func templateNames(templates []Template) []string {
+  names := []string{}
+  for _, tmpl := range templates {
+    names = append(names, tmpl.Name)
+  }
+  return names
+}
@@ -6,6 +6,8 @@ package risk_assessment
 
 import (
   "context"
+  "errors"
+  "reflect"
   "time"
 
   "go.mongodb.org/mongo-driver/bson"
@@ -14,6 +16,7 @@ import (
   "go.mongodb.org/mongo-driver/mongo/options"
 
   "github.com/starnight/riskassessment/backend/config"
+  "github.com/starnight/riskassessment/backend/database"
 )
 
 type Asset struct {
@@ -43,73 +46,142 @@ type Risk struct {
 }
 
 type IAssetUtils interface {
-  AddAsset(asset *Asset) (error)
-  GetAssetByID(id primitive.ObjectID) (Asset, error)
-  GetAssetsByScopeID(id primitive.ObjectID) ([]Asset, error)
-  GetAssets(offset int64, amount int64) ([]Asset, error)
-  SetAssetValue(id string, c uint, i uint, a uint) (error)
-  UpdateAsset(asset *Asset) (error)
-  DeleteAsset(id primitive.ObjectID) (error)
+  AddAsset(ctx context.Context, asset *Asset) (error)
+  /* Add all the assets, or none of them if it fails */
+  AddAssets(ctx context.Context, assets []Asset) (error)
+  GetAssetByID(ctx context.Context, id primitive.ObjectID) (Asset, error)
+  GetAssetsByScopeID(ctx context.Context, id primitive.ObjectID) ([]Asset, error)
+  GetAssets(ctx context.Context, offset int64, amount int64) ([]Asset, error)
+  QueryAssets(ctx context.Context, query *AssetQuery) (AssetList, error)
+  SetAssetValue(ctx context.Context, id string, c uint, i uint, a uint) (error)
+  UpdateAsset(ctx context.Context, asset *Asset) (error)
+  DeleteAsset(ctx context.Context, id primitive.ObjectID) (error)
+  PutAsset(ctx context.Context, asset *Asset) (error)
+  /* Replace the stored asset only if it is still old, or ErrAssetChanged */
+  ReplaceAsset(ctx context.Context, old *Asset, asset *Asset) (error)
+}
+
+var ErrAssetChanged = errors.New("the asset is changed or deleted")
+
+/* Whether the assets have the same fields, whatever the time zones of the create times */
+func sameAsset(a *Asset, b *Asset) bool {
+  x, y := *a, *b
+  if !x.CreateTime.Equal(y.CreateTime) {
+    return false
+  }
+  x.CreateTime, y.CreateTime = time.Time{}, time.Time{}
+  if len(x.Risks) == 0 && len(y.Risks) == 0 {
+    x.Risks, y.Risks = nil, nil
+  }
+  return reflect.DeepEqual(x, y)
 }
 
 type AssetUtils struct {
   DB_Client *mongo.Client
 }
 
-var _MONGO_DB string = config.DB_NAME
-var _COLLECTION string = "assets"
+var ASSET_MONGO_DB string = config.DB_NAME
+var ASSET_COLLECTION string = "assets"
 
-func (utils *AssetUtils) AddAsset(asset *Asset) (error) {
+/* The new asset's ID and create time */
+func newAsset(asset *Asset) {
   asset.ID = primitive.NewObjectID()
   asset.CreateTime = time.Now().UTC()
   if asset.Risks == nil {
     asset.Risks = []Risk{}
   }
+}
+
+func (utils *AssetUtils) AddAsset(ctx context.Context, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  newAsset(asset)
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  _, err := coll.InsertOne(ctx, asset)
+  return err
+}
+
+/*
+ * Insert the assets at once.  MongoDB stops at the failed one without a
+ * transaction, so the inserted ones before it are deleted.
+ */
+func (utils *AssetUtils) AddAssets(ctx context.Context, assets []Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if len(assets) == 0 {
+    return nil
+  }
+
+  docs := make([]interface{}, len(assets))
+  ids := make([]primitive.ObjectID, len(assets))
+  for i := range assets {
+    newAsset(&assets[i])
+    docs[i] = &assets[i]
+    ids[i] = assets[i].ID
+  }
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
-  _, err := coll.InsertOne(context.TODO(), asset)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  _, err := coll.InsertMany(ctx, docs)
+  if err != nil {
+    coll.DeleteMany(context.WithoutCancel(ctx), bson.M{"_id": bson.M{"$in": ids}})
+  }
   return err
 }
 
-func (utils *AssetUtils) GetAssetByID(id primitive.ObjectID) (Asset, error) {
+func (utils *AssetUtils) GetAssetByID(ctx context.Context, id primitive.ObjectID) (Asset, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var asset Asset
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
   filter := bson.D{{ "_id", id }}
-  err := coll.FindOne(context.TODO(), filter).Decode(&asset)
+  err := coll.FindOne(ctx, filter).Decode(&asset)
   return asset, err
 }
 
-func (utils *AssetUtils) GetAssetsByScopeID(id primitive.ObjectID) ([]Asset, error) {
+func (utils *AssetUtils) GetAssetsByScopeID(ctx context.Context, id primitive.ObjectID) ([]Asset, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var assets []Asset
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
   filter := bson.D{{ "scope", id }}
-  cur, err := coll.Find(context.TODO(), filter)
+  cur, err := coll.Find(ctx, filter)
   if err != nil {
     return assets, err
   }
 
-  err = cur.All(context.TODO(), &assets)
+  err = cur.All(ctx, &assets)
   return assets, err
 }
 
-func (utils *AssetUtils) GetAssets(offset int64, amount int64) ([]Asset, error) {
+func (utils *AssetUtils) GetAssets(ctx context.Context, offset int64, amount int64) ([]Asset, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var assets []Asset
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
   filter := bson.D{{}}
   opts := options.Find().SetLimit(amount).SetSkip(offset)
-  cur, err := coll.Find(context.TODO(), filter, opts)
+  cur, err := coll.Find(ctx, filter, opts)
   if err != nil {
     return assets, err
   }
 
-  err = cur.All(context.TODO(), &assets)
+  err = cur.All(ctx, &assets)
   return assets, err
 }
 
-func (utils *AssetUtils) SetAssetValue(id string, c uint, i uint, a uint) (error) {
+func (utils *AssetUtils) SetAssetValue(ctx context.Context, id string, c uint, i uint, a uint) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   a_id, _ := primitive.ObjectIDFromHex(id)
   filter := bson.M{ "_id": a_id }
   update := bson.M{
@@ -122,23 +194,58 @@ func (utils *AssetUtils) SetAssetValue(id string, c uint, i uint, a uint) (error
     },
   }
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
-  _, err := coll.UpdateOne(context.TODO(), filter, update)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  _, err := coll.UpdateOne(ctx, filter, update)
   return err
 }
 
-func (utils *AssetUtils) UpdateAsset(asset *Asset) (error) {
+func (utils *AssetUtils) UpdateAsset(ctx context.Context, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   filter := bson.D{{ "_id", asset.ID }}
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
-  _, err := coll.ReplaceOne(context.TODO(), filter, asset)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  _, err := coll.ReplaceOne(ctx, filter, asset)
   return err
 }
 
-func (utils *AssetUtils) DeleteAsset(id primitive.ObjectID) (error) {
+func (utils *AssetUtils) DeleteAsset(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   filter := bson.D{{ "_id", id }}
 
-  coll := utils.DB_Client.Database(_MONGO_DB).Collection(_COLLECTION)
-  _, err := coll.DeleteOne(context.TODO(), filter)
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  _, err := coll.DeleteOne(ctx, filter)
   return err
 }
+
+/* Insert or replace the asset with its own ID, like restoring a backup */
+func (utils *AssetUtils) PutAsset(ctx context.Context, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if asset.Risks == nil {
+    asset.Risks = []Risk{}
+  }
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  _, err := coll.ReplaceOne(ctx, bson.M{"_id": asset.ID}, asset, options.Replace().SetUpsert(true))
+  return err
+}
+
+/* The old asset as the filter matches only the document with all the same fields */
+func (utils *AssetUtils) ReplaceAsset(ctx context.Context, old *Asset, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  res, err := coll.ReplaceOne(ctx, old, asset)
+  if err != nil {
+    return err
+  } else if res.MatchedCount == 0 {
+    return ErrAssetChanged
+  }
+  return nil
+}
@@ -1,19 +1,32 @@
 package risk_assessment
 
 import (
+  "context"
   "testing"
+  "time"
   "github.com/stretchr/testify/assert"
-  "github.com/starnight/riskassessment/backend/database"
 
   "go.mongodb.org/mongo-driver/mongo"
   "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var asset_utils = AssetUtils{
-  DB_Client: database.ConnectDB(database.GetDBStr("")),
+func runAssetUtils(t *testing.T, test func(t *testing.T, asset_utils IAssetUtils)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, &AssetUtils{DB_Client: mongo_client})
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, &BoltAssetUtils{DB: bolt_db}) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, &PGAssetUtils{DB: pg_db})
+  })
 }
 
 func TestAddAsset(t *testing.T) {
+  runAssetUtils(t, testAddAsset)
+}
+
+func testAddAsset(t *testing.T, asset_utils IAssetUtils) {
   expected_blg_ctg := "big"
   expected_small_ctg := "small"
   expected_name := "test name"
@@ -25,10 +38,10 @@ func TestAddAsset(t *testing.T) {
     Name: expected_name,
   }
 
-  err1 := asset_utils.AddAsset(&asset)
+  err1 := asset_utils.AddAsset(context.TODO(), &asset)
   assert.Nil(t, err1)
 
-  assets, err2 := asset_utils.GetAssets(0, 0)
+  assets, err2 := asset_utils.GetAssets(context.TODO(), 0, 0)
   assert.Nil(t, err2)
   asset2 := assets[len(assets)-1]
   assert.NotNil(t, asset2.ID)
@@ -42,27 +55,59 @@ func TestAddAsset(t *testing.T) {
   assert.Zero(t, asset2.Value.Availability)
   assert.Zero(t, len(asset2.Risks))
 
-  asset3, err3 := asset_utils.GetAssetByID(asset2.ID)
+  asset3, err3 := asset_utils.GetAssetByID(context.TODO(), asset2.ID)
   assert.Nil(t, err3)
   assert.Equal(t, asset2, asset3)
 
-  assets4, err4 := asset_utils.GetAssetsByScopeID(asset2.Scope)
+  assets4, err4 := asset_utils.GetAssetsByScopeID(context.TODO(), asset2.Scope)
   assert.Nil(t, err4)
   assert.Equal(t, assets, assets4)
 }
 
+func TestAddAssets(t *testing.T) {
+  runAssetUtils(t, testAddAssets)
+}
+
+func testAddAssets(t *testing.T, asset_utils IAssetUtils) {
+  ctx := context.TODO()
+  scope := primitive.NewObjectID()
+  assets := []Asset{
+    {Scope: scope, Name: "first", Risks: []Risk{{Threat: "threat", Possibility: 2, Impact: 3}}},
+    {Scope: scope, Name: "second"},
+  }
+  assert.Nil(t, asset_utils.AddAssets(ctx, assets))
+  assert.Nil(t, asset_utils.AddAssets(ctx, []Asset{}))
+  assert.NotEqual(t, assets[0].ID, assets[1].ID)
+  assert.Equal(t, []Risk{}, assets[1].Risks)
+
+  stored, err := asset_utils.GetAssetsByScopeID(ctx, scope)
+  assert.Nil(t, err)
+  assert.Equal(t, 2, len(stored))
+  for i := range assets {
+    asset, err := asset_utils.GetAssetByID(ctx, assets[i].ID)
+    assert.Nil(t, err)
+    assert.Equal(t, assets[i].Name, asset.Name)
+    assert.Equal(t, len(assets[i].Risks), len(asset.Risks))
+    assert.Nil(t, asset_utils.DeleteAsset(ctx, assets[i].ID))
+  }
+}
+
 func TestSetAssetValue(t *testing.T) {
+  runAssetUtils(t, testSetAssetValue)
+}
+
+func testSetAssetValue(t *testing.T, asset_utils IAssetUtils) {
   expected_c := uint(4)
   expected_i := uint(3)
   expected_a := uint(2)
 
-  assets, _ := asset_utils.GetAssets(0, 0)
+  assets, _ := asset_utils.GetAssets(context.TODO(), 0, 0)
   orig_asset := assets[len(assets)-1]
 
-  err1 := asset_utils.SetAssetValue(orig_asset.ID.Hex(), expected_c, expected_i, expected_a)
+  err1 := asset_utils.SetAssetValue(context.TODO(), orig_asset.ID.Hex(), expected_c, expected_i, expected_a)
   assert.Nil(t, err1)
 
-  assets2, err2 := asset_utils.GetAssets(0, 0)
+  assets2, err2 := asset_utils.GetAssets(context.TODO(), 0, 0)
   assert.Nil(t, err2)
   new_asset := assets2[len(assets2)-1]
   assert.Equal(t, orig_asset.ID, new_asset.ID)
@@ -72,11 +117,15 @@ func TestSetAssetValue(t *testing.T) {
 }
 
 func TestUpdteAsset(t *testing.T) {
+  runAssetUtils(t, testUpdteAsset)
+}
+
+func testUpdteAsset(t *testing.T, asset_utils IAssetUtils) {
   expected_c := uint(2)
   expected_i := uint(4)
   expected_a := uint(3)
 
-  assets, _ := asset_utils.GetAssets(0, 0)
+  assets, _ := asset_utils.GetAssets(context.TODO(), 0, 0)
   orig_asset := assets[len(assets)-1]
 
   orig_asset.Value.Confidentiality = expected_c
@@ -91,22 +140,92 @@ func TestUpdteAsset(t *testing.T) {
   }
   orig_asset.Risks = append(orig_asset.Risks, risk)
 
-  err1 := asset_utils.UpdateAsset(&orig_asset)
+  err1 := asset_utils.UpdateAsset(context.TODO(), &orig_asset)
   assert.Nil(t, err1)
 
-  saved_asset, err2 := asset_utils.GetAssetByID(orig_asset.ID)
+  saved_asset, err2 := asset_utils.GetAssetByID(context.TODO(), orig_asset.ID)
   assert.Nil(t, err2)
   assert.Equal(t, orig_asset, saved_asset)
 }
 
 func TestDeleteAsset(t *testing.T) {
-  assets, _ := asset_utils.GetAssets(0, 1)
+  runAssetUtils(t, testDeleteAsset)
+}
+
+func testDeleteAsset(t *testing.T, asset_utils IAssetUtils) {
+  assets, _ := asset_utils.GetAssets(context.TODO(), 0, 1)
   assert.Equal(t, 1, len(assets))
   delete_asset := assets[0]
 
-  err1 := asset_utils.DeleteAsset(delete_asset.ID)
+  err1 := asset_utils.DeleteAsset(context.TODO(), delete_asset.ID)
   assert.Nil(t, err1)
 
-  _, err2 := asset_utils.GetAssetByID(delete_asset.ID)
+  _, err2 := asset_utils.GetAssetByID(context.TODO(), delete_asset.ID)
   assert.Equal(t, mongo.ErrNoDocuments, err2)
 }
+
+func TestReplaceAsset(t *testing.T) {
+  runAssetUtils(t, testReplaceAsset)
+}
+
+func testReplaceAsset(t *testing.T, asset_utils IAssetUtils) {
+  ctx := context.TODO()
+  asset := Asset{
+    Scope: primitive.NewObjectID(),
+    Name: "replace",
+    Value: Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []Risk{{Threat: "threat", Possibility: 2, Impact: 3}},
+  }
+  assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+  old, err := asset_utils.GetAssetByID(ctx, asset.ID)
+  assert.Nil(t, err)
+
+  replaced := old
+  replaced.Name = "replaced"
+  replaced.Risks = []Risk{}
+  assert.Nil(t, asset_utils.ReplaceAsset(ctx, &old, &replaced))
+  stored, err := asset_utils.GetAssetByID(ctx, asset.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, "replaced", stored.Name)
+  assert.Equal(t, 0, len(stored.Risks))
+
+  /* The stored asset is not the old one anymore */
+  other := old
+  other.Owner = "other"
+  assert.Equal(t, ErrAssetChanged, asset_utils.ReplaceAsset(ctx, &old, &other))
+  stored, _ = asset_utils.GetAssetByID(ctx, asset.ID)
+  assert.Equal(t, "replaced", stored.Name)
+  assert.Equal(t, "", stored.Owner)
+
+  assert.Nil(t, asset_utils.DeleteAsset(ctx, asset.ID))
+  assert.Equal(t, ErrAssetChanged, asset_utils.ReplaceAsset(ctx, &stored, &other))
+}
+
+func TestPutAsset(t *testing.T) {
+  runAssetUtils(t, testPutAsset)
+}
+
+func testPutAsset(t *testing.T, asset_utils IAssetUtils) {
+  /* A restored asset keeps its ID, create time and risks */
+  asset := Asset{
+    ID: primitive.NewObjectID(),
+    CreateTime: time.Now().UTC().Truncate(time.Millisecond),
+    Scope: primitive.NewObjectID(),
+    Name: "put",
+    Value: Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []Risk{{Threat: "threat", Possibility: 2, Impact: 3}},
+  }
+  assert.Nil(t, asset_utils.PutAsset(context.TODO(), &asset))
+
+  get_asset, err := asset_utils.GetAssetByID(context.TODO(), asset.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, asset, get_asset)
+
+  /* Put the same asset again replaces it */
+  asset.Name = "new put"
+  asset.Risks = []Risk{}
+  assert.Nil(t, asset_utils.PutAsset(context.TODO(), &asset))
+  get_asset, err = asset_utils.GetAssetByID(context.TODO(), asset.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, asset, get_asset)
+}
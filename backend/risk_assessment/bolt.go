@@ -0,0 +1,228 @@
+package risk_assessment
+
+import (
+  "context"
+  "time"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* BoltScopeUtils keeps the scopes in the embedded database */
+type BoltScopeUtils struct {
+  DB *bbolt.DB
+}
+
+func (utils *BoltScopeUtils) AddScope(ctx context.Context, scope *Scope) (primitive.ObjectID, error) {
+  scope.ID = primitive.NewObjectID()
+  scope.CreateTime = time.Now().UTC()
+
+  err := database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, SCOPE_COLLECTION, scope.ID, scope)
+  })
+  return scope.ID, err
+}
+
+func (utils *BoltScopeUtils) findScopes(ctx context.Context, match func(scope *Scope) bool) ([]Scope, error) {
+  var scopes []Scope
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var err error
+    scopes, err = database.BoltFind(tx, SCOPE_COLLECTION, match)
+    return err
+  })
+  return scopes, err
+}
+
+func (utils *BoltScopeUtils) GetScopes(ctx context.Context) ([]Scope, error) {
+  return utils.findScopes(ctx, nil)
+}
+
+func (utils *BoltScopeUtils) GetScopeByID(ctx context.Context, id primitive.ObjectID) (Scope, error) {
+  var scope Scope
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltGet(tx, SCOPE_COLLECTION, id, &scope)
+  })
+  return scope, err
+}
+
+func (utils *BoltScopeUtils) GetScopeByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Scope, error) {
+  wanted := map[primitive.ObjectID]bool{}
+  for _, id := range ids {
+    wanted[id] = true
+  }
+
+  return utils.findScopes(ctx, func(scope *Scope) bool {
+    return wanted[scope.ID]
+  })
+}
+
+func (utils *BoltScopeUtils) HasScopeID(ctx context.Context, id primitive.ObjectID) (bool, error) {
+  var has bool
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    has = database.BoltHas(tx, SCOPE_COLLECTION, id)
+    return nil
+  })
+  return has, err
+}
+
+/* Replace the stored scope, if there is one */
+func (utils *BoltScopeUtils) UpdateScope(ctx context.Context, scope *Scope) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    if !database.BoltHas(tx, SCOPE_COLLECTION, scope.ID) {
+      return nil
+    }
+    return database.BoltPut(tx, SCOPE_COLLECTION, scope.ID, scope)
+  })
+}
+
+/* Insert or replace the scope with its own ID, like restoring a backup */
+func (utils *BoltScopeUtils) PutScope(ctx context.Context, scope *Scope) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, SCOPE_COLLECTION, scope.ID, scope)
+  })
+}
+
+func (utils *BoltScopeUtils) DeleteScope(ctx context.Context, id primitive.ObjectID) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    points, err := database.BoltFind(tx, TREND_COLLECTION, func(point *TrendPoint) bool {
+      return point.Scope == id
+    })
+    if err != nil {
+      return err
+    }
+    for i := range points {
+      if err := database.BoltDelete(tx, TREND_COLLECTION, points[i].ID); err != nil {
+        return err
+      }
+    }
+    return database.BoltDelete(tx, SCOPE_COLLECTION, id)
+  })
+}
+
+/* BoltAssetUtils keeps the assets in the embedded database */
+type BoltAssetUtils struct {
+  DB *bbolt.DB
+}
+
+func (utils *BoltAssetUtils) AddAsset(ctx context.Context, asset *Asset) (error) {
+  newAsset(asset)
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, ASSET_COLLECTION, asset.ID, asset)
+  })
+}
+
+func (utils *BoltAssetUtils) AddAssets(ctx context.Context, assets []Asset) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    for i := range assets {
+      newAsset(&assets[i])
+      if err := database.BoltPut(tx, ASSET_COLLECTION, assets[i].ID, &assets[i]); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+}
+
+func (utils *BoltAssetUtils) GetAssetByID(ctx context.Context, id primitive.ObjectID) (Asset, error) {
+  var asset Asset
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltGet(tx, ASSET_COLLECTION, id, &asset)
+  })
+  return asset, err
+}
+
+func (utils *BoltAssetUtils) findAssets(ctx context.Context, match func(asset *Asset) bool) ([]Asset, error) {
+  var assets []Asset
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var err error
+    assets, err = database.BoltFind(tx, ASSET_COLLECTION, match)
+    return err
+  })
+  return assets, err
+}
+
+func (utils *BoltAssetUtils) GetAssetsByScopeID(ctx context.Context, id primitive.ObjectID) ([]Asset, error) {
+  return utils.findAssets(ctx, func(asset *Asset) bool {
+    return asset.Scope == id
+  })
+}
+
+/* Zero amount means no limit, like MongoDB */
+func (utils *BoltAssetUtils) GetAssets(ctx context.Context, offset int64, amount int64) ([]Asset, error) {
+  var index int64
+
+  return utils.findAssets(ctx, func(asset *Asset) bool {
+    index++
+    return index > offset && (amount <= 0 || index <= offset + amount)
+  })
+}
+
+/* Change the stored asset, if there is one */
+func (utils *BoltAssetUtils) updateAsset(ctx context.Context, id primitive.ObjectID, fn func(asset *Asset)) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var asset Asset
+
+    err := database.BoltGet(tx, ASSET_COLLECTION, id, &asset)
+    if err == database.ErrNotFound {
+      return nil
+    } else if err != nil {
+      return err
+    }
+
+    fn(&asset)
+    return database.BoltPut(tx, ASSET_COLLECTION, id, &asset)
+  })
+}
+
+func (utils *BoltAssetUtils) SetAssetValue(ctx context.Context, id string, c uint, i uint, a uint) (error) {
+  a_id, _ := primitive.ObjectIDFromHex(id)
+
+  return utils.updateAsset(ctx, a_id, func(asset *Asset) {
+    asset.Value = Value{Confidentiality: c, Integrity: i, Availability: a}
+  })
+}
+
+func (utils *BoltAssetUtils) UpdateAsset(ctx context.Context, asset *Asset) (error) {
+  return utils.updateAsset(ctx, asset.ID, func(stored *Asset) {
+    *stored = *asset
+  })
+}
+
+func (utils *BoltAssetUtils) DeleteAsset(ctx context.Context, id primitive.ObjectID) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltDelete(tx, ASSET_COLLECTION, id)
+  })
+}
+
+func (utils *BoltAssetUtils) ReplaceAsset(ctx context.Context, old *Asset, asset *Asset) (error) {
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var stored Asset
+
+    err := database.BoltGet(tx, ASSET_COLLECTION, old.ID, &stored)
+    if err == database.ErrNotFound || (err == nil && !sameAsset(&stored, old)) {
+      return ErrAssetChanged
+    } else if err != nil {
+      return err
+    }
+    return database.BoltPut(tx, ASSET_COLLECTION, asset.ID, asset)
+  })
+}
+
+/* Insert or replace the asset with its own ID, like restoring a backup */
+func (utils *BoltAssetUtils) PutAsset(ctx context.Context, asset *Asset) (error) {
+  if asset.Risks == nil {
+    asset.Risks = []Risk{}
+  }
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    return database.BoltPut(tx, ASSET_COLLECTION, asset.ID, asset)
+  })
+}
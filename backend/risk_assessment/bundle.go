@@ -0,0 +1,127 @@
+package risk_assessment
+
+import (
+  "context"
+  "fmt"
+  "strings"
+  "time"
+
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+ * A scope bundle is a self-contained JSON document of a scope with all of
+ * its assets and their risks, which moves the scope between the instances.
+ * The importing instance gives the scope and the assets new IDs.
+ */
+const BUNDLE_FORMAT = "riskassessment-scope"
+
+/* The bundle version, which is raised once the bundle changes incompatibly */
+const BUNDLE_VERSION = 1
+
+type ScopeBundle struct {
+  Format string
+  Version int
+  ExportTime time.Time
+  Scope Scope
+  Assets []Asset
+}
+
+/* The problems of an asset in the bundle, which is numbered from 0 */
+type AssetProblems struct {
+  Index int
+  ID primitive.ObjectID
+  Name string
+  Problems []string
+}
+
+type ImportResult struct {
+  Scope primitive.ObjectID
+  /* The new IDs of the assets by their IDs in the bundle */
+  Assets map[string]primitive.ObjectID
+}
+
+func ExportScope(ctx context.Context, scope_utils IScopeUtils, asset_utils IAssetUtils, id primitive.ObjectID) (ScopeBundle, error) {
+  bundle := ScopeBundle{
+    Format: BUNDLE_FORMAT,
+    Version: BUNDLE_VERSION,
+    ExportTime: time.Now().UTC(),
+  }
+
+  var err error
+  if bundle.Scope, err = scope_utils.GetScopeByID(ctx, id); err != nil {
+    return bundle, err
+  }
+  if bundle.Assets, err = asset_utils.GetAssetsByScopeID(ctx, id); err != nil {
+    return bundle, err
+  }
+  if bundle.Assets == nil {
+    bundle.Assets = []Asset{}
+  }
+  return bundle, nil
+}
+
+/* Check the bundle itself, and then each of its assets */
+func (bundle *ScopeBundle) Validate() ([]AssetProblems, error) {
+  if bundle.Format != BUNDLE_FORMAT {
+    return nil, fmt.Errorf("not a scope bundle, but %q", bundle.Format)
+  }
+  if bundle.Version < 1 || bundle.Version > BUNDLE_VERSION {
+    return nil, fmt.Errorf("unsupported scope bundle version %d, the supported one is %d", bundle.Version, BUNDLE_VERSION)
+  }
+  if strings.TrimSpace(bundle.Scope.Name) == "" {
+    return nil, fmt.Errorf("the scope has no name")
+  }
+  if bundle.Scope.Levels != (RiskLevels{}) && !bundle.Scope.Levels.IsValid() {
+    return nil, fmt.Errorf("the scope's levels must be 0 < medium < high")
+  }
+
+  invalid := []AssetProblems{}
+  for i := range bundle.Assets {
+    problems := bundle.Assets[i].Validate()
+    if len(problems) > 0 {
+      invalid = append(invalid, AssetProblems{
+        Index: i,
+        ID: bundle.Assets[i].ID,
+        Name: bundle.Assets[i].Name,
+        Problems: problems,
+      })
+    }
+  }
+  return invalid, nil
+}
+
+/*
+ * Create a new scope with the bundle's assets, which must be valid.  If the
+ * assets cannot be added, none of them is, and the new scope is deleted.
+ */
+func ImportScope(ctx context.Context, scope_utils IScopeUtils, asset_utils IAssetUtils, bundle *ScopeBundle) (ImportResult, error) {
+  result := ImportResult{Assets: map[string]primitive.ObjectID{}}
+
+  scope := Scope{
+    Name: strings.TrimSpace(bundle.Scope.Name),
+    Levels: bundle.Scope.Levels,
+  }
+  s_id, err := scope_utils.AddScope(ctx, &scope)
+  if err != nil {
+    return result, err
+  }
+  result.Scope = s_id
+
+  assets := make([]Asset, len(bundle.Assets))
+  for i := range bundle.Assets {
+    assets[i] = bundle.Assets[i]
+    assets[i].Scope = s_id
+  }
+  if err := asset_utils.AddAssets(ctx, assets); err != nil {
+    if err2 := scope_utils.DeleteScope(context.WithoutCancel(ctx), s_id); err2 != nil {
+      return ImportResult{}, fmt.Errorf("%w, and deleting the new scope %s failed: %v", err, s_id.Hex(), err2)
+    }
+    return ImportResult{}, err
+  }
+
+  for i := range bundle.Assets {
+    result.Assets[bundle.Assets[i].ID.Hex()] = assets[i].ID
+  }
+  return result, nil
+}
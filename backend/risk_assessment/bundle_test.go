@@ -0,0 +1,141 @@
+package risk_assessment
+
+import (
+  "context"
+  "errors"
+  "path/filepath"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+func TestAssetValidate(t *testing.T) {
+  asset := Asset{
+    Name: "asset",
+    Value: Value{Confidentiality: 1, Integrity: 2, Availability: MAX_RATING},
+    Risks: []Risk{{Possibility: 1, Impact: 4}},
+  }
+  assert.Equal(t, []string{}, asset.Validate())
+
+  asset.Name = " "
+  asset.Value.Integrity = 0
+  asset.Risks = append(asset.Risks, Risk{Possibility: 5, Impact: 1})
+  assert.Equal(t, []string{"empty name", "integrity 0 is not in 1-4", "risk 2: possibility 5 is not in 1-4"}, asset.Validate())
+}
+
+func TestScopeBundle(t *testing.T) {
+  ctx := context.TODO()
+  /* The conformance tests count on the scopes in the shared database */
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "bundle.db"))
+  assert.Nil(t, err)
+  defer db.Close()
+  scope_utils := &BoltScopeUtils{DB: db}
+  asset_utils := &BoltAssetUtils{DB: db}
+
+  scope := Scope{Name: "bundle", Levels: RiskLevels{Medium: 10, High: 20}}
+  s_id, err := scope_utils.AddScope(ctx, &scope)
+  assert.Nil(t, err)
+  asset := Asset{
+    Scope: s_id,
+    Name: "asset",
+    Value: Value{Confidentiality: 1, Integrity: 2, Availability: 3},
+    Risks: []Risk{{Threat: "threat", Possibility: 2, Impact: 3}},
+  }
+  assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+
+  /* The stored times are in milliseconds */
+  scope, _ = scope_utils.GetScopeByID(ctx, s_id)
+  asset, _ = asset_utils.GetAssetByID(ctx, asset.ID)
+
+  bundle, err := ExportScope(ctx, scope_utils, asset_utils, s_id)
+  assert.Nil(t, err)
+  assert.Equal(t, BUNDLE_FORMAT, bundle.Format)
+  assert.Equal(t, scope, bundle.Scope)
+  assert.Equal(t, []Asset{asset}, bundle.Assets)
+
+  invalid, err := bundle.Validate()
+  assert.Nil(t, err)
+  assert.Equal(t, []AssetProblems{}, invalid)
+
+  /* The imported scope and assets have new IDs */
+  result, err := ImportScope(ctx, scope_utils, asset_utils, &bundle)
+  assert.Nil(t, err)
+  assert.NotEqual(t, s_id, result.Scope)
+  assert.Equal(t, 1, len(result.Assets))
+
+  imported, err := ExportScope(ctx, scope_utils, asset_utils, result.Scope)
+  assert.Nil(t, err)
+  assert.Equal(t, scope.Name, imported.Scope.Name)
+  assert.Equal(t, scope.Levels, imported.Scope.Levels)
+  assert.Equal(t, 1, len(imported.Assets))
+  assert.Equal(t, result.Assets[asset.ID.Hex()], imported.Assets[0].ID)
+  assert.Equal(t, result.Scope, imported.Assets[0].Scope)
+  assert.Equal(t, asset.Risks, imported.Assets[0].Risks)
+
+  /* The original scope is untouched */
+  assets, _ := asset_utils.GetAssetsByScopeID(ctx, s_id)
+  assert.Equal(t, []Asset{asset}, assets)
+}
+
+func TestScopeBundleInvalid(t *testing.T) {
+  bundle := ScopeBundle{Format: BUNDLE_FORMAT, Version: BUNDLE_VERSION, Scope: Scope{Name: "foo"}}
+  bad := Asset{ID: primitive.NewObjectID(), Name: "bad", Value: Value{Confidentiality: 1, Integrity: 1, Availability: 1},
+                Risks: []Risk{{Possibility: 0, Impact: 1}}}
+  good := Asset{Name: "good", Value: Value{Confidentiality: 1, Integrity: 1, Availability: 1}}
+  bundle.Assets = []Asset{good, bad}
+
+  invalid, err := bundle.Validate()
+  assert.Nil(t, err)
+  assert.Equal(t, []AssetProblems{{Index: 1, ID: bad.ID, Name: "bad", Problems: []string{"risk 1: possibility 0 is not in 1-4"}}}, invalid)
+
+  bundle.Scope.Levels = RiskLevels{Medium: 20, High: 10}
+  _, err = bundle.Validate()
+  assert.NotNil(t, err)
+
+  bundle.Scope = Scope{Name: " "}
+  _, err = bundle.Validate()
+  assert.NotNil(t, err)
+
+  bundle.Version = BUNDLE_VERSION + 1
+  _, err = bundle.Validate()
+  assert.ErrorContains(t, err, "unsupported scope bundle version")
+
+  bundle.Format = "foo"
+  _, err = bundle.Validate()
+  assert.ErrorContains(t, err, "not a scope bundle")
+}
+
+/* The asset utils, which fail to add the assets */
+type failingAssetUtils struct {
+  IAssetUtils
+}
+
+func (utils *failingAssetUtils) AddAssets(ctx context.Context, assets []Asset) (error) {
+  return errors.New("add failed")
+}
+
+func TestImportScopeFailed(t *testing.T) {
+  ctx := context.TODO()
+  db, err := database.OpenBolt(filepath.Join(t.TempDir(), "bundle.db"))
+  assert.Nil(t, err)
+  defer db.Close()
+  scope_utils := &BoltScopeUtils{DB: db}
+  asset_utils := &failingAssetUtils{IAssetUtils: &BoltAssetUtils{DB: db}}
+
+  bundle := ScopeBundle{
+    Format: BUNDLE_FORMAT,
+    Version: BUNDLE_VERSION,
+    Scope: Scope{Name: "bundle"},
+    Assets: []Asset{{ID: primitive.NewObjectID(), Name: "asset"}},
+  }
+  _, err = ImportScope(ctx, scope_utils, asset_utils, &bundle)
+  assert.EqualError(t, err, "add failed")
+
+  /* No scope is left behind */
+  scopes, err := scope_utils.GetScopes(ctx)
+  assert.Nil(t, err)
+  assert.Equal(t, 0, len(scopes))
+}
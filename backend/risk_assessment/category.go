@@ -0,0 +1,43 @@
+package risk_assessment
+
+/* The small categories of each big category of the assets */
+type Category struct {
+  Big string
+  Small []string
+}
+
+/* The same categories as the options of the frontend's config.json */
+var CATEGORIES = []Category{
+  {"Information (or data)", []string{"Information System", "Database"}},
+  {"Intangibles", []string{"Trademarks", "Patents"}},
+  {"People", []string{"System Administrator", "Database Manager"}},
+  {"Hardware", []string{"Server", "Laptop"}},
+  {"Software", []string{"Toolchain", "Operating System"}},
+  {"Services", []string{"Cloud Service", "Internet"}},
+  {"Locations & Buildings", []string{"Office Area", "Electromechanics"}},
+}
+
+/* Whether the small category belongs to the big one */
+func ValidCategory(big string, small string) bool {
+  for _, category := range CATEGORIES {
+    if category.Big != big {
+      continue
+    }
+    for _, s := range category.Small {
+      if s == small {
+        return true
+      }
+    }
+    return false
+  }
+  return false
+}
+
+func validBigCategory(big string) bool {
+  for _, category := range CATEGORIES {
+    if category.Big == big {
+      return true
+    }
+  }
+  return false
+}
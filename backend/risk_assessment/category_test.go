@@ -0,0 +1,45 @@
+package risk_assessment
+
+import (
+  "encoding/json"
+  "os"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestValidCategory(t *testing.T) {
+  assert.True(t, ValidCategory("Hardware", "Server"))
+  assert.False(t, ValidCategory("Hardware", "Database"))
+  assert.False(t, ValidCategory("Furniture", "Desk"))
+  assert.True(t, validBigCategory("People"))
+  assert.False(t, validBigCategory("people"))
+}
+
+/* The categories must be the same as the frontend's */
+func TestCategoriesOfFrontend(t *testing.T) {
+  data, err := os.ReadFile("../../frontend/src/assets/config.json")
+  if err != nil {
+    t.Skip("no frontend config.json")
+  }
+
+  var config struct {
+    BigCategory []struct {
+      Value string `json:"value"`
+      SmallCategory []struct {
+        Value string `json:"value"`
+      }
+    }
+  }
+  assert.Nil(t, json.Unmarshal(data, &config))
+
+  categories := []Category{}
+  for _, big := range config.BigCategory {
+    category := Category{Big: big.Value, Small: []string{}}
+    for _, small := range big.SmallCategory {
+      category.Small = append(category.Small, small.Value)
+    }
+    categories = append(categories, category)
+  }
+  assert.Equal(t, CATEGORIES, categories)
+}
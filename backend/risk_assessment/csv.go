@@ -0,0 +1,267 @@
+package risk_assessment
+
+import (
+  "encoding/csv"
+  "errors"
+  "fmt"
+  "io"
+  "strconv"
+  "strings"
+)
+
+/*
+ * The CSV of the assets has a header row of the column names, which could be
+ * in any order, case and spacing, like "Big Category" or "C".  A row with a
+ * name begins an asset, and the following rows with only the risk columns
+ * add more risks to it, like the merged cells of a spreadsheet:
+ *
+ *   BigCategory,SmallCategory,Name,Owner,C,I,A,Threat,Vulnerability,CurrentControl,Possibility,Impact
+ *   Hardware,Server,web,IT,3,3,2,Power failure,No UPS,,2,3
+ *   ,,,,,,,Disk failure,No RAID,Backup,1,2
+ */
+const (
+  COLUMN_BIG_CATEGORY = "BigCategory"
+  COLUMN_SMALL_CATEGORY = "SmallCategory"
+  COLUMN_NAME = "Name"
+  COLUMN_OWNER = "Owner"
+  COLUMN_CONFIDENTIALITY = "Confidentiality"
+  COLUMN_INTEGRITY = "Integrity"
+  COLUMN_AVAILABILITY = "Availability"
+  COLUMN_THREAT = "Threat"
+  COLUMN_VULNERABILITY = "Vulnerability"
+  COLUMN_CURRENT_CONTROL = "CurrentControl"
+  COLUMN_POSSIBILITY = "Possibility"
+  COLUMN_IMPACT = "Impact"
+)
+
+/* The normalized header names of each column */
+var CSV_COLUMNS = map[string]string{
+  "bigcategory": COLUMN_BIG_CATEGORY,
+  "category": COLUMN_BIG_CATEGORY,
+  "smallcategory": COLUMN_SMALL_CATEGORY,
+  "subcategory": COLUMN_SMALL_CATEGORY,
+  "name": COLUMN_NAME,
+  "asset": COLUMN_NAME,
+  "owner": COLUMN_OWNER,
+  "confidentiality": COLUMN_CONFIDENTIALITY,
+  "c": COLUMN_CONFIDENTIALITY,
+  "integrity": COLUMN_INTEGRITY,
+  "i": COLUMN_INTEGRITY,
+  "availability": COLUMN_AVAILABILITY,
+  "a": COLUMN_AVAILABILITY,
+  "threat": COLUMN_THREAT,
+  "vulnerability": COLUMN_VULNERABILITY,
+  "currentcontrol": COLUMN_CURRENT_CONTROL,
+  "control": COLUMN_CURRENT_CONTROL,
+  "possibility": COLUMN_POSSIBILITY,
+  "impact": COLUMN_IMPACT,
+}
+
+var ASSET_COLUMNS = []string{COLUMN_BIG_CATEGORY, COLUMN_SMALL_CATEGORY, COLUMN_NAME, COLUMN_OWNER,
+                             COLUMN_CONFIDENTIALITY, COLUMN_INTEGRITY, COLUMN_AVAILABILITY}
+
+var RISK_COLUMNS = []string{COLUMN_THREAT, COLUMN_VULNERABILITY, COLUMN_CURRENT_CONTROL,
+                            COLUMN_POSSIBILITY, COLUMN_IMPACT}
+
+/* Every asset column but the owner must be in the header */
+var REQUIRED_COLUMNS = []string{COLUMN_BIG_CATEGORY, COLUMN_SMALL_CATEGORY, COLUMN_NAME,
+                                COLUMN_CONFIDENTIALITY, COLUMN_INTEGRITY, COLUMN_AVAILABILITY}
+
+/* The largest number of the rows in a CSV */
+const MAX_CSV_ROWS = 10000
+
+const (
+  AssetRow = "asset"
+  RiskRow = "risk"
+)
+
+/* The validation of a row, whose line is numbered from 1 for the header */
+type CSVRow struct {
+  Line int
+  Kind string
+  Name string
+  Problems []string
+}
+
+type CSVReport struct {
+  Assets int
+  Risks int
+  /* The columns which are not imported */
+  Ignored []string
+  Rows []CSVRow
+  /* Whether the assets are added */
+  Imported bool
+}
+
+/* Whether any row is invalid */
+func (report *CSVReport) Invalid() bool {
+  for _, row := range report.Rows {
+    if len(row.Problems) > 0 {
+      return true
+    }
+  }
+  return false
+}
+
+func normalizeColumn(name string) string {
+  name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+  return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+}
+
+/* Parse the rating of the column, or tell why it is not one */
+func ParseRating(column string, field string) (uint, string) {
+  rating, err := strconv.ParseUint(field, 10, 32)
+  if err != nil {
+    return 0, fmt.Sprintf("%s %q is not a number", strings.ToLower(column), field)
+  }
+  return uint(rating), ratingProblem(strings.ToLower(column), uint(rating))
+}
+
+/*
+ * Parse and validate the assets of the CSV for the scope, which already has
+ * the existing assets.  An error means the CSV could not be parsed at all,
+ * otherwise the report tells the problems of each row.
+ */
+func ParseAssetsCSV(r io.Reader, existing []Asset) ([]Asset, CSVReport, error) {
+  report := CSVReport{Ignored: []string{}, Rows: []CSVRow{}}
+  assets := []Asset{}
+
+  reader := csv.NewReader(r)
+  reader.FieldsPerRecord = -1
+  reader.TrimLeadingSpace = true
+
+  header, err := reader.Read()
+  if err == io.EOF {
+    return nil, report, errors.New("empty CSV")
+  } else if err != nil {
+    return nil, report, err
+  }
+
+  columns := map[string]int{}
+  for i, name := range header {
+    column, ok := CSV_COLUMNS[normalizeColumn(name)]
+    if !ok {
+      report.Ignored = append(report.Ignored, strings.TrimSpace(name))
+      continue
+    }
+    if _, dup := columns[column]; dup {
+      return nil, report, fmt.Errorf("duplicate column %s", column)
+    }
+    columns[column] = i
+  }
+  for _, column := range REQUIRED_COLUMNS {
+    if _, ok := columns[column]; !ok {
+      return nil, report, fmt.Errorf("missing column %s", column)
+    }
+  }
+
+  /* The lines of the names, where 0 is the stored asset */
+  names := map[string]int{}
+  for _, asset := range existing {
+    names[strings.TrimSpace(asset.Name)] = 0
+  }
+
+  for {
+    record, err := reader.Read()
+    if err == io.EOF {
+      break
+    } else if err != nil {
+      return nil, report, err
+    }
+    line, _ := reader.FieldPos(0)
+    if line - 1 > MAX_CSV_ROWS {
+      return nil, report, fmt.Errorf("more than %d rows", MAX_CSV_ROWS)
+    }
+
+    field := func(column string) string {
+      i, ok := columns[column]
+      if !ok || i >= len(record) {
+        return ""
+      }
+      return strings.TrimSpace(record[i])
+    }
+    filled := func(columns []string) bool {
+      for _, column := range columns {
+        if field(column) != "" {
+          return true
+        }
+      }
+      return false
+    }
+
+    has_asset, has_risk := filled(ASSET_COLUMNS), filled(RISK_COLUMNS)
+    if !has_asset && !has_risk {
+      continue
+    }
+
+    row := CSVRow{Line: line, Kind: AssetRow, Name: field(COLUMN_NAME), Problems: []string{}}
+    if has_asset {
+      asset := Asset{
+        BigCategory: field(COLUMN_BIG_CATEGORY),
+        SmallCategory: field(COLUMN_SMALL_CATEGORY),
+        Name: row.Name,
+        Owner: field(COLUMN_OWNER),
+        Risks: []Risk{},
+      }
+
+      if asset.Name == "" {
+        row.Problems = append(row.Problems, "empty name")
+      } else if prev, dup := names[asset.Name]; dup && prev == 0 {
+        row.Problems = append(row.Problems, fmt.Sprintf("duplicate name %q of an asset in the scope", asset.Name))
+      } else if dup {
+        row.Problems = append(row.Problems, fmt.Sprintf("duplicate name %q of line %d", asset.Name, prev))
+      } else {
+        names[asset.Name] = line
+      }
+
+      if !validBigCategory(asset.BigCategory) {
+        row.Problems = append(row.Problems, fmt.Sprintf("unknown big category %q", asset.BigCategory))
+      } else if !ValidCategory(asset.BigCategory, asset.SmallCategory) {
+        row.Problems = append(row.Problems, fmt.Sprintf("unknown small category %q of %q", asset.SmallCategory, asset.BigCategory))
+      }
+
+      ratings := []*uint{&asset.Value.Confidentiality, &asset.Value.Integrity, &asset.Value.Availability}
+      for i, column := range []string{COLUMN_CONFIDENTIALITY, COLUMN_INTEGRITY, COLUMN_AVAILABILITY} {
+        var problem string
+        if *ratings[i], problem = ParseRating(column, field(column)); problem != "" {
+          row.Problems = append(row.Problems, problem)
+        }
+      }
+
+      assets = append(assets, asset)
+      report.Assets++
+    } else {
+      row.Kind = RiskRow
+      if len(assets) == 0 {
+        row.Problems = append(row.Problems, "a risk without an asset above")
+      } else {
+        row.Name = assets[len(assets) - 1].Name
+      }
+    }
+
+    if has_risk {
+      risk := Risk{
+        Threat: field(COLUMN_THREAT),
+        Vulnerability: field(COLUMN_VULNERABILITY),
+        CurrentControl: field(COLUMN_CURRENT_CONTROL),
+      }
+
+      var problem string
+      if risk.Possibility, problem = ParseRating(COLUMN_POSSIBILITY, field(COLUMN_POSSIBILITY)); problem != "" {
+        row.Problems = append(row.Problems, problem)
+      }
+      if risk.Impact, problem = ParseRating(COLUMN_IMPACT, field(COLUMN_IMPACT)); problem != "" {
+        row.Problems = append(row.Problems, problem)
+      }
+
+      if len(assets) > 0 {
+        last := &assets[len(assets) - 1]
+        last.Risks = append(last.Risks, risk)
+        report.Risks++
+      }
+    }
+
+    report.Rows = append(report.Rows, row)
+  }
+  return assets, report, nil
+}
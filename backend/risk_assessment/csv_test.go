@@ -0,0 +1,79 @@
+package risk_assessment
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestParseAssetsCSV(t *testing.T) {
+  csv := "\ufeffBig Category,small_category,Name,Owner,C,I,A,Threat,Vulnerability,Control,Possibility,Impact,Note\n" +
+         "Hardware,Server,web,IT,3,3,2,Power failure,No UPS,,2,3,foo\n" +
+         ",,,,,,,Disk failure,No RAID,Backup,1,2,\n" +
+         ",,,,,,,,,,,,\n" +
+         "Software,Toolchain,gcc,,1,2,1,,,,,,\n"
+
+  assets, report, err := ParseAssetsCSV(strings.NewReader(csv), nil)
+  assert.Nil(t, err)
+  assert.False(t, report.Invalid())
+  assert.Equal(t, 2, report.Assets)
+  assert.Equal(t, 2, report.Risks)
+  assert.Equal(t, []string{"Note"}, report.Ignored)
+  assert.Equal(t, []CSVRow{
+    {Line: 2, Kind: AssetRow, Name: "web", Problems: []string{}},
+    {Line: 3, Kind: RiskRow, Name: "web", Problems: []string{}},
+    {Line: 5, Kind: AssetRow, Name: "gcc", Problems: []string{}},
+  }, report.Rows)
+
+  assert.Equal(t, 2, len(assets))
+  assert.Equal(t, Asset{
+    BigCategory: "Hardware",
+    SmallCategory: "Server",
+    Name: "web",
+    Owner: "IT",
+    Value: Value{Confidentiality: 3, Integrity: 3, Availability: 2},
+    Risks: []Risk{
+      {Threat: "Power failure", Vulnerability: "No UPS", Possibility: 2, Impact: 3},
+      {Threat: "Disk failure", Vulnerability: "No RAID", CurrentControl: "Backup", Possibility: 1, Impact: 2},
+    },
+  }, assets[0])
+  assert.Equal(t, []Risk{}, assets[1].Risks)
+}
+
+func TestParseAssetsCSVProblems(t *testing.T) {
+  csv := "BigCategory,SmallCategory,Name,C,I,A,Threat,Possibility,Impact\n" +
+         ",,,,,,Flood,1,1\n" +
+         "Foo,Server,web,1,1,1,,,\n" +
+         "Hardware,Toolchain,db,1,5,x,,,\n" +
+         "Hardware,Server,db,1,1,1,Fire,0,2\n" +
+         "Hardware,Server,old,1,1,1,,,\n" +
+         "Hardware,Server,,1,1,1,,,\n"
+  existing := []Asset{{Name: "old"}}
+
+  _, report, err := ParseAssetsCSV(strings.NewReader(csv), existing)
+  assert.Nil(t, err)
+  assert.True(t, report.Invalid())
+  assert.Equal(t, []string{"a risk without an asset above"}, report.Rows[0].Problems)
+  assert.Equal(t, []string{`unknown big category "Foo"`}, report.Rows[1].Problems)
+  assert.Equal(t, []string{`unknown small category "Toolchain" of "Hardware"`,
+                           "integrity 5 is not in 1-4",
+                           `availability "x" is not a number`}, report.Rows[2].Problems)
+  assert.Equal(t, []string{`duplicate name "db" of line 4`, "possibility 0 is not in 1-4"}, report.Rows[3].Problems)
+  assert.Equal(t, []string{`duplicate name "old" of an asset in the scope`}, report.Rows[4].Problems)
+  assert.Equal(t, []string{"empty name"}, report.Rows[5].Problems)
+}
+
+func TestParseAssetsCSVInvalid(t *testing.T) {
+  _, _, err := ParseAssetsCSV(strings.NewReader(""), nil)
+  assert.ErrorContains(t, err, "empty CSV")
+
+  _, _, err = ParseAssetsCSV(strings.NewReader("BigCategory,SmallCategory,Name,C,I\n"), nil)
+  assert.ErrorContains(t, err, "missing column Availability")
+
+  _, _, err = ParseAssetsCSV(strings.NewReader("BigCategory,SmallCategory,Name,C,I,A,Confidentiality\n"), nil)
+  assert.ErrorContains(t, err, "duplicate column Confidentiality")
+
+  _, _, err = ParseAssetsCSV(strings.NewReader("BigCategory,SmallCategory,Name,C,I,A\n\"foo\n"), nil)
+  assert.NotNil(t, err)
+}
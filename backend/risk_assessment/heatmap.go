@@ -0,0 +1,38 @@
+package risk_assessment
+
+/*
+ * The heat map counts the risks in the cells of the possibility and the
+ * impact, where a cell is indexed from 0 for the rating 1.  The level of a
+ * cell is the highest level of its risks, since the score depends on the
+ * asset value too.
+ */
+type HeatMap struct {
+  Counts [MAX_RATING][MAX_RATING]int
+  Levels [MAX_RATING][MAX_RATING]string
+}
+
+var levelOrder = map[string]int{"": 0, LowRisk: 1, MediumRisk: 2, HighRisk: 3}
+
+/* Count the risks with valid ratings of the assets */
+func NewHeatMap(assets []Asset, levels RiskLevels) HeatMap {
+  var heat_map HeatMap
+  for i := range assets {
+    for _, risk := range assets[i].Risks {
+      heat_map.Add(risk.Possibility, risk.Impact, levels.Level(RiskScore(assets[i].Value, risk)))
+    }
+  }
+  return heat_map
+}
+
+/* Add a risk of the level to the cell, unless its ratings are invalid */
+func (heat_map *HeatMap) Add(possibility uint, impact uint, level string) {
+  if !validRating(possibility) || !validRating(impact) {
+    return
+  }
+
+  p, i := possibility - 1, impact - 1
+  heat_map.Counts[p][i]++
+  if levelOrder[level] > levelOrder[heat_map.Levels[p][i]] {
+    heat_map.Levels[p][i] = level
+  }
+}
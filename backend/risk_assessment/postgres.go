@@ -0,0 +1,319 @@
+package risk_assessment
+
+import (
+  "context"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* PGScopeUtils keeps the scopes in PostgreSQL */
+type PGScopeUtils struct {
+  DB *pgxpool.Pool
+}
+
+const pg_scope_columns = "id, create_time, name, level_medium, level_high"
+
+func (utils *PGScopeUtils) AddScope(ctx context.Context, scope *Scope) (primitive.ObjectID, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  scope.ID = primitive.NewObjectID()
+  scope.CreateTime = time.Now().UTC()
+
+  _, err := utils.DB.Exec(ctx, "INSERT INTO scopes (" + pg_scope_columns + ") VALUES ($1, $2, $3, $4, $5)",
+                          scope.ID.Hex(), scope.CreateTime, scope.Name, scope.Levels.Medium, scope.Levels.High)
+  return scope.ID, err
+}
+
+func scanScope(row pgx.CollectableRow) (Scope, error) {
+  var scope Scope
+
+  err := row.Scan(database.PGID(&scope.ID), database.PGTime(&scope.CreateTime), &scope.Name,
+                  &scope.Levels.Medium, &scope.Levels.High)
+  return scope, err
+}
+
+func (utils *PGScopeUtils) findScopes(ctx context.Context, where string, args ...any) ([]Scope, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_scope_columns + " FROM scopes WHERE " + where + " ORDER BY id", args...)
+  return pgx.CollectRows(rows, scanScope)
+}
+
+func (utils *PGScopeUtils) GetScopes(ctx context.Context) ([]Scope, error) {
+  return utils.findScopes(ctx, "true")
+}
+
+func (utils *PGScopeUtils) GetScopeByID(ctx context.Context, id primitive.ObjectID) (Scope, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_scope_columns + " FROM scopes WHERE id = $1", id.Hex())
+  scope, err := pgx.CollectOneRow(rows, scanScope)
+  return scope, database.PGError(err)
+}
+
+func (utils *PGScopeUtils) GetScopeByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Scope, error) {
+  return utils.findScopes(ctx, "id = ANY($1)", database.PGHexes(ids))
+}
+
+func (utils *PGScopeUtils) HasScopeID(ctx context.Context, id primitive.ObjectID) (bool, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  var has bool
+
+  err := utils.DB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM scopes WHERE id = $1)", id.Hex()).Scan(&has)
+  return has, err
+}
+
+/* Replace the stored scope, if there is one */
+func (utils *PGScopeUtils) UpdateScope(ctx context.Context, scope *Scope) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "UPDATE scopes SET create_time = $2, name = $3, level_medium = $4, level_high = $5 WHERE id = $1",
+                          scope.ID.Hex(), scope.CreateTime, scope.Name, scope.Levels.Medium, scope.Levels.High)
+  return err
+}
+
+/* Insert or replace the scope with its own ID, like restoring a backup */
+func (utils *PGScopeUtils) PutScope(ctx context.Context, scope *Scope) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "INSERT INTO scopes (" + pg_scope_columns + ") VALUES ($1, $2, $3, $4, $5) " +
+                          "ON CONFLICT (id) DO UPDATE SET create_time = $2, name = $3, level_medium = $4, level_high = $5",
+                          scope.ID.Hex(), scope.CreateTime, scope.Name, scope.Levels.Medium, scope.Levels.High)
+  return err
+}
+
+/* The trend points are deleted with their scope by the foreign key */
+func (utils *PGScopeUtils) DeleteScope(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "DELETE FROM scopes WHERE id = $1", id.Hex())
+  return err
+}
+
+/* PGAssetUtils keeps the assets and their risks in PostgreSQL */
+type PGAssetUtils struct {
+  DB *pgxpool.Pool
+}
+
+const pg_asset_columns = "id, create_time, scope_id, big_category, small_category, name, owner, " +
+                         "confidentiality, integrity, availability"
+
+/* Replace the asset's risks, keeping their order */
+func insertRisks(ctx context.Context, tx pgx.Tx, asset *Asset) (error) {
+  if _, err := tx.Exec(ctx, "DELETE FROM risks WHERE asset_id = $1", asset.ID.Hex()); err != nil {
+    return err
+  }
+
+  for i, risk := range asset.Risks {
+    _, err := tx.Exec(ctx, "INSERT INTO risks (asset_id, position, threat, vulnerability, current_control, possibility, impact) " +
+                      "VALUES ($1, $2, $3, $4, $5, $6, $7)",
+                      asset.ID.Hex(), i, risk.Threat, risk.Vulnerability, risk.CurrentControl,
+                      risk.Possibility, risk.Impact)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func insertAsset(ctx context.Context, tx pgx.Tx, asset *Asset) (error) {
+  _, err := tx.Exec(ctx, "INSERT INTO assets (" + pg_asset_columns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+                    asset.ID.Hex(), asset.CreateTime, asset.Scope.Hex(), asset.BigCategory, asset.SmallCategory,
+                    asset.Name, asset.Owner, asset.Value.Confidentiality, asset.Value.Integrity,
+                    asset.Value.Availability)
+  if err != nil {
+    return err
+  }
+  return insertRisks(ctx, tx, asset)
+}
+
+func (utils *PGAssetUtils) AddAsset(ctx context.Context, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  newAsset(asset)
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    return insertAsset(ctx, tx, asset)
+  })
+}
+
+func (utils *PGAssetUtils) AddAssets(ctx context.Context, assets []Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    for i := range assets {
+      newAsset(&assets[i])
+      if err := insertAsset(ctx, tx, &assets[i]); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+}
+
+/* The pool, or a transaction */
+type pgQuerier interface {
+  Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+/* Get the assets selected by the query with their risks */
+func (utils *PGAssetUtils) findAssets(ctx context.Context, query string, args ...any) ([]Asset, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return selectAssets(ctx, utils.DB, query, args...)
+}
+
+func selectAssets(ctx context.Context, db pgQuerier, query string, args ...any) ([]Asset, error) {
+  rows, _ := db.Query(ctx, "SELECT " + pg_asset_columns + " FROM assets " + query, args...)
+  assets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Asset, error) {
+    asset := Asset{Risks: []Risk{}}
+    err := row.Scan(database.PGID(&asset.ID), database.PGTime(&asset.CreateTime), database.PGID(&asset.Scope),
+                    &asset.BigCategory, &asset.SmallCategory, &asset.Name, &asset.Owner,
+                    &asset.Value.Confidentiality, &asset.Value.Integrity, &asset.Value.Availability)
+    return asset, err
+  })
+  if err != nil || len(assets) == 0 {
+    return nil, err
+  }
+
+  index := map[primitive.ObjectID]int{}
+  ids := make([]primitive.ObjectID, len(assets))
+  for i := range assets {
+    index[assets[i].ID] = i
+    ids[i] = assets[i].ID
+  }
+
+  var a_id primitive.ObjectID
+  var risk Risk
+
+  rows, _ = db.Query(ctx, "SELECT asset_id, threat, vulnerability, current_control, possibility, impact " +
+                           "FROM risks WHERE asset_id = ANY($1) ORDER BY asset_id, position", database.PGHexes(ids))
+  scans := []any{database.PGID(&a_id), &risk.Threat, &risk.Vulnerability, &risk.CurrentControl,
+                 &risk.Possibility, &risk.Impact}
+  _, err = pgx.ForEachRow(rows, scans, func() error {
+    i := index[a_id]
+    assets[i].Risks = append(assets[i].Risks, risk)
+    return nil
+  })
+  return assets, err
+}
+
+func (utils *PGAssetUtils) GetAssetByID(ctx context.Context, id primitive.ObjectID) (Asset, error) {
+  assets, err := utils.findAssets(ctx, "WHERE id = $1", id.Hex())
+  if err != nil {
+    return Asset{}, err
+  }
+  if len(assets) == 0 {
+    return Asset{}, database.ErrNotFound
+  }
+  return assets[0], nil
+}
+
+func (utils *PGAssetUtils) GetAssetsByScopeID(ctx context.Context, id primitive.ObjectID) ([]Asset, error) {
+  return utils.findAssets(ctx, "WHERE scope_id = $1 ORDER BY id", id.Hex())
+}
+
+/* Zero amount means no limit, like MongoDB */
+func (utils *PGAssetUtils) GetAssets(ctx context.Context, offset int64, amount int64) ([]Asset, error) {
+  var limit any
+
+  if amount > 0 {
+    limit = amount
+  }
+  return utils.findAssets(ctx, "ORDER BY id OFFSET $1 LIMIT $2", offset, limit)
+}
+
+func (utils *PGAssetUtils) SetAssetValue(ctx context.Context, id string, c uint, i uint, a uint) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  a_id, _ := primitive.ObjectIDFromHex(id)
+  _, err := utils.DB.Exec(ctx, "UPDATE assets SET confidentiality = $2, integrity = $3, availability = $4 WHERE id = $1",
+                          a_id.Hex(), c, i, a)
+  return err
+}
+
+/* Replace the stored asset, if there is one */
+func (utils *PGAssetUtils) UpdateAsset(ctx context.Context, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    return updateAsset(ctx, tx, asset)
+  })
+}
+
+func updateAsset(ctx context.Context, tx pgx.Tx, asset *Asset) (error) {
+  tag, err := tx.Exec(ctx, "UPDATE assets SET create_time = $2, scope_id = $3, big_category = $4, small_category = $5, " +
+                      "name = $6, owner = $7, confidentiality = $8, integrity = $9, availability = $10 WHERE id = $1",
+                      asset.ID.Hex(), asset.CreateTime, asset.Scope.Hex(), asset.BigCategory, asset.SmallCategory,
+                      asset.Name, asset.Owner, asset.Value.Confidentiality, asset.Value.Integrity,
+                      asset.Value.Availability)
+  if err != nil || tag.RowsAffected() == 0 {
+    return err
+  }
+  return insertRisks(ctx, tx, asset)
+}
+
+/* The asset row is locked until the replacement, since every update of the asset changes it first */
+func (utils *PGAssetUtils) ReplaceAsset(ctx context.Context, old *Asset, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    stored, err := selectAssets(ctx, tx, "WHERE id = $1 FOR UPDATE", old.ID.Hex())
+    if err != nil {
+      return err
+    } else if len(stored) == 0 || !sameAsset(&stored[0], old) {
+      return ErrAssetChanged
+    }
+    return updateAsset(ctx, tx, asset)
+  })
+}
+
+func (utils *PGAssetUtils) DeleteAsset(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  _, err := utils.DB.Exec(ctx, "DELETE FROM assets WHERE id = $1", id.Hex())
+  return err
+}
+
+/* Insert or replace the asset with its own ID, like restoring a backup */
+func (utils *PGAssetUtils) PutAsset(ctx context.Context, asset *Asset) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  if asset.Risks == nil {
+    asset.Risks = []Risk{}
+  }
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    _, err := tx.Exec(ctx, "INSERT INTO assets (" + pg_asset_columns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) " +
+                      "ON CONFLICT (id) DO UPDATE SET create_time = $2, scope_id = $3, big_category = $4, " +
+                      "small_category = $5, name = $6, owner = $7, confidentiality = $8, integrity = $9, availability = $10",
+                      asset.ID.Hex(), asset.CreateTime, asset.Scope.Hex(), asset.BigCategory, asset.SmallCategory,
+                      asset.Name, asset.Owner, asset.Value.Confidentiality, asset.Value.Integrity,
+                      asset.Value.Availability)
+    if err != nil {
+      return err
+    }
+    return insertRisks(ctx, tx, asset)
+  })
+}
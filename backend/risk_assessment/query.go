@@ -0,0 +1,333 @@
+package risk_assessment
+
+import (
+  "bytes"
+  "context"
+  "sort"
+  "strconv"
+  "strings"
+
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* The orders of the asset listing */
+const (
+  SortByCreateTime = "createtime"
+  SortByName = "name"
+  SortByValue = "value"
+  SortByScore = "score"
+)
+
+var ASSET_SORTS = []string{SortByCreateTime, SortByName, SortByValue, SortByScore}
+
+/*
+ * A page of the assets of a scope.  The empty filters match any asset, and
+ * the value range, the sum of C, I and A, is unbounded at 0.  The Level is
+ * the level of the asset's highest risk score by the Levels, so an asset
+ * without risks has no level.  The assets of the same sort key are in the
+ * order of their IDs, which keeps the pages stable, and zero Limit means no
+ * limit.
+ */
+type AssetQuery struct {
+  Scope primitive.ObjectID
+  BigCategory string
+  SmallCategory string
+  Owner string
+  MinValue uint
+  MaxValue uint
+  Level string
+  Levels RiskLevels
+  NoRisks bool
+  Sort string
+  Descending bool
+  Offset int64
+  Limit int64
+}
+
+/* The page of the assets, and the number of all the matched ones */
+type AssetList struct {
+  Total int64
+  Assets []Asset
+}
+
+/* The highest risk score of the asset, or 0 without risks */
+func MaxRiskScore(asset *Asset) uint {
+  var score uint
+  for _, risk := range asset.Risks {
+    score = max(score, RiskScore(asset.Value, risk))
+  }
+  return score
+}
+
+func (query *AssetQuery) Match(asset *Asset) bool {
+  value := asset.Value.Sum()
+  switch {
+  case asset.Scope != query.Scope:
+  case query.BigCategory != "" && asset.BigCategory != query.BigCategory:
+  case query.SmallCategory != "" && asset.SmallCategory != query.SmallCategory:
+  case query.Owner != "" && asset.Owner != query.Owner:
+  case query.MinValue > 0 && value < query.MinValue:
+  case query.MaxValue > 0 && value > query.MaxValue:
+  case query.NoRisks && len(asset.Risks) > 0:
+  case query.Level != "" && (len(asset.Risks) == 0 || query.Levels.Level(MaxRiskScore(asset)) != query.Level):
+  default:
+    return true
+  }
+  return false
+}
+
+/* Compare the assets by the sort key, where the create time is the default one */
+func (query *AssetQuery) compare(a *Asset, b *Asset) int {
+  switch query.Sort {
+  case SortByName:
+    return strings.Compare(a.Name, b.Name)
+  case SortByValue:
+    return compareUint(a.Value.Sum(), b.Value.Sum())
+  case SortByScore:
+    return compareUint(MaxRiskScore(a), MaxRiskScore(b))
+  }
+  return a.CreateTime.Compare(b.CreateTime)
+}
+
+func compareUint(a uint, b uint) int {
+  if a < b {
+    return -1
+  } else if a > b {
+    return 1
+  }
+  return 0
+}
+
+/* Filter, sort and page the loaded assets */
+func FilterAssets(assets []Asset, query *AssetQuery) AssetList {
+  matched := []Asset{}
+  for i := range assets {
+    if query.Match(&assets[i]) {
+      matched = append(matched, assets[i])
+    }
+  }
+
+  sort.Slice(matched, func(i, j int) bool {
+    order := query.compare(&matched[i], &matched[j])
+    if query.Descending {
+      order = -order
+    }
+    if order != 0 {
+      return order < 0
+    }
+    return bytes.Compare(matched[i].ID[:], matched[j].ID[:]) < 0
+  })
+
+  list := AssetList{Total: int64(len(matched)), Assets: []Asset{}}
+  start := min(max(query.Offset, 0), list.Total)
+  end := list.Total
+  if query.Limit > 0 {
+    end = min(start + query.Limit, end)
+  }
+  list.Assets = append(list.Assets, matched[start:end]...)
+  return list
+}
+
+/* The score ranges of the levels, as the bounds [from, to) where 0 is unbounded */
+func (levels RiskLevels) scoreRange(level string) (uint, uint) {
+  switch level {
+  case LowRisk:
+    return 0, levels.Medium
+  case MediumRisk:
+    return levels.Medium, levels.High
+  }
+  return levels.High, 0
+}
+
+var mongoAssetSorts = map[string]string{
+  SortByCreateTime: "createtime",
+  SortByName: "name",
+  SortByValue: "_value",
+  SortByScore: "_score",
+}
+
+/* Filter, sort and page the assets in MongoDB with the asset value and the highest score computed */
+func (utils *AssetUtils) QueryAssets(ctx context.Context, query *AssetQuery) (AssetList, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  list := AssetList{Assets: []Asset{}}
+
+  filter := bson.M{"scope": query.Scope}
+  if query.BigCategory != "" {
+    filter["bigcategory"] = query.BigCategory
+  }
+  if query.SmallCategory != "" {
+    filter["smallcategory"] = query.SmallCategory
+  }
+  if query.Owner != "" {
+    filter["owner"] = query.Owner
+  }
+  if query.NoRisks {
+    filter["risks.0"] = bson.M{"$exists": false}
+  } else if query.Level != "" {
+    filter["risks.0"] = bson.M{"$exists": true}
+  }
+
+  value := bson.M{"$add": bson.A{"$value.confidentiality", "$value.integrity", "$value.availability"}}
+  score := bson.M{"$max": bson.M{"$map": bson.M{
+    "input": "$risks",
+    "in": bson.M{"$multiply": bson.A{"$_value", "$$this.possibility", "$$this.impact"}},
+  }}}
+
+  computed := bson.M{}
+  if query.MinValue > 0 {
+    computed["_value"] = bson.M{"$gte": query.MinValue}
+  }
+  if query.MaxValue > 0 {
+    computed["_value"] = bson.M{"$gte": query.MinValue, "$lte": query.MaxValue}
+  }
+  if query.Level != "" {
+    from, to := query.Levels.scoreRange(query.Level)
+    computed["_score"] = bson.M{"$gte": from}
+    if to > 0 {
+      computed["_score"] = bson.M{"$gte": from, "$lt": to}
+    }
+  }
+
+  direction := 1
+  if query.Descending {
+    direction = -1
+  }
+  key, ok := mongoAssetSorts[query.Sort]
+  if !ok {
+    key = mongoAssetSorts[SortByCreateTime]
+  }
+  page := bson.A{
+    bson.M{"$sort": bson.D{{Key: key, Value: direction}, {Key: "_id", Value: 1}}},
+    bson.M{"$skip": max(query.Offset, 0)},
+  }
+  if query.Limit > 0 {
+    page = append(page, bson.M{"$limit": query.Limit})
+  }
+  page = append(page, bson.M{"$unset": bson.A{"_value", "_score"}})
+
+  pipeline := bson.A{
+    bson.M{"$match": filter},
+    bson.M{"$set": bson.M{"_value": value}},
+    bson.M{"$set": bson.M{"_score": bson.M{"$ifNull": bson.A{score, 0}}}},
+    bson.M{"$match": computed},
+    bson.M{"$facet": bson.M{
+      "total": bson.A{bson.M{"$count": "count"}},
+      "assets": page,
+    }},
+  }
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  cur, err := coll.Aggregate(ctx, pipeline)
+  if err != nil {
+    return list, err
+  }
+  var results []struct {
+    Total []struct{ Count int64 }
+    Assets []Asset
+  }
+  if err := cur.All(ctx, &results); err != nil || len(results) == 0 {
+    return list, err
+  }
+
+  if len(results[0].Total) > 0 {
+    list.Total = results[0].Total[0].Count
+  }
+  list.Assets = append(list.Assets, results[0].Assets...)
+  return list, nil
+}
+
+/* The embedded database has no query planner, so the scope's assets are filtered in place */
+func (utils *BoltAssetUtils) QueryAssets(ctx context.Context, query *AssetQuery) (AssetList, error) {
+  assets, err := utils.GetAssetsByScopeID(ctx, query.Scope)
+  if err != nil {
+    return AssetList{Assets: []Asset{}}, err
+  }
+  return FilterAssets(assets, query), nil
+}
+
+const pg_asset_value = "(confidentiality + integrity + availability)"
+const pg_asset_score = "(" + pg_asset_value + " * COALESCE((SELECT max(possibility * impact) FROM risks WHERE risks.asset_id = assets.id), 0))"
+const pg_asset_risks = "EXISTS (SELECT 1 FROM risks WHERE risks.asset_id = assets.id)"
+
+/* The names are sorted by their bytes, like MongoDB and Go */
+var pgAssetSorts = map[string]string{
+  SortByCreateTime: "create_time",
+  SortByName: `name COLLATE "C"`,
+  SortByValue: pg_asset_value,
+  SortByScore: pg_asset_score,
+}
+
+/* The WHERE clause of the query with its arguments */
+func pgAssetFilter(query *AssetQuery) (string, []any) {
+  conditions := []string{}
+  args := []any{}
+  add := func(condition string, arg any) {
+    args = append(args, arg)
+    conditions = append(conditions, strings.ReplaceAll(condition, "?", "$" + strconv.Itoa(len(args))))
+  }
+
+  add("scope_id = ?", query.Scope.Hex())
+  if query.BigCategory != "" {
+    add("big_category = ?", query.BigCategory)
+  }
+  if query.SmallCategory != "" {
+    add("small_category = ?", query.SmallCategory)
+  }
+  if query.Owner != "" {
+    add("owner = ?", query.Owner)
+  }
+  if query.MinValue > 0 {
+    add(pg_asset_value + " >= ?", int64(query.MinValue))
+  }
+  if query.MaxValue > 0 {
+    add(pg_asset_value + " <= ?", int64(query.MaxValue))
+  }
+  if query.NoRisks {
+    conditions = append(conditions, "NOT " + pg_asset_risks)
+  }
+  if query.Level != "" {
+    from, to := query.Levels.scoreRange(query.Level)
+    conditions = append(conditions, pg_asset_risks)
+    add(pg_asset_score + " >= ?", int64(from))
+    if to > 0 {
+      add(pg_asset_score + " < ?", int64(to))
+    }
+  }
+  return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+/* Filter, sort and page the assets in PostgreSQL, and load the risks of the page only */
+func (utils *PGAssetUtils) QueryAssets(ctx context.Context, query *AssetQuery) (AssetList, error) {
+  list := AssetList{Assets: []Asset{}}
+  where, args := pgAssetFilter(query)
+
+  count_ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+  if err := utils.DB.QueryRow(count_ctx, "SELECT count(*) FROM assets " + where, args...).Scan(&list.Total); err != nil {
+    return list, err
+  }
+
+  key, ok := pgAssetSorts[query.Sort]
+  if !ok {
+    key = pgAssetSorts[SortByCreateTime]
+  }
+  direction := "ASC"
+  if query.Descending {
+    direction = "DESC"
+  }
+  var limit any
+  if query.Limit > 0 {
+    limit = query.Limit
+  }
+  args = append(args, max(query.Offset, 0), limit)
+  order := " ORDER BY " + key + " " + direction + ", id OFFSET $" + strconv.Itoa(len(args) - 1) + " LIMIT $" + strconv.Itoa(len(args))
+
+  assets, err := utils.findAssets(ctx, where + order, args...)
+  list.Assets = append(list.Assets, assets...)
+  return list, err
+}
@@ -0,0 +1,133 @@
+package risk_assessment
+
+import (
+  "context"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func queryNames(list AssetList) []string {
+  names := []string{}
+  for i := range list.Assets {
+    names = append(names, list.Assets[i].Name)
+  }
+  return names
+}
+
+func TestMaxRiskScore(t *testing.T) {
+  assets := statisticsAssets(primitive.NewObjectID(), primitive.NewObjectID())
+  assert.Equal(t, uint(48), MaxRiskScore(&assets[0]))
+  assert.Equal(t, uint(72), MaxRiskScore(&assets[1]))
+  assert.Equal(t, uint(0), MaxRiskScore(&assets[2]))
+}
+
+func TestFilterAssets(t *testing.T) {
+  s_id := primitive.NewObjectID()
+  assets := statisticsAssets(s_id, primitive.NewObjectID())
+  for i := range assets {
+    assets[i].ID = primitive.NewObjectID()
+  }
+  assets[1].Owner = "alice"
+
+  cases := []struct {
+    query AssetQuery
+    total int64
+    names []string
+  }{
+    {AssetQuery{}, 3, []string{"web", "db", "docs"}},
+    {AssetQuery{Sort: SortByName}, 3, []string{"db", "docs", "web"}},
+    {AssetQuery{Sort: SortByValue, Descending: true}, 3, []string{"db", "web", "docs"}},
+    {AssetQuery{Sort: SortByScore}, 3, []string{"docs", "web", "db"}},
+    {AssetQuery{Sort: SortByName, Offset: 1, Limit: 1}, 3, []string{"docs"}},
+    {AssetQuery{Offset: 5, Limit: 1}, 3, []string{}},
+    {AssetQuery{BigCategory: "Hardware"}, 2, []string{"web", "db"}},
+    {AssetQuery{BigCategory: "Hardware", Owner: "alice"}, 1, []string{"db"}},
+    {AssetQuery{MinValue: 8}, 2, []string{"web", "db"}},
+    {AssetQuery{MinValue: 3, MaxValue: 8}, 2, []string{"web", "docs"}},
+    {AssetQuery{NoRisks: true}, 1, []string{"docs"}},
+    {AssetQuery{Level: HighRisk}, 2, []string{"web", "db"}},
+    {AssetQuery{Level: LowRisk}, 0, []string{}},
+    /* The levels of the scope */
+    {AssetQuery{Level: MediumRisk, Levels: RiskLevels{Medium: 40, High: 50}}, 1, []string{"web"}},
+  }
+  for _, tc := range cases {
+    tc.query.Scope = s_id
+    if !tc.query.Levels.IsValid() {
+      tc.query.Levels = DEFAULT_RISK_LEVELS
+    }
+    list := FilterAssets(assets, &tc.query)
+    assert.Equal(t, tc.total, list.Total, tc.query)
+    assert.Equal(t, tc.names, queryNames(list), tc.query)
+  }
+}
+
+func TestQueryAssets(t *testing.T) {
+  runAssetUtils(t, testQueryAssets)
+}
+
+func testQueryAssets(t *testing.T, asset_utils IAssetUtils) {
+  ctx := context.TODO()
+  s_id := primitive.NewObjectID()
+  for _, asset := range statisticsAssets(s_id, primitive.NewObjectID()) {
+    asset.Owner = "bob"
+    assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+  }
+  more := []Asset{
+    {Scope: s_id, BigCategory: "Hardware", Name: "Web", Owner: "alice", Value: Value{Confidentiality: 3, Integrity: 3, Availability: 2}},
+    {Scope: s_id, BigCategory: "Data", Name: "logs", Value: Value{Confidentiality: 2, Integrity: 1, Availability: 1},
+     Risks: []Risk{{Threat: "Leak", Possibility: 1, Impact: 1}, {Threat: "Loss", Possibility: 3, Impact: 2}}},
+  }
+  for _, asset := range more {
+    assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+  }
+  stored, err := asset_utils.GetAssetsByScopeID(ctx, s_id)
+  assert.Nil(t, err)
+
+  /* Every backend pages the same assets as the loaded ones */
+  for _, query := range []AssetQuery{
+    {},
+    {Limit: 2},
+    {Offset: 2, Limit: 2},
+    {Offset: 10, Limit: 2},
+    {Sort: SortByName},
+    {Sort: SortByName, Descending: true, Limit: 3},
+    {Sort: SortByValue},
+    {Sort: SortByValue, Descending: true},
+    {Sort: SortByScore},
+    {Sort: SortByScore, Descending: true, Offset: 1, Limit: 2},
+    {BigCategory: "Hardware"},
+    {BigCategory: "Hardware", SmallCategory: "none"},
+    {Owner: "alice"},
+    {MinValue: 5},
+    {MaxValue: 8},
+    {MinValue: 8, MaxValue: 8, Sort: SortByName},
+    {NoRisks: true},
+    {Level: LowRisk},
+    {Level: MediumRisk},
+    {Level: HighRisk, Sort: SortByScore},
+    {Level: MediumRisk, Levels: RiskLevels{Medium: 10, High: 60}},
+    {Level: HighRisk, NoRisks: true},
+  } {
+    query.Scope = s_id
+    if !query.Levels.IsValid() {
+      query.Levels = DEFAULT_RISK_LEVELS
+    }
+    list, err := asset_utils.QueryAssets(ctx, &query)
+    assert.Nil(t, err)
+    expected := FilterAssets(stored, &query)
+    assert.Equal(t, expected.Total, list.Total, query)
+    assert.Equal(t, queryNames(expected), queryNames(list), query)
+  }
+
+  list, err := asset_utils.QueryAssets(ctx, &AssetQuery{Scope: s_id, Owner: "alice"})
+  assert.Nil(t, err)
+  assert.Equal(t, int64(1), list.Total)
+  assert.Equal(t, "Web", list.Assets[0].Name)
+  assert.Equal(t, []Risk{}, list.Assets[0].Risks)
+
+  list, err = asset_utils.QueryAssets(ctx, &AssetQuery{Scope: primitive.NewObjectID()})
+  assert.Nil(t, err)
+  assert.Equal(t, AssetList{Total: 0, Assets: []Asset{}}, list)
+}
@@ -7,23 +7,29 @@ import (
   "go.mongodb.org/mongo-driver/bson"
   "go.mongodb.org/mongo-driver/bson/primitive"
   "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
 
   "github.com/starnight/riskassessment/backend/config"
+  "github.com/starnight/riskassessment/backend/database"
 )
 
 type Scope struct {
   ID primitive.ObjectID `bson:"_id"`
   CreateTime time.Time
   Name string `binding:"required"`
+  Levels RiskLevels
 }
 
 type IScopeUtils interface {
-  AddScope(scope *Scope) (primitive.ObjectID, error)
-  GetScopes() ([]Scope, error)
-  GetScopeByID(id primitive.ObjectID) (Scope, error)
-  GetScopeByIDs(ids []primitive.ObjectID) ([]Scope, error)
-  HasScopeID(id primitive.ObjectID) (bool, error)
-  UpdateScope(scope *Scope) (error)
+  AddScope(ctx context.Context, scope *Scope) (primitive.ObjectID, error)
+  GetScopes(ctx context.Context) ([]Scope, error)
+  GetScopeByID(ctx context.Context, id primitive.ObjectID) (Scope, error)
+  GetScopeByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Scope, error)
+  HasScopeID(ctx context.Context, id primitive.ObjectID) (bool, error)
+  UpdateScope(ctx context.Context, scope *Scope) (error)
+  PutScope(ctx context.Context, scope *Scope) (error)
+  /* Delete the scope with its trend points, its assets are left to the caller */
+  DeleteScope(ctx context.Context, id primitive.ObjectID) (error)
 }
 
 type ScopeUtils struct {
@@ -33,64 +39,108 @@ type ScopeUtils struct {
 var SCOPE_MONGO_DB string = config.DB_NAME
 const SCOPE_COLLECTION = "scopes"
 
-func (utils *ScopeUtils) AddScope(scope *Scope) (primitive.ObjectID, error) {
+func (utils *ScopeUtils) AddScope(ctx context.Context, scope *Scope) (primitive.ObjectID, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   scope.ID = primitive.NewObjectID()
   scope.CreateTime = time.Now().UTC()
 
   coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
-  res, err := coll.InsertOne(context.TODO(), scope)
-  id := res.InsertedID.(primitive.ObjectID)
-  return id, err
+  res, err := coll.InsertOne(ctx, scope)
+  if err != nil {
+    return primitive.NilObjectID, err
+  }
+  return res.InsertedID.(primitive.ObjectID), nil
 }
 
-func (utils *ScopeUtils) GetScopes() ([]Scope, error) {
+func (utils *ScopeUtils) GetScopes(ctx context.Context) ([]Scope, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var scopes []Scope
 
   coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
   filter := bson.D{{}}
-  cur, err := coll.Find(context.TODO(), filter)
+  cur, err := coll.Find(ctx, filter)
   if err != nil {
     return scopes, err
   }
 
-  err = cur.All(context.TODO(), &scopes)
+  err = cur.All(ctx, &scopes)
   return scopes, err
 }
 
-func (utils *ScopeUtils) GetScopeByID(id primitive.ObjectID) (Scope, error) {
+func (utils *ScopeUtils) GetScopeByID(ctx context.Context, id primitive.ObjectID) (Scope, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var scope Scope
 
   coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
   filter := bson.D{{ "_id", id }}
-  err := coll.FindOne(context.TODO(), filter).Decode(&scope)
+  err := coll.FindOne(ctx, filter).Decode(&scope)
   return scope, err
 }
 
-func (utils *ScopeUtils) GetScopeByIDs(ids []primitive.ObjectID) ([]Scope, error) {
+func (utils *ScopeUtils) GetScopeByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Scope, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   var scopes []Scope
 
   coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
   filter := bson.M{"_id": bson.M{"$in": ids}}
-  cur, err := coll.Find(context.TODO(), filter)
+  cur, err := coll.Find(ctx, filter)
   if err != nil {
     return scopes, err
   }
 
-  err = cur.All(context.TODO(), &scopes)
+  err = cur.All(ctx, &scopes)
   return scopes, err
 }
 
-func (utils *ScopeUtils) HasScopeID(id primitive.ObjectID) (bool, error) {
+func (utils *ScopeUtils) HasScopeID(ctx context.Context, id primitive.ObjectID) (bool, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
   filter := bson.D{{"_id", id}}
-  count, err := coll.CountDocuments(context.TODO(), filter)
+  count, err := coll.CountDocuments(ctx, filter)
   return count > 0, err
 }
 
-func (utils *ScopeUtils) UpdateScope(scope *Scope) (error) {
+func (utils *ScopeUtils) UpdateScope(ctx context.Context, scope *Scope) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
   filter := bson.D{{ "_id", scope.ID }}
 
   coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
-  _, err := coll.ReplaceOne(context.TODO(), filter, scope)
+  _, err := coll.ReplaceOne(ctx, filter, scope)
+  return err
+}
+
+/* Insert or replace the scope with its own ID, like restoring a backup */
+func (utils *ScopeUtils) PutScope(ctx context.Context, scope *Scope) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
+  _, err := coll.ReplaceOne(ctx, bson.M{"_id": scope.ID}, scope, options.Replace().SetUpsert(true))
+  return err
+}
+
+func (utils *ScopeUtils) DeleteScope(ctx context.Context, id primitive.ObjectID) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  coll := utils.DB_Client.Database(SCOPE_MONGO_DB).Collection(SCOPE_COLLECTION)
+  if _, err := coll.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+    return err
+  }
+
+  coll = utils.DB_Client.Database(ASSET_MONGO_DB).Collection(TREND_COLLECTION)
+  _, err := coll.DeleteMany(ctx, bson.M{"scope": id})
   return err
 }
@@ -1,59 +1,130 @@
 package risk_assessment
 
 import (
+  "context"
   "testing"
+  "time"
   "github.com/stretchr/testify/assert"
   "go.mongodb.org/mongo-driver/bson/primitive"
-
-  "github.com/starnight/riskassessment/backend/database"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var scope_utils = ScopeUtils{
-  DB_Client: database.ConnectDB(database.GetDBStr("")),
+func runScopeUtils(t *testing.T, test func(t *testing.T, scope_utils IScopeUtils)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, &ScopeUtils{DB_Client: mongo_client})
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, &BoltScopeUtils{DB: bolt_db}) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, &PGScopeUtils{DB: pg_db})
+  })
 }
 
 func TestAddScope(t *testing.T) {
+  runScopeUtils(t, testAddScope)
+}
+
+func testAddScope(t *testing.T, scope_utils IScopeUtils) {
   scopes := []Scope {{Name: "test1"}, {Name: "test2"}}
 
   /* Add Scopes */
-  id1, err1 := scope_utils.AddScope(&scopes[0])
+  id1, err1 := scope_utils.AddScope(context.TODO(), &scopes[0])
   assert.Nil(t, err1)
   assert.True(t, id1.Hex() != "")
 
-  id2, err2 := scope_utils.AddScope(&scopes[1])
+  id2, err2 := scope_utils.AddScope(context.TODO(), &scopes[1])
   assert.Nil(t, err2)
   assert.True(t, id2.Hex() != "")
 
   /* Get Scope by ID */
-  get_scope, err3 := scope_utils.GetScopeByID(id1)
+  get_scope, err3 := scope_utils.GetScopeByID(context.TODO(), id1)
   assert.Nil(t, err3)
   assert.Equal(t, scopes[0].Name, get_scope.Name)
 
   /* Get Scopes by IDs */
   ids := []primitive.ObjectID{id1, id2}
-  get_scopes, err4 := scope_utils.GetScopeByIDs(ids)
+  get_scopes, err4 := scope_utils.GetScopeByIDs(context.TODO(), ids)
   assert.Nil(t, err4)
   assert.Equal(t, len(ids), len(get_scopes))
   assert.Equal(t, scopes[0].Name, get_scopes[0].Name)
   assert.Equal(t, scopes[1].Name, get_scopes[1].Name)
 
   /* Get all Scopes */
-  new_get_scopes, err5 := scope_utils.GetScopes()
+  new_get_scopes, err5 := scope_utils.GetScopes(context.TODO())
   assert.Nil(t, err5)
   assert.Equal(t, get_scopes, new_get_scopes)
 
   /* Has Scope ID */
-  has, err6 := scope_utils.HasScopeID(id1)
+  has, err6 := scope_utils.HasScopeID(context.TODO(), id1)
   assert.Nil(t, err6)
   assert.True(t, has)
 
   /* Update a Scope */
   scope := get_scopes[0]
   scope.Name = "new test1"
-  err7 := scope_utils.UpdateScope(&scope)
+  err7 := scope_utils.UpdateScope(context.TODO(), &scope)
   assert.Nil(t, err7)
 
   ids = []primitive.ObjectID{scope.ID}
-  new_scopes, _ := scope_utils.GetScopeByIDs(ids)
+  new_scopes, _ := scope_utils.GetScopeByIDs(context.TODO(), ids)
   assert.Equal(t, scope, new_scopes[0])
 }
+
+func TestAddScopeFailed(t *testing.T) {
+  /* Nothing listens on the port, so the insert fails instead of panicking */
+  opts := options.Client().ApplyURI("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100")
+  client, err := mongo.Connect(context.TODO(), opts)
+  assert.Nil(t, err)
+  defer client.Disconnect(context.TODO())
+
+  scope_utils := ScopeUtils{DB_Client: client}
+  id, err := scope_utils.AddScope(context.TODO(), &Scope{Name: "test"})
+  assert.NotNil(t, err)
+  assert.True(t, id.IsZero())
+}
+
+func TestPutScope(t *testing.T) {
+  runScopeUtils(t, testPutScope)
+}
+
+func testPutScope(t *testing.T, scope_utils IScopeUtils) {
+  /* A restored scope keeps its ID and create time */
+  scope := Scope{
+    ID: primitive.NewObjectID(),
+    CreateTime: time.Now().UTC().Truncate(time.Millisecond),
+    Name: "put",
+    Levels: RiskLevels{Medium: 10, High: 20},
+  }
+  assert.Nil(t, scope_utils.PutScope(context.TODO(), &scope))
+
+  get_scope, err := scope_utils.GetScopeByID(context.TODO(), scope.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, scope, get_scope)
+
+  /* Put the same scope again replaces it */
+  scope.Name = "new put"
+  assert.Nil(t, scope_utils.PutScope(context.TODO(), &scope))
+  get_scope, err = scope_utils.GetScopeByID(context.TODO(), scope.ID)
+  assert.Nil(t, err)
+  assert.Equal(t, scope, get_scope)
+}
+
+func TestDeleteScope(t *testing.T) {
+  runScopeUtils(t, testDeleteScope)
+}
+
+func testDeleteScope(t *testing.T, scope_utils IScopeUtils) {
+  scope := Scope{Name: "delete"}
+  s_id, err := scope_utils.AddScope(context.TODO(), &scope)
+  assert.Nil(t, err)
+
+  assert.Nil(t, scope_utils.DeleteScope(context.TODO(), s_id))
+  has, err := scope_utils.HasScopeID(context.TODO(), s_id)
+  assert.Nil(t, err)
+  assert.False(t, has)
+
+  /* Deleting a missing scope is fine */
+  assert.Nil(t, scope_utils.DeleteScope(context.TODO(), s_id))
+}
@@ -0,0 +1,52 @@
+package risk_assessment
+
+/*
+ * The asset value is the sum of its C, I and A levels, and the score of a
+ * risk is the asset value multiplied by the risk's possibility and impact.
+ * It is the same calculation as the risk column in RiskAssessmentView.
+ */
+
+const (
+  LowRisk = "low"
+  MediumRisk = "medium"
+  HighRisk = "high"
+)
+
+/* A risk with the score not less than High is high, Medium is medium */
+type RiskLevels struct {
+  Medium uint
+  High uint
+}
+
+var DEFAULT_RISK_LEVELS = RiskLevels{ Medium: 24, High: 48 }
+
+var RISK_LEVEL_NAMES = []string{LowRisk, MediumRisk, HighRisk}
+
+func (v Value) Sum() uint {
+  return v.Confidentiality + v.Integrity + v.Availability
+}
+
+func RiskScore(value Value, risk Risk) uint {
+  return value.Sum() * risk.Possibility * risk.Impact
+}
+
+func (levels RiskLevels) Level(score uint) string {
+  if score >= levels.High {
+    return HighRisk
+  } else if score >= levels.Medium {
+    return MediumRisk
+  }
+  return LowRisk
+}
+
+func (levels RiskLevels) IsValid() bool {
+  return levels.Medium > 0 && levels.Medium < levels.High
+}
+
+/* The thresholds of the scope, or the default ones if it has none */
+func (scope *Scope) RiskLevels() RiskLevels {
+  if scope.Levels.IsValid() {
+    return scope.Levels
+  }
+  return DEFAULT_RISK_LEVELS
+}
@@ -0,0 +1,62 @@
+package risk_assessment
+
+import (
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestRiskScore(t *testing.T) {
+  value := Value{ Confidentiality: 1, Integrity: 2, Availability: 3 }
+  risk := Risk{ Possibility: 2, Impact: 4 }
+
+  assert.Equal(t, uint(6), value.Sum())
+  assert.Equal(t, uint(48), RiskScore(value, risk))
+}
+
+func TestRiskLevels(t *testing.T) {
+  levels := RiskLevels{ Medium: 10, High: 20 }
+
+  assert.Equal(t, LowRisk, levels.Level(9))
+  assert.Equal(t, MediumRisk, levels.Level(10))
+  assert.Equal(t, MediumRisk, levels.Level(19))
+  assert.Equal(t, HighRisk, levels.Level(20))
+
+  scope := Scope{ Levels: levels }
+  assert.Equal(t, levels, scope.RiskLevels())
+
+  /* Fall back to the default levels */
+  scope.Levels = RiskLevels{ Medium: 20, High: 10 }
+  assert.Equal(t, DEFAULT_RISK_LEVELS, scope.RiskLevels())
+  scope.Levels = RiskLevels{}
+  assert.Equal(t, DEFAULT_RISK_LEVELS, scope.RiskLevels())
+}
+
+func TestHeatMap(t *testing.T) {
+  assets := []Asset{
+    {
+      Value: Value{ Confidentiality: 1, Integrity: 1, Availability: 1 },
+      Risks: []Risk{ { Possibility: 2, Impact: 4 }, { Possibility: 5, Impact: 1 } },
+    },
+    {
+      Value: Value{ Confidentiality: 4, Integrity: 4, Availability: 4 },
+      Risks: []Risk{ { Possibility: 2, Impact: 4 }, { Possibility: 1, Impact: 1 } },
+    },
+  }
+
+  heat_map := NewHeatMap(assets, DEFAULT_RISK_LEVELS)
+  assert.Equal(t, 2, heat_map.Counts[1][3])
+  /* The cell has the highest level of its risks: 3 × 8 and 12 × 8 */
+  assert.Equal(t, HighRisk, heat_map.Levels[1][3])
+  assert.Equal(t, 1, heat_map.Counts[0][0])
+  assert.Equal(t, LowRisk, heat_map.Levels[0][0])
+  assert.Equal(t, "", heat_map.Levels[3][0])
+
+  /* The invalid possibility 5 is not counted */
+  total := 0
+  for p := range heat_map.Counts {
+    for i := range heat_map.Counts[p] {
+      total += heat_map.Counts[p][i]
+    }
+  }
+  assert.Equal(t, 3, total)
+}
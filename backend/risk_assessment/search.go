@@ -0,0 +1,272 @@
+package risk_assessment
+
+import (
+  "bytes"
+  "context"
+  "sort"
+  "strings"
+  "unicode"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* A risk of the found asset which has the searched text, where Index is its position from 0 */
+type MatchedRisk struct {
+  Index int
+  Risk Risk
+}
+
+/*
+ * An asset which has the searched text, with its risks which have it too.
+ * The Risks are empty if only the asset's own fields have the text.
+ */
+type SearchResult struct {
+  Asset Asset
+  Risks []MatchedRisk
+  Score float64
+}
+
+type ISearchUtils interface {
+  SearchAssets(ctx context.Context, scopes []primitive.ObjectID, text string, limit int) ([]SearchResult, error)
+}
+
+/* The fields of the text index, as the bson names of the assets */
+var SEARCH_FIELDS = []string{
+  "name", "owner", "bigcategory", "smallcategory",
+  "risks.threat", "risks.vulnerability", "risks.currentcontrol",
+}
+
+/*
+ * The text search of MongoDB, parsed the same way:  the "quoted phrases" must
+ * all be in the asset, the -words must not, and any of the other words is
+ * enough without phrases.  The words are matched whole and the phrases as
+ * substrings, both ignoring the case.
+ */
+type SearchText struct {
+  Words []string
+  Phrases []string
+  Excluded []string
+}
+
+/* The words of the text, split by the spaces and the punctuation, in lower case */
+func searchWords(text string) []string {
+  return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+    return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+  })
+}
+
+func ParseSearchText(text string) SearchText {
+  search := SearchText{Words: []string{}, Phrases: []string{}, Excluded: []string{}}
+  parts := strings.Split(text, `"`)
+  for i, part := range parts {
+    /* The odd parts are between the quotes, except an unclosed last one */
+    if i % 2 == 1 && i < len(parts) - 1 {
+      if phrase := strings.TrimSpace(strings.ToLower(part)); phrase != "" {
+        search.Phrases = append(search.Phrases, phrase)
+      }
+      continue
+    }
+    for _, field := range strings.Fields(part) {
+      if strings.HasPrefix(field, "-") {
+        search.Excluded = append(search.Excluded, searchWords(field)...)
+      } else {
+        search.Words = append(search.Words, searchWords(field)...)
+      }
+    }
+  }
+  return search
+}
+
+/* Nothing can be found without words or phrases */
+func (search *SearchText) IsEmpty() bool {
+  return len(search.Words) == 0 && len(search.Phrases) == 0
+}
+
+/* The number of the words and the phrases in the texts */
+func (search *SearchText) count(texts ...string) (int, int) {
+  var words, phrases int
+  for _, text := range texts {
+    for _, word := range searchWords(text) {
+      for _, w := range search.Words {
+        if word == w {
+          words++
+        }
+      }
+    }
+    for _, phrase := range search.Phrases {
+      if strings.Contains(strings.ToLower(text), phrase) {
+        phrases++
+      }
+    }
+  }
+  return words, phrases
+}
+
+func riskTexts(risk *Risk) []string {
+  return []string{risk.Threat, risk.Vulnerability, risk.CurrentControl}
+}
+
+/* The risks of the asset with any of the words or the phrases */
+func (search *SearchText) matchedRisks(asset *Asset) []MatchedRisk {
+  risks := []MatchedRisk{}
+  for i := range asset.Risks {
+    if words, phrases := search.count(riskTexts(&asset.Risks[i])...); words + phrases > 0 {
+      risks = append(risks, MatchedRisk{Index: i, Risk: asset.Risks[i]})
+    }
+  }
+  return risks
+}
+
+/* The asset's result, or false if the asset does not have the text */
+func (search *SearchText) Match(asset *Asset) (SearchResult, bool) {
+  texts := []string{asset.Name, asset.Owner, asset.BigCategory, asset.SmallCategory}
+  for i := range asset.Risks {
+    texts = append(texts, riskTexts(&asset.Risks[i])...)
+  }
+
+  excluded := SearchText{Words: search.Excluded}
+  if words, _ := excluded.count(texts...); words > 0 {
+    return SearchResult{}, false
+  }
+  for _, phrase := range search.Phrases {
+    phrase := SearchText{Phrases: []string{phrase}}
+    if _, phrases := phrase.count(texts...); phrases == 0 {
+      return SearchResult{}, false
+    }
+  }
+  words, phrases := search.count(texts...)
+  if words + phrases == 0 {
+    return SearchResult{}, false
+  }
+  return SearchResult{Asset: *asset, Risks: search.matchedRisks(asset), Score: float64(words + phrases)}, true
+}
+
+/* Search the loaded assets, the highest scores first and then by the IDs; zero limit means no limit */
+func SearchAssets(assets []Asset, text string, limit int) []SearchResult {
+  results := []SearchResult{}
+  search := ParseSearchText(text)
+  if search.IsEmpty() {
+    return results
+  }
+  for i := range assets {
+    if result, ok := search.Match(&assets[i]); ok {
+      results = append(results, result)
+    }
+  }
+
+  sort.SliceStable(results, func(i, j int) bool {
+    if results[i].Score != results[j].Score {
+      return results[i].Score > results[j].Score
+    }
+    return bytes.Compare(results[i].Asset.ID[:], results[j].Asset.ID[:]) < 0
+  })
+  if limit > 0 && len(results) > limit {
+    results = results[:limit]
+  }
+  return results
+}
+
+/*
+ * The text index of the assets.  The language is none, which matches the
+ * words as they are without stemming and stop words, since the assessments
+ * are not always in English.
+ */
+func EnsureSearchIndex(ctx context.Context, coll *mongo.Collection) (error) {
+  keys := bson.D{}
+  for _, field := range SEARCH_FIELDS {
+    keys = append(keys, bson.E{Key: field, Value: "text"})
+  }
+  index := mongo.IndexModel{
+    Keys: keys,
+    Options: options.Index().SetName("search").SetDefaultLanguage("none"),
+  }
+  _, err := coll.Indexes().CreateOne(ctx, index)
+  return err
+}
+
+/*
+ * Search the assets of the scopes with the text index, the best text scores
+ * first.  MongoDB does not tell which risks matched, so they are found again
+ * in the results.
+ */
+func (utils *AssetUtils) SearchAssets(ctx context.Context, scopes []primitive.ObjectID, text string, limit int) ([]SearchResult, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  results := []SearchResult{}
+  search := ParseSearchText(text)
+  if search.IsEmpty() || len(scopes) == 0 {
+    return results, nil
+  }
+
+  score := bson.M{"$meta": "textScore"}
+  pipeline := bson.A{
+    bson.M{"$match": bson.M{"$text": bson.M{"$search": text}, "scope": bson.M{"$in": scopes}}},
+    bson.M{"$sort": bson.D{{Key: "_score", Value: score}, {Key: "_id", Value: 1}}},
+  }
+  if limit > 0 {
+    pipeline = append(pipeline, bson.M{"$limit": limit})
+  }
+  pipeline = append(pipeline, bson.M{"$set": bson.M{"_score": score}})
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  cur, err := coll.Aggregate(ctx, pipeline)
+  if err != nil {
+    return results, err
+  }
+  var found []struct {
+    Asset `bson:",inline"`
+    Score float64 `bson:"_score"`
+  }
+  if err := cur.All(ctx, &found); err != nil {
+    return results, err
+  }
+
+  for i := range found {
+    results = append(results, SearchResult{
+      Asset: found[i].Asset,
+      Risks: search.matchedRisks(&found[i].Asset),
+      Score: found[i].Score,
+    })
+  }
+  return results, nil
+}
+
+/* The embedded database has no text index, so the scopes' assets are searched in place */
+func (utils *BoltAssetUtils) SearchAssets(ctx context.Context, scopes []primitive.ObjectID, text string, limit int) ([]SearchResult, error) {
+  wanted := map[primitive.ObjectID]bool{}
+  for _, id := range scopes {
+    wanted[id] = true
+  }
+
+  var assets []Asset
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var err error
+    assets, err = database.BoltFind(tx, ASSET_COLLECTION, func(asset *Asset) bool {
+      return wanted[asset.Scope]
+    })
+    return err
+  })
+  if err != nil {
+    return []SearchResult{}, err
+  }
+  return SearchAssets(assets, text, limit), nil
+}
+
+/* The scopes' assets are loaded with their risks and searched like the embedded database */
+func (utils *PGAssetUtils) SearchAssets(ctx context.Context, scopes []primitive.ObjectID, text string, limit int) ([]SearchResult, error) {
+  if len(scopes) == 0 {
+    return []SearchResult{}, nil
+  }
+  assets, err := utils.findAssets(ctx, "WHERE scope_id = ANY($1) ORDER BY id", database.PGHexes(scopes))
+  if err != nil {
+    return []SearchResult{}, err
+  }
+  return SearchAssets(assets, text, limit), nil
+}
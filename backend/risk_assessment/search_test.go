@@ -0,0 +1,142 @@
+package risk_assessment
+
+import (
+  "context"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func searchAssets(s1 primitive.ObjectID, s2 primitive.ObjectID, s3 primitive.ObjectID) []Asset {
+  return []Asset{
+    {
+      Scope: s1, BigCategory: "Hardware", SmallCategory: "Server", Name: "file server", Owner: "IT",
+      Risks: []Risk{
+        {Threat: "Ransomware", Vulnerability: "Unpatched SMB", CurrentControl: "Backup"},
+        {Threat: "Power failure", CurrentControl: "UPS"},
+      },
+    },
+    {
+      Scope: s1, BigCategory: "Hardware", SmallCategory: "Endpoint", Name: "laptop", Owner: "Sales",
+      Risks: []Risk{{Threat: "Theft", CurrentControl: "VPN and disk encryption"}},
+    },
+    {
+      Scope: s1, BigCategory: "Network", Name: "VPN gateway",
+      Risks: []Risk{{Threat: "Brute force", Vulnerability: "Weak passwords", CurrentControl: "MFA"}},
+    },
+    {
+      Scope: s2, BigCategory: "Software", Name: "mail",
+      Risks: []Risk{{Threat: "Phishing"}, {Threat: "RANSOMWARE", CurrentControl: "VPN, EDR"}},
+    },
+    {
+      Scope: s3, BigCategory: "Software", Name: "ransomware honeypot",
+      Risks: []Risk{{Threat: "Ransomware"}},
+    },
+  }
+}
+
+/* The found assets by their names, with the indexes of the matched risks */
+func searchMatches(t *testing.T, results []SearchResult) map[string][]int {
+  matches := map[string][]int{}
+  for i := range results {
+    indexes := []int{}
+    for _, risk := range results[i].Risks {
+      indexes = append(indexes, risk.Index)
+      assert.Equal(t, results[i].Asset.Risks[risk.Index], risk.Risk)
+    }
+    matches[results[i].Asset.Name] = indexes
+  }
+  return matches
+}
+
+func TestParseSearchText(t *testing.T) {
+  assert.Equal(t, SearchText{
+    Words: []string{"vpn", "remote", "desktop"},
+    Phrases: []string{"disk encryption"},
+    Excluded: []string{"backup"},
+  }, ParseSearchText(`VPN remote-desktop "Disk Encryption " -backup`))
+
+  /* Only excluded words find nothing, and an unclosed quote is not a phrase */
+  search := ParseSearchText(`"" -vpn`)
+  assert.True(t, search.IsEmpty())
+  assert.Equal(t, []string{"vpn"}, search.Excluded)
+  search = ParseSearchText(`"ups`)
+  assert.Equal(t, []string{"ups"}, search.Words)
+  assert.Equal(t, []string{}, search.Phrases)
+}
+
+var search_cases = []struct {
+  text string
+  matches map[string][]int
+}{
+  {"ransomware", map[string][]int{"file server": {0}, "mail": {1}}},
+  {"VPN", map[string][]int{"laptop": {0}, "VPN gateway": {}, "mail": {1}}},
+  {"vpn -ransomware", map[string][]int{"laptop": {0}, "VPN gateway": {}}},
+  {"ups passwords", map[string][]int{"file server": {1}, "VPN gateway": {0}}},
+  {`"disk encryption"`, map[string][]int{"laptop": {0}}},
+  {`"power failure" backup`, map[string][]int{"file server": {0, 1}}},
+  {"sales", map[string][]int{"laptop": {}}},
+  {"endpoint", map[string][]int{"laptop": {}}},
+  {"ransom", map[string][]int{}},
+  {"-vpn", map[string][]int{}},
+}
+
+func TestSearchAssets(t *testing.T) {
+  s1, s2, s3 := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+  assets := searchAssets(s1, s2, s3)[:4]
+  for i := range assets {
+    assets[i].ID = primitive.NewObjectID()
+  }
+
+  for _, tc := range search_cases {
+    assert.Equal(t, tc.matches, searchMatches(t, SearchAssets(assets, tc.text, 0)), tc.text)
+  }
+
+  /* The more matched words first */
+  results := SearchAssets(assets, "ransomware smb", 1)
+  assert.Equal(t, 1, len(results))
+  assert.Equal(t, "file server", results[0].Asset.Name)
+  assert.Equal(t, float64(2), results[0].Score)
+}
+
+func TestSearchAssetsUtils(t *testing.T) {
+  runAssetUtils(t, testSearchAssets)
+}
+
+func testSearchAssets(t *testing.T, asset_utils IAssetUtils) {
+  ctx := context.TODO()
+  if utils, ok := asset_utils.(*AssetUtils); ok {
+    coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+    assert.Nil(t, EnsureSearchIndex(ctx, coll))
+  }
+  search_utils := asset_utils.(ISearchUtils)
+
+  s1, s2, s3 := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+  for _, asset := range searchAssets(s1, s2, s3) {
+    assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+  }
+
+  /* Only the assets of the given scopes are found */
+  scopes := []primitive.ObjectID{s1, s2}
+  for _, tc := range search_cases {
+    results, err := search_utils.SearchAssets(ctx, scopes, tc.text, 0)
+    assert.Nil(t, err)
+    assert.Equal(t, tc.matches, searchMatches(t, results), tc.text)
+  }
+
+  results, err := search_utils.SearchAssets(ctx, []primitive.ObjectID{s2}, "ransomware", 10)
+  assert.Nil(t, err)
+  assert.Equal(t, 1, len(results))
+  assert.Equal(t, s2, results[0].Asset.Scope)
+  assert.Equal(t, []MatchedRisk{{Index: 1, Risk: results[0].Asset.Risks[1]}}, results[0].Risks)
+  assert.Less(t, float64(0), results[0].Score)
+
+  results, err = search_utils.SearchAssets(ctx, scopes, "vpn", 2)
+  assert.Nil(t, err)
+  assert.Equal(t, 2, len(results))
+
+  results, err = search_utils.SearchAssets(ctx, []primitive.ObjectID{}, "ransomware", 10)
+  assert.Nil(t, err)
+  assert.Equal(t, []SearchResult{}, results)
+}
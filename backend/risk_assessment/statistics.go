@@ -0,0 +1,359 @@
+package risk_assessment
+
+import (
+  "bytes"
+  "context"
+  "sort"
+
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/* The asset value of a BigCategory, which is the sum of C, I and A */
+type CategoryValue struct {
+  BigCategory string
+  Assets int
+  Average float64
+  Max uint
+}
+
+type AssetRef struct {
+  ID primitive.ObjectID `bson:"_id"`
+  Scope primitive.ObjectID
+  Name string
+}
+
+/* A risk with its asset, where Index is the risk's position in the asset from 0 */
+type TopRisk struct {
+  Scope primitive.ObjectID
+  Asset primitive.ObjectID
+  AssetName string
+  Index int
+  Risk Risk
+  Score uint
+  Level string
+}
+
+/*
+ * The dashboard of the scopes.  The risks are counted by the level of their
+ * own scope, and the heat map counts only the ones with valid ratings.
+ */
+type Statistics struct {
+  Scopes int
+  Assets int
+  Risks int
+  HeatMap HeatMap
+  Levels map[string]int
+  Categories []CategoryValue
+  Unassessed []AssetRef
+  TopRisks []TopRisk
+}
+
+type IStatisticsUtils interface {
+  GetStatistics(ctx context.Context, scopes []Scope, top int) (Statistics, error)
+}
+
+func newStatistics(scopes []Scope) Statistics {
+  statistics := Statistics{
+    Scopes: len(scopes),
+    Levels: map[string]int{},
+    Categories: []CategoryValue{},
+    Unassessed: []AssetRef{},
+    TopRisks: []TopRisk{},
+  }
+  for _, name := range RISK_LEVEL_NAMES {
+    statistics.Levels[name] = 0
+  }
+  return statistics
+}
+
+/* The highest scores first, then in the order of the assets and their risks */
+func lessRisk(a *TopRisk, b *TopRisk) bool {
+  if a.Score != b.Score {
+    return a.Score > b.Score
+  }
+  if a.Asset != b.Asset {
+    return bytes.Compare(a.Asset[:], b.Asset[:]) < 0
+  }
+  return a.Index < b.Index
+}
+
+/* Count the statistics of the scopes' assets, which are loaded at all */
+func NewStatistics(scopes []Scope, assets []Asset, top int) Statistics {
+  statistics := newStatistics(scopes)
+  levels := map[primitive.ObjectID]RiskLevels{}
+  for i := range scopes {
+    levels[scopes[i].ID] = scopes[i].RiskLevels()
+  }
+
+  categories := map[string]*CategoryValue{}
+  sums := map[string]uint{}
+  risks := []TopRisk{}
+  for i := range assets {
+    asset := &assets[i]
+    scope_levels, ok := levels[asset.Scope]
+    if !ok {
+      continue
+    }
+    statistics.Assets++
+
+    value := asset.Value.Sum()
+    category, ok := categories[asset.BigCategory]
+    if !ok {
+      category = &CategoryValue{BigCategory: asset.BigCategory}
+      categories[asset.BigCategory] = category
+    }
+    category.Assets++
+    sums[asset.BigCategory] += value
+    if value > category.Max {
+      category.Max = value
+    }
+
+    if len(asset.Risks) == 0 {
+      statistics.Unassessed = append(statistics.Unassessed, AssetRef{ID: asset.ID, Scope: asset.Scope, Name: asset.Name})
+    }
+    for j, risk := range asset.Risks {
+      score := RiskScore(asset.Value, risk)
+      level := scope_levels.Level(score)
+      statistics.Risks++
+      statistics.Levels[level]++
+      statistics.HeatMap.Add(risk.Possibility, risk.Impact, level)
+      risks = append(risks, TopRisk{
+        Scope: asset.Scope, Asset: asset.ID, AssetName: asset.Name, Index: j,
+        Risk: risk, Score: score, Level: level,
+      })
+    }
+  }
+
+  for name, category := range categories {
+    category.Average = float64(sums[name]) / float64(category.Assets)
+    statistics.Categories = append(statistics.Categories, *category)
+  }
+  sort.Slice(statistics.Categories, func(i, j int) bool {
+    return statistics.Categories[i].BigCategory < statistics.Categories[j].BigCategory
+  })
+  sort.Slice(statistics.Unassessed, func(i, j int) bool {
+    return bytes.Compare(statistics.Unassessed[i].ID[:], statistics.Unassessed[j].ID[:]) < 0
+  })
+
+  sort.Slice(risks, func(i, j int) bool {
+    return lessRisk(&risks[i], &risks[j])
+  })
+  if len(risks) > top {
+    risks = risks[:max(top, 0)]
+  }
+  statistics.TopRisks = append(statistics.TopRisks, risks...)
+  return statistics
+}
+
+/* The risk level threshold of the asset's scope, where the levels are ranked by RISK_LEVEL_NAMES */
+func levelThreshold(scopes []Scope, threshold func(levels RiskLevels) uint) bson.M {
+  branches := bson.A{}
+  for i := range scopes {
+    branches = append(branches, bson.M{
+      "case": bson.M{"$eq": bson.A{"$scope", scopes[i].ID}},
+      "then": threshold(scopes[i].RiskLevels()),
+    })
+  }
+  return bson.M{"$switch": bson.M{"branches": branches, "default": threshold(DEFAULT_RISK_LEVELS)}}
+}
+
+/* The stages unwinding the risks with their scores and level ranks */
+func riskStages(scopes []Scope) bson.A {
+  value := bson.M{"$add": bson.A{"$value.confidentiality", "$value.integrity", "$value.availability"}}
+  medium := levelThreshold(scopes, func(levels RiskLevels) uint { return levels.Medium })
+  high := levelThreshold(scopes, func(levels RiskLevels) uint { return levels.High })
+
+  return bson.A{
+    bson.M{"$unwind": bson.M{"path": "$risks", "includeArrayIndex": "index"}},
+    bson.M{"$set": bson.M{"score": bson.M{"$multiply": bson.A{value, "$risks.possibility", "$risks.impact"}}}},
+    bson.M{"$set": bson.M{"rank": bson.M{"$cond": bson.A{
+      bson.M{"$gte": bson.A{"$score", high}}, 2,
+      bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$score", medium}}, 1, 0}},
+    }}}},
+  }
+}
+
+func concat(stages ...bson.A) bson.A {
+  all := bson.A{}
+  for _, s := range stages {
+    all = append(all, s...)
+  }
+  return all
+}
+
+type aggregatedCell struct {
+  ID struct {
+    Possibility uint
+    Impact uint
+  } `bson:"_id"`
+  Count int
+  Rank int
+}
+
+type aggregatedLevel struct {
+  Rank int `bson:"_id"`
+  Count int
+}
+
+type aggregatedCategory struct {
+  BigCategory string `bson:"_id"`
+  Assets int
+  Average float64
+  Max uint
+}
+
+type aggregatedRisk struct {
+  ID primitive.ObjectID `bson:"_id"`
+  Scope primitive.ObjectID
+  Name string
+  Index int
+  Risks Risk
+  Score uint
+  Rank int
+}
+
+type aggregatedStatistics struct {
+  Assets []struct{ Count int }
+  Cells []aggregatedCell
+  Levels []aggregatedLevel
+  Categories []aggregatedCategory
+  Unassessed []AssetRef
+  Top []aggregatedRisk
+}
+
+/*
+ * Aggregate the statistics of the scopes in MongoDB, without loading the
+ * assets.  Each facet unwinds the risks itself, because a facet cannot have
+ * another one.
+ */
+func (utils *AssetUtils) GetStatistics(ctx context.Context, scopes []Scope, top int) (Statistics, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  statistics := newStatistics(scopes)
+  if len(scopes) == 0 {
+    return statistics, nil
+  }
+  ids := []primitive.ObjectID{}
+  for i := range scopes {
+    ids = append(ids, scopes[i].ID)
+  }
+  value := bson.M{"$add": bson.A{"$value.confidentiality", "$value.integrity", "$value.availability"}}
+  valid := func(field string) bson.M {
+    return bson.M{"$and": bson.A{
+      bson.M{"$gte": bson.A{field, 1}},
+      bson.M{"$lte": bson.A{field, MAX_RATING}},
+    }}
+  }
+
+  pipeline := bson.A{
+    bson.M{"$match": bson.M{"scope": bson.M{"$in": ids}}},
+    bson.M{"$facet": bson.M{
+      "assets": bson.A{bson.M{"$count": "count"}},
+      "cells": concat(riskStages(scopes), bson.A{
+        bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{valid("$risks.possibility"), valid("$risks.impact")}}}},
+        bson.M{"$group": bson.M{
+          "_id": bson.M{"possibility": "$risks.possibility", "impact": "$risks.impact"},
+          "count": bson.M{"$sum": 1},
+          "rank": bson.M{"$max": "$rank"},
+        }},
+      }),
+      "levels": concat(riskStages(scopes), bson.A{
+        bson.M{"$group": bson.M{"_id": "$rank", "count": bson.M{"$sum": 1}}},
+      }),
+      "categories": bson.A{
+        bson.M{"$group": bson.M{
+          "_id": "$bigcategory",
+          "assets": bson.M{"$sum": 1},
+          "average": bson.M{"$avg": value},
+          "max": bson.M{"$max": value},
+        }},
+        bson.M{"$sort": bson.M{"_id": 1}},
+      },
+      "unassessed": bson.A{
+        bson.M{"$match": bson.M{"risks.0": bson.M{"$exists": false}}},
+        bson.M{"$sort": bson.M{"_id": 1}},
+        bson.M{"$project": bson.M{"_id": 1, "scope": 1, "name": 1}},
+      },
+      "top": concat(riskStages(scopes), bson.A{
+        bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}, {Key: "index", Value: 1}}},
+        /* $limit must be positive */
+        bson.M{"$limit": max(top, 1)},
+        bson.M{"$project": bson.M{"_id": 1, "scope": 1, "name": 1, "index": 1, "risks": 1, "score": 1, "rank": 1}},
+      }),
+    }},
+  }
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(ASSET_COLLECTION)
+  cur, err := coll.Aggregate(ctx, pipeline)
+  if err != nil {
+    return statistics, err
+  }
+  var results []aggregatedStatistics
+  if err := cur.All(ctx, &results); err != nil || len(results) == 0 {
+    return statistics, err
+  }
+  result := results[0]
+
+  if len(result.Assets) > 0 {
+    statistics.Assets = result.Assets[0].Count
+  }
+  for _, cell := range result.Cells {
+    p, i := cell.ID.Possibility - 1, cell.ID.Impact - 1
+    statistics.HeatMap.Counts[p][i] = cell.Count
+    statistics.HeatMap.Levels[p][i] = RISK_LEVEL_NAMES[cell.Rank]
+  }
+  for _, level := range result.Levels {
+    statistics.Levels[RISK_LEVEL_NAMES[level.Rank]] = level.Count
+    statistics.Risks += level.Count
+  }
+  for _, category := range result.Categories {
+    statistics.Categories = append(statistics.Categories, CategoryValue(category))
+  }
+  statistics.Unassessed = append(statistics.Unassessed, result.Unassessed...)
+  for _, risk := range result.Top[:max(min(top, len(result.Top)), 0)] {
+    statistics.TopRisks = append(statistics.TopRisks, TopRisk{
+      Scope: risk.Scope, Asset: risk.ID, AssetName: risk.Name, Index: risk.Index,
+      Risk: risk.Risks, Score: risk.Score, Level: RISK_LEVEL_NAMES[risk.Rank],
+    })
+  }
+  return statistics, nil
+}
+
+/* The embedded database has no aggregation, so the scopes' assets are counted in place */
+func (utils *BoltAssetUtils) GetStatistics(ctx context.Context, scopes []Scope, top int) (Statistics, error) {
+  wanted := map[primitive.ObjectID]bool{}
+  for i := range scopes {
+    wanted[scopes[i].ID] = true
+  }
+
+  var assets []Asset
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    var err error
+    assets, err = database.BoltFind(tx, ASSET_COLLECTION, func(asset *Asset) bool {
+      return wanted[asset.Scope]
+    })
+    return err
+  })
+  if err != nil {
+    return newStatistics(scopes), err
+  }
+  return NewStatistics(scopes, assets, top), nil
+}
+
+/* The scopes' assets are loaded with their risks, like the risk register */
+func (utils *PGAssetUtils) GetStatistics(ctx context.Context, scopes []Scope, top int) (Statistics, error) {
+  assets := []Asset{}
+  for i := range scopes {
+    scope_assets, err := utils.GetAssetsByScopeID(ctx, scopes[i].ID)
+    if err != nil {
+      return newStatistics(scopes), err
+    }
+    assets = append(assets, scope_assets...)
+  }
+  return NewStatistics(scopes, assets, top), nil
+}
@@ -0,0 +1,119 @@
+package risk_assessment
+
+import (
+  "context"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func statisticsAssets(s1 primitive.ObjectID, s2 primitive.ObjectID) []Asset {
+  return []Asset{
+    {
+      Scope: s1, BigCategory: "Hardware", Name: "web",
+      Value: Value{Confidentiality: 3, Integrity: 3, Availability: 2},
+      Risks: []Risk{
+        {Threat: "Power failure", Possibility: 2, Impact: 3},
+        {Threat: "Disk failure", Possibility: 1, Impact: 2},
+      },
+    },
+    {
+      Scope: s1, BigCategory: "Hardware", Name: "db",
+      Value: Value{Confidentiality: 4, Integrity: 4, Availability: 4},
+      Risks: []Risk{{Threat: "Power failure", Possibility: 2, Impact: 3}},
+    },
+    {
+      Scope: s1, BigCategory: "Data", Name: "docs",
+      Value: Value{Confidentiality: 1, Integrity: 1, Availability: 1},
+      Risks: []Risk{},
+    },
+    {
+      Scope: s2, BigCategory: "Software", Name: "gcc",
+      Value: Value{Confidentiality: 1, Integrity: 2, Availability: 1},
+      Risks: []Risk{{Threat: "Bug", Possibility: 2, Impact: 3}, {Threat: "Typo", Possibility: 5, Impact: 1}},
+    },
+  }
+}
+
+func TestNewStatistics(t *testing.T) {
+  scopes := []Scope{
+    {ID: primitive.NewObjectID()},
+    /* 24 is high in the second scope */
+    {ID: primitive.NewObjectID(), Levels: RiskLevels{Medium: 10, High: 20}},
+  }
+  assets := statisticsAssets(scopes[0].ID, scopes[1].ID)
+  for i := range assets {
+    assets[i].ID = primitive.NewObjectID()
+  }
+  /* The asset of another scope is not counted */
+  assets = append(assets, Asset{ID: primitive.NewObjectID(), Scope: primitive.NewObjectID(), Name: "foo"})
+
+  statistics := NewStatistics(scopes, assets, 3)
+  assert.Equal(t, 2, statistics.Scopes)
+  assert.Equal(t, 4, statistics.Assets)
+  assert.Equal(t, 5, statistics.Risks)
+  /* 72, 48, 24 and 20 of the second scope, and 16 */
+  assert.Equal(t, map[string]int{"low": 1, "medium": 0, "high": 4}, statistics.Levels)
+
+  /* The invalid possibility 5 is not in the heat map */
+  assert.Equal(t, 3, statistics.HeatMap.Counts[1][2])
+  assert.Equal(t, HighRisk, statistics.HeatMap.Levels[1][2])
+  assert.Equal(t, 1, statistics.HeatMap.Counts[0][1])
+  assert.Equal(t, LowRisk, statistics.HeatMap.Levels[0][1])
+
+  assert.Equal(t, []CategoryValue{
+    {BigCategory: "Data", Assets: 1, Average: 3, Max: 3},
+    {BigCategory: "Hardware", Assets: 2, Average: 10, Max: 12},
+    {BigCategory: "Software", Assets: 1, Average: 4, Max: 4},
+  }, statistics.Categories)
+  assert.Equal(t, []AssetRef{{ID: assets[2].ID, Scope: scopes[0].ID, Name: "docs"}}, statistics.Unassessed)
+
+  assert.Equal(t, 3, len(statistics.TopRisks))
+  assert.Equal(t, TopRisk{
+    Scope: scopes[0].ID, Asset: assets[1].ID, AssetName: "db", Index: 0,
+    Risk: assets[1].Risks[0], Score: 72, Level: HighRisk,
+  }, statistics.TopRisks[0])
+  assert.Equal(t, uint(48), statistics.TopRisks[1].Score)
+  assert.Equal(t, uint(24), statistics.TopRisks[2].Score)
+  assert.Equal(t, HighRisk, statistics.TopRisks[2].Level)
+
+  statistics = NewStatistics([]Scope{}, assets, 3)
+  assert.Equal(t, 0, statistics.Assets)
+  assert.Equal(t, []TopRisk{}, statistics.TopRisks)
+}
+
+func TestGetStatistics(t *testing.T) {
+  runAssetUtils(t, testGetStatistics)
+}
+
+func testGetStatistics(t *testing.T, asset_utils IAssetUtils) {
+  ctx := context.TODO()
+  scopes := []Scope{
+    {ID: primitive.NewObjectID()},
+    {ID: primitive.NewObjectID(), Levels: RiskLevels{Medium: 10, High: 20}},
+  }
+  for _, asset := range statisticsAssets(scopes[0].ID, scopes[1].ID) {
+    assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+  }
+
+  stored := []Asset{}
+  for _, scope := range scopes {
+    assets, err := asset_utils.GetAssetsByScopeID(ctx, scope.ID)
+    assert.Nil(t, err)
+    stored = append(stored, assets...)
+  }
+
+  /* Every backend has the same statistics as the loaded assets */
+  statistics, err := asset_utils.(IStatisticsUtils).GetStatistics(ctx, scopes, 3)
+  assert.Nil(t, err)
+  assert.Equal(t, NewStatistics(scopes, stored, 3), statistics)
+
+  statistics, err = asset_utils.(IStatisticsUtils).GetStatistics(ctx, scopes[1:], 10)
+  assert.Nil(t, err)
+  assert.Equal(t, NewStatistics(scopes[1:], stored, 10), statistics)
+
+  statistics, err = asset_utils.(IStatisticsUtils).GetStatistics(ctx, []Scope{}, 10)
+  assert.Nil(t, err)
+  assert.Equal(t, 0, statistics.Assets)
+}
@@ -0,0 +1,356 @@
+package risk_assessment
+
+import (
+  "context"
+  "sort"
+  "time"
+
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgxpool"
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+
+  "github.com/starnight/riskassessment/backend/database"
+)
+
+/*
+ * A point of the risk trend of a scope, which is the scope at the end of the
+ * Date, the UTC midnight of the day.  A scope has a point a day at most, and
+ * recording the point again replaces it.  The risks are counted by the
+ * scope's levels of the day.
+ */
+type TrendPoint struct {
+  ID primitive.ObjectID `bson:"_id"`
+  Scope primitive.ObjectID
+  Date time.Time
+  Assets int
+  Risks int
+  TotalScore uint
+  Levels map[string]int
+  UpdateTime time.Time
+}
+
+type ITrendUtils interface {
+  RecordTrendPoint(ctx context.Context, point *TrendPoint) (error)
+  /* The points of the scope from the day of from to the day of to, by the date */
+  GetTrend(ctx context.Context, scope_id primitive.ObjectID, from time.Time, to time.Time) ([]TrendPoint, error)
+  /* All the points of all the scopes, like dumping a backup */
+  GetTrends(ctx context.Context) ([]TrendPoint, error)
+  /* Insert the point with its own ID, replacing the point of the same ID or the same scope and day */
+  PutTrendPoint(ctx context.Context, point *TrendPoint) (error)
+}
+
+var TREND_COLLECTION string = "trends"
+
+/* The UTC midnight of the day of the time */
+func TrendDay(t time.Time) time.Time {
+  year, month, day := t.UTC().Date()
+  return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+/* BSON decodes the dates in the local time, but the days are in UTC */
+func utcTrend(points []TrendPoint) {
+  for i := range points {
+    points[i].Date = points[i].Date.UTC()
+    points[i].UpdateTime = points[i].UpdateTime.UTC()
+  }
+}
+
+/* Aggregate the scope's assets into the point of the day of the date */
+func NewTrendPoint(scope *Scope, assets []Asset, date time.Time) TrendPoint {
+  point := TrendPoint{
+    Scope: scope.ID,
+    Date: TrendDay(date),
+    Levels: map[string]int{LowRisk: 0, MediumRisk: 0, HighRisk: 0},
+  }
+
+  levels := scope.RiskLevels()
+  for i := range assets {
+    if assets[i].Scope != scope.ID {
+      continue
+    }
+    point.Assets++
+    for _, risk := range assets[i].Risks {
+      score := RiskScore(assets[i].Value, risk)
+      point.Risks++
+      point.TotalScore += score
+      point.Levels[levels.Level(score)]++
+    }
+  }
+  return point
+}
+
+/* Record today's point of every scope */
+func RecordTrends(ctx context.Context, scope_utils IScopeUtils, asset_utils IAssetUtils, trend_utils ITrendUtils, now time.Time) (error) {
+  scopes, err := scope_utils.GetScopes(ctx)
+  if err != nil {
+    return err
+  }
+
+  for i := range scopes {
+    assets, err := asset_utils.GetAssetsByScopeID(ctx, scopes[i].ID)
+    if err != nil {
+      return err
+    }
+
+    point := NewTrendPoint(&scopes[i], assets, now)
+    if err := trend_utils.RecordTrendPoint(ctx, &point); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+type TrendUtils struct {
+  DB_Client *mongo.Client
+}
+
+/* The unique index of the points, which makes the upserts of the webservers safe */
+func EnsureTrendIndex(ctx context.Context, coll *mongo.Collection) (error) {
+  index := mongo.IndexModel{
+    Keys: bson.D{{Key: "scope", Value: 1}, {Key: "date", Value: 1}},
+    Options: options.Index().SetUnique(true),
+  }
+  _, err := coll.Indexes().CreateOne(ctx, index)
+  return err
+}
+
+func (utils *TrendUtils) RecordTrendPoint(ctx context.Context, point *TrendPoint) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  point.Date = TrendDay(point.Date)
+  point.UpdateTime = time.Now().UTC()
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(TREND_COLLECTION)
+  filter := bson.M{"scope": point.Scope, "date": point.Date}
+  update := bson.M{
+    "$set": bson.M{
+      "assets": point.Assets,
+      "risks": point.Risks,
+      "totalscore": point.TotalScore,
+      "levels": point.Levels,
+      "updatetime": point.UpdateTime,
+    },
+    "$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+  }
+  opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After).SetProjection(bson.M{"_id": 1})
+  var stored TrendPoint
+  err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored)
+  point.ID = stored.ID
+  return err
+}
+
+func (utils *TrendUtils) GetTrend(ctx context.Context, scope_id primitive.ObjectID, from time.Time, to time.Time) ([]TrendPoint, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  points := []TrendPoint{}
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(TREND_COLLECTION)
+  filter := bson.M{"scope": scope_id, "date": bson.M{"$gte": TrendDay(from), "$lte": TrendDay(to)}}
+  cur, err := coll.Find(ctx, filter, options.Find().SetSort(bson.M{"date": 1}))
+  if err != nil {
+    return points, err
+  }
+
+  err = cur.All(ctx, &points)
+  utcTrend(points)
+  return points, err
+}
+
+func (utils *TrendUtils) GetTrends(ctx context.Context) ([]TrendPoint, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  points := []TrendPoint{}
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(TREND_COLLECTION)
+  cur, err := coll.Find(ctx, bson.D{{}})
+  if err != nil {
+    return points, err
+  }
+
+  err = cur.All(ctx, &points)
+  utcTrend(points)
+  return points, err
+}
+
+func (utils *TrendUtils) PutTrendPoint(ctx context.Context, point *TrendPoint) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  point.Date = TrendDay(point.Date)
+
+  coll := utils.DB_Client.Database(ASSET_MONGO_DB).Collection(TREND_COLLECTION)
+  filter := bson.M{"$or": bson.A{bson.M{"_id": point.ID}, bson.M{"scope": point.Scope, "date": point.Date}}}
+  if _, err := coll.DeleteMany(ctx, filter); err != nil {
+    return err
+  }
+  _, err := coll.InsertOne(ctx, point)
+  return err
+}
+
+/* BoltTrendUtils keeps the trends in the embedded database */
+type BoltTrendUtils struct {
+  DB *bbolt.DB
+}
+
+func (utils *BoltTrendUtils) RecordTrendPoint(ctx context.Context, point *TrendPoint) (error) {
+  point.Date = TrendDay(point.Date)
+  point.UpdateTime = time.Now().UTC().Truncate(time.Millisecond)
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    stored, err := database.BoltFindOne(tx, TREND_COLLECTION, func(stored *TrendPoint) bool {
+      return stored.Scope == point.Scope && stored.Date.Equal(point.Date)
+    })
+    if err == database.ErrNotFound {
+      stored.ID = primitive.NewObjectID()
+    } else if err != nil {
+      return err
+    }
+
+    point.ID = stored.ID
+    return database.BoltPut(tx, TREND_COLLECTION, point.ID, point)
+  })
+}
+
+func (utils *BoltTrendUtils) GetTrend(ctx context.Context, scope_id primitive.ObjectID, from time.Time, to time.Time) ([]TrendPoint, error) {
+  points := []TrendPoint{}
+  from, to = TrendDay(from), TrendDay(to)
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    found, err := database.BoltFind(tx, TREND_COLLECTION, func(point *TrendPoint) bool {
+      return point.Scope == scope_id && !point.Date.Before(from) && !point.Date.After(to)
+    })
+    points = append(points, found...)
+    return err
+  })
+  /* The points are in the order of their IDs, which is not the date's if a day is recorded late */
+  sort.Slice(points, func(i, j int) bool {
+    return points[i].Date.Before(points[j].Date)
+  })
+  utcTrend(points)
+  return points, err
+}
+
+func (utils *BoltTrendUtils) GetTrends(ctx context.Context) ([]TrendPoint, error) {
+  points := []TrendPoint{}
+
+  err := database.BoltView(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    found, err := database.BoltFind(tx, TREND_COLLECTION, func(point *TrendPoint) bool {
+      return true
+    })
+    points = append(points, found...)
+    return err
+  })
+  utcTrend(points)
+  return points, err
+}
+
+func (utils *BoltTrendUtils) PutTrendPoint(ctx context.Context, point *TrendPoint) (error) {
+  point.Date = TrendDay(point.Date)
+
+  return database.BoltUpdate(ctx, utils.DB, func(tx *bbolt.Tx) error {
+    replaced, err := database.BoltFind(tx, TREND_COLLECTION, func(stored *TrendPoint) bool {
+      return stored.Scope == point.Scope && stored.Date.Equal(point.Date)
+    })
+    if err != nil {
+      return err
+    }
+    for i := range replaced {
+      if err := database.BoltDelete(tx, TREND_COLLECTION, replaced[i].ID); err != nil {
+        return err
+      }
+    }
+    return database.BoltPut(tx, TREND_COLLECTION, point.ID, point)
+  })
+}
+
+/* PGTrendUtils keeps the trends in PostgreSQL */
+type PGTrendUtils struct {
+  DB *pgxpool.Pool
+}
+
+const pg_trend_columns = "id, scope_id, day, assets, risks, total_score, level_low, level_medium, level_high, update_time"
+
+func (utils *PGTrendUtils) RecordTrendPoint(ctx context.Context, point *TrendPoint) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  point.Date = TrendDay(point.Date)
+  point.UpdateTime = time.Now().UTC()
+
+  /* The ID of the replaced point is kept */
+  var id string
+  err := utils.DB.QueryRow(ctx, "INSERT INTO trends (" + pg_trend_columns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) " +
+                           "ON CONFLICT (scope_id, day) DO UPDATE SET assets = $4, risks = $5, total_score = $6, " +
+                           "level_low = $7, level_medium = $8, level_high = $9, update_time = $10 RETURNING id",
+                           primitive.NewObjectID().Hex(), point.Scope.Hex(), point.Date, point.Assets, point.Risks,
+                           int64(point.TotalScore), point.Levels[LowRisk], point.Levels[MediumRisk], point.Levels[HighRisk],
+                           point.UpdateTime).Scan(&id)
+  if err != nil {
+    return err
+  }
+  point.ID, err = primitive.ObjectIDFromHex(id)
+  return err
+}
+
+func scanTrendPoint(row pgx.CollectableRow) (TrendPoint, error) {
+  var point TrendPoint
+  var total_score int64
+  var low, medium, high int
+
+  err := row.Scan(database.PGID(&point.ID), database.PGID(&point.Scope), database.PGTime(&point.Date),
+                  &point.Assets, &point.Risks, &total_score, &low, &medium, &high, database.PGTime(&point.UpdateTime))
+  point.TotalScore = uint(total_score)
+  point.Levels = map[string]int{LowRisk: low, MediumRisk: medium, HighRisk: high}
+  return point, err
+}
+
+func (utils *PGTrendUtils) GetTrend(ctx context.Context, scope_id primitive.ObjectID, from time.Time, to time.Time) ([]TrendPoint, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_trend_columns + " FROM trends WHERE scope_id = $1 AND day BETWEEN $2 AND $3 ORDER BY day",
+                            scope_id.Hex(), TrendDay(from), TrendDay(to))
+  points, err := pgx.CollectRows(rows, scanTrendPoint)
+  if points == nil {
+    points = []TrendPoint{}
+  }
+  return points, err
+}
+
+func (utils *PGTrendUtils) GetTrends(ctx context.Context) ([]TrendPoint, error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  rows, _ := utils.DB.Query(ctx, "SELECT " + pg_trend_columns + " FROM trends ORDER BY id")
+  points, err := pgx.CollectRows(rows, scanTrendPoint)
+  if points == nil {
+    points = []TrendPoint{}
+  }
+  return points, err
+}
+
+func (utils *PGTrendUtils) PutTrendPoint(ctx context.Context, point *TrendPoint) (error) {
+  ctx, cancel := database.WithTimeout(ctx)
+  defer cancel()
+
+  point.Date = TrendDay(point.Date)
+
+  return pgx.BeginFunc(ctx, utils.DB, func(tx pgx.Tx) error {
+    _, err := tx.Exec(ctx, "DELETE FROM trends WHERE id = $1 OR (scope_id = $2 AND day = $3)",
+                      point.ID.Hex(), point.Scope.Hex(), point.Date)
+    if err != nil {
+      return err
+    }
+    _, err = tx.Exec(ctx, "INSERT INTO trends (" + pg_trend_columns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+                     point.ID.Hex(), point.Scope.Hex(), point.Date, point.Assets, point.Risks, int64(point.TotalScore),
+                     point.Levels[LowRisk], point.Levels[MediumRisk], point.Levels[HighRisk], point.UpdateTime)
+    return err
+  })
+}
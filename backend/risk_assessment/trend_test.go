@@ -0,0 +1,229 @@
+package risk_assessment
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+  "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runTrendUtils(t *testing.T, test func(t *testing.T, trend_utils ITrendUtils)) {
+  t.Run("mongo", func(t *testing.T) {
+    skipMongo(t)
+    test(t, &TrendUtils{DB_Client: mongo_client})
+  })
+  t.Run("bolt", func(t *testing.T) { test(t, &BoltTrendUtils{DB: bolt_db}) })
+  t.Run("postgres", func(t *testing.T) {
+    skipPostgres(t)
+    test(t, &PGTrendUtils{DB: pg_db})
+  })
+}
+
+/* The points of PostgreSQL must have their scopes */
+func storeTrendScopes(t *testing.T, trend_utils ITrendUtils, scopes ...*Scope) {
+  if utils, ok := trend_utils.(*PGTrendUtils); ok {
+    scope_utils := &PGScopeUtils{DB: utils.DB}
+    for _, scope := range scopes {
+      assert.Nil(t, scope_utils.PutScope(context.TODO(), scope))
+    }
+  }
+}
+
+/* The scope utils of the same backend */
+func trendScopeUtils(trend_utils ITrendUtils) IScopeUtils {
+  switch utils := trend_utils.(type) {
+  case *TrendUtils:
+    return &ScopeUtils{DB_Client: utils.DB_Client}
+  case *BoltTrendUtils:
+    return &BoltScopeUtils{DB: utils.DB}
+  default:
+    return &PGScopeUtils{DB: trend_utils.(*PGTrendUtils).DB}
+  }
+}
+
+func TestTrendDay(t *testing.T) {
+  taipei := time.FixedZone("Asia/Taipei", 8 * 60 * 60)
+  assert.Equal(t, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC), TrendDay(time.Date(2026, 4, 1, 7, 59, 0, 0, taipei)))
+  assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), TrendDay(time.Date(2026, 4, 1, 8, 0, 0, 0, taipei)))
+}
+
+func TestNewTrendPoint(t *testing.T) {
+  scopes := []Scope{
+    {ID: primitive.NewObjectID()},
+    {ID: primitive.NewObjectID(), Levels: RiskLevels{Medium: 10, High: 20}},
+  }
+  assets := statisticsAssets(scopes[0].ID, scopes[1].ID)
+  date := time.Date(2026, 4, 1, 13, 0, 0, 0, time.UTC)
+
+  point := NewTrendPoint(&scopes[0], assets, date)
+  assert.Equal(t, TrendPoint{
+    Scope: scopes[0].ID,
+    Date: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+    Assets: 3,
+    Risks: 3,
+    TotalScore: 48 + 16 + 72,
+    Levels: map[string]int{"low": 1, "medium": 0, "high": 2},
+  }, point)
+
+  /* The scope's own levels */
+  point = NewTrendPoint(&scopes[1], assets, date)
+  assert.Equal(t, 1, point.Assets)
+  assert.Equal(t, uint(24 + 20), point.TotalScore)
+  assert.Equal(t, map[string]int{"low": 0, "medium": 0, "high": 2}, point.Levels)
+
+  point = NewTrendPoint(&Scope{ID: primitive.NewObjectID()}, assets, date)
+  assert.Equal(t, 0, point.Assets)
+  assert.Equal(t, map[string]int{"low": 0, "medium": 0, "high": 0}, point.Levels)
+}
+
+func TestGetTrend(t *testing.T) {
+  runTrendUtils(t, testGetTrend)
+}
+
+func testGetTrend(t *testing.T, trend_utils ITrendUtils) {
+  ctx := context.TODO()
+  scope := Scope{ID: primitive.NewObjectID()}
+  other := Scope{ID: primitive.NewObjectID()}
+  assets := statisticsAssets(scope.ID, other.ID)
+  day := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+  storeTrendScopes(t, trend_utils, &scope, &other)
+
+  /* The later days are recorded first */
+  for _, days := range []int{2, 0, 1} {
+    point := NewTrendPoint(&scope, assets[:days + 1], day.AddDate(0, 0, days).Add(time.Hour))
+    assert.Nil(t, trend_utils.RecordTrendPoint(ctx, &point))
+    assert.False(t, point.ID.IsZero())
+  }
+  point := NewTrendPoint(&other, assets, day)
+  assert.Nil(t, trend_utils.RecordTrendPoint(ctx, &point))
+
+  points, err := trend_utils.GetTrend(ctx, scope.ID, day, day.AddDate(0, 0, 2))
+  assert.Nil(t, err)
+  assert.Equal(t, 3, len(points))
+  for i := range points {
+    assert.Equal(t, scope.ID, points[i].Scope)
+    assert.Equal(t, day.AddDate(0, 0, i), points[i].Date)
+    assert.Equal(t, i + 1, points[i].Assets)
+  }
+  assert.Equal(t, map[string]int{"low": 1, "medium": 0, "high": 1}, points[0].Levels)
+
+  /* Recording a day again replaces its point, and the range follows the days of the times */
+  first_id := points[0].ID
+  point = NewTrendPoint(&scope, assets, day.Add(23 * time.Hour))
+  assert.Nil(t, trend_utils.RecordTrendPoint(ctx, &point))
+  assert.Equal(t, first_id, point.ID)
+
+  points, err = trend_utils.GetTrend(ctx, scope.ID, day.Add(12 * time.Hour), day.Add(12 * time.Hour))
+  assert.Nil(t, err)
+  assert.Equal(t, 1, len(points))
+  assert.Equal(t, first_id, points[0].ID)
+  assert.Equal(t, 3, points[0].Assets)
+  assert.Equal(t, uint(136), points[0].TotalScore)
+  assert.Equal(t, map[string]int{"low": 1, "medium": 0, "high": 2}, points[0].Levels)
+
+  points, err = trend_utils.GetTrend(ctx, scope.ID, day.AddDate(0, 0, 3), day.AddDate(0, 0, 30))
+  assert.Nil(t, err)
+  assert.Equal(t, []TrendPoint{}, points)
+}
+
+func TestPutTrendPoint(t *testing.T) {
+  runTrendUtils(t, testPutTrendPoint)
+}
+
+func testPutTrendPoint(t *testing.T, trend_utils ITrendUtils) {
+  ctx := context.TODO()
+  scope := Scope{ID: primitive.NewObjectID(), Name: "put trend"}
+  storeTrendScopes(t, trend_utils, &scope)
+  day := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+  recorded := NewTrendPoint(&scope, []Asset{}, day)
+  assert.Nil(t, trend_utils.RecordTrendPoint(ctx, &recorded))
+
+  /* The restored point replaces the recorded one of the day, and keeps its ID */
+  point := TrendPoint{
+    ID: primitive.NewObjectID(),
+    Scope: scope.ID,
+    Date: day.Add(time.Hour),
+    Assets: 2,
+    Risks: 3,
+    TotalScore: 40,
+    Levels: map[string]int{"low": 1, "medium": 1, "high": 1},
+    UpdateTime: day.Add(2 * time.Hour),
+  }
+  assert.Nil(t, trend_utils.PutTrendPoint(ctx, &point))
+  assert.Nil(t, trend_utils.PutTrendPoint(ctx, &point))
+
+  points, err := trend_utils.GetTrend(ctx, scope.ID, day, day)
+  assert.Nil(t, err)
+  point.Date = day
+  assert.Equal(t, []TrendPoint{point}, points)
+
+  all, err := trend_utils.GetTrends(ctx)
+  assert.Nil(t, err)
+  found := 0
+  for i := range all {
+    if all[i].Scope == scope.ID {
+      assert.Equal(t, point, all[i])
+      found++
+    }
+  }
+  assert.Equal(t, 1, found)
+}
+
+func TestRecordTrends(t *testing.T) {
+  ctx := context.TODO()
+  scope_utils := &BoltScopeUtils{DB: bolt_db}
+  asset_utils := &BoltAssetUtils{DB: bolt_db}
+  trend_utils := &BoltTrendUtils{DB: bolt_db}
+
+  scope := Scope{Name: "trend", Levels: RiskLevels{Medium: 10, High: 20}}
+  s_id, err := scope_utils.AddScope(ctx, &scope)
+  assert.Nil(t, err)
+  for _, asset := range statisticsAssets(primitive.NewObjectID(), s_id) {
+    assert.Nil(t, asset_utils.AddAsset(ctx, &asset))
+  }
+
+  now := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+  assert.Nil(t, RecordTrends(ctx, scope_utils, asset_utils, trend_utils, now))
+  assert.Nil(t, RecordTrends(ctx, scope_utils, asset_utils, trend_utils, now.Add(time.Hour)))
+
+  points, err := trend_utils.GetTrend(ctx, s_id, now, now)
+  assert.Nil(t, err)
+  assert.Equal(t, 1, len(points))
+  assert.Equal(t, 1, points[0].Assets)
+  assert.Equal(t, 2, points[0].Risks)
+  assert.Equal(t, uint(44), points[0].TotalScore)
+}
+
+func TestDeleteScopeTrend(t *testing.T) {
+  runTrendUtils(t, testDeleteScopeTrend)
+}
+
+func testDeleteScopeTrend(t *testing.T, trend_utils ITrendUtils) {
+  ctx := context.TODO()
+  scope_utils := trendScopeUtils(trend_utils)
+  scope := Scope{Name: "deleted"}
+  other := Scope{Name: "kept"}
+  _, err := scope_utils.AddScope(ctx, &scope)
+  assert.Nil(t, err)
+  _, err = scope_utils.AddScope(ctx, &other)
+  assert.Nil(t, err)
+
+  day := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+  for _, s := range []*Scope{&scope, &other} {
+    point := NewTrendPoint(s, []Asset{}, day)
+    assert.Nil(t, trend_utils.RecordTrendPoint(ctx, &point))
+  }
+
+  /* The trend is deleted with its scope, on every backend */
+  assert.Nil(t, scope_utils.DeleteScope(ctx, scope.ID))
+  points, err := trend_utils.GetTrend(ctx, scope.ID, day, day)
+  assert.Nil(t, err)
+  assert.Equal(t, 0, len(points))
+  points, err = trend_utils.GetTrend(ctx, other.ID, day, day)
+  assert.Nil(t, err)
+  assert.Equal(t, 1, len(points))
+  assert.Nil(t, scope_utils.DeleteScope(ctx, other.ID))
+}
@@ -0,0 +1,57 @@
+package risk_assessment
+
+import (
+  "fmt"
+  "strings"
+)
+
+/*
+ * The C, I and A values, the possibility and the impact are rated from 1 to
+ * MAX_RATING, which are the options of the frontend's config.json.
+ */
+const MAX_RATING = 4
+
+func validRating(rating uint) bool {
+  return rating >= 1 && rating <= MAX_RATING
+}
+
+/* Why the rating is invalid, or "" if it is valid */
+func ratingProblem(name string, rating uint) string {
+  if validRating(rating) {
+    return ""
+  }
+  return fmt.Sprintf("%s %d is not in 1-%d", name, rating, MAX_RATING)
+}
+
+/* Every problem of the asset and its risks, or none if it is valid */
+func (asset *Asset) Validate() []string {
+  problems := []string{}
+
+  if strings.TrimSpace(asset.Name) == "" {
+    problems = append(problems, "empty name")
+  }
+
+  ratings := []struct {
+    name string
+    rating uint
+  }{
+    {"confidentiality", asset.Value.Confidentiality},
+    {"integrity", asset.Value.Integrity},
+    {"availability", asset.Value.Availability},
+  }
+  for _, r := range ratings {
+    if problem := ratingProblem(r.name, r.rating); problem != "" {
+      problems = append(problems, problem)
+    }
+  }
+
+  for i, risk := range asset.Risks {
+    if problem := ratingProblem("possibility", risk.Possibility); problem != "" {
+      problems = append(problems, fmt.Sprintf("risk %d: %s", i + 1, problem))
+    }
+    if problem := ratingProblem("impact", risk.Impact); problem != "" {
+      problems = append(problems, fmt.Sprintf("risk %d: %s", i + 1, problem))
+    }
+  }
+  return problems
+}
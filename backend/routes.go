@@ -4,6 +4,11 @@ import (
   "github.com/gin-gonic/gin"
 )
 
+func HealthRoutes (g *gin.RouterGroup, ap IHealthApp) {
+  g.GET("/healthz", ap.Healthz)
+  g.GET("/readyz", ap.Readyz)
+}
+
 func PublicAuthRoutes (g *gin.RouterGroup, ap IAuthApp) {
   g.GET("/api/login", ap.GetLogin)
   g.POST("/api/login", ap.DoLogin)
@@ -26,9 +31,76 @@ func AssetsRoutes (g *gin.RouterGroup, ap IAssetsApp) {
   g.POST("/api/addasset", ap.AddAsset)
   g.POST("/api/updateasset", ap.UpdateAsset)
   g.POST("/api/deleteasset", ap.DeleteAsset)
+  g.POST("/api/importassets/:scopeID", ap.ImportAssets)
+}
+
+func SessionsRoutes (g *gin.RouterGroup, ap ISessionsApp) {
+  g.GET("/api/getsessions", ap.GetSessions)
+  g.POST("/api/revokesession", ap.RevokeSession)
+}
+
+func PrivilegeSessionsRoutes (g *gin.RouterGroup, ap ISessionsApp) {
+  g.POST("/api/revokeuser_sessions", ap.RevokeUserSessions)
 }
 
 func PrivilegeAuthRoutes (g *gin.RouterGroup, ap IAuthApp) {
   g.GET("/api/getuser_by_account", ap.GetUser_By_Account)
   g.POST("/api/updateuser_scopes", ap.UpdateUser_Scopes)
 }
+
+func BackupRoutes (g *gin.RouterGroup, ap IBackupApp) {
+  g.GET("/api/backup", ap.GetBackup)
+  g.POST("/api/restore", ap.Restore)
+}
+
+func BundleRoutes (g *gin.RouterGroup, ap IBundleApp) {
+  g.GET("/api/exportscope/:scopeID", ap.ExportScope)
+}
+
+func PrivilegeBundleRoutes (g *gin.RouterGroup, ap IBundleApp) {
+  g.POST("/api/importscope", ap.ImportScope)
+}
+
+func RegisterRoutes (g *gin.RouterGroup, ap IRegisterApp) {
+  g.GET("/api/register/:scopeID", ap.ExportRegister)
+  g.POST("/api/importregister/:scopeID", ap.ImportRegister)
+}
+
+func ReportRoutes (g *gin.RouterGroup, ap IReportApp) {
+  g.GET("/api/report/:scopeID", ap.GetReport)
+}
+
+func StatisticsRoutes (g *gin.RouterGroup, ap IStatisticsApp) {
+  g.GET("/api/statistics", ap.GetStatistics)
+  g.GET("/api/statistics/:scopeID", ap.GetScopeStatistics)
+}
+
+func TrendRoutes (g *gin.RouterGroup, ap ITrendApp) {
+  g.GET("/api/trend/:scopeID", ap.GetTrend)
+}
+
+func SearchRoutes (g *gin.RouterGroup, ap ISearchApp) {
+  g.GET("/api/search", ap.Search)
+}
+
+func TemplateRoutes (g *gin.RouterGroup, ap ITemplateApp) {
+  g.GET("/api/gettemplates", ap.GetTemplates)
+  g.GET("/api/templatereport/:scopeID", ap.RenderReport)
+}
+
+func PrivilegeTemplateRoutes (g *gin.RouterGroup, ap ITemplateApp) {
+  g.GET("/api/gettemplate/:templateID", ap.GetTemplate)
+  g.POST("/api/addtemplate", ap.AddTemplate)
+  g.POST("/api/updatetemplate/:templateID", ap.UpdateTemplate)
+  g.POST("/api/deletetemplate/:templateID", ap.DeleteTemplate)
+  g.POST("/api/previewtemplate", ap.PreviewTemplate)
+}
+
+func ChartRoutes (g *gin.RouterGroup, ap IChartApp) {
+  g.GET("/api/charts/:scopeID/:chart", ap.GetChart)
+  g.GET("/api/chartlink/:scopeID", ap.GetChartLink)
+}
+
+func PublicChartRoutes (g *gin.RouterGroup, ap IChartApp) {
+  g.GET("/api/sharedcharts/:scopeID/:chart", ap.GetSharedChart)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+  "context"
+  "errors"
+  "log/slog"
+  "net/http"
+  "time"
+
+  "github.com/starnight/riskassessment/backend/config"
+)
+
+/*
+ * Serve the handler over HTTPS if TLS is configured, or plain HTTP otherwise,
+ * until the context is done.  With TLS, an optional listener redirects the
+ * plain HTTP requests to HTTPS.  The other servers, like the metrics one, are
+ * run and shut down together.
+ */
+func Serve(ctx context.Context, cfg *config.Config, handler http.Handler, others ...*http.Server) error {
+  srv := &http.Server{
+    Addr: cfg.Listen,
+    Handler: handler,
+  }
+  servers := []*http.Server{srv}
+
+  if cfg.TLSEnabled() {
+    reloader, err := NewCertReloader(cfg.TLS.Cert_file, cfg.TLS.Key_file)
+    if err != nil {
+      return err
+    }
+    srv.TLSConfig = TLSConfig(reloader)
+
+    if cfg.TLS.Redirect_listen != "" {
+      servers = append(servers, &http.Server{
+        Addr: cfg.TLS.Redirect_listen,
+        Handler: RedirectHandler(cfg.Listen),
+      })
+    }
+  }
+  servers = append(servers, others...)
+
+  errs := make(chan error, len(servers))
+  for _, s := range servers {
+    go func(s *http.Server) {
+      var err error
+      if s.TLSConfig != nil {
+        err = s.ListenAndServeTLS("", "")
+      } else {
+        err = s.ListenAndServe()
+      }
+      errs <- err
+    }(s)
+  }
+
+  /* Stop all the servers, if any of them fails */
+  var err error
+  select {
+  case err = <-errs:
+  case <-ctx.Done():
+    slog.Info("shutting down", "timeout", cfg.ShutdownTimeout())
+  }
+
+  return errors.Join(err, Shutdown(servers, cfg.ShutdownTimeout()))
+}
+
+/*
+ * Stop accepting new connections, and wait for the in-flight requests at most
+ * the timeout.  Zero timeout closes the connections at once.
+ */
+func Shutdown(servers []*http.Server, timeout time.Duration) error {
+  if timeout <= 0 {
+    var errs []error
+    for _, s := range servers {
+      errs = append(errs, s.Close())
+    }
+    return errors.Join(errs...)
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), timeout)
+  defer cancel()
+
+  errs := make(chan error, len(servers))
+  for _, s := range servers {
+    go func(s *http.Server) {
+      errs <- s.Shutdown(ctx)
+    }(s)
+  }
+
+  var all []error
+  for range servers {
+    all = append(all, <-errs)
+  }
+  return errors.Join(all...)
+}
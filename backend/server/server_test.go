@@ -0,0 +1,121 @@
+package server
+
+import (
+  "context"
+  "io"
+  "net"
+  "net/http"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+
+  "github.com/starnight/riskassessment/backend/config"
+)
+
+func freeAddr(t *testing.T) string {
+  l, err := net.Listen("tcp", "127.0.0.1:0")
+  assert.Nil(t, err)
+  defer l.Close()
+  return l.Addr().String()
+}
+
+func waitListening(t *testing.T, addr string) {
+  for i := 0; i < 100; i++ {
+    conn, err := net.Dial("tcp", addr)
+    if err == nil {
+      conn.Close()
+      return
+    }
+    time.Sleep(10 * time.Millisecond)
+  }
+  t.Fatalf("%s is not listening", addr)
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+  cfg := config.Default()
+  cfg.Listen = freeAddr(t)
+  cfg.Shutdown_timeout = config.Duration(5 * time.Second)
+
+  started := make(chan struct{})
+  release := make(chan struct{})
+  handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+    close(started)
+    <-release
+    io.WriteString(w, "done")
+  })
+
+  ctx, cancel := context.WithCancel(context.Background())
+  served := make(chan error)
+  go func() {
+    served <- Serve(ctx, cfg, handler)
+  }()
+  waitListening(t, cfg.Listen)
+
+  /* An in-flight request */
+  body := make(chan string)
+  go func() {
+    res, err := http.Get("http://" + cfg.Listen + "/")
+    if err != nil {
+      body <- err.Error()
+      return
+    }
+    defer res.Body.Close()
+    b, _ := io.ReadAll(res.Body)
+    body <- string(b)
+  }()
+  <-started
+
+  /* Shutting down waits for the request */
+  cancel()
+  select {
+  case <-served:
+    t.Fatal("Serve returned before the request finished")
+  case <-time.After(100 * time.Millisecond):
+  }
+
+  close(release)
+  assert.Equal(t, "done", <-body)
+  assert.Nil(t, <-served)
+
+  /* No new connections are accepted */
+  _, err := net.Dial("tcp", cfg.Listen)
+  assert.NotNil(t, err)
+}
+
+func TestServeListenFailed(t *testing.T) {
+  l, err := net.Listen("tcp", "127.0.0.1:0")
+  assert.Nil(t, err)
+  defer l.Close()
+
+  cfg := config.Default()
+  cfg.Listen = l.Addr().String()
+  other := &http.Server{Addr: freeAddr(t), Handler: http.NotFoundHandler()}
+
+  /* The address is in use, so the other server is stopped, too */
+  err = Serve(context.Background(), cfg, http.NotFoundHandler(), other)
+  assert.NotNil(t, err)
+  assert.ErrorIs(t, other.ListenAndServe(), http.ErrServerClosed)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+  addr := freeAddr(t)
+  release := make(chan struct{})
+  defer close(release)
+  srv := &http.Server{
+    Addr: addr,
+    Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+      <-release
+    }),
+  }
+  go srv.ListenAndServe()
+  waitListening(t, addr)
+  go http.Get("http://" + addr + "/")
+  time.Sleep(50 * time.Millisecond)
+
+  /* The hanging request is given up after the timeout */
+  start := time.Now()
+  err := Shutdown([]*http.Server{srv}, 100 * time.Millisecond)
+  assert.ErrorIs(t, err, context.DeadlineExceeded)
+  assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+  "crypto/tls"
+  "log/slog"
+  "net"
+  "net/http"
+  "os"
+  "sync"
+  "time"
+)
+
+/* How often the certificate files are checked for changes */
+var CERT_CHECK_INTERVAL = 10 * time.Second
+
+/*
+ * CertReloader serves the certificate loaded from the files, and loads them
+ * again once either of them is modified, for example renewed by a cron job.
+ */
+type CertReloader struct {
+  cert_file string
+  key_file string
+
+  mu sync.Mutex
+  cert *tls.Certificate
+  cert_mod time.Time
+  key_mod time.Time
+  checked time.Time
+}
+
+func modTime(path string) (time.Time, error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return time.Time{}, err
+  }
+  return info.ModTime(), nil
+}
+
+func NewCertReloader(cert_file string, key_file string) (*CertReloader, error) {
+  r := &CertReloader{ cert_file: cert_file, key_file: key_file }
+  if err := r.load(); err != nil {
+    return nil, err
+  }
+  return r, nil
+}
+
+func (r *CertReloader) load() error {
+  cert_mod, err := modTime(r.cert_file)
+  if err != nil {
+    return err
+  }
+
+  key_mod, err := modTime(r.key_file)
+  if err != nil {
+    return err
+  }
+
+  cert, err := tls.LoadX509KeyPair(r.cert_file, r.key_file)
+  if err != nil {
+    return err
+  }
+
+  r.cert = &cert
+  r.cert_mod = cert_mod
+  r.key_mod = key_mod
+  return nil
+}
+
+func (r *CertReloader) changed() bool {
+  cert_mod, err1 := modTime(r.cert_file)
+  key_mod, err2 := modTime(r.key_file)
+  if err1 != nil || err2 != nil {
+    return false
+  }
+
+  return !cert_mod.Equal(r.cert_mod) || !key_mod.Equal(r.key_mod)
+}
+
+/* Keep serving the old certificate, if the new one cannot be loaded */
+func (r *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+
+  now := time.Now()
+  if now.Sub(r.checked) >= CERT_CHECK_INTERVAL {
+    r.checked = now
+    if r.changed() {
+      if err := r.load(); err != nil {
+        slog.Warn("keep the old TLS certificate", "error", err)
+      }
+    }
+  }
+
+  return r.cert, nil
+}
+
+func TLSConfig(reloader *CertReloader) *tls.Config {
+  return &tls.Config{
+    MinVersion: tls.VersionTLS12,
+    GetCertificate: reloader.GetCertificate,
+  }
+}
+
+/* Redirect to the same host and path on the HTTPS listen address */
+func RedirectHandler(https_listen string) http.Handler {
+  _, port, _ := net.SplitHostPort(https_listen)
+
+  return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+    host := req.Host
+    if h, _, err := net.SplitHostPort(host); err == nil {
+      host = h
+    }
+    if port != "" && port != "443" {
+      host = net.JoinHostPort(host, port)
+    }
+
+    target := "https://" + host + req.URL.RequestURI()
+    http.Redirect(w, req, target, http.StatusMovedPermanently)
+  })
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "crypto/rand"
+  "crypto/x509"
+  "crypto/x509/pkix"
+  "encoding/pem"
+  "math/big"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+/* Write a self-signed certificate for the common name and its key */
+func writeCert(t *testing.T, dir string, cn string, mod time.Time) (string, string) {
+  key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  tmpl := x509.Certificate{
+    SerialNumber: big.NewInt(1),
+    Subject: pkix.Name{CommonName: cn},
+    NotBefore: time.Now().Add(-time.Hour),
+    NotAfter: time.Now().Add(time.Hour),
+  }
+  der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+  assert.Nil(t, err)
+  key_der, _ := x509.MarshalECPrivateKey(key)
+
+  cert_file := filepath.Join(dir, "cert.pem")
+  key_file := filepath.Join(dir, "key.pem")
+  os.WriteFile(cert_file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+  os.WriteFile(key_file, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der}), 0600)
+  os.Chtimes(cert_file, mod, mod)
+  os.Chtimes(key_file, mod, mod)
+  return cert_file, key_file
+}
+
+func commonName(t *testing.T, r *CertReloader) string {
+  cert, err := r.GetCertificate(nil)
+  assert.Nil(t, err)
+  leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+  return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+  CERT_CHECK_INTERVAL = 0
+  dir := t.TempDir()
+  now := time.Now()
+
+  cert_file, key_file := writeCert(t, dir, "foo", now.Add(-time.Minute))
+  r, err := NewCertReloader(cert_file, key_file)
+  assert.Nil(t, err)
+  assert.Equal(t, "foo", commonName(t, r))
+
+  /* Renew the certificate */
+  writeCert(t, dir, "bar", now)
+  assert.Equal(t, "bar", commonName(t, r))
+
+  /* Keep the old one, if the new files are broken */
+  os.WriteFile(cert_file, []byte("broken"), 0600)
+  assert.Equal(t, "bar", commonName(t, r))
+}
+
+func TestNewCertReloaderFailed(t *testing.T) {
+  _, err := NewCertReloader("no-such-cert.pem", "no-such-key.pem")
+  assert.NotNil(t, err)
+}
+
+func TestRedirectHandler(t *testing.T) {
+  res1 := httptest.NewRecorder()
+  req1 := httptest.NewRequest("GET", "http://example.com/api/login?foo=bar", nil)
+  RedirectHandler(":443").ServeHTTP(res1, req1)
+  assert.Equal(t, http.StatusMovedPermanently, res1.Code)
+  assert.Equal(t, "https://example.com/api/login?foo=bar", res1.Header().Get("Location"))
+
+  res2 := httptest.NewRecorder()
+  req2 := httptest.NewRequest("GET", "http://example.com:8080/", nil)
+  RedirectHandler(":8443").ServeHTTP(res2, req2)
+  assert.Equal(t, "https://example.com:8443/", res2.Header().Get("Location"))
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+  "context"
+  "log/slog"
+  "time"
+
+  "github.com/gin-contrib/sessions"
+  "go.etcd.io/bbolt"
+  "go.mongodb.org/mongo-driver/bson"
+  "go.mongodb.org/mongo-driver/mongo"
+  "go.mongodb.org/mongo-driver/mongo/options"
+
+  "github.com/starnight/riskassessment/backend/auth"
+  "github.com/starnight/riskassessment/backend/backup"
+  "github.com/starnight/riskassessment/backend/config"
+  "github.com/starnight/riskassessment/backend/database"
+  "github.com/starnight/riskassessment/backend/metrics"
+  "github.com/starnight/riskassessment/backend/migrations"
+  "github.com/starnight/riskassessment/backend/report"
+  "github.com/starnight/riskassessment/backend/risk_assessment"
+)
+
+/* Storage is the backend chosen by the configuration, with its session store */
+type Storage struct {
+  User_utils auth.IUserUtils
+  Session_utils auth.ISessionUtils
+  Scope_utils risk_assessment.IScopeUtils
+  Asset_utils risk_assessment.IAssetUtils
+  Template_utils report.ITemplateUtils
+  Statistics_utils risk_assessment.IStatisticsUtils
+  Search_utils risk_assessment.ISearchUtils
+  Trend_utils risk_assessment.ITrendUtils
+  Session_store sessions.Store
+  Checks map[string]HealthCheck
+  /* Delete all the stored data, including the sessions, before a full restore */
+  Clear func(ctx context.Context) error
+  Close func()
+}
+
+/* The collections, or buckets, of the stored data */
+var STORED_COLLECTIONS = []string{
+  auth.USER_COLLECTION,
+  risk_assessment.SCOPE_COLLECTION,
+  risk_assessment.ASSET_COLLECTION,
+  report.TEMPLATE_COLLECTION,
+  risk_assessment.TREND_COLLECTION,
+  auth.SESSION_COLLECTION,
+  auth.SESSION_INFO_COLLECTION,
+}
+
+/* The storage to dump the backups from and restore them to */
+func (storage *Storage) backupStorage() *backup.Storage {
+  return &backup.Storage{
+    User_utils: storage.User_utils,
+    Scope_utils: storage.Scope_utils,
+    Asset_utils: storage.Asset_utils,
+    Template_utils: storage.Template_utils,
+    Trend_utils: storage.Trend_utils,
+    Clear: storage.Clear,
+  }
+}
+
+/* How often the expired sessions are removed from the bolt and PostgreSQL storages */
+const SESSION_PURGE_INTERVAL = time.Hour
+
+/* How often today's points of the risk trends are recorded again */
+const TREND_RECORD_INTERVAL = time.Hour
+
+/* All the utils share the database given by the configuration */
+func setDBName(name string) {
+  auth.USER_MONGO_DB = name
+  risk_assessment.SCOPE_MONGO_DB = name
+  risk_assessment.ASSET_MONGO_DB = name
+  report.TEMPLATE_MONGO_DB = name
+}
+
+func prepareDb(ctx context.Context, cfg *config.Config, m *metrics.Metrics) (*mongo.Client, error) {
+  setDBName(cfg.Mongo.DB_Name)
+  opts := options.Client()
+  if m != nil {
+    opts.SetMonitor(m.CommandMonitor())
+  }
+
+  if cfg.ConnectTimeout() > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout())
+    defer cancel()
+  }
+  uri := database.GetDBStr(cfg.Mongo.URI)
+  return database.Connect(ctx, uri, database.DEFAULT_BACKOFF, opts)
+}
+
+func prepareMongoStorage(ctx context.Context, cfg *config.Config, m *metrics.Metrics) (*Storage, error) {
+  db_client, err := prepareDb(ctx, cfg, m)
+  if err != nil {
+    return nil, err
+  }
+
+  if _, err := migrations.MigrateMongo(ctx, db_client, cfg.Mongo.DB_Name); err != nil {
+    db_client.Disconnect(context.Background())
+    return nil, err
+  }
+
+  session_utils := &auth.SessionUtils{ DB_Client: db_client }
+  asset_utils := &risk_assessment.AssetUtils{ DB_Client: db_client }
+  if err := session_utils.EnsureStoreTTL(ctx, cfg.AbsoluteTimeout()); err != nil {
+    db_client.Disconnect(context.Background())
+    return nil, err
+  }
+
+  return &Storage{
+    User_utils: &auth.UserUtils{ DB_Client: db_client },
+    Session_utils: session_utils,
+    Scope_utils: &risk_assessment.ScopeUtils{ DB_Client: db_client },
+    Asset_utils: asset_utils,
+    Statistics_utils: asset_utils,
+    Search_utils: asset_utils,
+    Template_utils: &report.TemplateUtils{ DB_Client: db_client },
+    Trend_utils: &risk_assessment.TrendUtils{ DB_Client: db_client },
+    Session_store: prepareSessionStore(db_client, cfg),
+    Checks: map[string]HealthCheck{
+      "mongo": func(ctx context.Context) error {
+        return database.Ping(ctx, db_client)
+      },
+      "sessions": session_utils.CheckStore,
+    },
+    Clear: func(ctx context.Context) error {
+      db := db_client.Database(cfg.Mongo.DB_Name)
+      for _, name := range STORED_COLLECTIONS {
+        if _, err := db.Collection(name).DeleteMany(ctx, bson.M{}); err != nil {
+          return err
+        }
+      }
+      return nil
+    },
+    Close: func() {
+      ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+      defer cancel()
+      if err := db_client.Disconnect(ctx); err != nil {
+        slog.Error("cannot disconnect MongoDB", "error", err)
+      }
+    },
+  }, nil
+}
+
+/* Remove the expired sessions periodically, until the context is done */
+func purgeSessions(ctx context.Context, store *auth.RecordStore) {
+  ticker := time.NewTicker(SESSION_PURGE_INTERVAL)
+  defer ticker.Stop()
+
+  for {
+    if _, err := store.PurgeExpired(ctx); err != nil && ctx.Err() == nil {
+      slog.Warn("cannot purge the expired sessions", "error", err)
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+/*
+ * Record the points of the risk trends periodically, until the context is
+ * done.  The point of a day is replaced until the day ends, so it keeps the
+ * scope at the end of the day.
+ */
+func recordTrends(ctx context.Context, storage *Storage) {
+  ticker := time.NewTicker(TREND_RECORD_INTERVAL)
+  defer ticker.Stop()
+
+  for {
+    err := risk_assessment.RecordTrends(ctx, storage.Scope_utils, storage.Asset_utils, storage.Trend_utils, time.Now())
+    if err != nil && ctx.Err() == nil {
+      slog.Warn("cannot record the risk trends", "error", err)
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+func prepareBoltStorage(ctx context.Context, cfg *config.Config) (*Storage, error) {
+  db, err := database.OpenBolt(cfg.Storage.Path)
+  if err != nil {
+    return nil, err
+  }
+
+  max_age := int(cfg.AbsoluteTimeout().Seconds())
+  store := auth.NewBoltStore(db, max_age, []byte(cfg.Secrets.Session))
+  store.Options(sessionOptions(cfg))
+  go purgeSessions(ctx, store)
+
+  session_utils := &auth.BoltSessionUtils{ DB: db }
+  asset_utils := &risk_assessment.BoltAssetUtils{ DB: db }
+  return &Storage{
+    User_utils: &auth.BoltUserUtils{ DB: db },
+    Session_utils: session_utils,
+    Scope_utils: &risk_assessment.BoltScopeUtils{ DB: db },
+    Asset_utils: asset_utils,
+    Statistics_utils: asset_utils,
+    Search_utils: asset_utils,
+    Template_utils: &report.BoltTemplateUtils{ DB: db },
+    Trend_utils: &risk_assessment.BoltTrendUtils{ DB: db },
+    Session_store: store,
+    Checks: map[string]HealthCheck{
+      "bolt": func(ctx context.Context) error {
+        return database.BoltView(ctx, db, func(tx *bbolt.Tx) error { return nil })
+      },
+      "sessions": session_utils.CheckStore,
+    },
+    Clear: func(ctx context.Context) error {
+      return database.BoltUpdate(ctx, db, func(tx *bbolt.Tx) error {
+        for _, name := range STORED_COLLECTIONS {
+          if err := database.BoltClear(tx, name); err != nil {
+            return err
+          }
+        }
+        return nil
+      })
+    },
+    Close: func() {
+      if err := db.Close(); err != nil {
+        slog.Error("cannot close the bolt storage", "error", err)
+      }
+    },
+  }, nil
+}
+
+func preparePostgresStorage(ctx context.Context, cfg *config.Config) (*Storage, error) {
+  connect_ctx := ctx
+  if cfg.ConnectTimeout() > 0 {
+    var cancel context.CancelFunc
+    connect_ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout())
+    defer cancel()
+  }
+
+  pool, err := database.ConnectPostgres(connect_ctx, cfg.Postgres.URI, database.DEFAULT_BACKOFF)
+  if err != nil {
+    return nil, err
+  }
+  if _, err := database.MigratePostgres(connect_ctx, pool); err != nil {
+    pool.Close()
+    return nil, err
+  }
+
+  max_age := int(cfg.AbsoluteTimeout().Seconds())
+  store := auth.NewPGStore(pool, max_age, []byte(cfg.Secrets.Session))
+  store.Options(sessionOptions(cfg))
+  go purgeSessions(ctx, store)
+
+  session_utils := &auth.PGSessionUtils{ DB: pool }
+  asset_utils := &risk_assessment.PGAssetUtils{ DB: pool }
+  return &Storage{
+    User_utils: &auth.PGUserUtils{ DB: pool },
+    Session_utils: session_utils,
+    Scope_utils: &risk_assessment.PGScopeUtils{ DB: pool },
+    Asset_utils: asset_utils,
+    Statistics_utils: asset_utils,
+    Search_utils: asset_utils,
+    Template_utils: &report.PGTemplateUtils{ DB: pool },
+    Trend_utils: &risk_assessment.PGTrendUtils{ DB: pool },
+    Session_store: store,
+    Checks: map[string]HealthCheck{
+      "postgres": func(ctx context.Context) error {
+        return database.PingPostgres(ctx, pool)
+      },
+      "sessions": session_utils.CheckStore,
+    },
+    Clear: func(ctx context.Context) error {
+      _, err := pool.Exec(ctx, "TRUNCATE users, user_scopes, scopes, assets, risks, templates, trends, sessions, session_infos")
+      return err
+    },
+    Close: pool.Close,
+  }, nil
+}
+
+func prepareStorage(ctx context.Context, cfg *config.Config, m *metrics.Metrics) (*Storage, error) {
+  database.OPERATION_TIMEOUT = cfg.OperationTimeout()
+
+  switch cfg.Storage.Backend {
+  case config.BoltStorage:
+    return prepareBoltStorage(ctx, cfg)
+  case config.PostgresStorage:
+    return preparePostgresStorage(ctx, cfg)
+  }
+  return prepareMongoStorage(ctx, cfg, m)
+}
+
+/*
+ * Migrate the storage to the latest schema version without serving, which
+ * is done at the startup, too.  The bolt storage has no schema.
+ */
+func migrateStorage(ctx context.Context, cfg *config.Config) (int, error) {
+  if cfg.ConnectTimeout() > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout())
+    defer cancel()
+  }
+
+  switch cfg.Storage.Backend {
+  case config.BoltStorage:
+    return 0, nil
+  case config.PostgresStorage:
+    pool, err := database.ConnectPostgres(ctx, cfg.Postgres.URI, database.DEFAULT_BACKOFF)
+    if err != nil {
+      return 0, err
+    }
+    defer pool.Close()
+    return database.MigratePostgres(ctx, pool)
+  }
+
+  uri := database.GetDBStr(cfg.Mongo.URI)
+  db_client, err := database.Connect(ctx, uri, database.DEFAULT_BACKOFF)
+  if err != nil {
+    return 0, err
+  }
+  defer db_client.Disconnect(context.Background())
+  return migrations.MigrateMongo(ctx, db_client, cfg.Mongo.DB_Name)
+}
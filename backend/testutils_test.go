@@ -6,10 +6,12 @@ import (
 
   "github.com/gin-gonic/gin"
   "github.com/gin-contrib/sessions"
+
+  "github.com/starnight/riskassessment/backend/config"
 )
 
 func _SetupMockSession(c *gin.Context) gin.HandlerFunc {
-  session_store := prepareSessionStore(nil)
+  session_store := prepareSessionStore(nil, config.Default())
   return sessions.Sessions("sessionid", session_store)
 }
 